@@ -0,0 +1,95 @@
+package main
+
+import (
+	"SSO/internal/config"
+	"SSO/internal/services/importer"
+	"SSO/internal/storage/postgresql"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/joho/godotenv"
+	"io/fs"
+	"log"
+	"log/slog"
+	"os"
+)
+
+// main imports users file. It takes the same configuration as the server,
+// config flags go after importer flags and "--":
+//
+//	importer -file users.csv -- -db.port 6432
+func main() {
+	var (
+		filePath       string
+		format         string
+		batchSize      int
+		checkpointPath string
+		reportPath     string
+	)
+
+	flag.StringVar(&filePath, "file", "", "path to users file")
+	flag.StringVar(&format, "format", importer.FormatCSV, "input format: csv or json (json lines)")
+	flag.IntVar(&batchSize, "batch", 500, "rows per transaction")
+	flag.StringVar(&checkpointPath, "checkpoint", "", "checkpoint file, import resumes after saved line (default <file>.checkpoint)")
+	flag.StringVar(&reportPath, "report", "", "rejected rows report file (default stdout)")
+	flag.Parse()
+
+	if filePath == "" {
+		log.Fatal("file is required")
+	}
+	if checkpointPath == "" {
+		checkpointPath = filePath + ".checkpoint"
+	}
+
+	// .env is optional, real environment and config file work without it
+	if err := godotenv.Load("../../.env"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+
+	cfg, err := config.Load(flag.Args(), os.LookupEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	storage, err := postgresql.New(context.Background(), cfg.DB.Migrations, cfg.DB.ConnString(), cfg.DB.Name)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer storage.Stop()
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		log.Fatalf("Failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	loger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	report, importErr := importer.New(storage, loger).Import(context.Background(), file, importer.Options{
+		Format:         format,
+		BatchSize:      batchSize,
+		CheckpointPath: checkpointPath,
+	})
+
+	out := os.Stdout
+	if reportPath != "" {
+		out, err = os.Create(reportPath)
+		if err != nil {
+			log.Fatalf("Failed to create report: %v", err)
+		}
+		defer out.Close()
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+
+	if importErr != nil {
+		log.Fatalf("Import stopped at line %d: %v", report.LastLine, importErr)
+	}
+}
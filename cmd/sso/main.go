@@ -2,114 +2,54 @@
 package main
 
 import (
-	grpcapp "SSO/internal/app/grpc"
-	"SSO/internal/domain/models"
-	"SSO/internal/services/auth"
-	"SSO/internal/storage/postgresql"
+	"SSO/internal/app"
+	"SSO/internal/config"
+	"SSO/internal/lib/tracing"
 	"context"
-	"fmt"
-	"github.com/google/uuid"
+	"errors"
 	"github.com/joho/godotenv"
+	"io/fs"
 	"log"
 	"log/slog"
 	"os"
-	"strconv"
-	"time"
-)
-
-const (
-	envLocal = "local"
-	envDev   = "dev"
-	envProd  = "prod"
 )
 
 func main() {
 
-	if err := godotenv.Load("../../.env"); err != nil {
+	// .env is optional, real environment and config file work without it
+	if err := godotenv.Load("../../.env"); err != nil && !errors.Is(err, fs.ErrNotExist) {
 		log.Fatalf("Error loading .env file: %v", err)
 	}
 
-	dbName := os.Getenv("DB_NAME")
-
-	dbConn := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		dbName,
-		os.Getenv("DB_SSLMODE"),
-	)
-
-	storage, err := postgresql.New(context.Background(), os.Getenv("DB_MIGRATIONS"), dbConn, dbName)
-	if err != nil {
-		log.Fatalf("Failed to initialize storage: %v", err)
-	}
-
-	defer storage.Stop()
-
-	AccessTTL, err := time.ParseDuration(os.Getenv("ACCESS_TOKEN_TTL"))
-	if err != nil {
-		log.Fatalf("Invalid ACCESS_TOKEN_TTL: %v", err)
-	}
-	RefreshTTL, err := time.ParseDuration(os.Getenv("REFRESH_TOKEN_TTL"))
-	if err != nil {
-		log.Fatalf("Invalid REFRESH_TOKEN_TTL: %v", err)
+	if len(os.Args) > 1 && os.Args[1] == verifyAuditCommand {
+		os.Exit(verifyAudit(os.Args[2:]))
 	}
 
-	authApp := models.NewApp(uuid.New(), os.Getenv("APP_NAME"), os.Getenv("APP_SECRET"))
+	cfg := config.MustLoad()
 
-	loger := setupLogger(os.Getenv("ENV"))
+	loger := setupLogger(cfg.Env)
 
-	limiters, err := models.NewLimitersByEnv(os.Getenv("REG_RATE"), os.Getenv("REG_BURST"), os.Getenv("LOGIN_RATE"), os.Getenv("LOGIN_BURST"))
+	application, err := app.New(cfg, loger)
 	if err != nil {
-		log.Fatalf("Failed to initialize limiters: %v", err)
+		log.Fatalf("Failed to initialize app: %v", err)
 	}
 
-	casherAddr := os.Getenv("CasherAddress")
-	casherPort := os.Getenv("6379")
-	casherPath := casherAddr + ":" + casherPort
-
-	casherPassword := os.Getenv("CasherPassword")
-	if casherPassword == "" {
-		log.Fatalf("empty casher password")
-	}
-
-	casherDB := os.Getenv("CasherDBId")
-	casherDBID, err := strconv.Atoi(casherDB)
-	if err != nil {
-		log.Fatalf("error cant use casher db id(%v)", casherDBID)
-	}
-
-	casher := models.NewRedisClient(casherPath, casherPassword, casherDBID, RefreshTTL)
-
-	Auth := auth.New(*authApp, casher, AccessTTL, RefreshTTL, storage, limiters.RegLimiter, limiters.LoginLimiter, loger)
-
-	grpcPortStr := os.Getenv("GRPC_PORT")
-	grpcPort, err := strconv.Atoi(grpcPortStr)
-	if err != nil {
-		log.Fatalf("Invalid GRPC_PORT: %v", err)
-	}
-
-	app := grpcapp.New(loger, Auth, grpcPort)
-	app.MustRun()
-
-	defer app.Stop()
+	os.Exit(application.Run(context.Background(), loger))
 }
 
 func setupLogger(env string) *slog.Logger {
 	var loger *slog.Logger
 
 	switch env {
-	case envLocal:
+	case config.EnvLocal:
 		loger = slog.New(
 			slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
 		)
-	case envDev:
+	case config.EnvDev:
 		loger = slog.New(
 			slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
 		)
-	case envProd:
+	case config.EnvProd:
 		loger = slog.New(
 			slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}),
 		)
@@ -119,5 +59,5 @@ func setupLogger(env string) *slog.Logger {
 		)
 	}
 	//TODO: починить логер ибо он не чекает окружение
-	return loger
+	return slog.New(tracing.NewLogHandler(loger.Handler()))
 }
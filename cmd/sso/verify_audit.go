@@ -0,0 +1,103 @@
+package main
+
+import (
+	"SSO/internal/app"
+	"SSO/internal/config"
+	"SSO/internal/lib/auditchain"
+	"SSO/internal/lib/jwtLib"
+	"SSO/internal/storage/postgresql"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// verifyAuditCommand checks hash chain of audit log and signatures of its
+// checkpoints, prints report as JSON and exits with error when chain is
+// broken. It takes the same configuration as the server and -jwks flag with
+// JWKS file of retired signing keys, checkpoints signed before key rotation
+// are verified with them.
+const verifyAuditCommand = "verify-audit"
+
+const jwksFlag = "jwks"
+
+func verifyAudit(args []string) int {
+	jwksFile, args := cutFlag(args, jwksFlag)
+
+	cfg, err := config.Load(args, os.LookupEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var keys jwtLib.JWKS
+	if jwksFile != "" {
+		data, err := os.ReadFile(jwksFile)
+		if err != nil {
+			log.Fatalf("Failed to read jwks file: %v", err)
+		}
+		if err := json.Unmarshal(data, &keys); err != nil {
+			log.Fatalf("Failed to parse jwks file: %v", err)
+		}
+	}
+
+	// ephemeral key of local environment can't verify anything signed before
+	if cfg.OIDC.SigningKeyFile != "" {
+		signingKey, err := jwtLib.LoadSigningKey(cfg.OIDC.SigningKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load signing key: %v", err)
+		}
+		keys.Keys = append(keys.Keys, signingKey.JWKS().Keys...)
+	}
+	if len(keys.Keys) == 0 {
+		log.Fatal("signing key file (env SIGNING_KEY_FILE) or -jwks file is required to verify audit checkpoints")
+	}
+
+	storage, err := postgresql.New(context.Background(), cfg.DB.Migrations, cfg.DB.ConnString(), cfg.DB.Name)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer storage.Stop()
+
+	report, err := auditchain.Verify(context.Background(), storage, keys, 0)
+	if err != nil {
+		log.Fatalf("Failed to verify audit log: %v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+
+	if report.Broken != nil {
+		return app.ExitError
+	}
+	return app.ExitOK
+}
+
+// cutFlag removes -name value or -name=value from args, config.Load rejects
+// flags it does not know.
+func cutFlag(args []string, name string) (string, []string) {
+	rest := make([]string, 0, len(args))
+	var value string
+	for i := 0; i < len(args); i++ {
+		arg := strings.TrimPrefix(strings.TrimPrefix(args[i], "-"), "-")
+		if arg == args[i] {
+			rest = append(rest, args[i])
+			continue
+		}
+		switch {
+		case arg == name && i+1 < len(args):
+			value = args[i+1]
+			i++
+		case strings.HasPrefix(arg, name+"="):
+			value = strings.TrimPrefix(arg, name+"=")
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	return value, rest
+}
@@ -0,0 +1,97 @@
+// stubwebhook is webhook receiver to try deliveries locally. It checks
+// signature, prints every delivery and can fail first deliveries to show
+// retries, nothing is persisted.
+//
+//	go run ./cmd/stubwebhook -secret 0123456789abcdef -fail 2
+//
+// and subscribe http://localhost:9100/ with the same secret.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"SSO/internal/services/webhooks"
+)
+
+type stub struct {
+	secret    string
+	tolerance time.Duration
+
+	mu sync.Mutex
+	// failLeft is number of deliveries still to be answered with 500.
+	failLeft int
+	// seen counts attempts per delivery, retries share delivery id.
+	seen map[string]int
+}
+
+func main() {
+	addr := flag.String("addr", ":9100", "listen address")
+	secret := flag.String("secret", "", "subscription secret, signature is not checked when empty")
+	fail := flag.Int("fail", 0, "answer 500 to this many first requests")
+	tolerance := flag.Duration("tolerance", 5*time.Minute, "accepted age of signature timestamp")
+	flag.Parse()
+
+	s := &stub{
+		secret:    *secret,
+		tolerance: *tolerance,
+		failLeft:  *fail,
+		seen:      map[string]int{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /", s.receive)
+
+	log.Printf("stub webhook receiver listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+func (s *stub) receive(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	deliveryID := r.Header.Get(webhooks.DeliveryHeader)
+	eventType := r.Header.Get(webhooks.EventHeader)
+
+	if s.secret != "" {
+		err := webhooks.VerifySignature(s.secret, r.Header.Get(webhooks.SignatureHeader), body, time.Now(), s.tolerance)
+		if err != nil {
+			log.Printf("delivery %s (%s): rejected: %v", deliveryID, eventType, err)
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	s.seen[deliveryID]++
+	attempt := s.seen[deliveryID]
+	failing := s.failLeft > 0
+	if failing {
+		s.failLeft--
+	}
+	s.mu.Unlock()
+
+	var event map[string]any
+	if err := json.Unmarshal(body, &event); err != nil {
+		log.Printf("delivery %s (%s) attempt %d: invalid json: %v", deliveryID, eventType, attempt, err)
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if failing {
+		log.Printf("delivery %s (%s) attempt %d: failing on purpose", deliveryID, eventType, attempt)
+		http.Error(w, "failing on purpose", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("delivery %s (%s) attempt %d: %s", deliveryID, eventType, attempt, body)
+	w.WriteHeader(http.StatusNoContent)
+}
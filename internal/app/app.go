@@ -1,42 +1,219 @@
 package app
 
 import (
+	"SSO/internal/config"
 	"SSO/internal/domain/models"
+	"SSO/internal/lib/auditchain"
+	"SSO/internal/lib/eventsink"
+	"SSO/internal/lib/hasher"
+	"SSO/internal/lib/health"
+	"SSO/internal/lib/jwtLib"
+	"SSO/internal/lib/ldapauth"
+	"SSO/internal/lib/mailer"
+	"SSO/internal/lib/metrics"
+	"SSO/internal/lib/saml"
+	libtls "SSO/internal/lib/tls"
+	"SSO/internal/lib/tracing"
+	"SSO/internal/lib/upstream"
+	"SSO/internal/storage/metered"
 	"SSO/internal/storage/postgresql"
+	"SSO/internal/storage/traced"
 	"context"
+	"errors"
+	"fmt"
+	ssov2 "github.com/AlexseyBrashka/protos/gen/go/sso"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
 	"log/slog"
+	"strings"
 	"time"
 
 	grpcapp "SSO/internal/app/grpc"
+	httpapp "SSO/internal/app/http"
+	metricsapp "SSO/internal/app/metrics"
+	authgrpc "SSO/internal/grpc/auth"
 	"SSO/internal/services/auth"
+	"SSO/internal/services/importer"
+	"SSO/internal/services/outbox"
+	"SSO/internal/services/webhooks"
 )
 
 type App struct {
 	GRPCServer *grpcapp.App
+	HTTPServer *httpapp.App
+	// MetricsServer is stopped last, so drain is visible in metrics.
+	MetricsServer *metricsapp.App
+
+	health          *health.Checker
+	webhooks        *webhooks.Webhooks
+	outbox          *outbox.Relay
+	casher          *models.RedisCasher
+	storage         *postgresql.Storage
+	shutdownTracing func(context.Context) error
+	shutdownTimeout time.Duration
 }
 
-func New(
-	authApp models.AuthApp,
-	casher *models.RedisCasher,
-	accTokenTTL time.Duration,
-	refTokenTTL time.Duration,
-	migrationPath string,
-	dbName string,
-	limiters *models.Limiters,
-	log *slog.Logger,
-	grpcPort int,
-	connStr string,
-) *App {
-	storage, err := postgresql.New(context.Background(), migrationPath, connStr, dbName)
+func New(cfg *config.Config, log *slog.Logger) (*App, error) {
+	const op = "app.New"
+
+	authApp := cfg.AuthApp()
+	if authApp == nil {
+		return nil, fmt.Errorf("%s: %w", op, errors.New("app name and secret are required"))
+	}
+
+	hasherCfg, err := cfg.HasherConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TracingConfig())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	appMetrics := metrics.New()
+
+	passHasher := hasher.New(hasherCfg)
+	passHasher.SetObserver(appMetrics.ObservePasswordHash)
+
+	var authenticator auth.Authenticator = auth.NewLocalAuthenticator(passHasher)
+	ldapCfg, err := cfg.LDAPConfig()
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if ldapCfg != nil {
+		authenticator = auth.NewLDAPAuthenticator(ldapauth.New(*ldapCfg))
 	}
 
-	authService := auth.New(authApp, casher, accTokenTTL, refTokenTTL, storage, limiters.RegLimiter, limiters.LoginLimiter, log)
+	var webAuthn *webauthn.WebAuthn
+	if cfg.WebAuthn.RPID != "" {
+		webAuthn, err = webauthn.New(&webauthn.Config{
+			RPID:          cfg.WebAuthn.RPID,
+			RPDisplayName: cfg.App.Name,
+			RPOrigins:     cfg.WebAuthn.Origins,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	} else {
+		log.Info("webauthn rp id is not set, passkeys are disabled")
+	}
 
-	grpcApp := grpcapp.New(log, authService, grpcPort)
+	var signingKey *jwtLib.SigningKey
+	if cfg.OIDC.SigningKeyFile != "" {
+		signingKey, err = jwtLib.LoadSigningKey(cfg.OIDC.SigningKeyFile)
+	} else if cfg.Env == config.EnvLocal {
+		log.Warn("oidc signing key file is not set, using ephemeral signing key")
+		signingKey, err = jwtLib.GenerateSigningKey()
+	} else {
+		err = errors.New("oidc signing key file is required outside local env")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var mail mailer.Mailer = mailer.NewLog(log)
+	if cfg.SMTP.Host != "" {
+		mail = mailer.NewSMTP(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.From, cfg.SMTP.User, cfg.SMTP.Password)
+	}
+
+	issuer := strings.TrimSuffix(cfg.OIDC.Issuer, "/")
+
+	var providers []*upstream.Provider
+	if cfg.FederationProvidersFile != "" {
+		configs, err := upstream.LoadConfigs(cfg.FederationProvidersFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		for _, providerCfg := range configs {
+			providers = append(providers, upstream.New(providerCfg, issuer+"/federation/callback", nil))
+		}
+	}
+
+	samlIdP, err := saml.NewIdP(signingKey, issuer+"/saml/metadata", issuer+"/saml/sso")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var tlsReloader *libtls.Reloader
+	if tlsCfg := cfg.TLSConfig(); tlsCfg != nil {
+		tlsReloader, err = libtls.NewReloader(*tlsCfg, log)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	storage, err := postgresql.New(context.Background(), cfg.DB.Migrations, cfg.DB.ConnString(), cfg.DB.Name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	casher := models.NewRedisClient(cfg.Redis.Addr(), cfg.Redis.Password, cfg.Redis.DB, cfg.Tokens.RefreshTTL)
+	casher.AddHook(appMetrics.RedisHook())
+	casher.AddHook(tracing.RedisHook())
+	limiters := cfg.Limiters()
+
+	auditLog := auditchain.New(storage, signingKey, cfg.Audit.CheckpointInterval, log)
+	webhookService := webhooks.New(storage, cfg.WebhooksConfig(), log)
+
+	sinks, err := outboxSinks(cfg, webhookService, log)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	relay := outbox.New(storage, sinks, cfg.OutboxConfig(), log)
+
+	authService := auth.New(*authApp, casher, cfg.Tokens.AccessTTL, cfg.Tokens.RefreshTTL, traced.New(metered.New(storage, appMetrics.ObserveStorage), "postgresql"), auditLog, limiters.RegLimiter, limiters.LoginLimiter, passHasher, authenticator, webAuthn, signingKey, cfg.OIDC.Issuer, mail, cfg.MagicLinkURL, providers, samlIdP, appMetrics, log)
+
+	checker := health.New(log, cfg.Health.Interval, cfg.Health.Timeout, ssov2.Auth_ServiceDesc.ServiceName)
+	checker.Add("postgres", storage.Ping)
+	checker.Add("redis", func(ctx context.Context) error {
+		return casher.Ping(ctx).Err()
+	})
+
+	admins := authgrpc.NewAdmins(cfg.GRPC.AdminPrincipals, cfg.AdminApp(), authService)
+	if len(cfg.GRPC.AdminPrincipals) == 0 && cfg.AdminApp() == uuid.Nil {
+		log.Warn("no admin principals or admin app configured, admin services and permission management of REST gateway are disabled")
+	}
+
+	grpcApp := grpcapp.New(log, authService, webhookService, importer.New(storage, log), checker.Server(), appMetrics, cfg.GRPC.Port, tlsReloader, admins)
+
+	httpApp := httpapp.New(log, authService, authService, authService, authService, cfg.AdminApp(), authgrpc.NewGatewayServer(authService, admins), authgrpc.NewAuditServer(authService, admins), authgrpc.NewWebhookServer(webhookService, admins), authgrpc.NewMagicLinkServer(authService), authgrpc.NewMFAServer(authService), checker, cfg.HTTP.Port)
+
+	metricsApp := metricsapp.New(log, appMetrics.Handler(), cfg.Metrics.Port)
 
 	return &App{
-		GRPCServer: grpcApp,
+		GRPCServer:      grpcApp,
+		HTTPServer:      httpApp,
+		MetricsServer:   metricsApp,
+		health:          checker,
+		webhooks:        webhookService,
+		outbox:          relay,
+		casher:          casher,
+		storage:         storage,
+		shutdownTracing: shutdownTracing,
+		shutdownTimeout: cfg.ShutdownTimeout,
+	}, nil
+}
+
+// outboxSinks creates sinks named in cfg.Outbox.Sinks.
+func outboxSinks(cfg *config.Config, webhookService *webhooks.Webhooks, log *slog.Logger) (map[string]outbox.Sink, error) {
+	sinks := make(map[string]outbox.Sink, len(cfg.Outbox.Sinks))
+	for _, name := range cfg.Outbox.Sinks {
+		switch name {
+		case "webhook":
+			sinks[name] = webhookService
+		case "log":
+			sinks[name] = eventsink.NewLog(log)
+		case "kafka":
+			sinks[name] = eventsink.NewKafka(cfg.Kafka.RESTURL, cfg.Kafka.Topic, cfg.Kafka.User, cfg.Kafka.Password, cfg.Outbox.SinkTimeout)
+		case "nats":
+			sink, err := eventsink.NewNATS(cfg.NATS.URL, cfg.NATS.SubjectPrefix, cfg.Outbox.SinkTimeout)
+			if err != nil {
+				return nil, err
+			}
+			sinks[name] = sink
+		default:
+			return nil, fmt.Errorf("unknown outbox sink %q", name)
+		}
 	}
+	return sinks, nil
 }
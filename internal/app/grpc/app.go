@@ -7,25 +7,39 @@ import (
 	"net"
 
 	authgrpc "SSO/internal/grpc/auth"
+	"SSO/internal/lib/metrics"
+	libtls "SSO/internal/lib/tls"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/recovery"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/status"
 )
 
 type App struct {
 	log        *slog.Logger
 	gRPCServer *grpc.Server
+	tls        *libtls.Reloader
 	port       int
 }
 
-// New creates new gRPC server app.
+// New creates new gRPC server app. Server listens in plaintext when tls is
+// nil. Client certificates verified by tls identify admin principals.
+// healthServer is registered as grpc.health.v1 service.
 func New(
 	log *slog.Logger,
 	authService authgrpc.Auth,
+	webhooks authgrpc.Webhooks,
+	importer authgrpc.Importer,
+	healthServer healthpb.HealthServer,
+	metrics *metrics.Metrics,
 	port int,
+	tls *libtls.Reloader,
+	admins *authgrpc.Admins,
 ) *App {
 	loggingOpts := []logging.Option{
 		logging.WithLogOnEvents(
@@ -43,16 +57,30 @@ func New(
 		}),
 	}
 
-	gRPCServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
-		recovery.UnaryServerInterceptor(recoveryOpts...),
-		logging.UnaryServerInterceptor(InterceptorLogger(log), loggingOpts...),
-	))
+	opts := []grpc.ServerOption{
+		// extracts incoming trace context and starts server span
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(
+			metrics.UnaryServerInterceptor(),
+			recovery.UnaryServerInterceptor(recoveryOpts...),
+			logging.UnaryServerInterceptor(InterceptorLogger(log), loggingOpts...),
+			authgrpc.PrincipalInterceptor(),
+			authgrpc.ClientIPInterceptor(),
+		),
+	}
+	if tls != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tls.ServerConfig())))
+	}
+
+	gRPCServer := grpc.NewServer(opts...)
 
-	authgrpc.Register(gRPCServer, authService)
+	authgrpc.Register(gRPCServer, authService, webhooks, importer, admins)
+	healthpb.RegisterHealthServer(gRPCServer, healthServer)
 
 	return &App{
 		log:        log,
 		gRPCServer: gRPCServer,
+		tls:        tls,
 		port:       port,
 	}
 }
@@ -81,7 +109,11 @@ func (a *App) Run() error {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	a.log.Info("grpc server started", slog.String("addr", l.Addr().String()))
+	a.log.Info("grpc server started", slog.String("addr", l.Addr().String()), slog.Bool("tls", a.tls != nil))
+
+	if a.tls != nil {
+		go a.tls.Run()
+	}
 
 	if err := a.gRPCServer.Serve(l); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
@@ -98,4 +130,36 @@ func (a *App) Stop() {
 		Info("stopping gRPC server", slog.Int("port", a.port))
 
 	a.gRPCServer.GracefulStop()
+
+	if a.tls != nil {
+		a.tls.Stop()
+	}
+}
+
+// Shutdown stops accepting calls and waits for in-flight ones until ctx is
+// done, then closes remaining connections.
+func (a *App) Shutdown(ctx context.Context) error {
+	const op = "grpcapp.Shutdown"
+
+	a.log.With(slog.String("op", op)).
+		Info("draining gRPC server", slog.Int("port", a.port))
+
+	if a.tls != nil {
+		defer a.tls.Stop()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		a.gRPCServer.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		a.gRPCServer.Stop()
+		<-done
+		return fmt.Errorf("%s: %w", op, ctx.Err())
+	}
 }
@@ -0,0 +1,123 @@
+package httpapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	authgrpc "SSO/internal/grpc/auth"
+	gatewayhttp "SSO/internal/http/gateway"
+	healthhttp "SSO/internal/http/health"
+	oauthhttp "SSO/internal/http/oauth"
+	oidchttp "SSO/internal/http/oidc"
+	samlhttp "SSO/internal/http/saml"
+	scimhttp "SSO/internal/http/scim"
+	"SSO/internal/lib/requestmeta"
+
+	ssov2 "github.com/AlexseyBrashka/protos/gen/go/sso"
+	"github.com/google/uuid"
+)
+
+type App struct {
+	log        *slog.Logger
+	httpServer *http.Server
+	port       int
+}
+
+// New creates new HTTP server app.
+func New(
+	log *slog.Logger,
+	oauthService oauthhttp.OAuth,
+	oidcService oidchttp.OIDC,
+	samlService samlhttp.SAML,
+	scimService scimhttp.SCIM,
+	adminApp uuid.UUID,
+	authServer ssov2.AuthServer,
+	auditServer authgrpc.AuditServer,
+	webhookServer authgrpc.WebhookServer,
+	magicLinkServer authgrpc.MagicLinkServer,
+	mfaServer authgrpc.MFAServer,
+	health healthhttp.Health,
+	port int,
+) *App {
+	mux := http.NewServeMux()
+
+	oauthhttp.Register(mux, oauthService, log)
+	oidchttp.Register(mux, oidcService, log)
+	samlhttp.Register(mux, samlService, log)
+	scimhttp.Register(mux, scimService, adminApp, log)
+	gatewayhttp.Register(mux, authServer, auditServer, webhookServer, magicLinkServer, mfaServer, log)
+	healthhttp.Register(mux, health, log)
+
+	return &App{
+		log: log,
+		httpServer: &http.Server{
+			Handler:           withClientIP(mux),
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		port: port,
+	}
+}
+
+// MustRun runs HTTP server and panics if any error occurs.
+func (a *App) MustRun() {
+	if err := a.Run(); err != nil {
+		panic(err)
+	}
+}
+
+// Run runs HTTP server.
+func (a *App) Run() error {
+	const op = "httpapp.Run"
+
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("http server started", slog.String("addr", l.Addr().String()))
+
+	if err := a.httpServer.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Stop stops HTTP server.
+func (a *App) Stop() {
+	const op = "httpapp.Stop"
+
+	a.log.With(slog.String("op", op)).
+		Info("stopping HTTP server", slog.Int("port", a.port))
+
+	if err := a.httpServer.Shutdown(context.Background()); err != nil {
+		a.log.Error("failed to stop HTTP server", slog.String("error", err.Error()))
+	}
+}
+
+// Shutdown waits for in-flight requests until ctx is done.
+func (a *App) Shutdown(ctx context.Context) error {
+	const op = "httpapp.Shutdown"
+
+	a.log.With(slog.String("op", op)).
+		Info("draining HTTP server", slog.Int("port", a.port))
+
+	if err := a.httpServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// withClientIP puts address of connected peer into request context.
+// Forwarded headers are not trusted, they are set by client.
+func withClientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := requestmeta.WithClientIP(r.Context(), requestmeta.Host(r.RemoteAddr))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
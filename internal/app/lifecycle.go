@@ -0,0 +1,110 @@
+package app
+
+import (
+	"SSO/internal/lib/logger/sl"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+const (
+	ExitOK    = 0
+	ExitError = 1
+)
+
+// Run serves gRPC, HTTP and metrics, relays outbox and delivers webhooks
+// until SIGINT/SIGTERM, ctx cancellation or server failure, then shuts down
+// and returns process exit code. Non zero code means server failed or
+// in-flight calls were cut by shutdown deadline.
+func (a *App) Run(ctx context.Context, log *slog.Logger) int {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErrs := make(chan error, 3)
+	go a.health.Run()
+	go a.outbox.Run()
+	go a.webhooks.Run()
+	go func() { serveErrs <- a.GRPCServer.Run() }()
+	go func() { serveErrs <- a.HTTPServer.Run() }()
+	go func() { serveErrs <- a.MetricsServer.Run() }()
+
+	code := ExitOK
+
+	select {
+	case <-ctx.Done():
+		log.Info("shutdown requested")
+	case err := <-serveErrs:
+		log.Error("server failed", sl.Err(err))
+		code = ExitError
+	}
+	// second signal kills process without waiting for drain
+	stop()
+
+	if err := a.shutdown(); err != nil {
+		log.Error("shutdown finished with errors", sl.Err(err))
+		code = ExitError
+	} else {
+		log.Info("shutdown finished")
+	}
+
+	return code
+}
+
+// shutdown reports NOT_SERVING, drains gRPC and HTTP servers concurrently
+// within shutdownTimeout,
+// stops outbox relay and webhook worker and only then closes resources
+// in-flight calls may still use: Redis and storage.
+func (a *App) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), a.shutdownTimeout)
+	defer cancel()
+
+	a.health.Shutdown()
+
+	// servers drain at once, so slow calls on one do not eat deadline of other
+	var (
+		wg      sync.WaitGroup
+		grpcErr error
+		httpErr error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		grpcErr = a.GRPCServer.Shutdown(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		httpErr = a.HTTPServer.Shutdown(ctx)
+	}()
+	wg.Wait()
+
+	// errors.Join drops nil ones
+	errs := []error{grpcErr, httpErr}
+
+	// relay first, its webhook sink saves deliveries the worker sends
+	if err := a.outbox.Shutdown(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := a.webhooks.Shutdown(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := a.casher.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("close redis: %w", err))
+	}
+	a.storage.Stop()
+
+	if err := a.shutdownTracing(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("flush traces: %w", err))
+	}
+
+	if err := a.MetricsServer.Shutdown(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,485 @@
+// Package config loads settings of the SSO server. Sources are applied in
+// order defaults < YAML file < environment < flags, each setting has YAML
+// path, environment variable and flag named after the YAML path
+// (-grpc.port). Secret settings can be read from file: NAME_FILE variable
+// or "file:" prefixed value.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/hasher"
+	"SSO/internal/lib/ldapauth"
+	libtls "SSO/internal/lib/tls"
+	"SSO/internal/lib/tracing"
+	"SSO/internal/services/outbox"
+	"SSO/internal/services/webhooks"
+
+	"github.com/google/uuid"
+)
+
+const (
+	EnvLocal = "local"
+	EnvDev   = "dev"
+	EnvProd  = "prod"
+)
+
+type Config struct {
+	Env string `yaml:"env" env:"ENV" default:"local"`
+	// ShutdownTimeout is how long in-flight calls are drained on SIGTERM.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" default:"30s"`
+
+	App      App      `yaml:"app"`
+	DB       DB       `yaml:"db"`
+	Redis    Redis    `yaml:"redis"`
+	Tokens   Tokens   `yaml:"tokens"`
+	Limits   Limits   `yaml:"limits"`
+	GRPC     GRPC     `yaml:"grpc"`
+	HTTP     HTTP     `yaml:"http"`
+	Hasher   Hasher   `yaml:"hasher"`
+	LDAP     LDAP     `yaml:"ldap"`
+	WebAuthn WebAuthn `yaml:"webauthn"`
+	OIDC     OIDC     `yaml:"oidc"`
+	SMTP     SMTP     `yaml:"smtp"`
+	Health   Health   `yaml:"health"`
+	Metrics  Metrics  `yaml:"metrics"`
+	Tracing  Tracing  `yaml:"tracing"`
+	Audit    Audit    `yaml:"audit"`
+	Webhooks Webhooks `yaml:"webhooks"`
+	Outbox   Outbox   `yaml:"outbox"`
+	Kafka    Kafka    `yaml:"kafka"`
+	NATS     NATS     `yaml:"nats"`
+
+	MagicLinkURL            string `yaml:"magic_link_url" env:"MAGIC_LINK_URL"`
+	FederationProvidersFile string `yaml:"federation_providers_file" env:"FEDERATION_PROVIDERS_FILE"`
+}
+
+type App struct {
+	Name   string `yaml:"name" env:"APP_NAME" required:"true"`
+	Secret string `yaml:"secret" env:"APP_SECRET" required:"true" secret:"true"`
+}
+
+type DB struct {
+	Host       string `yaml:"host" env:"DB_HOST" required:"true"`
+	Port       int    `yaml:"port" env:"DB_PORT" default:"5432"`
+	User       string `yaml:"user" env:"DB_USER" required:"true"`
+	Password   string `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name       string `yaml:"name" env:"DB_NAME" required:"true"`
+	SSLMode    string `yaml:"sslmode" env:"DB_SSLMODE" default:"disable"`
+	Migrations string `yaml:"migrations" env:"DB_MIGRATIONS" required:"true"`
+}
+
+// ConnString is lib/pq key-value connection string.
+func (d DB) ConnString() string {
+	return fmt.Sprintf(
+		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		pqValue(d.Host), d.Port, pqValue(d.User), pqValue(d.Password), pqValue(d.Name), pqValue(d.SSLMode),
+	)
+}
+
+// pqValue quotes value of key-value connection string, so spaces, quotes
+// and backslashes can not end value or add other keys.
+func pqValue(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+	return "'" + value + "'"
+}
+
+type Redis struct {
+	Address  string `yaml:"address" env:"CasherAddress" required:"true"`
+	Port     int    `yaml:"port" env:"CasherPort" default:"6379"`
+	Password string `yaml:"password" env:"CasherPassword" required:"true" secret:"true"`
+	DB       int    `yaml:"db" env:"CasherDBId" default:"0"`
+}
+
+func (r Redis) Addr() string {
+	return r.Address + ":" + strconv.Itoa(r.Port)
+}
+
+type Tokens struct {
+	AccessTTL  time.Duration `yaml:"access_ttl" env:"ACCESS_TOKEN_TTL" default:"15m"`
+	RefreshTTL time.Duration `yaml:"refresh_ttl" env:"REFRESH_TOKEN_TTL" default:"720h"`
+}
+
+type Limits struct {
+	RegRate    time.Duration `yaml:"reg_rate" env:"REG_RATE" default:"1s"`
+	RegBurst   int           `yaml:"reg_burst" env:"REG_BURST" default:"5"`
+	LoginRate  time.Duration `yaml:"login_rate" env:"LOGIN_RATE" default:"1s"`
+	LoginBurst int           `yaml:"login_burst" env:"LOGIN_BURST" default:"10"`
+}
+
+type GRPC struct {
+	Port            int      `yaml:"port" env:"GRPC_PORT" default:"44044"`
+	TLS             TLS      `yaml:"tls"`
+	AdminPrincipals []string `yaml:"admin_principals" env:"GRPC_ADMIN_PRINCIPALS"`
+	// AdminApp is app whose sso.admin permission lets user call admin
+	// RPCs with access token of the app, its scim.global permission lets
+	// SCIM client manage every user.
+	AdminApp string `yaml:"admin_app" env:"GRPC_ADMIN_APP"`
+}
+
+type TLS struct {
+	CertFile          string        `yaml:"cert_file" env:"GRPC_TLS_CERT_FILE"`
+	KeyFile           string        `yaml:"key_file" env:"GRPC_TLS_KEY_FILE"`
+	ClientCAFile      string        `yaml:"client_ca_file" env:"GRPC_TLS_CLIENT_CA_FILE"`
+	RequireClientCert bool          `yaml:"require_client_cert" env:"GRPC_TLS_REQUIRE_CLIENT_CERT"`
+	ReloadInterval    time.Duration `yaml:"reload_interval" env:"GRPC_TLS_RELOAD_INTERVAL" default:"30s"`
+}
+
+type HTTP struct {
+	Port int `yaml:"port" env:"HTTP_PORT" default:"8080"`
+}
+
+type Hasher struct {
+	Algorithm     string `yaml:"algorithm" env:"PASSWORD_HASH_ALGORITHM" default:"argon2id"`
+	BcryptCost    int    `yaml:"bcrypt_cost" env:"BCRYPT_COST" default:"10"`
+	Argon2Memory  int    `yaml:"argon2_memory" env:"ARGON2_MEMORY" default:"65536"`
+	Argon2Time    int    `yaml:"argon2_time" env:"ARGON2_TIME" default:"3"`
+	Argon2Threads int    `yaml:"argon2_threads" env:"ARGON2_THREADS" default:"2"`
+}
+
+type LDAP struct {
+	URL                  string `yaml:"url" env:"LDAP_URL"`
+	StartTLS             bool   `yaml:"start_tls" env:"LDAP_START_TLS"`
+	BindDN               string `yaml:"bind_dn" env:"LDAP_BIND_DN"`
+	BindPassword         string `yaml:"bind_password" env:"LDAP_BIND_PASSWORD" secret:"true"`
+	BaseDN               string `yaml:"base_dn" env:"LDAP_BASE_DN"`
+	UserFilter           string `yaml:"user_filter" env:"LDAP_USER_FILTER"`
+	EmailAttribute       string `yaml:"email_attribute" env:"LDAP_EMAIL_ATTRIBUTE"`
+	GroupAttribute       string `yaml:"group_attribute" env:"LDAP_GROUP_ATTRIBUTE"`
+	GroupPermissionsFile string `yaml:"group_permissions_file" env:"LDAP_GROUP_PERMISSIONS_FILE"`
+}
+
+// WebAuthn is disabled while RPID is empty.
+type WebAuthn struct {
+	RPID    string   `yaml:"rp_id" env:"WEBAUTHN_RP_ID"`
+	Origins []string `yaml:"origins" env:"WEBAUTHN_ORIGINS"`
+}
+
+type OIDC struct {
+	Issuer         string `yaml:"issuer" env:"OIDC_ISSUER" required:"true"`
+	SigningKeyFile string `yaml:"signing_key_file" env:"SIGNING_KEY_FILE"`
+}
+
+type SMTP struct {
+	Host     string `yaml:"host" env:"SMTP_HOST"`
+	Port     string `yaml:"port" env:"SMTP_PORT" default:"587"`
+	From     string `yaml:"from" env:"SMTP_FROM"`
+	User     string `yaml:"user" env:"SMTP_USER"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD" secret:"true"`
+}
+
+type Health struct {
+	Interval time.Duration `yaml:"interval" env:"HEALTH_CHECK_INTERVAL" default:"10s"`
+	Timeout  time.Duration `yaml:"timeout" env:"HEALTH_CHECK_TIMEOUT" default:"2s"`
+}
+
+type Metrics struct {
+	Port int `yaml:"port" env:"METRICS_PORT" default:"9090"`
+}
+
+type Tracing struct {
+	// Exporter is none, stdout (local debugging) or otlp.
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER" default:"none"`
+	ServiceName string  `yaml:"service_name" env:"OTEL_SERVICE_NAME" default:"sso"`
+	Endpoint    string  `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	Insecure    bool    `yaml:"insecure" env:"OTEL_EXPORTER_OTLP_INSECURE"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" default:"1"`
+}
+
+type Audit struct {
+	// CheckpointInterval is number of audit events between signed
+	// checkpoints of hash chain, 0 disables checkpoints.
+	CheckpointInterval int `yaml:"checkpoint_interval" env:"AUDIT_CHECKPOINT_INTERVAL" default:"1000"`
+}
+
+type Webhooks struct {
+	MaxAttempts    int           `yaml:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS" default:"8"`
+	InitialBackoff time.Duration `yaml:"initial_backoff" env:"WEBHOOK_INITIAL_BACKOFF" default:"10s"`
+	MaxBackoff     time.Duration `yaml:"max_backoff" env:"WEBHOOK_MAX_BACKOFF" default:"1h"`
+	Timeout        time.Duration `yaml:"timeout" env:"WEBHOOK_TIMEOUT" default:"10s"`
+	PollInterval   time.Duration `yaml:"poll_interval" env:"WEBHOOK_POLL_INTERVAL" default:"5s"`
+	BatchSize      int           `yaml:"batch_size" env:"WEBHOOK_BATCH_SIZE" default:"100"`
+}
+
+type Outbox struct {
+	// Sinks are webhook, log, kafka and nats, every identity event is
+	// published to all of them.
+	Sinks          []string      `yaml:"sinks" env:"OUTBOX_SINKS" default:"webhook"`
+	PollInterval   time.Duration `yaml:"poll_interval" env:"OUTBOX_POLL_INTERVAL" default:"1s"`
+	BatchSize      int           `yaml:"batch_size" env:"OUTBOX_BATCH_SIZE" default:"50"`
+	InitialBackoff time.Duration `yaml:"initial_backoff" env:"OUTBOX_INITIAL_BACKOFF" default:"1s"`
+	MaxBackoff     time.Duration `yaml:"max_backoff" env:"OUTBOX_MAX_BACKOFF" default:"5m"`
+	Lease          time.Duration `yaml:"lease" env:"OUTBOX_LEASE" default:"1m"`
+	SinkTimeout    time.Duration `yaml:"sink_timeout" env:"OUTBOX_SINK_TIMEOUT" default:"10s"`
+	// Retention is how long published events are kept.
+	Retention time.Duration `yaml:"retention" env:"OUTBOX_RETENTION" default:"168h"`
+}
+
+// Kafka is REST proxy the kafka sink posts to.
+type Kafka struct {
+	RESTURL  string `yaml:"rest_url" env:"KAFKA_REST_URL"`
+	Topic    string `yaml:"topic" env:"KAFKA_TOPIC" default:"sso.identity-events"`
+	User     string `yaml:"user" env:"KAFKA_USER"`
+	Password string `yaml:"password" env:"KAFKA_PASSWORD" secret:"true"`
+}
+
+type NATS struct {
+	// URL is nats://[user:pass@]host[:port].
+	URL           string `yaml:"url" env:"NATS_URL" secret:"true"`
+	SubjectPrefix string `yaml:"subject_prefix" env:"NATS_SUBJECT_PREFIX" default:"sso.identity"`
+}
+
+// Validate checks settings which are not just required, all problems are
+// reported at once.
+func (c *Config) Validate() error {
+	var errs []error
+
+	switch c.Env {
+	case EnvLocal, EnvDev, EnvProd:
+	default:
+		errs = append(errs, fieldError("env", "must be local, dev or prod"))
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, fieldError("shutdown_timeout", "must be positive"))
+	}
+
+	ports := []struct {
+		name string
+		port int
+	}{
+		{"db.port", c.DB.Port},
+		{"redis.port", c.Redis.Port},
+		{"grpc.port", c.GRPC.Port},
+		{"http.port", c.HTTP.Port},
+		{"metrics.port", c.Metrics.Port},
+	}
+	for _, p := range ports {
+		if p.port < 1 || p.port > 65535 {
+			errs = append(errs, fieldError(p.name, "must be between 1 and 65535"))
+		}
+	}
+	if c.GRPC.Port == c.HTTP.Port {
+		errs = append(errs, fieldError("http.port", "must differ from grpc.port"))
+	}
+	if c.Metrics.Port == c.GRPC.Port || c.Metrics.Port == c.HTTP.Port {
+		errs = append(errs, fieldError("metrics.port", "must differ from grpc.port and http.port"))
+	}
+	if c.Redis.DB < 0 {
+		errs = append(errs, fieldError("redis.db", "must not be negative"))
+	}
+
+	if c.Tokens.AccessTTL <= 0 {
+		errs = append(errs, fieldError("tokens.access_ttl", "must be positive"))
+	}
+	if c.Tokens.RefreshTTL <= c.Tokens.AccessTTL {
+		errs = append(errs, fieldError("tokens.refresh_ttl", "must be longer than access_ttl"))
+	}
+	if c.Health.Interval <= 0 || c.Health.Timeout <= 0 {
+		errs = append(errs, fieldError("health", "interval and timeout must be positive"))
+	} else if c.Health.Timeout > c.Health.Interval {
+		errs = append(errs, fieldError("health.timeout", "must not exceed health.interval"))
+	}
+	if c.Audit.CheckpointInterval < 0 {
+		errs = append(errs, fieldError("audit.checkpoint_interval", "must not be negative"))
+	}
+	if c.Limits.RegBurst < 1 || c.Limits.LoginBurst < 1 {
+		errs = append(errs, fieldError("limits", "bursts must be positive"))
+	}
+
+	if _, err := c.HasherConfig(); err != nil {
+		errs = append(errs, fieldError("hasher", err.Error()))
+	}
+
+	if c.GRPC.TLS.CertFile != "" || c.GRPC.TLS.KeyFile != "" {
+		if err := c.TLSConfig().Validate(); err != nil {
+			errs = append(errs, fieldError("grpc.tls", err.Error()))
+		}
+	}
+	if len(c.GRPC.AdminPrincipals) > 0 && c.GRPC.TLS.ClientCAFile == "" {
+		errs = append(errs, fieldError("grpc.admin_principals", "needs grpc.tls.client_ca_file"))
+	}
+	if _, err := uuid.Parse(c.GRPC.AdminApp); c.GRPC.AdminApp != "" && err != nil {
+		errs = append(errs, fieldError("grpc.admin_app", "must be app uuid"))
+	}
+
+	if err := c.WebhooksConfig().Validate(); err != nil {
+		errs = append(errs, fieldError("webhooks", err.Error()))
+	}
+
+	if err := c.OutboxConfig().Validate(len(c.Outbox.Sinks)); err != nil {
+		errs = append(errs, fieldError("outbox", err.Error()))
+	}
+	if len(c.Outbox.Sinks) == 0 {
+		errs = append(errs, fieldError("outbox.sinks", "must not be empty"))
+	}
+	for _, sink := range c.Outbox.Sinks {
+		switch sink {
+		case "webhook", "log":
+		case "kafka":
+			if u, err := url.Parse(c.Kafka.RESTURL); err != nil || u.Scheme == "" || u.Host == "" {
+				errs = append(errs, fieldError("kafka.rest_url", "must be absolute url with kafka sink"))
+			}
+			if c.Kafka.Topic == "" {
+				errs = append(errs, fieldError("kafka.topic", "is required with kafka sink"))
+			}
+		case "nats":
+			if c.NATS.URL == "" {
+				errs = append(errs, fieldError("nats.url", "is required with nats sink"))
+			}
+		default:
+			errs = append(errs, fieldError("outbox.sinks", fmt.Sprintf("unknown sink %q", sink)))
+		}
+	}
+
+	if err := c.TracingConfig().Validate(); err != nil {
+		errs = append(errs, fieldError("tracing", err.Error()))
+	}
+
+	if c.LDAP.URL != "" {
+		if _, err := c.LDAPConfig(); err != nil {
+			errs = append(errs, fieldError("ldap", err.Error()))
+		}
+	}
+
+	if u, err := url.Parse(c.OIDC.Issuer); c.OIDC.Issuer != "" && (err != nil || u.Scheme == "" || u.Host == "") {
+		errs = append(errs, fieldError("oidc.issuer", "must be absolute url"))
+	}
+	// ephemeral key would invalidate every token and audit signature on restart
+	if c.OIDC.SigningKeyFile == "" && c.Env != EnvLocal {
+		errs = append(errs, fieldError("oidc.signing_key_file", "is required outside local env"))
+	}
+
+	if c.WebAuthn.RPID != "" && len(c.WebAuthn.Origins) == 0 {
+		errs = append(errs, fieldError("webauthn.origins", "is required with webauthn.rp_id"))
+	}
+
+	if c.SMTP.Host != "" && c.SMTP.From == "" {
+		errs = append(errs, fieldError("smtp.from", "is required with smtp.host"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// AuthApp is identity of the SSO itself, its secret signs access tokens.
+// It is nil when name or secret is empty.
+func (c *Config) AuthApp() *models.AuthApp {
+	return models.NewApp(uuid.New(), c.App.Name, c.App.Secret)
+}
+
+// AdminApp is uuid.Nil when admin tokens are not accepted.
+func (c *Config) AdminApp() uuid.UUID {
+	adminApp, err := uuid.Parse(c.GRPC.AdminApp)
+	if err != nil {
+		return uuid.Nil
+	}
+	return adminApp
+}
+
+func (c *Config) Limiters() *models.Limiters {
+	return models.NewLimiters(c.Limits.RegRate, c.Limits.RegBurst, c.Limits.LoginRate, c.Limits.LoginBurst)
+}
+
+func (c *Config) HasherConfig() (hasher.Config, error) {
+	// ints are checked before conversion, overflow must not wrap into
+	// valid value
+	switch {
+	case c.Hasher.Argon2Memory < 0 || c.Hasher.Argon2Memory > hasher.MaxArgon2Memory:
+		return hasher.Config{}, fmt.Errorf("argon2_memory must be in 0..%d", hasher.MaxArgon2Memory)
+	case c.Hasher.Argon2Time < 0 || c.Hasher.Argon2Time > hasher.MaxArgon2Time:
+		return hasher.Config{}, fmt.Errorf("argon2_time must be in 0..%d", hasher.MaxArgon2Time)
+	case c.Hasher.Argon2Threads < 0 || c.Hasher.Argon2Threads > math.MaxUint8:
+		return hasher.Config{}, fmt.Errorf("argon2_threads must be in 0..%d", math.MaxUint8)
+	}
+
+	cfg := hasher.DefaultConfig()
+	cfg.Algorithm = c.Hasher.Algorithm
+	cfg.BcryptCost = c.Hasher.BcryptCost
+	cfg.Argon2.Memory = uint32(c.Hasher.Argon2Memory)
+	cfg.Argon2.Time = uint32(c.Hasher.Argon2Time)
+	cfg.Argon2.Threads = uint8(c.Hasher.Argon2Threads)
+
+	return cfg, cfg.Validate()
+}
+
+// LDAPConfig is nil when directory is not configured.
+func (c *Config) LDAPConfig() (*ldapauth.Config, error) {
+	if c.LDAP.URL == "" {
+		return nil, nil
+	}
+
+	cfg, err := ldapauth.NewConfigByEnv(
+		c.LDAP.URL,
+		strconv.FormatBool(c.LDAP.StartTLS),
+		c.LDAP.BindDN,
+		c.LDAP.BindPassword,
+		c.LDAP.BaseDN,
+		c.LDAP.UserFilter,
+		c.LDAP.EmailAttribute,
+		c.LDAP.GroupAttribute,
+		c.LDAP.GroupPermissionsFile,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (c *Config) TracingConfig() tracing.Config {
+	return tracing.Config{
+		Exporter:    c.Tracing.Exporter,
+		ServiceName: c.Tracing.ServiceName,
+		Endpoint:    c.Tracing.Endpoint,
+		Insecure:    c.Tracing.Insecure,
+		SampleRatio: c.Tracing.SampleRatio,
+	}
+}
+
+func (c *Config) WebhooksConfig() webhooks.Config {
+	return webhooks.Config{
+		MaxAttempts:    c.Webhooks.MaxAttempts,
+		InitialBackoff: c.Webhooks.InitialBackoff,
+		MaxBackoff:     c.Webhooks.MaxBackoff,
+		Timeout:        c.Webhooks.Timeout,
+		PollInterval:   c.Webhooks.PollInterval,
+		BatchSize:      c.Webhooks.BatchSize,
+	}
+}
+
+func (c *Config) OutboxConfig() outbox.Config {
+	return outbox.Config{
+		PollInterval:   c.Outbox.PollInterval,
+		BatchSize:      c.Outbox.BatchSize,
+		InitialBackoff: c.Outbox.InitialBackoff,
+		MaxBackoff:     c.Outbox.MaxBackoff,
+		Lease:          c.Outbox.Lease,
+		SinkTimeout:    c.Outbox.SinkTimeout,
+		Retention:      c.Outbox.Retention,
+	}
+}
+
+// TLSConfig is nil when gRPC server runs in plaintext.
+func (c *Config) TLSConfig() *libtls.Config {
+	if c.GRPC.TLS.CertFile == "" && c.GRPC.TLS.KeyFile == "" {
+		return nil
+	}
+
+	return &libtls.Config{
+		CertFile:          c.GRPC.TLS.CertFile,
+		KeyFile:           c.GRPC.TLS.KeyFile,
+		ClientCAFile:      c.GRPC.TLS.ClientCAFile,
+		RequireClientCert: c.GRPC.TLS.RequireClientCert,
+		ReloadInterval:    c.GRPC.TLS.ReloadInterval,
+	}
+}
+
+func fieldError(path string, msg string) error {
+	return fmt.Errorf("%s: %s", path, msg)
+}
@@ -0,0 +1,266 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configPathEnv = "CONFIG_PATH"
+	filePrefix    = "file:"
+)
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+// field is settable leaf of Config.
+type field struct {
+	path     string // YAML path, also flag name
+	env      string
+	def      string
+	required bool
+	secret   bool
+	value    reflect.Value
+}
+
+// MustLoad loads config from command line arguments and environment and
+// exits with all problems listed when it is invalid.
+func MustLoad() *Config {
+	cfg, err := Load(os.Args[1:], os.LookupEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	return cfg
+}
+
+// Load reads config file given by -config flag or CONFIG_PATH, then applies
+// environment and flags. Every invalid setting is reported in returned error.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := &Config{}
+	fields := collectFields(reflect.ValueOf(cfg).Elem(), "")
+
+	fs := flag.NewFlagSet("sso", flag.ContinueOnError)
+	configPath := fs.String("config", "", "path to YAML config file (env "+configPathEnv+")")
+	flags := make(map[string]*string, len(fields))
+	for _, f := range fields {
+		usage := "env " + f.env
+		if f.def != "" {
+			usage += ", default " + f.def
+		}
+		flags[f.path] = fs.String(f.path, "", usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+
+	for _, f := range fields {
+		if f.def != "" {
+			if err := setValue(f.value, f.def); err != nil {
+				errs = append(errs, fmt.Errorf("%s: default: %w", f.path, err))
+			}
+		}
+	}
+
+	path := *configPath
+	if path == "" {
+		path, _ = lookupEnv(configPathEnv)
+	}
+	if path != "" {
+		if err := loadFile(cfg, path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, f := range fields {
+		if err := applyEnv(f, lookupEnv); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	setFlags := map[string]bool{}
+	fs.Visit(func(fl *flag.Flag) { setFlags[fl.Name] = true })
+	for _, f := range fields {
+		if !setFlags[f.path] {
+			continue
+		}
+		if err := setValue(f.value, *flags[f.path]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: flag: %w", f.path, err))
+		}
+	}
+
+	for _, f := range fields {
+		if err := resolveSecretFile(f); err != nil {
+			errs = append(errs, err)
+		}
+		if f.required && f.value.IsZero() {
+			errs = append(errs, fmt.Errorf("%s: is required (env %s)", f.path, f.env))
+		}
+	}
+
+	// cross field checks only make sense when fields themselves parsed
+	if len(errs) == 0 {
+		if err := cfg.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%w:\n%w", ErrInvalidConfig, errors.Join(errs...))
+	}
+
+	return cfg, nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	// empty file is valid and decodes to io.EOF
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv sets field from its variable, secrets also from NAME_FILE.
+func applyEnv(f field, lookupEnv func(string) (string, bool)) error {
+	if value, ok := lookupEnv(f.env); ok {
+		if err := setValue(f.value, value); err != nil {
+			return fmt.Errorf("%s: env %s: %w", f.path, f.env, err)
+		}
+	}
+
+	if !f.secret {
+		return nil
+	}
+	if file, ok := lookupEnv(f.env + "_FILE"); ok && file != "" {
+		value, err := readSecret(file)
+		if err != nil {
+			return fmt.Errorf("%s: env %s_FILE: %w", f.path, f.env, err)
+		}
+		f.value.SetString(value)
+	}
+	return nil
+}
+
+// resolveSecretFile replaces "file:/path" value of secret with file content,
+// it works the same for value from YAML, environment or flag.
+func resolveSecretFile(f field) error {
+	if !f.secret {
+		return nil
+	}
+
+	file, ok := strings.CutPrefix(f.value.String(), filePrefix)
+	if !ok {
+		return nil
+	}
+
+	value, err := readSecret(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.path, err)
+	}
+	f.value.SetString(value)
+	return nil
+}
+
+func readSecret(file string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func collectFields(v reflect.Value, prefix string) []field {
+	var fields []field
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		name := sf.Tag.Get("yaml")
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		if sf.Type.Kind() == reflect.Struct && sf.Type != reflect.TypeOf(time.Duration(0)) {
+			fields = append(fields, collectFields(v.Field(i), name)...)
+			continue
+		}
+
+		fields = append(fields, field{
+			path:     name,
+			env:      sf.Tag.Get("env"),
+			def:      sf.Tag.Get("default"),
+			required: sf.Tag.Get("required") == "true",
+			secret:   sf.Tag.Get("secret") == "true",
+			value:    v.Field(i),
+		})
+	}
+
+	return fields
+}
+
+// setValue parses string setting into field, lists are comma separated.
+func setValue(v reflect.Value, s string) error {
+	switch v.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	case []string:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("%q is not integer", s)
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not number", s)
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%q is not boolean", s)
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// requiredEnv sets every required setting, cases override it.
+var requiredEnv = map[string]string{
+	"APP_NAME":       "sso",
+	"APP_SECRET":     "app-secret",
+	"DB_HOST":        "localhost",
+	"DB_USER":        "sso",
+	"DB_NAME":        "sso",
+	"DB_MIGRATIONS":  "./migrations",
+	"CasherAddress":  "localhost",
+	"CasherPassword": "redis-secret",
+	"OIDC_ISSUER":    "https://sso.example.com",
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		return path
+	}
+
+	configFile := writeFile("config.yaml", "db:\n  port: 6000\n  password: file:"+filepath.Join(dir, "db_password")+"\nhttp:\n  port: 8100\n")
+	otherFile := writeFile("other.yaml", "db:\n  port: 6100\n")
+	writeFile("db_password", "from-secret-file\n")
+	appSecretFile := writeFile("app_secret", "app-secret-from-file\n")
+
+	tests := []struct {
+		name  string
+		args  []string
+		env   map[string]string
+		check func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "default",
+			check: func(t *testing.T, cfg *Config) {
+				assertEqual(t, "db.port", cfg.DB.Port, 5432)
+				assertEqual(t, "env", cfg.Env, EnvLocal)
+			},
+		},
+		{
+			name: "file over default",
+			env:  map[string]string{"CONFIG_PATH": configFile},
+			check: func(t *testing.T, cfg *Config) {
+				assertEqual(t, "db.port", cfg.DB.Port, 6000)
+				assertEqual(t, "http.port", cfg.HTTP.Port, 8100)
+			},
+		},
+		{
+			name: "env over file",
+			env:  map[string]string{"CONFIG_PATH": configFile, "DB_PORT": "6200"},
+			check: func(t *testing.T, cfg *Config) {
+				assertEqual(t, "db.port", cfg.DB.Port, 6200)
+				assertEqual(t, "http.port", cfg.HTTP.Port, 8100)
+			},
+		},
+		{
+			name: "flag over env",
+			args: []string{"-db.port", "6300"},
+			env:  map[string]string{"CONFIG_PATH": configFile, "DB_PORT": "6200"},
+			check: func(t *testing.T, cfg *Config) {
+				assertEqual(t, "db.port", cfg.DB.Port, 6300)
+			},
+		},
+		{
+			name: "config flag over env",
+			args: []string{"-config", otherFile},
+			env:  map[string]string{"CONFIG_PATH": configFile},
+			check: func(t *testing.T, cfg *Config) {
+				assertEqual(t, "db.port", cfg.DB.Port, 6100)
+				assertEqual(t, "http.port", cfg.HTTP.Port, 8080)
+			},
+		},
+		{
+			name: "secret file reference",
+			env:  map[string]string{"CONFIG_PATH": configFile},
+			check: func(t *testing.T, cfg *Config) {
+				assertEqual(t, "db.password", cfg.DB.Password, "from-secret-file")
+			},
+		},
+		{
+			name: "secret env file over env",
+			env:  map[string]string{"APP_SECRET_FILE": appSecretFile},
+			check: func(t *testing.T, cfg *Config) {
+				assertEqual(t, "app.secret", cfg.App.Secret, "app-secret-from-file")
+			},
+		},
+		{
+			name: "list from env",
+			env:  map[string]string{"OUTBOX_SINKS": "webhook, log,"},
+			check: func(t *testing.T, cfg *Config) {
+				if !slices.Equal(cfg.Outbox.Sinks, []string{"webhook", "log"}) {
+					t.Fatalf("outbox.sinks = %v, want [webhook log]", cfg.Outbox.Sinks)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(tt.args, lookupEnv(tt.env))
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	unknownField := filepath.Join(dir, "unknown.yaml")
+	if err := os.WriteFile(unknownField, []byte("db:\n  hostname: localhost\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		// want is part of error message, empty when only flag parsing fails
+		want string
+	}{
+		{name: "missing required", env: map[string]string{"DB_HOST": ""}, want: "db.host: is required"},
+		{name: "invalid integer", env: map[string]string{"DB_PORT": "port"}, want: "db.port: env DB_PORT"},
+		{name: "invalid duration flag", args: []string{"-tokens.access_ttl", "soon"}, want: "tokens.access_ttl: flag"},
+		{name: "unknown file field", env: map[string]string{"CONFIG_PATH": unknownField}, want: "hostname"},
+		{name: "missing file", args: []string{"-config", filepath.Join(dir, "missing.yaml")}, want: "config file"},
+		{name: "invalid env name", env: map[string]string{"ENV": "staging"}, want: "env: must be local, dev or prod"},
+		{name: "signing key outside local", env: map[string]string{"ENV": "prod"}, want: "oidc.signing_key_file"},
+		{name: "argon2 time overflow", env: map[string]string{"ARGON2_TIME": "4294967299"}, want: "argon2_time must be in"},
+		{name: "argon2 threads overflow", env: map[string]string{"ARGON2_THREADS": "258"}, want: "argon2_threads must be in"},
+		{name: "negative argon2 memory", env: map[string]string{"ARGON2_MEMORY": "-1"}, want: "argon2_memory must be in"},
+		{name: "unknown flag", args: []string{"-jwks", "keys.json"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(tt.args, lookupEnv(tt.env))
+			if err == nil {
+				t.Fatal("Load() error = nil, want error")
+			}
+			if tt.want == "" {
+				return
+			}
+			if !errors.Is(err, ErrInvalidConfig) || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Load() error = %v, want %v with %q", err, ErrInvalidConfig, tt.want)
+			}
+		})
+	}
+}
+
+func TestDBConnString(t *testing.T) {
+	tests := []struct {
+		name string
+		db   DB
+		want string
+	}{
+		{
+			name: "plain",
+			db:   DB{Host: "localhost", Port: 5432, User: "sso", Password: "secret", Name: "sso", SSLMode: "disable"},
+			want: "host='localhost' port=5432 user='sso' password='secret' dbname='sso' sslmode='disable'",
+		},
+		{
+			name: "password with spaces and quotes",
+			db:   DB{Host: "localhost", Port: 5432, User: "sso", Password: `p a's\s`, Name: "sso", SSLMode: "disable"},
+			want: `host='localhost' port=5432 user='sso' password='p a\'s\\s' dbname='sso' sslmode='disable'`,
+		},
+		{
+			name: "injected key",
+			db:   DB{Host: "localhost", Port: 5432, User: "sso", Password: "x sslmode=disable", Name: "sso", SSLMode: "verify-full"},
+			want: "host='localhost' port=5432 user='sso' password='x sslmode=disable' dbname='sso' sslmode='verify-full'",
+		},
+		{
+			name: "empty password",
+			db:   DB{Host: "localhost", Port: 5432, User: "sso", Name: "sso", SSLMode: "disable"},
+			want: "host='localhost' port=5432 user='sso' password='' dbname='sso' sslmode='disable'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertEqual(t, "ConnString()", tt.db.ConnString(), tt.want)
+		})
+	}
+}
+
+// lookupEnv returns environment of requiredEnv with overrides, empty
+// override unsets variable.
+func lookupEnv(overrides map[string]string) func(string) (string, bool) {
+	env := make(map[string]string, len(requiredEnv)+len(overrides))
+	for name, value := range requiredEnv {
+		env[name] = value
+	}
+	for name, value := range overrides {
+		if value == "" {
+			delete(env, name)
+			continue
+		}
+		env[name] = value
+	}
+
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func assertEqual[T comparable](t *testing.T, name string, got T, want T) {
+	t.Helper()
+	if got != want {
+		t.Fatalf("%s = %v, want %v", name, got, want)
+	}
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audit actions.
+const (
+	AuditLogin            = "login"
+	AuditRegister         = "register"
+	AuditLogout           = "logout"
+	AuditTokenRefresh     = "token.refresh"
+	AuditTokenExchange    = "token.exchange"
+	AuditTokenIssue       = "token.issue"
+	AuditPermissionCreate = "permission.create"
+	AuditPermissionDelete = "permission.delete"
+	AuditPermissionGrant  = "permission.grant"
+	AuditPermissionRevoke = "permission.revoke"
+
+	AuditServiceAccountCreate = "service_account.create"
+	AuditServiceAccountGrant  = "service_account.grant"
+)
+
+// Audit outcomes.
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditEvent is append-only record of security relevant action. Actor
+// performed the action, Subject is user it was performed on.
+type AuditEvent struct {
+	UUID    uuid.UUID
+	Time    time.Time
+	Actor   string
+	Subject string
+	AppUUID uuid.UUID
+	Action  string
+	// Method is how action was done, e.g. login method.
+	Method  string
+	Outcome string
+	// Reason is failure reason, empty on success.
+	Reason string
+	IP     string
+	// Target is object of action other than user, e.g. permission UUID.
+	Target string
+
+	// Seq is position in hash chain starting from 1, Hash covers event
+	// fields and PrevHash, hash of event Seq-1 (empty for the first one).
+	Seq      int64
+	PrevHash []byte
+	Hash     []byte
+}
+
+// AuditCheckpoint is signature of chain head made with service signing key,
+// events up to Seq can't be rewritten without the key.
+type AuditCheckpoint struct {
+	Seq       int64
+	EventUUID uuid.UUID
+	Hash      []byte
+	Time      time.Time
+	KeyID     string
+	Signature []byte
+}
+
+// AuditFilter selects events newest first, zero fields match everything.
+// Events older than (BeforeTime, BeforeUUID) cursor are returned.
+type AuditFilter struct {
+	Actor   string
+	Subject string
+	AppUUID uuid.UUID
+	Action  string
+	Outcome string
+	Since   time.Time
+	Until   time.Time
+
+	BeforeTime time.Time
+	BeforeUUID uuid.UUID
+
+	Limit int
+}
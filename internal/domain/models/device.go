@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DeviceStatusPending  = "pending"
+	DeviceStatusApproved = "approved"
+	DeviceStatusDenied   = "denied"
+)
+
+// DeviceAuthorization is pending device flow (RFC 8628) kept in session store.
+type DeviceAuthorization struct {
+	ClientID string        `json:"client_id"`
+	AppUUID  uuid.UUID     `json:"app_uuid"`
+	Scope    string        `json:"scope"`
+	UserCode string        `json:"user_code"`
+	Status   string        `json:"status"`
+	Email    string        `json:"email,omitempty"`
+	AuthTime time.Time     `json:"auth_time,omitempty"`
+	Interval time.Duration `json:"interval"`
+	LastPoll time.Time     `json:"last_poll,omitempty"`
+}
+
+// DeviceCode is device authorization response returned to device.
+type DeviceCode struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
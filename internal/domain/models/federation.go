@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExternalIdentity links user to subject at upstream identity provider.
+type ExternalIdentity struct {
+	Provider  string
+	Subject   string
+	UserUUID  uuid.UUID
+	Email     string
+	CreatedAt time.Time
+}
+
+// FederationState is kept between redirect to upstream provider and callback.
+type FederationState struct {
+	Provider     string           `json:"provider"`
+	Request      AuthorizeRequest `json:"request"`
+	Nonce        string           `json:"nonce"`
+	CodeVerifier string           `json:"code_verifier"`
+}
+
+// FederationMFA is federated login of user with MFA waiting for second
+// factor, user is resolved by callback already.
+type FederationMFA struct {
+	Provider string           `json:"provider"`
+	Request  AuthorizeRequest `json:"request"`
+	UserUUID uuid.UUID        `json:"user_uuid"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "github.com/google/uuid"
+
+// ImportUser is a user row from legacy system with already hashed password.
+type ImportUser struct {
+	Line        int
+	UUID        uuid.UUID
+	Email       string
+	PassHash    []byte
+	Permissions map[uuid.UUID][]string // app uuid -> permission names
+	// Events are written to outbox together with the user.
+	Events []IdentityEvent
+}
+
+type ImportRejection struct {
+	Line   int    `json:"line"`
+	Email  string `json:"email"`
+	Reason string `json:"reason"`
+}
+
+type ImportReport struct {
+	Imported int               `json:"imported"`
+	Skipped  int               `json:"skipped"`
+	Rejected []ImportRejection `json:"rejected"`
+	LastLine int               `json:"last_line"`
+}
@@ -11,7 +11,7 @@ type Limiters struct {
 	LoginLimiter *rate.Limiter
 }
 
-func newLimiters(regRate time.Duration, regBurst int, loginRate time.Duration, loginBurst int) *Limiters {
+func NewLimiters(regRate time.Duration, regBurst int, loginRate time.Duration, loginBurst int) *Limiters {
 
 	return &Limiters{
 		RegLimiter:   rate.NewLimiter(rate.Limit(regRate), regBurst),
@@ -42,5 +42,5 @@ func NewLimitersByEnv(regRate string, regBurst string, loginRate string, loginBu
 		return nil, err
 	}
 
-	return newLimiters(regRateI, regBurstI, loginRateI, loginBurstI), nil
+	return NewLimiters(regRateI, regBurstI, loginRateI, loginBurstI), nil
 }
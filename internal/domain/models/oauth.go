@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OAuthClient is a front-end registered to use SSO of an app.
+// Public clients (SPA, mobile) have no secret and must use PKCE.
+type OAuthClient struct {
+	ID           string
+	AppUUID      uuid.UUID
+	Name         string
+	SecretHash   []byte
+	RedirectURIs []string
+	Public       bool
+}
+
+func (c OAuthClient) AllowsRedirect(redirectURI string) bool {
+	for _, uri := range c.RedirectURIs {
+		if uri == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+type AuthorizeRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+}
+
+// AuthorizationCode is what is stored behind issued code until exchange.
+type AuthorizationCode struct {
+	ClientID      string    `json:"client_id"`
+	AppUUID       uuid.UUID `json:"app_uuid"`
+	Email         string    `json:"email"`
+	RedirectURI   string    `json:"redirect_uri"`
+	Scope         string    `json:"scope"`
+	CodeChallenge string    `json:"code_challenge"`
+	Nonce         string    `json:"nonce,omitempty"`
+	AuthTime      time.Time `json:"auth_time"`
+}
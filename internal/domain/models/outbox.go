@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// OutboxEvent is identity event stored in the same transaction as change it
+// describes, relay hands it to every sink at least once. Sinks lists sinks
+// which already accepted it, retries go only to the rest.
+type OutboxEvent struct {
+	Event         IdentityEvent
+	Sinks         []string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	// PublishedAt is set when all sinks accepted event.
+	PublishedAt time.Time
+}
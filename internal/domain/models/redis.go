@@ -2,11 +2,14 @@ package models
 
 import (
 	"context"
+	"errors"
 	"github.com/google/uuid"
 	redisGo "github.com/redis/go-redis/v9"
 	"time"
 )
 
+var ErrUserCodeTaken = errors.New("user code already taken")
+
 // TODO поменять на интерфейс ( что бы можно было подменять )
 type RedisCasher struct {
 	*redisGo.Client
@@ -47,6 +50,29 @@ func (r *RedisCasher) GetUserRefresh(ctx context.Context, email string, appUUID
 	return result, nil
 
 }
+
+// rotateUserRefresh replaces refresh token of app only if the stored one
+// is the presented token.
+var rotateUserRefresh = redisGo.NewScript(`
+if redis.call("HGET", KEYS[1], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[3])
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+return 1
+`)
+
+// RotateUserRefresh swaps current refresh token for next one atomically,
+// false means current is not the latest issued token: it was rotated
+// already, revoked or logged out.
+func (r *RedisCasher) RotateUserRefresh(ctx context.Context, email string, appUUID uuid.UUID, current string, next string) (bool, error) {
+	rotated, err := rotateUserRefresh.Run(ctx, r, []string{email}, appUUID.String(), current, next, r.RefreshTTL.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return rotated == 1, nil
+}
+
 func (r *RedisCasher) BlockUserRefresh(ctx context.Context, email string, appUUID uuid.UUID) error {
 
 	err := r.HDel(ctx, email, appUUID.String()).Err()
@@ -55,3 +81,173 @@ func (r *RedisCasher) BlockUserRefresh(ctx context.Context, email string, appUUI
 	}
 	return nil
 }
+
+// SetMFAChallenge saves pending second factor login, tokenHash is key of challenge.
+func (r *RedisCasher) SetMFAChallenge(ctx context.Context, tokenHash string, email string, appUUID uuid.UUID, ttl time.Duration) error {
+	return r.setPendingLogin(ctx, "mfa_challenge:"+tokenHash, email, appUUID, ttl)
+}
+
+// TakeMFAChallenge returns and deletes pending login, so challenge is single-use.
+func (r *RedisCasher) TakeMFAChallenge(ctx context.Context, tokenHash string) (string, uuid.UUID, error) {
+	return r.takePendingLogin(ctx, "mfa_challenge:"+tokenHash)
+}
+
+// useTOTPStep saves time step unless the same or later one is saved.
+var useTOTPStep = redisGo.NewScript(`
+local last = tonumber(redis.call("GET", KEYS[1]) or "-1")
+if tonumber(ARGV[1]) <= last then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+return 1
+`)
+
+// UseTOTPStep records time step of accepted TOTP code of user, false means
+// code of this or later step was accepted already and must be refused.
+func (r *RedisCasher) UseTOTPStep(ctx context.Context, userUUID uuid.UUID, step int64, ttl time.Duration) (bool, error) {
+	used, err := useTOTPStep.Run(ctx, r, []string{"totp_step:" + userUUID.String()}, step, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return used == 1, nil
+}
+
+// SetMagicLink saves emailed login token, tokenHash is key of link.
+func (r *RedisCasher) SetMagicLink(ctx context.Context, tokenHash string, email string, appUUID uuid.UUID, ttl time.Duration) error {
+	return r.setPendingLogin(ctx, "magic_link:"+tokenHash, email, appUUID, ttl)
+}
+
+// TakeMagicLink returns and deletes emailed login token, so link is single-use.
+func (r *RedisCasher) TakeMagicLink(ctx context.Context, tokenHash string) (string, uuid.UUID, error) {
+	return r.takePendingLogin(ctx, "magic_link:"+tokenHash)
+}
+
+func (r *RedisCasher) setPendingLogin(ctx context.Context, key string, email string, appUUID uuid.UUID, ttl time.Duration) error {
+	set := r.HSet(ctx, key, "email", email, "app", appUUID.String())
+	if set.Err() != nil {
+		return set.Err()
+	}
+	exp := r.Expire(ctx, key, ttl)
+	if exp.Err() != nil {
+		return exp.Err()
+	}
+	return nil
+}
+
+func (r *RedisCasher) takePendingLogin(ctx context.Context, key string) (string, uuid.UUID, error) {
+	values, err := r.HGetAll(ctx, key).Result()
+	if err != nil {
+		return "", uuid.Nil, err
+	}
+	if len(values) == 0 {
+		return "", uuid.Nil, redisGo.Nil
+	}
+
+	// only one of concurrent callers deletes the key
+	deleted, err := r.Del(ctx, key).Result()
+	if err != nil {
+		return "", uuid.Nil, err
+	}
+	if deleted == 0 {
+		return "", uuid.Nil, redisGo.Nil
+	}
+
+	appUUID, err := uuid.Parse(values["app"])
+	if err != nil {
+		return "", uuid.Nil, err
+	}
+	return values["email"], appUUID, nil
+}
+
+// SetWebAuthnSession saves ceremony state between begin and finish calls.
+func (r *RedisCasher) SetWebAuthnSession(ctx context.Context, sessionID string, session []byte, ttl time.Duration) error {
+	return r.Set(ctx, "webauthn_session:"+sessionID, session, ttl).Err()
+}
+
+// TakeWebAuthnSession returns and deletes ceremony state, so it can not be replayed.
+func (r *RedisCasher) TakeWebAuthnSession(ctx context.Context, sessionID string) ([]byte, error) {
+	return r.GetDel(ctx, "webauthn_session:"+sessionID).Bytes()
+}
+
+// SetOAuthCode saves authorization code until it is exchanged for tokens.
+func (r *RedisCasher) SetOAuthCode(ctx context.Context, codeHash string, code []byte, ttl time.Duration) error {
+	return r.Set(ctx, "oauth_code:"+codeHash, code, ttl).Err()
+}
+
+// TakeOAuthCode returns and deletes authorization code, so it is exchanged once.
+func (r *RedisCasher) TakeOAuthCode(ctx context.Context, codeHash string) ([]byte, error) {
+	return r.GetDel(ctx, "oauth_code:"+codeHash).Bytes()
+}
+
+// SetFederationState saves login at upstream provider until its callback.
+func (r *RedisCasher) SetFederationState(ctx context.Context, stateHash string, state []byte, ttl time.Duration) error {
+	return r.Set(ctx, "federation_state:"+stateHash, state, ttl).Err()
+}
+
+func (r *RedisCasher) TakeFederationState(ctx context.Context, stateHash string) ([]byte, error) {
+	return r.GetDel(ctx, "federation_state:"+stateHash).Bytes()
+}
+
+// SetFederationMFA saves federated login waiting for second factor.
+func (r *RedisCasher) SetFederationMFA(ctx context.Context, challengeHash string, pending []byte, ttl time.Duration) error {
+	return r.Set(ctx, "federation_mfa:"+challengeHash, pending, ttl).Err()
+}
+
+// TakeFederationMFA returns and deletes federated login, so challenge is single-use.
+func (r *RedisCasher) TakeFederationMFA(ctx context.Context, challengeHash string) ([]byte, error) {
+	return r.GetDel(ctx, "federation_mfa:"+challengeHash).Bytes()
+}
+
+// SetDeviceAuthorization saves pending device flow and index of its user code.
+func (r *RedisCasher) SetDeviceAuthorization(ctx context.Context, deviceCodeHash string, userCode string, authorization []byte, ttl time.Duration) error {
+	ok, err := r.SetNX(ctx, "device_user_code:"+userCode, deviceCodeHash, ttl).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrUserCodeTaken
+	}
+	return r.Set(ctx, "device_code:"+deviceCodeHash, authorization, ttl).Err()
+}
+
+// DeviceCodeByUserCode returns hash of device code the user code belongs to.
+func (r *RedisCasher) DeviceCodeByUserCode(ctx context.Context, userCode string) (string, error) {
+	return r.Get(ctx, "device_user_code:"+userCode).Result()
+}
+
+func (r *RedisCasher) DeviceAuthorization(ctx context.Context, deviceCodeHash string) ([]byte, error) {
+	return r.Get(ctx, "device_code:"+deviceCodeHash).Bytes()
+}
+
+// swapDeviceAuthorization replaces device flow keeping its expiration only
+// if it is still the read one.
+var swapDeviceAuthorization = redisGo.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[2], "KEEPTTL")
+return 1
+`)
+
+// UpdateDeviceAuthorization overwrites device flow read as current, false
+// means it was changed by concurrent approval or poll, or expired.
+func (r *RedisCasher) UpdateDeviceAuthorization(ctx context.Context, deviceCodeHash string, current []byte, next []byte) (bool, error) {
+	swapped, err := swapDeviceAuthorization.Run(ctx, r, []string{"device_code:" + deviceCodeHash}, current, next).Int()
+	if err != nil {
+		return false, err
+	}
+	return swapped == 1, nil
+}
+
+// DeleteDeviceAuthorization removes finished device flow, reports false if
+// it was already removed by concurrent poll.
+func (r *RedisCasher) DeleteDeviceAuthorization(ctx context.Context, deviceCodeHash string, userCode string) (bool, error) {
+	deleted, err := r.Del(ctx, "device_code:"+deviceCodeHash).Result()
+	if err != nil {
+		return false, err
+	}
+	if err := r.Del(ctx, "device_user_code:"+userCode).Err(); err != nil {
+		return false, err
+	}
+	return deleted == 1, nil
+}
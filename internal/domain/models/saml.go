@@ -0,0 +1,13 @@
+package models
+
+import "github.com/google/uuid"
+
+// SAMLServiceProvider is a SaaS tool registered to use SSO of an app by SAML.
+type SAMLServiceProvider struct {
+	EntityID     string
+	AppUUID      uuid.UUID
+	ACSURL       string
+	NameIDFormat string
+	// Attributes maps SAML attribute name to user field: email, uuid or permissions.
+	Attributes map[string]string
+}
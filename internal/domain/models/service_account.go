@@ -0,0 +1,12 @@
+package models
+
+import "github.com/google/uuid"
+
+// ServiceAccount is a machine client of an app. It authenticates with
+// client credentials and has its own permissions in target apps.
+type ServiceAccount struct {
+	ClientID   string
+	AppUUID    uuid.UUID
+	Name       string
+	SecretHash []byte
+}
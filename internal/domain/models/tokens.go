@@ -5,6 +5,7 @@ import "encoding/json"
 type Tokens struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token,omitempty"`
 }
 
 func (t Tokens) MarshalBinary() ([]byte, error) {
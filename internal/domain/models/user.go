@@ -7,4 +7,6 @@ type User struct {
 	Email       string
 	PassHash    []byte
 	Permissions map[string]bool
+	MFAEnabled  bool // TOTP confirmed or WebAuthn credential registered
+	Disabled    bool // deprovisioned, user cannot log in
 }
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebAuthnCredential is a registered passkey or security key.
+// Data is JSON encoded webauthn.Credential, SignCount is kept
+// separately to detect cloned authenticators.
+type WebAuthnCredential struct {
+	ID        []byte
+	UserUUID  uuid.UUID
+	SignCount uint32
+	Data      []byte
+	CreatedAt time.Time
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Identity event types.
+const (
+	EventUserRegistered    = "user.registered"
+	EventUserLoggedOut     = "user.logged_out"
+	EventUserDisabled      = "user.disabled"
+	EventUserEnabled       = "user.enabled"
+	EventUserDeleted       = "user.deleted"
+	EventPermissionGranted = "permission.granted"
+	EventPermissionRevoked = "permission.revoked"
+)
+
+// IdentityEvents lists every event type, webhooks can subscribe to them.
+var IdentityEvents = []string{
+	EventUserRegistered,
+	EventUserLoggedOut,
+	EventUserDisabled,
+	EventUserEnabled,
+	EventUserDeleted,
+	EventPermissionGranted,
+	EventPermissionRevoked,
+}
+
+// IdentityEvent is change of user state other systems may react to.
+// AppUUID is nil for events not bound to app, e.g. registration, only
+// webhooks opted in to global events get them.
+type IdentityEvent struct {
+	UUID           uuid.UUID
+	Type           string
+	Time           time.Time
+	AppUUID        uuid.UUID
+	UserUUID       uuid.UUID
+	Email          string
+	PermissionUUID uuid.UUID
+}
+
+// Webhook delivery statuses. Dead delivery ran out of attempts and waits
+// for manual retry.
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookDead      = "dead"
+)
+
+// WebhookSubscription is endpoint of app receiving events of EventTypes.
+// Secret is key of HMAC signature of deliveries. Events not bound to app
+// are delivered only when GlobalEvents is set.
+type WebhookSubscription struct {
+	UUID         uuid.UUID
+	AppUUID      uuid.UUID
+	URL          string
+	EventTypes   []string
+	GlobalEvents bool
+	Secret       string
+	CreatedAt    time.Time
+}
+
+func (s WebhookSubscription) Subscribed(event IdentityEvent) bool {
+	if event.AppUUID == uuid.Nil && !s.GlobalEvents {
+		return false
+	}
+	for _, t := range s.EventTypes {
+		if t == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event sent to one subscription, it keeps
+// outcome of the last attempt.
+type WebhookDelivery struct {
+	UUID             uuid.UUID
+	SubscriptionUUID uuid.UUID
+	AppUUID          uuid.UUID
+	EventUUID        uuid.UUID
+	EventType        string
+	Payload          []byte
+	Status           string
+	Attempts         int
+	NextAttemptAt    time.Time
+	LastStatusCode   int
+	LastError        string
+	CreatedAt        time.Time
+	DeliveredAt      time.Time
+}
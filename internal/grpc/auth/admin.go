@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Admin services below are not part of shared sso protos, so they are
+// registered by hand and their messages are google.protobuf.Struct.
+
+// structMethod adapts method of hand-registered service S to
+// grpc.MethodDesc, interceptors see it as serviceName/name.
+func structMethod[S any](serviceName string, name string, call func(S, context.Context, *structpb.Struct) (*structpb.Struct, error)) grpc.MethodDesc {
+	fullMethod := "/" + serviceName + "/" + name
+
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			in := new(structpb.Struct)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(S), ctx, in)
+			}
+
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}
+			handler := func(ctx context.Context, req any) (any, error) {
+				return call(srv.(S), ctx, req.(*structpb.Struct))
+			}
+			return interceptor(ctx, in, info, handler)
+		},
+	}
+}
+
+// uuidField parses required UUID field.
+func uuidField(in *structpb.Struct, name string) (uuid.UUID, error) {
+	parsed, err := uuid.Parse(in.GetFields()[name].GetStringValue())
+	if err != nil {
+		return uuid.Nil, status.Errorf(codes.InvalidArgument, "incorrect %s", name)
+	}
+	return parsed, nil
+}
+
+// intField parses optional integer field, absent field is 0.
+func intField(in *structpb.Struct, name string) (int, error) {
+	value := in.GetFields()[name].GetNumberValue()
+	if value != float64(int(value)) {
+		return 0, status.Errorf(codes.InvalidArgument, "%s must be integer", name)
+	}
+	return int(value), nil
+}
+
+// stringList reads optional list of strings, other values in it are
+// skipped.
+func stringList(in *structpb.Struct, name string) []string {
+	var list []string
+	for _, value := range in.GetFields()[name].GetListValue().GetValues() {
+		if str, ok := value.GetKind().(*structpb.Value_StringValue); ok {
+			list = append(list, str.StringValue)
+		}
+	}
+	return list
+}
+
+func successResponse() *structpb.Struct {
+	return &structpb.Struct{Fields: map[string]*structpb.Value{"success": structpb.NewBoolValue(true)}}
+}
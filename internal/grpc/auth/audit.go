@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/services/auth"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Audit admin service messages:
+//
+//	request:  {actor, subject, app_uuid, action, outcome, since, until,
+//	           page_size, page_token}, times in RFC 3339
+//	response: {events: [{uuid, time, actor, subject, app_uuid, action,
+//	           method, outcome, reason, ip, target, seq, hash}],
+//	           next_page_token}, hash is hex
+const (
+	AuditServiceName               = "sso.AuditAdmin"
+	QueryAuditEventsFullMethodName = "/" + AuditServiceName + "/QueryAuditEvents"
+)
+
+type AuditServer interface {
+	QueryAuditEvents(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+}
+
+type auditServer struct {
+	auth   Auth
+	admins *Admins
+}
+
+// NewAuditServer returns audit handlers, only admins may query events.
+func NewAuditServer(auth Auth, admins *Admins) AuditServer {
+	return &auditServer{auth: auth, admins: admins}
+}
+
+func RegisterAuditServer(gRPCServer *grpc.Server, server AuditServer) {
+	gRPCServer.RegisterService(&auditServiceDesc, server)
+}
+
+var auditServiceDesc = grpc.ServiceDesc{
+	ServiceName: AuditServiceName,
+	HandlerType: (*AuditServer)(nil),
+	Methods: []grpc.MethodDesc{
+		structMethod(AuditServiceName, "QueryAuditEvents", AuditServer.QueryAuditEvents),
+	},
+	Metadata: "internal/grpc/auth/audit.go",
+}
+
+func (s *auditServer) QueryAuditEvents(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	ctx, err := s.admins.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := in.GetFields()
+	str := func(name string) string {
+		return fields[name].GetStringValue()
+	}
+
+	filter := models.AuditFilter{
+		Actor:   str("actor"),
+		Subject: str("subject"),
+		Action:  str("action"),
+		Outcome: str("outcome"),
+	}
+
+	if appUUID := str("app_uuid"); appUUID != "" {
+		parsed, err := uuid.Parse(appUUID)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "incorrect app uuid")
+		}
+		filter.AppUUID = parsed
+	}
+
+	for name, dst := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := str(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "%s must be RFC 3339 time", name)
+			}
+			*dst = parsed
+		}
+	}
+
+	pageSize, err := intField(in, "page_size")
+	if err != nil {
+		return nil, err
+	}
+
+	events, next, err := s.auth.QueryAuditEvents(ctx, filter, pageSize, str("page_token"))
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidAuditQuery) {
+			return nil, status.Error(codes.InvalidArgument, "invalid page_size or page_token")
+		}
+		return nil, status.Error(codes.Internal, "failed to query audit events")
+	}
+
+	list := make([]any, 0, len(events))
+	for _, event := range events {
+		list = append(list, map[string]any{
+			"uuid":     event.UUID.String(),
+			"time":     event.Time.Format(time.RFC3339Nano),
+			"actor":    event.Actor,
+			"subject":  event.Subject,
+			"app_uuid": event.AppUUID.String(),
+			"action":   event.Action,
+			"method":   event.Method,
+			"outcome":  event.Outcome,
+			"reason":   event.Reason,
+			"ip":       event.IP,
+			"target":   event.Target,
+			"seq":      float64(event.Seq),
+			"hash":     hex.EncodeToString(event.Hash),
+		})
+	}
+
+	resp, err := structpb.NewStruct(map[string]any{
+		"events":          list,
+		"next_page_token": next,
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to encode audit events")
+	}
+	return resp, nil
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/services/importer"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Import admin service messages:
+//
+//	request:  {format, data, batch_size}, format is csv or json (json
+//	          lines), data is the file content
+//	response: {imported, skipped, rejected: [{line, email, reason}],
+//	           last_line}
+const (
+	ImportServiceName         = "sso.ImportAdmin"
+	ImportUsersFullMethodName = "/" + ImportServiceName + "/ImportUsers"
+)
+
+type Importer interface {
+	Import(ctx context.Context, r io.Reader, opts importer.Options) (models.ImportReport, error)
+}
+
+type ImportServer interface {
+	ImportUsers(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+}
+
+type importServer struct {
+	importer Importer
+	admins   *Admins
+}
+
+// NewImportServer returns import handler for admins. Import over RPC has
+// no checkpoint, rows already imported are rejected as existing users
+// when the same data is sent again.
+func NewImportServer(importer Importer, admins *Admins) ImportServer {
+	return &importServer{importer: importer, admins: admins}
+}
+
+func RegisterImportServer(gRPCServer *grpc.Server, server ImportServer) {
+	gRPCServer.RegisterService(&importServiceDesc, server)
+}
+
+var importServiceDesc = grpc.ServiceDesc{
+	ServiceName: ImportServiceName,
+	HandlerType: (*ImportServer)(nil),
+	Methods: []grpc.MethodDesc{
+		structMethod(ImportServiceName, "ImportUsers", ImportServer.ImportUsers),
+	},
+	Metadata: "internal/grpc/auth/importer.go",
+}
+
+func (s *importServer) ImportUsers(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	ctx, err := s.admins.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	batchSize, err := intField(in, "batch_size")
+	if err != nil {
+		return nil, err
+	}
+
+	fields := in.GetFields()
+	opts := importer.Options{
+		Format:    fields["format"].GetStringValue(),
+		BatchSize: batchSize,
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	data := fields["data"].GetStringValue()
+	if data == "" {
+		return nil, status.Error(codes.InvalidArgument, "data is required")
+	}
+
+	report, err := s.importer.Import(ctx, strings.NewReader(data), opts)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return nil, status.Error(codes.Canceled, "import canceled")
+		}
+		return nil, status.Error(codes.Internal, "failed to import users")
+	}
+
+	rejected := make([]any, 0, len(report.Rejected))
+	for _, rejection := range report.Rejected {
+		rejected = append(rejected, map[string]any{
+			"line":   float64(rejection.Line),
+			"email":  rejection.Email,
+			"reason": rejection.Reason,
+		})
+	}
+
+	return newStruct(map[string]any{
+		"imported":  float64(report.Imported),
+		"skipped":   float64(report.Skipped),
+		"rejected":  rejected,
+		"last_line": float64(report.LastLine),
+	})
+}
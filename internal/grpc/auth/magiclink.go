@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	verfic "SSO/internal/lib/verifications"
+	"SSO/internal/services/auth"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Magic link service messages:
+//
+//	RequestMagicLink {email, app_uuid} -> {success}, link is mailed, unknown
+//	    email gets the same answer
+//	RedeemMagicLink {token} -> {access_token, refresh_token}, user with MFA
+//	    gets FailedPrecondition and x-mfa-challenge header as in Login
+const (
+	MagicLinkServiceName = "sso.MagicLink"
+
+	RequestMagicLinkFullMethodName = "/" + MagicLinkServiceName + "/RequestMagicLink"
+	RedeemMagicLinkFullMethodName  = "/" + MagicLinkServiceName + "/RedeemMagicLink"
+)
+
+type MagicLink interface {
+	RequestMagicLink(ctx context.Context, email string, appUUID uuid.UUID) error
+	RedeemMagicLink(ctx context.Context, token string) (accessToken string, refreshToken string, err error)
+}
+
+type MagicLinkServer interface {
+	RequestMagicLink(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+	RedeemMagicLink(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+}
+
+type magicLinkServer struct {
+	magicLink MagicLink
+}
+
+func NewMagicLinkServer(magicLink MagicLink) MagicLinkServer {
+	return &magicLinkServer{magicLink: magicLink}
+}
+
+func RegisterMagicLinkServer(gRPCServer *grpc.Server, server MagicLinkServer) {
+	gRPCServer.RegisterService(&magicLinkServiceDesc, server)
+}
+
+var magicLinkServiceDesc = grpc.ServiceDesc{
+	ServiceName: MagicLinkServiceName,
+	HandlerType: (*MagicLinkServer)(nil),
+	Methods: []grpc.MethodDesc{
+		structMethod(MagicLinkServiceName, "RequestMagicLink", MagicLinkServer.RequestMagicLink),
+		structMethod(MagicLinkServiceName, "RedeemMagicLink", MagicLinkServer.RedeemMagicLink),
+	},
+	Metadata: "internal/grpc/auth/magiclink.go",
+}
+
+func (s *magicLinkServer) RequestMagicLink(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	email := in.GetFields()["email"].GetStringValue()
+	if _, err := verfic.VerifyEmail(email); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid email")
+	}
+	appUUID, err := uuidField(in, "app_uuid")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.magicLink.RequestMagicLink(ctx, email, appUUID); err != nil {
+		if errors.Is(err, auth.ErrTooManyRequests) {
+			return nil, status.Error(codes.ResourceExhausted, "too many requests")
+		}
+		return nil, status.Error(codes.Internal, "failed to send magic link")
+	}
+	return successResponse(), nil
+}
+
+func (s *magicLinkServer) RedeemMagicLink(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	token := in.GetFields()["token"].GetStringValue()
+	if token == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	accessToken, refreshToken, err := s.magicLink.RedeemMagicLink(ctx, token)
+	if err != nil {
+		if mfaErr := mfaChallenge(ctx, err); mfaErr != nil {
+			return nil, mfaErr
+		}
+
+		switch {
+		case errors.Is(err, auth.ErrInvalidMagicLink):
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired magic link")
+		case errors.Is(err, auth.ErrUserDisabled):
+			return nil, status.Error(codes.PermissionDenied, "user is disabled")
+		default:
+			return nil, status.Error(codes.Internal, "failed to redeem magic link")
+		}
+	}
+
+	return newStruct(map[string]any{"access_token": accessToken, "refresh_token": refreshToken})
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"SSO/internal/services/auth"
+	"SSO/internal/storage"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// MFA service messages, enrolment calls carry access token of the user in
+// authorization metadata:
+//
+//	EnrollMFA {} -> {secret, uri}
+//	ConfirmMFA {code} -> {recovery_codes}
+//	VerifyMFA {challenge_token, code} -> {access_token, refresh_token},
+//	    challenge_token is x-mfa-challenge header of Login
+const (
+	MFAServiceName = "sso.MFA"
+
+	EnrollMFAFullMethodName  = "/" + MFAServiceName + "/EnrollMFA"
+	ConfirmMFAFullMethodName = "/" + MFAServiceName + "/ConfirmMFA"
+	VerifyMFAFullMethodName  = "/" + MFAServiceName + "/VerifyMFA"
+)
+
+type MFA interface {
+	EnrollMFA(ctx context.Context, accessToken string) (secret string, uri string, err error)
+	ConfirmMFA(ctx context.Context, accessToken string, code string) (recoveryCodes []string, err error)
+	VerifyMFA(ctx context.Context, challengeToken string, code string) (accessToken string, refreshToken string, err error)
+}
+
+type MFAServer interface {
+	EnrollMFA(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+	ConfirmMFA(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+	VerifyMFA(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+}
+
+type mfaServer struct {
+	mfa MFA
+}
+
+func NewMFAServer(mfa MFA) MFAServer {
+	return &mfaServer{mfa: mfa}
+}
+
+func RegisterMFAServer(gRPCServer *grpc.Server, server MFAServer) {
+	gRPCServer.RegisterService(&mfaServiceDesc, server)
+}
+
+var mfaServiceDesc = grpc.ServiceDesc{
+	ServiceName: MFAServiceName,
+	HandlerType: (*MFAServer)(nil),
+	Methods: []grpc.MethodDesc{
+		structMethod(MFAServiceName, "EnrollMFA", MFAServer.EnrollMFA),
+		structMethod(MFAServiceName, "ConfirmMFA", MFAServer.ConfirmMFA),
+		structMethod(MFAServiceName, "VerifyMFA", MFAServer.VerifyMFA),
+	},
+	Metadata: "internal/grpc/auth/mfa.go",
+}
+
+func (s *mfaServer) EnrollMFA(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	token := bearerToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "access token required")
+	}
+
+	secret, uri, err := s.mfa.EnrollMFA(ctx, token)
+	if err != nil {
+		return nil, mfaError(err, "failed to enroll mfa")
+	}
+
+	return newStruct(map[string]any{"secret": secret, "uri": uri})
+}
+
+func (s *mfaServer) ConfirmMFA(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	token := bearerToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "access token required")
+	}
+
+	code := in.GetFields()["code"].GetStringValue()
+	if code == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	recoveryCodes, err := s.mfa.ConfirmMFA(ctx, token, code)
+	if err != nil {
+		return nil, mfaError(err, "failed to confirm mfa")
+	}
+
+	list := make([]any, 0, len(recoveryCodes))
+	for _, recoveryCode := range recoveryCodes {
+		list = append(list, recoveryCode)
+	}
+
+	return newStruct(map[string]any{"recovery_codes": list})
+}
+
+func (s *mfaServer) VerifyMFA(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	fields := in.GetFields()
+	challengeToken := fields["challenge_token"].GetStringValue()
+	code := fields["code"].GetStringValue()
+	if challengeToken == "" || code == "" {
+		return nil, status.Error(codes.InvalidArgument, "challenge_token and code are required")
+	}
+
+	accessToken, refreshToken, err := s.mfa.VerifyMFA(ctx, challengeToken, code)
+	if err != nil {
+		return nil, mfaError(err, "failed to verify mfa")
+	}
+
+	return newStruct(map[string]any{"access_token": accessToken, "refresh_token": refreshToken})
+}
+
+// mfaChallenge turns auth.MFARequiredError into FailedPrecondition with
+// challenge token in x-mfa-challenge header, nil for other errors.
+func mfaChallenge(ctx context.Context, err error) error {
+	var mfaErr *auth.MFARequiredError
+	if !errors.As(err, &mfaErr) {
+		return nil
+	}
+
+	if err := grpc.SetHeader(ctx, metadata.Pairs(MFAChallengeHeader, mfaErr.ChallengeToken)); err != nil {
+		return status.Error(codes.Internal, "failed to set mfa challenge")
+	}
+	return status.Error(codes.FailedPrecondition, "mfa required")
+}
+
+func mfaError(err error, internal string) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidAccessToken), errors.Is(err, storage.ErrUserNotFound):
+		return status.Error(codes.Unauthenticated, "invalid access token")
+	case errors.Is(err, auth.ErrInvalidMFAChallenge):
+		return status.Error(codes.InvalidArgument, "invalid or expired mfa challenge")
+	case errors.Is(err, auth.ErrInvalidMFACode):
+		return status.Error(codes.InvalidArgument, "invalid mfa code")
+	case errors.Is(err, auth.ErrMFANotEnrolled):
+		return status.Error(codes.FailedPrecondition, "mfa is not enrolled")
+	case errors.Is(err, auth.ErrMFAAlreadyEnabled):
+		return status.Error(codes.AlreadyExists, "mfa is already enabled")
+	case errors.Is(err, auth.ErrUserDisabled):
+		return status.Error(codes.PermissionDenied, "user is disabled")
+	default:
+		return status.Error(codes.Internal, internal)
+	}
+}
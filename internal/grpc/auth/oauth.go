@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/services/auth"
+	"SSO/internal/storage"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// OAuth admin service messages:
+//
+//	RegisterOAuthClient {app_uuid, name, redirect_uris, public} ->
+//	    {client_id, app_uuid, name, redirect_uris, public, client_secret},
+//	    secret of confidential client is returned only here
+const (
+	OAuthAdminServiceName             = "sso.OAuthAdmin"
+	RegisterOAuthClientFullMethodName = "/" + OAuthAdminServiceName + "/RegisterOAuthClient"
+)
+
+type OAuthClients interface {
+	RegisterOAuthClient(
+		ctx context.Context,
+		appUUID uuid.UUID,
+		name string,
+		redirectURIs []string,
+		public bool,
+	) (client models.OAuthClient, secret string, err error)
+}
+
+type OAuthAdminServer interface {
+	RegisterOAuthClient(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+}
+
+type oauthAdminServer struct {
+	clients OAuthClients
+	admins  *Admins
+}
+
+func NewOAuthAdminServer(clients OAuthClients, admins *Admins) OAuthAdminServer {
+	return &oauthAdminServer{clients: clients, admins: admins}
+}
+
+func RegisterOAuthAdminServer(gRPCServer *grpc.Server, server OAuthAdminServer) {
+	gRPCServer.RegisterService(&oauthAdminServiceDesc, server)
+}
+
+var oauthAdminServiceDesc = grpc.ServiceDesc{
+	ServiceName: OAuthAdminServiceName,
+	HandlerType: (*OAuthAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		structMethod(OAuthAdminServiceName, "RegisterOAuthClient", OAuthAdminServer.RegisterOAuthClient),
+	},
+	Metadata: "internal/grpc/auth/oauth.go",
+}
+
+func (s *oauthAdminServer) RegisterOAuthClient(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	ctx, err := s.admins.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	appUUID, err := uuidField(in, "app_uuid")
+	if err != nil {
+		return nil, err
+	}
+
+	fields := in.GetFields()
+	name := fields["name"].GetStringValue()
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	redirectURIs := stringList(in, "redirect_uris")
+
+	client, secret, err := s.clients.RegisterOAuthClient(ctx, appUUID, name, redirectURIs, fields["public"].GetBoolValue())
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidRedirectURI):
+			return nil, status.Error(codes.InvalidArgument, "redirect_uris must be absolute urls without fragment")
+		case errors.Is(err, storage.ErrAppNotFound):
+			return nil, status.Error(codes.NotFound, "app not found")
+		case errors.Is(err, storage.ErrClientExists):
+			return nil, status.Error(codes.AlreadyExists, "client already exists")
+		default:
+			return nil, status.Error(codes.Internal, "failed to register client")
+		}
+	}
+
+	uris := make([]any, 0, len(client.RedirectURIs))
+	for _, uri := range client.RedirectURIs {
+		uris = append(uris, uri)
+	}
+
+	resp := map[string]any{
+		"client_id":     client.ID,
+		"app_uuid":      client.AppUUID.String(),
+		"name":          client.Name,
+		"redirect_uris": uris,
+		"public":        client.Public,
+	}
+	if secret != "" {
+		resp["client_secret"] = secret
+	}
+	return newStruct(resp)
+}
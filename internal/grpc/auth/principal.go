@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"SSO/internal/lib/requestmeta"
+	libtls "SSO/internal/lib/tls"
+	"SSO/internal/services/auth"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type principalKey struct{}
+
+// Principal is caller identified by verified client certificate.
+type Principal struct {
+	Name string
+}
+
+func ContextWithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// PrincipalInterceptor puts principal of verified client certificate into
+// context, it is also actor of audit events. Calls without certificate pass
+// without principal.
+func PrincipalInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if p, ok := peer.FromContext(ctx); ok {
+			if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 {
+				leaf := tlsInfo.State.VerifiedChains[0][0]
+				name := libtls.Principal(leaf)
+				ctx = ContextWithPrincipal(ctx, Principal{Name: name})
+				ctx = requestmeta.WithActor(ctx, name)
+			}
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// AdminVerifier checks access token of admin RPC caller and returns actor
+// for audit.
+type AdminVerifier interface {
+	AuthorizeAdmin(ctx context.Context, accessToken string, adminApp uuid.UUID) (actor string, err error)
+}
+
+// Admins decides who may call admin RPCs: client certificate of one of
+// principals or bearer access token of admin app with sso.admin
+// permission.
+type Admins struct {
+	principals map[string]bool
+	app        uuid.UUID
+	verifier   AdminVerifier
+}
+
+// NewAdmins returns admin policy, uuid.Nil adminApp disables admin tokens.
+func NewAdmins(principals []string, adminApp uuid.UUID, verifier AdminVerifier) *Admins {
+	return &Admins{principals: adminSet(principals), app: adminApp, verifier: verifier}
+}
+
+func (a *Admins) configured() bool {
+	return a != nil && (len(a.principals) > 0 || a.app != uuid.Nil)
+}
+
+// authorize lets admin callers through and puts them into context as
+// actor, REST gateway calls handlers without interceptors. Admin services
+// fail closed while no admin is configured.
+func (a *Admins) authorize(ctx context.Context) (context.Context, error) {
+	if !a.configured() {
+		return nil, status.Error(codes.PermissionDenied, "admin access is not configured")
+	}
+
+	principal, hasPrincipal := PrincipalFromContext(ctx)
+	if hasPrincipal && a.principals[principal.Name] {
+		return requestmeta.WithActor(ctx, principal.Name), nil
+	}
+
+	token := bearerToken(ctx)
+	if token == "" || a.app == uuid.Nil {
+		if hasPrincipal {
+			return nil, status.Error(codes.PermissionDenied, "caller is not admin")
+		}
+		return nil, status.Error(codes.Unauthenticated, "client certificate or admin token required")
+	}
+
+	actor, err := a.verifier.AuthorizeAdmin(ctx, token, a.app)
+	switch {
+	case err == nil:
+		return requestmeta.WithActor(ctx, actor), nil
+	case errors.Is(err, auth.ErrInvalidAccessToken):
+		return nil, status.Error(codes.Unauthenticated, "invalid access token")
+	case errors.Is(err, auth.ErrNotAdmin):
+		return nil, status.Error(codes.PermissionDenied, "caller is not admin")
+	default:
+		return nil, status.Error(codes.Internal, "failed to authorize caller")
+	}
+}
+
+// authorizeBaseline guards permission management RPCs of shared protos,
+// they stay open as before while no admin is configured.
+func (a *Admins) authorizeBaseline(ctx context.Context) (context.Context, error) {
+	if !a.configured() {
+		return ctx, nil
+	}
+	return a.authorize(ctx)
+}
+
+// bearerToken is access token from authorization metadata, empty when
+// there is none.
+func bearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return ""
+	}
+	token, _ := strings.CutPrefix(values[0], "Bearer ")
+	return token
+}
+
+// ClientIPInterceptor puts address of connected peer into context.
+func ClientIPInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			ctx = requestmeta.WithClientIP(ctx, requestmeta.Host(p.Addr.String()))
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func adminSet(adminPrincipals []string) map[string]bool {
+	admins := make(map[string]bool, len(adminPrincipals))
+	for _, principal := range adminPrincipals {
+		admins[principal] = true
+	}
+	return admins
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/saml"
+	"SSO/internal/services/auth"
+	"SSO/internal/storage"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// SAML admin service messages:
+//
+//	RegisterSAMLServiceProvider {app_uuid, metadata, name_id_format, attributes} ->
+//	    {entity_id, app_uuid, acs_url, name_id_format, attributes}, metadata
+//	    is SP metadata XML, attributes maps SAML attribute name to email,
+//	    uuid or permissions and defaults when absent
+const (
+	SAMLAdminServiceName                      = "sso.SAMLAdmin"
+	RegisterSAMLServiceProviderFullMethodName = "/" + SAMLAdminServiceName + "/RegisterSAMLServiceProvider"
+)
+
+type SAMLServiceProviders interface {
+	RegisterSAMLServiceProvider(
+		ctx context.Context,
+		appUUID uuid.UUID,
+		metadata []byte,
+		nameIDFormat string,
+		attributes map[string]string,
+	) (models.SAMLServiceProvider, error)
+}
+
+type SAMLAdminServer interface {
+	RegisterSAMLServiceProvider(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+}
+
+type samlAdminServer struct {
+	providers SAMLServiceProviders
+	admins    *Admins
+}
+
+func NewSAMLAdminServer(providers SAMLServiceProviders, admins *Admins) SAMLAdminServer {
+	return &samlAdminServer{providers: providers, admins: admins}
+}
+
+func RegisterSAMLAdminServer(gRPCServer *grpc.Server, server SAMLAdminServer) {
+	gRPCServer.RegisterService(&samlAdminServiceDesc, server)
+}
+
+var samlAdminServiceDesc = grpc.ServiceDesc{
+	ServiceName: SAMLAdminServiceName,
+	HandlerType: (*SAMLAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		structMethod(SAMLAdminServiceName, "RegisterSAMLServiceProvider", SAMLAdminServer.RegisterSAMLServiceProvider),
+	},
+	Metadata: "internal/grpc/auth/saml.go",
+}
+
+func (s *samlAdminServer) RegisterSAMLServiceProvider(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	ctx, err := s.admins.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	appUUID, err := uuidField(in, "app_uuid")
+	if err != nil {
+		return nil, err
+	}
+
+	fields := in.GetFields()
+	metadata := fields["metadata"].GetStringValue()
+	if metadata == "" {
+		return nil, status.Error(codes.InvalidArgument, "metadata is required")
+	}
+
+	var attributes map[string]string
+	for name, value := range fields["attributes"].GetStructValue().GetFields() {
+		field, ok := value.GetKind().(*structpb.Value_StringValue)
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "attribute %q must map to user field name", name)
+		}
+		if attributes == nil {
+			attributes = make(map[string]string)
+		}
+		attributes[name] = field.StringValue
+	}
+
+	sp, err := s.providers.RegisterSAMLServiceProvider(ctx, appUUID, []byte(metadata), fields["name_id_format"].GetStringValue(), attributes)
+	if err != nil {
+		switch {
+		case errors.Is(err, saml.ErrInvalidMetadata):
+			return nil, status.Error(codes.InvalidArgument, "invalid metadata")
+		case errors.Is(err, auth.ErrInvalidAttributeMapping):
+			return nil, status.Error(codes.InvalidArgument, "invalid name id format or attribute mapping")
+		case errors.Is(err, storage.ErrAppNotFound):
+			return nil, status.Error(codes.NotFound, "app not found")
+		case errors.Is(err, storage.ErrServiceProviderExists):
+			return nil, status.Error(codes.AlreadyExists, "service provider already exists")
+		default:
+			return nil, status.Error(codes.Internal, "failed to register service provider")
+		}
+	}
+
+	mapping := make(map[string]any, len(sp.Attributes))
+	for name, field := range sp.Attributes {
+		mapping[name] = field
+	}
+
+	return newStruct(map[string]any{
+		"entity_id":      sp.EntityID,
+		"app_uuid":       sp.AppUUID.String(),
+		"acs_url":        sp.ACSURL,
+		"name_id_format": sp.NameIDFormat,
+		"attributes":     mapping,
+	})
+}
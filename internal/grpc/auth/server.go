@@ -17,8 +17,15 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// MFAChallengeHeader carries challenge token when Login needs second factor.
+const MFAChallengeHeader = "x-mfa-challenge"
+
 type serverAPI struct {
-	auth Auth
+	auth   Auth
+	admins *Admins
+	// failClosed refuses permission management while no admin is
+	// configured instead of leaving it open.
+	failClosed bool
 	ssov2.UnimplementedAuthServer
 }
 type Auth interface {
@@ -73,10 +80,57 @@ type Auth interface {
 		ctx context.Context,
 		appUUID uuid.UUID,
 	) ([]models.Permission, error)
+
+	QueryAuditEvents(
+		ctx context.Context,
+		filter models.AuditFilter,
+		pageSize int,
+		pageToken string,
+	) (events []models.AuditEvent, nextPageToken string, err error)
+
+	MFA
+	WebAuthn
+	MagicLink
+	OAuthClients
+	ServiceAccounts
+	TokenExchanger
+	SAMLServiceProviders
+}
+
+func Register(gRPCServer *grpc.Server, auth Auth, webhooks Webhooks, importer Importer, admins *Admins) {
+	ssov2.RegisterAuthServer(gRPCServer, NewServer(auth, admins))
+	RegisterAuditServer(gRPCServer, NewAuditServer(auth, admins))
+	RegisterWebhookServer(gRPCServer, NewWebhookServer(webhooks, admins))
+	RegisterImportServer(gRPCServer, NewImportServer(importer, admins))
+	RegisterMFAServer(gRPCServer, NewMFAServer(auth))
+	RegisterWebAuthnServer(gRPCServer, NewWebAuthnServer(auth))
+	RegisterMagicLinkServer(gRPCServer, NewMagicLinkServer(auth))
+	RegisterOAuthAdminServer(gRPCServer, NewOAuthAdminServer(auth, admins))
+	RegisterServiceAccountAdminServer(gRPCServer, NewServiceAccountAdminServer(auth, admins))
+	RegisterTokenExchangeServer(gRPCServer, NewTokenExchangeServer(auth))
+	RegisterSAMLAdminServer(gRPCServer, NewSAMLAdminServer(auth, admins))
+}
+
+// NewServer returns Auth handlers, REST gateway calls them in process so
+// validation and error codes are the same as over gRPC. When admins are
+// configured, permission management RPCs are limited to them.
+func NewServer(auth Auth, admins *Admins) ssov2.AuthServer {
+	return &serverAPI{auth: auth, admins: admins}
 }
 
-func Register(gRPCServer *grpc.Server, auth Auth) {
-	ssov2.RegisterAuthServer(gRPCServer, &serverAPI{auth: auth})
+// NewGatewayServer returns Auth handlers for REST gateway. Gateway is on
+// public HTTP port, so its permission management is limited to admins and
+// refused while none is configured.
+func NewGatewayServer(auth Auth, admins *Admins) ssov2.AuthServer {
+	return &serverAPI{auth: auth, admins: admins, failClosed: true}
+}
+
+// authorizePermissions guards permission management RPCs.
+func (s *serverAPI) authorizePermissions(ctx context.Context) (context.Context, error) {
+	if s.failClosed {
+		return s.admins.authorize(ctx)
+	}
+	return s.admins.authorizeBaseline(ctx)
 }
 func (s *serverAPI) Login(
 	ctx context.Context,
@@ -103,6 +157,10 @@ func (s *serverAPI) Login(
 		if errors.Is(err, auth.ErrInvalidCredentials) {
 			return nil, status.Error(codes.InvalidArgument, "invalid email or password")
 		}
+
+		if mfaErr := mfaChallenge(ctx, err); mfaErr != nil {
+			return nil, mfaErr
+		}
 		return nil, status.Error(codes.Internal, "failed to login")
 	}
 
@@ -158,6 +216,11 @@ func (s *serverAPI) Logout(ctx context.Context, in *ssov2.LogoutRequest) (*ssov2
 
 func (s *serverAPI) AddPermission(ctx context.Context, in *ssov2.AddPermissionRequest) (*ssov2.AddPermissionResponse, error) {
 
+	ctx, err := s.authorizePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	appUUID, err := uuid.Parse(in.GetAppUUID())
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, "No App")
@@ -173,6 +236,11 @@ func (s *serverAPI) AddPermission(ctx context.Context, in *ssov2.AddPermissionRe
 
 func (s *serverAPI) RemovePermission(ctx context.Context, in *ssov2.RemovePermissionRequest) (*ssov2.OperationResponse, error) {
 
+	ctx, err := s.authorizePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	appUUID, err := uuid.Parse(in.GetAppUUID())
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, "No App")
@@ -194,7 +262,12 @@ func (s *serverAPI) RemovePermission(ctx context.Context, in *ssov2.RemovePermis
 
 func (s *serverAPI) GrantPermission(ctx context.Context, in *ssov2.GrantPermissionRequest) (*ssov2.LoginResponse, error) {
 
-	_, err := verfic.VerifyEmail(in.GetEmail())
+	ctx, err := s.authorizePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = verfic.VerifyEmail(in.GetEmail())
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, "incorrect email")
 	}
@@ -219,7 +292,12 @@ func (s *serverAPI) GrantPermission(ctx context.Context, in *ssov2.GrantPermissi
 
 func (s *serverAPI) RevokePermission(ctx context.Context, in *ssov2.RevokePermissionRequest) (*ssov2.LoginResponse, error) {
 
-	_, err := verfic.VerifyEmail(in.GetEmail())
+	ctx, err := s.authorizePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = verfic.VerifyEmail(in.GetEmail())
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, "incorrect email")
 	}
@@ -243,9 +321,20 @@ func (s *serverAPI) RevokePermission(ctx context.Context, in *ssov2.RevokePermis
 
 func (s *serverAPI) RefreshToken(ctx context.Context, in *ssov2.RefreshTokenRequest) (*ssov2.LoginResponse, error) {
 
-	accessToken, refreshToken, err := s.auth.RefreshToken(ctx, in.Token)
+	if in.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	accessToken, refreshToken, err := s.auth.RefreshToken(ctx, in.GetToken())
 	if err != nil {
-		return nil, status.Error(codes.Internal, "failed to grant permission")
+		switch {
+		case errors.Is(err, auth.ErrInvalidRefreshToken), errors.Is(err, storage.ErrUserNotFound):
+			return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
+		case errors.Is(err, auth.ErrUserDisabled):
+			return nil, status.Error(codes.PermissionDenied, "user is disabled")
+		default:
+			return nil, status.Error(codes.Internal, "failed to refresh token")
+		}
 	}
 	return &ssov2.LoginResponse{AccessToken: accessToken, RefreshToken: refreshToken}, nil
 }
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	ssov2 "github.com/AlexseyBrashka/protos/gen/go/sso"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grantingAuth grants any permission, other methods of Auth are not
+// expected to be called.
+type grantingAuth struct {
+	Auth
+}
+
+func (grantingAuth) GrantPermission(context.Context, string, uuid.UUID, uuid.UUID) (string, string, error) {
+	return "access", "refresh", nil
+}
+
+func TestPermissionManagementWithoutAdmins(t *testing.T) {
+	in := &ssov2.GrantPermissionRequest{
+		Email:          "user@example.com",
+		AppUUID:        uuid.NewString(),
+		PermissionUUID: uuid.NewString(),
+	}
+	unconfigured := NewAdmins(nil, uuid.Nil, nil)
+
+	tests := []struct {
+		name     string
+		server   ssov2.AuthServer
+		wantCode codes.Code
+	}{
+		{name: "grpc keeps baseline", server: NewServer(grantingAuth{}, unconfigured), wantCode: codes.OK},
+		{name: "gateway fails closed", server: NewGatewayServer(grantingAuth{}, unconfigured), wantCode: codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.server.GrantPermission(context.Background(), in)
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("GrantPermission() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"SSO/internal/storage"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Service account admin service messages:
+//
+//	CreateServiceAccount {app_uuid, name} -> {client_id, client_secret},
+//	    secret is returned only here
+//	GrantServiceAccountPermission {client_id, app_uuid, permission_uuid} -> {success}
+const (
+	ServiceAccountAdminServiceName              = "sso.ServiceAccountAdmin"
+	CreateServiceAccountFullMethodName          = "/" + ServiceAccountAdminServiceName + "/CreateServiceAccount"
+	GrantServiceAccountPermissionFullMethodName = "/" + ServiceAccountAdminServiceName + "/GrantServiceAccountPermission"
+)
+
+type ServiceAccounts interface {
+	CreateServiceAccount(ctx context.Context, appUUID uuid.UUID, name string) (clientID string, secret string, err error)
+	GrantServiceAccountPermission(ctx context.Context, clientID string, appUUID uuid.UUID, permissionUUID uuid.UUID) error
+}
+
+type ServiceAccountAdminServer interface {
+	CreateServiceAccount(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+	GrantServiceAccountPermission(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+}
+
+type serviceAccountAdminServer struct {
+	accounts ServiceAccounts
+	admins   *Admins
+}
+
+func NewServiceAccountAdminServer(accounts ServiceAccounts, admins *Admins) ServiceAccountAdminServer {
+	return &serviceAccountAdminServer{accounts: accounts, admins: admins}
+}
+
+func RegisterServiceAccountAdminServer(gRPCServer *grpc.Server, server ServiceAccountAdminServer) {
+	gRPCServer.RegisterService(&serviceAccountAdminServiceDesc, server)
+}
+
+var serviceAccountAdminServiceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceAccountAdminServiceName,
+	HandlerType: (*ServiceAccountAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		structMethod(ServiceAccountAdminServiceName, "CreateServiceAccount", ServiceAccountAdminServer.CreateServiceAccount),
+		structMethod(ServiceAccountAdminServiceName, "GrantServiceAccountPermission", ServiceAccountAdminServer.GrantServiceAccountPermission),
+	},
+	Metadata: "internal/grpc/auth/service_account.go",
+}
+
+func (s *serviceAccountAdminServer) CreateServiceAccount(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	ctx, err := s.admins.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	appUUID, err := uuidField(in, "app_uuid")
+	if err != nil {
+		return nil, err
+	}
+	name := in.GetFields()["name"].GetStringValue()
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	clientID, secret, err := s.accounts.CreateServiceAccount(ctx, appUUID, name)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrAppNotFound):
+			return nil, status.Error(codes.NotFound, "app not found")
+		case errors.Is(err, storage.ErrServiceAccountExists):
+			return nil, status.Error(codes.AlreadyExists, "service account already exists")
+		default:
+			return nil, status.Error(codes.Internal, "failed to create service account")
+		}
+	}
+
+	return newStruct(map[string]any{
+		"client_id":     clientID,
+		"client_secret": secret,
+	})
+}
+
+func (s *serviceAccountAdminServer) GrantServiceAccountPermission(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	ctx, err := s.admins.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	clientID := in.GetFields()["client_id"].GetStringValue()
+	if clientID == "" {
+		return nil, status.Error(codes.InvalidArgument, "client_id is required")
+	}
+	appUUID, err := uuidField(in, "app_uuid")
+	if err != nil {
+		return nil, err
+	}
+	permissionUUID, err := uuidField(in, "permission_uuid")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.accounts.GrantServiceAccountPermission(ctx, clientID, appUUID, permissionUUID); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrServiceAccountNotFound):
+			return nil, status.Error(codes.NotFound, "service account not found")
+		case errors.Is(err, storage.ErrAppNotFound), errors.Is(err, storage.ErrPermNotFound):
+			return nil, status.Error(codes.NotFound, "permission not found")
+		case errors.Is(err, storage.ErrCantGrantPermission):
+			return nil, status.Error(codes.FailedPrecondition, "app cant grant this permission")
+		case errors.Is(err, storage.ErrUserPermissionsExists):
+			return nil, status.Error(codes.AlreadyExists, "permission already granted")
+		default:
+			return nil, status.Error(codes.Internal, "failed to grant permission")
+		}
+	}
+
+	return successResponse(), nil
+}
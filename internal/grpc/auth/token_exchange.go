@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"SSO/internal/services/auth"
+	"SSO/internal/storage"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Token exchange service messages, RFC 8693 as token endpoint grant:
+//
+//	ExchangeToken {subject_token, subject_token_type, actor_token, scope} ->
+//	    {access_token, issued_token_type, expires_in}, subject_token_type
+//	    defaults to access token, actor token may be sent as bearer
+//	    authorization instead
+const (
+	TokenExchangeServiceName    = "sso.TokenExchange"
+	ExchangeTokenFullMethodName = "/" + TokenExchangeServiceName + "/ExchangeToken"
+)
+
+type TokenExchanger interface {
+	TokenExchange(
+		ctx context.Context,
+		subjectToken string,
+		subjectTokenType string,
+		actorToken string,
+		scope string,
+	) (accessToken string, expiresIn time.Duration, err error)
+}
+
+type TokenExchangeServer interface {
+	ExchangeToken(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+}
+
+type tokenExchangeServer struct {
+	exchanger TokenExchanger
+}
+
+func NewTokenExchangeServer(exchanger TokenExchanger) TokenExchangeServer {
+	return &tokenExchangeServer{exchanger: exchanger}
+}
+
+func RegisterTokenExchangeServer(gRPCServer *grpc.Server, server TokenExchangeServer) {
+	gRPCServer.RegisterService(&tokenExchangeServiceDesc, server)
+}
+
+var tokenExchangeServiceDesc = grpc.ServiceDesc{
+	ServiceName: TokenExchangeServiceName,
+	HandlerType: (*TokenExchangeServer)(nil),
+	Methods: []grpc.MethodDesc{
+		structMethod(TokenExchangeServiceName, "ExchangeToken", TokenExchangeServer.ExchangeToken),
+	},
+	Metadata: "internal/grpc/auth/token_exchange.go",
+}
+
+func (s *tokenExchangeServer) ExchangeToken(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	fields := in.GetFields()
+
+	subjectToken := fields["subject_token"].GetStringValue()
+	if subjectToken == "" {
+		return nil, status.Error(codes.InvalidArgument, "subject_token is required")
+	}
+	subjectTokenType := fields["subject_token_type"].GetStringValue()
+	if subjectTokenType == "" {
+		subjectTokenType = auth.TokenTypeAccessToken
+	}
+	actorToken := fields["actor_token"].GetStringValue()
+	if actorToken == "" {
+		actorToken = bearerToken(ctx)
+	}
+	if actorToken == "" {
+		return nil, status.Error(codes.Unauthenticated, "actor token is required")
+	}
+
+	accessToken, expiresIn, err := s.exchanger.TokenExchange(ctx, subjectToken, subjectTokenType, actorToken, fields["scope"].GetStringValue())
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidGrant),
+			errors.Is(err, storage.ErrUserNotFound):
+			return nil, status.Error(codes.Unauthenticated, "invalid subject or actor token")
+		case errors.Is(err, auth.ErrInvalidOAuthRequest):
+			return nil, status.Error(codes.InvalidArgument, "unsupported subject_token_type")
+		case errors.Is(err, auth.ErrInvalidTarget):
+			return nil, status.Error(codes.InvalidArgument, "subject token is of another app")
+		case errors.Is(err, auth.ErrInsufficientScope):
+			return nil, status.Error(codes.InvalidArgument, "scope exceeds subject token scope")
+		case errors.Is(err, auth.ErrExchangeNotAllowed):
+			return nil, status.Error(codes.PermissionDenied, "actor is not allowed to exchange tokens")
+		default:
+			return nil, status.Error(codes.Internal, "failed to exchange token")
+		}
+	}
+
+	return newStruct(map[string]any{
+		"access_token":      accessToken,
+		"issued_token_type": auth.TokenTypeAccessToken,
+		"expires_in":        expiresIn.Seconds(),
+	})
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"SSO/internal/services/auth"
+	"SSO/internal/storage"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// WebAuthn service messages, options and response are WebAuthn JSON
+// objects passed between browser and these calls as is:
+//
+//	BeginWebAuthnRegistration {} -> {options, session_id}, call carries
+//	    access token of the user in authorization metadata
+//	FinishWebAuthnRegistration {session_id, response} -> {success}
+//	BeginWebAuthnLogin {email, app_uuid} -> {options, session_id}
+//	BeginWebAuthnMFA {challenge_token} -> {options, session_id}
+//	FinishWebAuthnLogin {session_id, response} -> {access_token, refresh_token}
+const (
+	WebAuthnServiceName = "sso.WebAuthn"
+
+	BeginWebAuthnRegistrationFullMethodName  = "/" + WebAuthnServiceName + "/BeginWebAuthnRegistration"
+	FinishWebAuthnRegistrationFullMethodName = "/" + WebAuthnServiceName + "/FinishWebAuthnRegistration"
+	BeginWebAuthnLoginFullMethodName         = "/" + WebAuthnServiceName + "/BeginWebAuthnLogin"
+	BeginWebAuthnMFAFullMethodName           = "/" + WebAuthnServiceName + "/BeginWebAuthnMFA"
+	FinishWebAuthnLoginFullMethodName        = "/" + WebAuthnServiceName + "/FinishWebAuthnLogin"
+)
+
+type WebAuthn interface {
+	BeginWebAuthnRegistration(ctx context.Context, accessToken string) (options []byte, sessionID string, err error)
+	FinishWebAuthnRegistration(ctx context.Context, sessionID string, response []byte) error
+	BeginWebAuthnLogin(ctx context.Context, email string, appUUID uuid.UUID) (options []byte, sessionID string, err error)
+	BeginWebAuthnMFA(ctx context.Context, challengeToken string) (options []byte, sessionID string, err error)
+	FinishWebAuthnLogin(ctx context.Context, sessionID string, response []byte) (accessToken string, refreshToken string, err error)
+}
+
+type WebAuthnServer interface {
+	BeginWebAuthnRegistration(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+	FinishWebAuthnRegistration(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+	BeginWebAuthnLogin(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+	BeginWebAuthnMFA(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+	FinishWebAuthnLogin(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+}
+
+type webAuthnServer struct {
+	webAuthn WebAuthn
+}
+
+func NewWebAuthnServer(webAuthn WebAuthn) WebAuthnServer {
+	return &webAuthnServer{webAuthn: webAuthn}
+}
+
+func RegisterWebAuthnServer(gRPCServer *grpc.Server, server WebAuthnServer) {
+	gRPCServer.RegisterService(&webAuthnServiceDesc, server)
+}
+
+var webAuthnServiceDesc = grpc.ServiceDesc{
+	ServiceName: WebAuthnServiceName,
+	HandlerType: (*WebAuthnServer)(nil),
+	Methods: []grpc.MethodDesc{
+		structMethod(WebAuthnServiceName, "BeginWebAuthnRegistration", WebAuthnServer.BeginWebAuthnRegistration),
+		structMethod(WebAuthnServiceName, "FinishWebAuthnRegistration", WebAuthnServer.FinishWebAuthnRegistration),
+		structMethod(WebAuthnServiceName, "BeginWebAuthnLogin", WebAuthnServer.BeginWebAuthnLogin),
+		structMethod(WebAuthnServiceName, "BeginWebAuthnMFA", WebAuthnServer.BeginWebAuthnMFA),
+		structMethod(WebAuthnServiceName, "FinishWebAuthnLogin", WebAuthnServer.FinishWebAuthnLogin),
+	},
+	Metadata: "internal/grpc/auth/webauthn.go",
+}
+
+func (s *webAuthnServer) BeginWebAuthnRegistration(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	token := bearerToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "access token required")
+	}
+
+	options, sessionID, err := s.webAuthn.BeginWebAuthnRegistration(ctx, token)
+	if err != nil {
+		return nil, webAuthnError(err, "failed to begin registration")
+	}
+	return ceremonyResponse(options, sessionID)
+}
+
+func (s *webAuthnServer) FinishWebAuthnRegistration(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	sessionID, response, err := ceremonyRequest(in)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.webAuthn.FinishWebAuthnRegistration(ctx, sessionID, response); err != nil {
+		return nil, webAuthnError(err, "failed to finish registration")
+	}
+	return successResponse(), nil
+}
+
+func (s *webAuthnServer) BeginWebAuthnLogin(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	appUUID, err := uuidField(in, "app_uuid")
+	if err != nil {
+		return nil, err
+	}
+	email := in.GetFields()["email"].GetStringValue()
+	if email == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	options, sessionID, err := s.webAuthn.BeginWebAuthnLogin(ctx, email, appUUID)
+	if err != nil {
+		return nil, webAuthnError(err, "failed to begin login")
+	}
+	return ceremonyResponse(options, sessionID)
+}
+
+func (s *webAuthnServer) BeginWebAuthnMFA(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	challengeToken := in.GetFields()["challenge_token"].GetStringValue()
+	if challengeToken == "" {
+		return nil, status.Error(codes.InvalidArgument, "challenge_token is required")
+	}
+
+	options, sessionID, err := s.webAuthn.BeginWebAuthnMFA(ctx, challengeToken)
+	if err != nil {
+		return nil, webAuthnError(err, "failed to begin login")
+	}
+	return ceremonyResponse(options, sessionID)
+}
+
+func (s *webAuthnServer) FinishWebAuthnLogin(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	sessionID, response, err := ceremonyRequest(in)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, refreshToken, err := s.webAuthn.FinishWebAuthnLogin(ctx, sessionID, response)
+	if err != nil {
+		return nil, webAuthnError(err, "failed to finish login")
+	}
+
+	return newStruct(map[string]any{"access_token": accessToken, "refresh_token": refreshToken})
+}
+
+// ceremonyRequest reads session_id and response object of finish calls.
+func ceremonyRequest(in *structpb.Struct) (string, []byte, error) {
+	fields := in.GetFields()
+
+	sessionID := fields["session_id"].GetStringValue()
+	response := fields["response"].GetStructValue()
+	if sessionID == "" || response == nil {
+		return "", nil, status.Error(codes.InvalidArgument, "session_id and response are required")
+	}
+
+	data, err := json.Marshal(response.AsMap())
+	if err != nil {
+		return "", nil, status.Error(codes.InvalidArgument, "invalid response")
+	}
+	return sessionID, data, nil
+}
+
+func ceremonyResponse(options []byte, sessionID string) (*structpb.Struct, error) {
+	var value map[string]any
+	if err := json.Unmarshal(options, &value); err != nil {
+		return nil, status.Error(codes.Internal, "failed to encode options")
+	}
+
+	return newStruct(map[string]any{"options": value, "session_id": sessionID})
+}
+
+func webAuthnError(err error, internal string) error {
+	switch {
+	case errors.Is(err, auth.ErrWebAuthnDisabled):
+		return status.Error(codes.Unimplemented, "webauthn is not configured")
+	case errors.Is(err, auth.ErrInvalidAccessToken):
+		return status.Error(codes.Unauthenticated, "invalid access token")
+	case errors.Is(err, auth.ErrInvalidMFAChallenge):
+		return status.Error(codes.InvalidArgument, "invalid or expired mfa challenge")
+	case errors.Is(err, auth.ErrInvalidWebAuthnSession):
+		return status.Error(codes.InvalidArgument, "invalid or expired webauthn session")
+	case errors.Is(err, auth.ErrInvalidWebAuthnResponse):
+		return status.Error(codes.InvalidArgument, "invalid webauthn response")
+	case errors.Is(err, auth.ErrInvalidCredentials), errors.Is(err, auth.ErrNoWebAuthnCredentials), errors.Is(err, storage.ErrUserNotFound):
+		return status.Error(codes.InvalidArgument, "invalid credentials")
+	case errors.Is(err, auth.ErrUserDisabled):
+		return status.Error(codes.PermissionDenied, "user is disabled")
+	default:
+		return status.Error(codes.Internal, internal)
+	}
+}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/services/webhooks"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Webhook admin service messages:
+//
+//	CreateWebhookSubscription {app_uuid, url, event_types, secret, global_events} ->
+//	    subscription, secret is generated when empty and returned only here,
+//	    global_events subscribes to events not bound to any app
+//	DeleteWebhookSubscription {app_uuid, subscription_uuid} -> {success}
+//	ListWebhookSubscriptions {app_uuid} -> {subscriptions}
+//	ListWebhookDeliveries {app_uuid, subscription_uuid, limit} -> {deliveries}
+//	RetryWebhookDelivery {app_uuid, delivery_uuid} -> {success}
+const (
+	WebhookServiceName = "sso.WebhookAdmin"
+
+	CreateWebhookSubscriptionFullMethodName = "/" + WebhookServiceName + "/CreateWebhookSubscription"
+	DeleteWebhookSubscriptionFullMethodName = "/" + WebhookServiceName + "/DeleteWebhookSubscription"
+	ListWebhookSubscriptionsFullMethodName  = "/" + WebhookServiceName + "/ListWebhookSubscriptions"
+	ListWebhookDeliveriesFullMethodName     = "/" + WebhookServiceName + "/ListWebhookDeliveries"
+	RetryWebhookDeliveryFullMethodName      = "/" + WebhookServiceName + "/RetryWebhookDelivery"
+)
+
+type Webhooks interface {
+	CreateSubscription(
+		ctx context.Context,
+		appUUID uuid.UUID,
+		endpoint string,
+		eventTypes []string,
+		secret string,
+		globalEvents bool,
+	) (models.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, appUUID uuid.UUID, subscriptionUUID uuid.UUID) error
+	Subscriptions(ctx context.Context, appUUID uuid.UUID) ([]models.WebhookSubscription, error)
+	Deliveries(ctx context.Context, appUUID uuid.UUID, subscriptionUUID uuid.UUID, limit int) ([]models.WebhookDelivery, error)
+	RetryDelivery(ctx context.Context, appUUID uuid.UUID, deliveryUUID uuid.UUID) error
+}
+
+type WebhookServer interface {
+	CreateWebhookSubscription(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+	DeleteWebhookSubscription(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+	ListWebhookSubscriptions(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+	ListWebhookDeliveries(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+	RetryWebhookDelivery(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+}
+
+type webhookServer struct {
+	webhooks Webhooks
+	admins   *Admins
+}
+
+// NewWebhookServer returns webhook handlers, they are limited to admins.
+func NewWebhookServer(webhooks Webhooks, admins *Admins) WebhookServer {
+	return &webhookServer{webhooks: webhooks, admins: admins}
+}
+
+func RegisterWebhookServer(gRPCServer *grpc.Server, server WebhookServer) {
+	gRPCServer.RegisterService(&webhookServiceDesc, server)
+}
+
+var webhookServiceDesc = grpc.ServiceDesc{
+	ServiceName: WebhookServiceName,
+	HandlerType: (*WebhookServer)(nil),
+	Methods: []grpc.MethodDesc{
+		structMethod(WebhookServiceName, "CreateWebhookSubscription", WebhookServer.CreateWebhookSubscription),
+		structMethod(WebhookServiceName, "DeleteWebhookSubscription", WebhookServer.DeleteWebhookSubscription),
+		structMethod(WebhookServiceName, "ListWebhookSubscriptions", WebhookServer.ListWebhookSubscriptions),
+		structMethod(WebhookServiceName, "ListWebhookDeliveries", WebhookServer.ListWebhookDeliveries),
+		structMethod(WebhookServiceName, "RetryWebhookDelivery", WebhookServer.RetryWebhookDelivery),
+	},
+	Metadata: "internal/grpc/auth/webhooks.go",
+}
+
+func (s *webhookServer) CreateWebhookSubscription(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	ctx, err := s.admins.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	appUUID, err := uuidField(in, "app_uuid")
+	if err != nil {
+		return nil, err
+	}
+
+	fields := in.GetFields()
+	endpoint := fields["url"].GetStringValue()
+	secret := fields["secret"].GetStringValue()
+	globalEvents := fields["global_events"].GetBoolValue()
+
+	var eventTypes []string
+	for _, value := range fields["event_types"].GetListValue().GetValues() {
+		eventTypes = append(eventTypes, value.GetStringValue())
+	}
+
+	if err := webhooks.ValidateSubscription(endpoint, eventTypes, secret); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	subscription, err := s.webhooks.CreateSubscription(ctx, appUUID, endpoint, eventTypes, secret, globalEvents)
+	if err != nil {
+		return nil, webhookError(err)
+	}
+
+	resp := subscriptionValue(subscription)
+	resp["secret"] = subscription.Secret
+
+	return newStruct(resp)
+}
+
+func (s *webhookServer) DeleteWebhookSubscription(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	ctx, err := s.admins.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	appUUID, err := uuidField(in, "app_uuid")
+	if err != nil {
+		return nil, err
+	}
+	subscriptionUUID, err := uuidField(in, "subscription_uuid")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.webhooks.DeleteSubscription(ctx, appUUID, subscriptionUUID); err != nil {
+		return nil, webhookError(err)
+	}
+	return successResponse(), nil
+}
+
+func (s *webhookServer) ListWebhookSubscriptions(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	ctx, err := s.admins.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	appUUID, err := uuidField(in, "app_uuid")
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions, err := s.webhooks.Subscriptions(ctx, appUUID)
+	if err != nil {
+		return nil, webhookError(err)
+	}
+
+	list := make([]any, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		list = append(list, subscriptionValue(subscription))
+	}
+
+	return newStruct(map[string]any{"subscriptions": list})
+}
+
+func (s *webhookServer) ListWebhookDeliveries(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	ctx, err := s.admins.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	appUUID, err := uuidField(in, "app_uuid")
+	if err != nil {
+		return nil, err
+	}
+	subscriptionUUID, err := uuidField(in, "subscription_uuid")
+	if err != nil {
+		return nil, err
+	}
+	limit, err := intField(in, "limit")
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := s.webhooks.Deliveries(ctx, appUUID, subscriptionUUID, limit)
+	if err != nil {
+		return nil, webhookError(err)
+	}
+
+	list := make([]any, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		value := map[string]any{
+			"uuid":              delivery.UUID.String(),
+			"subscription_uuid": delivery.SubscriptionUUID.String(),
+			"event_uuid":        delivery.EventUUID.String(),
+			"event_type":        delivery.EventType,
+			"status":            delivery.Status,
+			"attempts":          float64(delivery.Attempts),
+			"last_status_code":  float64(delivery.LastStatusCode),
+			"last_error":        delivery.LastError,
+			"created_at":        delivery.CreatedAt.Format(time.RFC3339Nano),
+		}
+		if delivery.Status == models.WebhookPending {
+			value["next_attempt_at"] = delivery.NextAttemptAt.Format(time.RFC3339Nano)
+		}
+		if delivery.Status == models.WebhookDelivered {
+			value["delivered_at"] = delivery.DeliveredAt.Format(time.RFC3339Nano)
+		}
+		list = append(list, value)
+	}
+
+	return newStruct(map[string]any{"deliveries": list})
+}
+
+func (s *webhookServer) RetryWebhookDelivery(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	ctx, err := s.admins.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	appUUID, err := uuidField(in, "app_uuid")
+	if err != nil {
+		return nil, err
+	}
+	deliveryUUID, err := uuidField(in, "delivery_uuid")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.webhooks.RetryDelivery(ctx, appUUID, deliveryUUID); err != nil {
+		return nil, webhookError(err)
+	}
+	return successResponse(), nil
+}
+
+// subscriptionValue leaves secret out, it is shown only on creation.
+func subscriptionValue(subscription models.WebhookSubscription) map[string]any {
+	eventTypes := make([]any, 0, len(subscription.EventTypes))
+	for _, eventType := range subscription.EventTypes {
+		eventTypes = append(eventTypes, eventType)
+	}
+
+	return map[string]any{
+		"uuid":          subscription.UUID.String(),
+		"app_uuid":      subscription.AppUUID.String(),
+		"url":           subscription.URL,
+		"event_types":   eventTypes,
+		"global_events": subscription.GlobalEvents,
+		"created_at":    subscription.CreatedAt.Format(time.RFC3339Nano),
+	}
+}
+
+func newStruct(value map[string]any) (*structpb.Struct, error) {
+	resp, err := structpb.NewStruct(value)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to encode response")
+	}
+	return resp, nil
+}
+
+func webhookError(err error) error {
+	switch {
+	case errors.Is(err, webhooks.ErrInvalidSubscription):
+		return status.Error(codes.InvalidArgument, "invalid subscription")
+	case errors.Is(err, webhooks.ErrInvalidDeliveriesPage):
+		return status.Errorf(codes.InvalidArgument, "limit must be between 0 and %d", webhooks.MaxDeliveriesLimit)
+	case errors.Is(err, webhooks.ErrSubscriptionNotFound):
+		return status.Error(codes.NotFound, "subscription not found")
+	case errors.Is(err, webhooks.ErrDeliveryNotFound):
+		return status.Error(codes.NotFound, "delivery not found")
+	case errors.Is(err, webhooks.ErrDeliveryNotDead):
+		return status.Error(codes.FailedPrecondition, "only dead delivery can be retried")
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
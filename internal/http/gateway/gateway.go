@@ -0,0 +1,565 @@
+// Package gateway is REST/JSON surface of Auth gRPC service for browsers
+// and scripts. Requests are translated to gRPC messages and served by the
+// same handlers in process, gRPC status codes are mapped to HTTP statuses.
+package gateway
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	authgrpc "SSO/internal/grpc/auth"
+	"SSO/internal/lib/logger/sl"
+
+	ssov2 "github.com/AlexseyBrashka/protos/gen/go/sso"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// openAPI documents every route below, keep it in sync when routes change.
+//
+//go:embed openapi.json
+var openAPI []byte
+
+type handlers struct {
+	server    ssov2.AuthServer
+	audit     authgrpc.AuditServer
+	webhooks  authgrpc.WebhookServer
+	magicLink authgrpc.MagicLinkServer
+	mfa       authgrpc.MFAServer
+	log       *slog.Logger
+}
+
+func Register(
+	mux *http.ServeMux,
+	server ssov2.AuthServer,
+	audit authgrpc.AuditServer,
+	webhooks authgrpc.WebhookServer,
+	magicLink authgrpc.MagicLinkServer,
+	mfa authgrpc.MFAServer,
+	log *slog.Logger,
+) {
+	h := &handlers{server: server, audit: audit, webhooks: webhooks, magicLink: magicLink, mfa: mfa, log: log}
+
+	mux.HandleFunc("GET /v1/openapi.json", h.openAPI)
+
+	mux.HandleFunc("POST /v1/auth/register", h.register)
+	mux.HandleFunc("POST /v1/auth/login", h.login)
+	mux.HandleFunc("POST /v1/auth/refresh", h.refreshToken)
+	mux.HandleFunc("POST /v1/auth/mfa/verify", h.verifyMFA)
+	mux.HandleFunc("POST /v1/auth/logout", h.logout)
+	mux.HandleFunc("POST /v1/auth/magic-link", h.requestMagicLink)
+	mux.HandleFunc("POST /v1/auth/magic-link/redeem", h.redeemMagicLink)
+
+	mux.HandleFunc("GET /v1/apps/{app_uuid}/permissions", h.getAppPermissions)
+	mux.HandleFunc("POST /v1/apps/{app_uuid}/permissions", h.addPermission)
+	mux.HandleFunc("DELETE /v1/apps/{app_uuid}/permissions/{permission_uuid}", h.removePermission)
+	mux.HandleFunc("PUT /v1/apps/{app_uuid}/permissions/{permission_uuid}/users/{email}", h.grantPermission)
+	mux.HandleFunc("DELETE /v1/apps/{app_uuid}/permissions/{permission_uuid}/users/{email}", h.revokePermission)
+
+	mux.HandleFunc("GET /v1/admin/audit-events", h.queryAuditEvents)
+
+	mux.HandleFunc("POST /v1/apps/{app_uuid}/webhooks", h.createWebhookSubscription)
+	mux.HandleFunc("GET /v1/apps/{app_uuid}/webhooks", h.listWebhookSubscriptions)
+	mux.HandleFunc("DELETE /v1/apps/{app_uuid}/webhooks/{subscription_uuid}", h.deleteWebhookSubscription)
+	mux.HandleFunc("GET /v1/apps/{app_uuid}/webhooks/{subscription_uuid}/deliveries", h.listWebhookDeliveries)
+	mux.HandleFunc("POST /v1/apps/{app_uuid}/webhook-deliveries/{delivery_uuid}/retry", h.retryWebhookDelivery)
+}
+
+type credentialsRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	AppUUID  string `json:"app_uuid,omitempty"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type verifyMFARequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+type logoutRequest struct {
+	Email   string `json:"email"`
+	AppUUID string `json:"app_uuid"`
+}
+
+type magicLinkRequest struct {
+	Email   string `json:"email"`
+	AppUUID string `json:"app_uuid"`
+}
+
+type redeemMagicLinkRequest struct {
+	Token string `json:"token"`
+}
+
+type addPermissionRequest struct {
+	Name string `json:"name"`
+}
+
+type webhookSubscriptionRequest struct {
+	URL          string   `json:"url"`
+	EventTypes   []string `json:"event_types"`
+	Secret       string   `json:"secret,omitempty"`
+	GlobalEvents bool     `json:"global_events,omitempty"`
+}
+
+type tokensResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type operationResponse struct {
+	Success bool `json:"success"`
+}
+
+type permission struct {
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+}
+
+type permissionsResponse struct {
+	Permissions []permission `json:"permissions"`
+}
+
+type errorResponse struct {
+	Code    int    `json:"code"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+func (h *handlers) openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPI)
+}
+
+func (h *handlers) register(w http.ResponseWriter, r *http.Request) {
+	var in credentialsRequest
+	if !h.readJSON(w, r, &in) {
+		return
+	}
+
+	ctx, _ := h.context(r, ssov2.Auth_Register_FullMethodName)
+
+	resp, err := h.server.Register(ctx, &ssov2.RegisterRequest{Email: in.Email, Password: in.Password})
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, operationResponse{Success: resp.GetSuccess()})
+}
+
+func (h *handlers) login(w http.ResponseWriter, r *http.Request) {
+	var in credentialsRequest
+	if !h.readJSON(w, r, &in) {
+		return
+	}
+
+	ctx, stream := h.context(r, ssov2.Auth_Login_FullMethodName)
+
+	resp, err := h.server.Login(ctx, &ssov2.LoginRequest{Email: in.Email, Password: in.Password, AppUuid: in.AppUUID})
+	if err != nil {
+		if challenge := stream.header.Get(authgrpc.MFAChallengeHeader); len(challenge) > 0 {
+			w.Header().Set(authgrpc.MFAChallengeHeader, challenge[0])
+		}
+		h.error(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokensResponse{AccessToken: resp.GetAccessToken(), RefreshToken: resp.GetRefreshToken()})
+}
+
+func (h *handlers) refreshToken(w http.ResponseWriter, r *http.Request) {
+	var in refreshRequest
+	if !h.readJSON(w, r, &in) {
+		return
+	}
+
+	ctx, _ := h.context(r, ssov2.Auth_RefreshToken_FullMethodName)
+
+	resp, err := h.server.RefreshToken(ctx, &ssov2.RefreshTokenRequest{Token: in.RefreshToken})
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokensResponse{AccessToken: resp.GetAccessToken(), RefreshToken: resp.GetRefreshToken()})
+}
+
+// verifyMFA finishes login answered with x-mfa-challenge header.
+func (h *handlers) verifyMFA(w http.ResponseWriter, r *http.Request) {
+	var in verifyMFARequest
+	if !h.readJSON(w, r, &in) {
+		return
+	}
+
+	h.callStruct(w, r, authgrpc.VerifyMFAFullMethodName, h.mfa.VerifyMFA, map[string]any{
+		"challenge_token": in.ChallengeToken,
+		"code":            in.Code,
+	}, http.StatusOK)
+}
+
+func (h *handlers) logout(w http.ResponseWriter, r *http.Request) {
+	var in logoutRequest
+	if !h.readJSON(w, r, &in) {
+		return
+	}
+
+	ctx, _ := h.context(r, ssov2.Auth_Logout_FullMethodName)
+
+	resp, err := h.server.Logout(ctx, &ssov2.LogoutRequest{Email: in.Email, AppUUID: in.AppUUID})
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, operationResponse{Success: resp.GetSuccess()})
+}
+
+func (h *handlers) requestMagicLink(w http.ResponseWriter, r *http.Request) {
+	var in magicLinkRequest
+	if !h.readJSON(w, r, &in) {
+		return
+	}
+
+	h.callStruct(w, r, authgrpc.RequestMagicLinkFullMethodName, h.magicLink.RequestMagicLink, map[string]any{
+		"email":    in.Email,
+		"app_uuid": in.AppUUID,
+	}, http.StatusAccepted)
+}
+
+func (h *handlers) redeemMagicLink(w http.ResponseWriter, r *http.Request) {
+	var in redeemMagicLinkRequest
+	if !h.readJSON(w, r, &in) {
+		return
+	}
+
+	h.callStruct(w, r, authgrpc.RedeemMagicLinkFullMethodName, h.magicLink.RedeemMagicLink, map[string]any{
+		"token": in.Token,
+	}, http.StatusOK)
+}
+
+func (h *handlers) getAppPermissions(w http.ResponseWriter, r *http.Request) {
+	ctx, _ := h.context(r, ssov2.Auth_GetAppPermissions_FullMethodName)
+
+	resp, err := h.server.GetAppPermissions(ctx, &ssov2.GetAppPermissionsRequest{AppUUID: r.PathValue("app_uuid")})
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	permissions := make([]permission, 0, len(resp.GetPermissions()))
+	for _, perm := range resp.GetPermissions() {
+		permissions = append(permissions, permission{UUID: perm.GetUUID(), Name: perm.GetName()})
+	}
+
+	writeJSON(w, http.StatusOK, permissionsResponse{Permissions: permissions})
+}
+
+func (h *handlers) addPermission(w http.ResponseWriter, r *http.Request) {
+	var in addPermissionRequest
+	if !h.readJSON(w, r, &in) {
+		return
+	}
+
+	ctx, _ := h.context(r, ssov2.Auth_AddPermission_FullMethodName)
+
+	resp, err := h.server.AddPermission(ctx, &ssov2.AddPermissionRequest{PermissionName: in.Name, AppUUID: r.PathValue("app_uuid")})
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, permission{UUID: resp.GetUUID(), Name: in.Name})
+}
+
+func (h *handlers) removePermission(w http.ResponseWriter, r *http.Request) {
+	ctx, _ := h.context(r, ssov2.Auth_RemovePermission_FullMethodName)
+
+	resp, err := h.server.RemovePermission(ctx, &ssov2.RemovePermissionRequest{
+		PermissionUUID: r.PathValue("permission_uuid"),
+		AppUUID:        r.PathValue("app_uuid"),
+	})
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, operationResponse{Success: resp.GetSuccess()})
+}
+
+func (h *handlers) grantPermission(w http.ResponseWriter, r *http.Request) {
+	ctx, _ := h.context(r, ssov2.Auth_GrantPermission_FullMethodName)
+
+	resp, err := h.server.GrantPermission(ctx, &ssov2.GrantPermissionRequest{
+		PermissionUUID: r.PathValue("permission_uuid"),
+		Email:          r.PathValue("email"),
+		AppUUID:        r.PathValue("app_uuid"),
+	})
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokensResponse{AccessToken: resp.GetAccessToken(), RefreshToken: resp.GetRefreshToken()})
+}
+
+func (h *handlers) revokePermission(w http.ResponseWriter, r *http.Request) {
+	ctx, _ := h.context(r, ssov2.Auth_RevokePermission_FullMethodName)
+
+	resp, err := h.server.RevokePermission(ctx, &ssov2.RevokePermissionRequest{
+		PermissionUUID: r.PathValue("permission_uuid"),
+		Email:          r.PathValue("email"),
+		AppUUID:        r.PathValue("app_uuid"),
+	})
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokensResponse{AccessToken: resp.GetAccessToken(), RefreshToken: resp.GetRefreshToken()})
+}
+
+// auditQueryParams are query parameters passed to QueryAuditEvents as is.
+var auditQueryParams = []string{"actor", "subject", "app_uuid", "action", "outcome", "since", "until", "page_token"}
+
+func (h *handlers) queryAuditEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	fields := make(map[string]any)
+	for _, name := range auditQueryParams {
+		if value := query.Get(name); value != "" {
+			fields[name] = value
+		}
+	}
+	if !h.intQueryParam(w, r, "page_size", fields) {
+		return
+	}
+
+	h.callStruct(w, r, authgrpc.QueryAuditEventsFullMethodName, h.audit.QueryAuditEvents, fields, http.StatusOK)
+}
+
+func (h *handlers) createWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	var in webhookSubscriptionRequest
+	if !h.readJSON(w, r, &in) {
+		return
+	}
+
+	eventTypes := make([]any, 0, len(in.EventTypes))
+	for _, eventType := range in.EventTypes {
+		eventTypes = append(eventTypes, eventType)
+	}
+
+	h.callStruct(w, r, authgrpc.CreateWebhookSubscriptionFullMethodName, h.webhooks.CreateWebhookSubscription, map[string]any{
+		"app_uuid":      r.PathValue("app_uuid"),
+		"url":           in.URL,
+		"event_types":   eventTypes,
+		"secret":        in.Secret,
+		"global_events": in.GlobalEvents,
+	}, http.StatusCreated)
+}
+
+func (h *handlers) listWebhookSubscriptions(w http.ResponseWriter, r *http.Request) {
+	h.callStruct(w, r, authgrpc.ListWebhookSubscriptionsFullMethodName, h.webhooks.ListWebhookSubscriptions, map[string]any{
+		"app_uuid": r.PathValue("app_uuid"),
+	}, http.StatusOK)
+}
+
+func (h *handlers) deleteWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	h.callStruct(w, r, authgrpc.DeleteWebhookSubscriptionFullMethodName, h.webhooks.DeleteWebhookSubscription, map[string]any{
+		"app_uuid":          r.PathValue("app_uuid"),
+		"subscription_uuid": r.PathValue("subscription_uuid"),
+	}, http.StatusOK)
+}
+
+func (h *handlers) listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	fields := map[string]any{
+		"app_uuid":          r.PathValue("app_uuid"),
+		"subscription_uuid": r.PathValue("subscription_uuid"),
+	}
+	if !h.intQueryParam(w, r, "limit", fields) {
+		return
+	}
+
+	h.callStruct(w, r, authgrpc.ListWebhookDeliveriesFullMethodName, h.webhooks.ListWebhookDeliveries, fields, http.StatusOK)
+}
+
+func (h *handlers) retryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	h.callStruct(w, r, authgrpc.RetryWebhookDeliveryFullMethodName, h.webhooks.RetryWebhookDelivery, map[string]any{
+		"app_uuid":      r.PathValue("app_uuid"),
+		"delivery_uuid": r.PathValue("delivery_uuid"),
+	}, http.StatusOK)
+}
+
+// callStruct calls method of hand-registered service with fields as
+// request and writes its response as JSON. MFA challenge header is passed
+// on like in login.
+func (h *handlers) callStruct(
+	w http.ResponseWriter,
+	r *http.Request,
+	method string,
+	call func(context.Context, *structpb.Struct) (*structpb.Struct, error),
+	fields map[string]any,
+	httpStatus int,
+) {
+	in, err := structpb.NewStruct(fields)
+	if err != nil {
+		h.error(w, status.Error(codes.InvalidArgument, "invalid request"))
+		return
+	}
+
+	ctx, stream := h.context(r, method)
+
+	resp, err := call(ctx, in)
+	if err != nil {
+		if challenge := stream.header.Get(authgrpc.MFAChallengeHeader); len(challenge) > 0 {
+			w.Header().Set(authgrpc.MFAChallengeHeader, challenge[0])
+		}
+		h.error(w, err)
+		return
+	}
+
+	writeJSON(w, httpStatus, resp.AsMap())
+}
+
+// intQueryParam copies integer query parameter into fields, it answers 400
+// and returns false when parameter is not integer.
+func (h *handlers) intQueryParam(w http.ResponseWriter, r *http.Request, name string, fields map[string]any) bool {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return true
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		h.error(w, status.Errorf(codes.InvalidArgument, "%s must be integer", name))
+		return false
+	}
+
+	fields[name] = float64(n)
+	return true
+}
+
+// context makes request context look like gRPC call: Authorization header
+// becomes incoming metadata and headers set by handler are captured.
+func (h *handlers) context(r *http.Request, method string) (context.Context, *headerStream) {
+	ctx := r.Context()
+
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", authorization))
+	}
+
+	stream := &headerStream{method: method}
+
+	return grpc.NewContextWithServerTransportStream(ctx, stream), stream
+}
+
+func (h *handlers) readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{
+			Code:    int(codes.InvalidArgument),
+			Status:  statusName(codes.InvalidArgument),
+			Message: "invalid json body",
+		})
+		return false
+	}
+	return true
+}
+
+func (h *handlers) error(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+
+	httpStatus := HTTPStatus(st.Code())
+	if httpStatus == http.StatusInternalServerError {
+		h.log.Error("gateway call failed", sl.Err(err))
+	}
+
+	writeJSON(w, httpStatus, errorResponse{
+		Code:    int(st.Code()),
+		Status:  statusName(st.Code()),
+		Message: st.Message(),
+	})
+}
+
+// HTTPStatus maps gRPC code to HTTP status the way grpc-gateway does.
+func HTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499 // client closed request
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// statusName is code name in google.rpc.Code style, e.g. INVALID_ARGUMENT.
+func statusName(code codes.Code) string {
+	name := code.String()
+
+	var b strings.Builder
+	for i, c := range name {
+		if i > 0 && c >= 'A' && c <= 'Z' {
+			b.WriteByte('_')
+		}
+		b.WriteRune(c)
+	}
+	return strings.ToUpper(b.String())
+}
+
+// headerStream collects headers handlers set with grpc.SetHeader.
+type headerStream struct {
+	method string
+	header metadata.MD
+}
+
+func (s *headerStream) Method() string {
+	return s.method
+}
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *headerStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *headerStream) SetTrailer(md metadata.MD) error {
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
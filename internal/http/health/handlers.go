@@ -0,0 +1,53 @@
+package health
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	libhealth "SSO/internal/lib/health"
+)
+
+type Health interface {
+	Ready() (bool, []libhealth.Result)
+}
+
+type handlers struct {
+	health Health
+	log    *slog.Logger
+}
+
+// Register adds probes: /healthz answers while process serves HTTP,
+// /readyz only while dependencies are reachable and server is not draining.
+func Register(mux *http.ServeMux, health Health, log *slog.Logger) {
+	h := &handlers{health: health, log: log}
+
+	mux.HandleFunc("GET /healthz", h.healthz)
+	mux.HandleFunc("GET /readyz", h.readyz)
+}
+
+type statusResponse struct {
+	Status string             `json:"status"`
+	Checks []libhealth.Result `json:"checks,omitempty"`
+}
+
+func (h *handlers) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, statusResponse{Status: "ok"})
+}
+
+func (h *handlers) readyz(w http.ResponseWriter, r *http.Request) {
+	ready, results := h.health.Ready()
+	if !ready {
+		writeJSON(w, http.StatusServiceUnavailable, statusResponse{Status: "not ready", Checks: results})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, statusResponse{Status: "ok", Checks: results})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
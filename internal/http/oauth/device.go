@@ -0,0 +1,155 @@
+package oauth
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+
+	"SSO/internal/lib/logger/sl"
+	"SSO/internal/services/auth"
+	"SSO/internal/storage"
+)
+
+const grantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+var devicePage = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Connect a device</title></head>
+<body>
+<h1>Connect a device{{if .Client}} to {{.Client}}{{end}}</h1>
+{{if .Error}}<p style="color:red">{{.Error}}</p>{{end}}
+{{if .Done}}<p>{{.Done}}</p>{{else}}
+<form method="post" action="/oauth/device">
+<p><label>Code shown on device <input type="text" name="user_code" value="{{.UserCode}}" required></label></p>
+<p><label>Email <input type="email" name="email" value="{{.Email}}" required></label></p>
+<p><label>Password <input type="password" name="password" required></label></p>
+{{if .MFA}}<p><label>Authentication code <input type="text" name="mfa_code" autocomplete="one-time-code"></label></p>{{end}}
+<p><button type="submit" name="action" value="approve">Approve</button>
+<button type="submit" name="action" value="deny">Deny</button></p>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+type devicePageData struct {
+	Client   string
+	UserCode string
+	Email    string
+	Error    string
+	Done     string
+	MFA      bool
+}
+
+func (h *handlers) deviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, http.StatusBadRequest, "invalid_request", "invalid form")
+		return
+	}
+
+	clientID, clientSecret := clientCredentials(r)
+
+	code, err := h.oauth.StartDeviceAuthorization(r.Context(), clientID, clientSecret, r.PostForm.Get("scope"))
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidClient) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="sso"`)
+			writeTokenError(w, http.StatusUnauthorized, "invalid_client", "")
+			return
+		}
+		h.log.Error("failed to start device authorization", sl.Err(err))
+		writeTokenError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, code)
+}
+
+func (h *handlers) deviceForm(w http.ResponseWriter, r *http.Request) {
+	page := devicePageData{UserCode: r.URL.Query().Get("user_code")}
+
+	if page.UserCode != "" {
+		client, err := h.oauth.DeviceClient(r.Context(), page.UserCode)
+		if err == nil {
+			page.Client = client.Name
+		}
+	}
+
+	h.renderDevice(w, http.StatusOK, page)
+}
+
+func (h *handlers) deviceApprove(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	page := devicePageData{
+		UserCode: r.PostForm.Get("user_code"),
+		Email:    r.PostForm.Get("email"),
+	}
+	approve := r.PostForm.Get("action") == "approve"
+
+	err := h.oauth.ApproveDevice(
+		r.Context(),
+		page.UserCode,
+		page.Email,
+		r.PostForm.Get("password"),
+		r.PostForm.Get("mfa_code"),
+		approve,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidUserCode):
+			page.Error = "Unknown or expired code"
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			page.Error = "Invalid email or password"
+		case errors.Is(err, auth.ErrMFARequired):
+			page.MFA = true
+		case errors.Is(err, auth.ErrInvalidMFACode):
+			page.Error = "Invalid authentication code"
+			page.MFA = true
+		case errors.Is(err, auth.ErrTooManyRequests):
+			page.Error = "Too many attempts, try again later"
+		default:
+			h.log.Error("failed to approve device", sl.Err(err))
+			page.Error = "Something went wrong, try again"
+		}
+
+		h.renderDevice(w, http.StatusUnauthorized, page)
+		return
+	}
+
+	page.Done = "Device was denied access, you can close this page."
+	if approve {
+		page.Done = "Device is connected, you can return to it."
+	}
+	h.renderDevice(w, http.StatusOK, page)
+}
+
+func (h *handlers) renderDevice(w http.ResponseWriter, status int, page devicePageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+
+	if err := devicePage.Execute(w, page); err != nil {
+		h.log.Error("failed to render device page", sl.Err(err))
+	}
+}
+
+// deviceTokenError maps device flow errors to RFC 8628 3.5 error codes,
+// returns false for errors not specific to device flow.
+func deviceTokenError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, auth.ErrAuthorizationPending):
+		writeTokenError(w, http.StatusBadRequest, "authorization_pending", "")
+	case errors.Is(err, auth.ErrSlowDown):
+		writeTokenError(w, http.StatusBadRequest, "slow_down", "")
+	case errors.Is(err, auth.ErrAccessDenied):
+		writeTokenError(w, http.StatusBadRequest, "access_denied", "")
+	case errors.Is(err, auth.ErrExpiredToken), errors.Is(err, storage.ErrUserNotFound):
+		writeTokenError(w, http.StatusBadRequest, "expired_token", "")
+	default:
+		return false
+	}
+	return true
+}
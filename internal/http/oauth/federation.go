@@ -0,0 +1,102 @@
+package oauth
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+
+	"SSO/internal/lib/logger/sl"
+	"SSO/internal/services/auth"
+)
+
+var federationMFAPage = template.Must(template.New("federation_mfa").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Confirm sign in</title></head>
+<body>
+<h1>Confirm sign in</h1>
+<form method="post" action="/federation/mfa">
+<input type="hidden" name="challenge" value="{{.}}">
+<p><label>Authentication code <input type="text" name="mfa_code" autocomplete="one-time-code" required></label></p>
+<p><button type="submit">Continue</button></p>
+</form>
+</body>
+</html>
+`))
+
+func (h *handlers) federatedLogin(w http.ResponseWriter, r *http.Request) {
+	req := authorizeRequest(r.URL.Query())
+
+	redirect, err := h.oauth.StartFederatedLogin(r.Context(), r.PathValue("provider"), req)
+	if err != nil {
+		if errors.Is(err, auth.ErrUnknownProvider) {
+			http.Error(w, "unknown identity provider", http.StatusNotFound)
+			return
+		}
+		h.authorizeError(w, r, req, err)
+		return
+	}
+
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// federatedCallback is redirect uri registered at upstream providers.
+func (h *handlers) federatedCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	code := query.Get("code")
+	if query.Get("error") != "" {
+		code = ""
+	}
+
+	req, authCode, err := h.oauth.FinishFederatedLogin(r.Context(), query.Get("state"), code)
+	if err != nil {
+		var mfaRequired *auth.MFARequiredError
+
+		switch {
+		case errors.As(err, &mfaRequired):
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("X-Frame-Options", "DENY")
+			if err := federationMFAPage.Execute(w, mfaRequired.ChallengeToken); err != nil {
+				h.log.Error("failed to render mfa page", sl.Err(err))
+			}
+		case errors.Is(err, auth.ErrInvalidFederationState):
+			http.Error(w, "login session expired, start again", http.StatusBadRequest)
+		case errors.Is(err, auth.ErrInvalidClient), errors.Is(err, auth.ErrInvalidRedirectURI):
+			h.authorizeError(w, r, req, err)
+		case errors.Is(err, auth.ErrAccessDenied), errors.Is(err, auth.ErrUnverifiedEmail):
+			h.redirectError(w, r, req, "access_denied")
+		default:
+			h.log.Error("failed to finish federated login", sl.Err(err))
+			h.redirectError(w, r, req, "server_error")
+		}
+		return
+	}
+
+	h.redirectCode(w, r, req, authCode)
+}
+
+// federatedMFA finishes federated login of user with second factor.
+func (h *handlers) federatedMFA(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	req, authCode, err := h.oauth.FinishFederatedMFA(r.Context(), r.PostForm.Get("challenge"), r.PostForm.Get("mfa_code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidMFAChallenge):
+			http.Error(w, "login session expired, start again", http.StatusBadRequest)
+		case errors.Is(err, auth.ErrInvalidMFACode), errors.Is(err, auth.ErrMFANotEnrolled):
+			http.Error(w, "invalid authentication code, start again", http.StatusUnauthorized)
+		case errors.Is(err, auth.ErrInvalidClient), errors.Is(err, auth.ErrInvalidRedirectURI):
+			h.authorizeError(w, r, req, err)
+		default:
+			h.log.Error("failed to finish federated login", sl.Err(err))
+			h.redirectError(w, r, req, "server_error")
+		}
+		return
+	}
+
+	h.redirectCode(w, r, req, authCode)
+}
@@ -0,0 +1,461 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/logger/sl"
+	"SSO/internal/lib/upstream"
+	"SSO/internal/services/auth"
+	"SSO/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+type OAuth interface {
+	ValidateAuthorizeRequest(
+		ctx context.Context,
+		req models.AuthorizeRequest,
+	) (models.OAuthClient, error)
+
+	Authorize(
+		ctx context.Context,
+		req models.AuthorizeRequest,
+		email string,
+		password string,
+		mfaCode string,
+	) (code string, err error)
+
+	ExchangeAuthorizationCode(
+		ctx context.Context,
+		clientID string,
+		clientSecret string,
+		code string,
+		redirectURI string,
+		codeVerifier string,
+	) (models.Tokens, error)
+
+	RefreshClientToken(
+		ctx context.Context,
+		clientID string,
+		clientSecret string,
+		refreshToken string,
+	) (models.Tokens, error)
+
+	ClientCredentialsToken(
+		ctx context.Context,
+		clientID string,
+		clientSecret string,
+		targetAppUUID uuid.UUID,
+	) (accessToken string, err error)
+
+	StartDeviceAuthorization(
+		ctx context.Context,
+		clientID string,
+		clientSecret string,
+		scope string,
+	) (models.DeviceCode, error)
+
+	DeviceClient(
+		ctx context.Context,
+		userCode string,
+	) (models.OAuthClient, error)
+
+	ApproveDevice(
+		ctx context.Context,
+		userCode string,
+		email string,
+		password string,
+		mfaCode string,
+		approve bool,
+	) error
+
+	PollDeviceToken(
+		ctx context.Context,
+		clientID string,
+		clientSecret string,
+		deviceCode string,
+	) (models.Tokens, error)
+
+	TokenExchange(
+		ctx context.Context,
+		subjectToken string,
+		subjectTokenType string,
+		actorToken string,
+		scope string,
+	) (accessToken string, expiresIn time.Duration, err error)
+
+	FederatedProviders(appUUID uuid.UUID) []*upstream.Provider
+
+	StartFederatedLogin(
+		ctx context.Context,
+		provider string,
+		req models.AuthorizeRequest,
+	) (redirectURL string, err error)
+
+	FinishFederatedLogin(
+		ctx context.Context,
+		state string,
+		code string,
+	) (req models.AuthorizeRequest, authCode string, err error)
+
+	FinishFederatedMFA(
+		ctx context.Context,
+		challengeToken string,
+		code string,
+	) (req models.AuthorizeRequest, authCode string, err error)
+
+	AccessTTL() time.Duration
+}
+
+type handlers struct {
+	oauth OAuth
+	log   *slog.Logger
+}
+
+func Register(mux *http.ServeMux, oauth OAuth, log *slog.Logger) {
+	h := &handlers{oauth: oauth, log: log}
+
+	mux.HandleFunc("GET /oauth/authorize", h.authorizeForm)
+	mux.HandleFunc("POST /oauth/authorize", h.authorize)
+	mux.HandleFunc("POST /oauth/token", h.token)
+	mux.HandleFunc("POST /oauth/device_authorization", h.deviceAuthorization)
+	mux.HandleFunc("GET /oauth/device", h.deviceForm)
+	mux.HandleFunc("POST /oauth/device", h.deviceApprove)
+	mux.HandleFunc("GET /federation/login/{provider}", h.federatedLogin)
+	mux.HandleFunc("GET /federation/callback", h.federatedCallback)
+	mux.HandleFunc("POST /federation/mfa", h.federatedMFA)
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in to {{.Client}}</title></head>
+<body>
+<h1>Sign in to {{.Client}}</h1>
+{{if .Error}}<p style="color:red">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/authorize">
+<input type="hidden" name="client_id" value="{{.Req.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Req.RedirectURI}}">
+<input type="hidden" name="response_type" value="{{.Req.ResponseType}}">
+<input type="hidden" name="scope" value="{{.Req.Scope}}">
+<input type="hidden" name="state" value="{{.Req.State}}">
+<input type="hidden" name="code_challenge" value="{{.Req.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Req.CodeChallengeMethod}}">
+<input type="hidden" name="nonce" value="{{.Req.Nonce}}">
+<p><label>Email <input type="email" name="email" value="{{.Email}}" required></label></p>
+<p><label>Password <input type="password" name="password" required></label></p>
+{{if .MFA}}<p><label>Authentication code <input type="text" name="mfa_code" autocomplete="one-time-code"></label></p>{{end}}
+<p><button type="submit">Sign in</button></p>
+</form>
+{{range .Providers}}<p><a href="{{.URL}}">Sign in with {{.Name}}</a></p>
+{{end}}</body>
+</html>
+`))
+
+type loginPageData struct {
+	Client    string
+	Req       models.AuthorizeRequest
+	Email     string
+	Error     string
+	MFA       bool
+	Providers []providerLink
+}
+
+type providerLink struct {
+	Name string
+	URL  string
+}
+
+func authorizeRequest(values url.Values) models.AuthorizeRequest {
+	return models.AuthorizeRequest{
+		ClientID:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		ResponseType:        values.Get("response_type"),
+		Scope:               values.Get("scope"),
+		State:               values.Get("state"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+		Nonce:               values.Get("nonce"),
+	}
+}
+
+func (h *handlers) authorizeForm(w http.ResponseWriter, r *http.Request) {
+	req := authorizeRequest(r.URL.Query())
+
+	client, err := h.oauth.ValidateAuthorizeRequest(r.Context(), req)
+	if err != nil {
+		h.authorizeError(w, r, req, err)
+		return
+	}
+
+	h.renderLogin(w, h.newLoginPage(client, req))
+}
+
+// newLoginPage offers upstream identity providers of client app next to
+// password form, they get the same authorization request.
+func (h *handlers) newLoginPage(client models.OAuthClient, req models.AuthorizeRequest) loginPageData {
+	page := loginPageData{Client: client.Name, Req: req}
+
+	query := authorizeQuery(req).Encode()
+	for _, provider := range h.oauth.FederatedProviders(client.AppUUID) {
+		page.Providers = append(page.Providers, providerLink{
+			Name: provider.DisplayName(),
+			URL:  "/federation/login/" + url.PathEscape(provider.Name()) + "?" + query,
+		})
+	}
+
+	return page
+}
+
+func authorizeQuery(req models.AuthorizeRequest) url.Values {
+	return url.Values{
+		"client_id":             {req.ClientID},
+		"redirect_uri":          {req.RedirectURI},
+		"response_type":         {req.ResponseType},
+		"scope":                 {req.Scope},
+		"state":                 {req.State},
+		"code_challenge":        {req.CodeChallenge},
+		"code_challenge_method": {req.CodeChallengeMethod},
+		"nonce":                 {req.Nonce},
+	}
+}
+
+func (h *handlers) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	req := authorizeRequest(r.PostForm)
+
+	client, err := h.oauth.ValidateAuthorizeRequest(r.Context(), req)
+	if err != nil {
+		h.authorizeError(w, r, req, err)
+		return
+	}
+
+	email := r.PostForm.Get("email")
+
+	code, err := h.oauth.Authorize(r.Context(), req, email, r.PostForm.Get("password"), r.PostForm.Get("mfa_code"))
+	if err != nil {
+		page := h.newLoginPage(client, req)
+		page.Email = email
+
+		switch {
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			page.Error = "Invalid email or password"
+		case errors.Is(err, auth.ErrMFARequired):
+			page.MFA = true
+		case errors.Is(err, auth.ErrInvalidMFACode):
+			page.Error = "Invalid authentication code"
+			page.MFA = true
+		case errors.Is(err, auth.ErrTooManyRequests):
+			page.Error = "Too many attempts, try again later"
+		default:
+			h.log.Error("failed to authorize", sl.Err(err))
+			h.redirectError(w, r, req, "server_error")
+			return
+		}
+
+		w.WriteHeader(http.StatusUnauthorized)
+		h.renderLogin(w, page)
+		return
+	}
+
+	h.redirectCode(w, r, req, code)
+}
+
+func (h *handlers) redirectCode(w http.ResponseWriter, r *http.Request, req models.AuthorizeRequest, code string) {
+	redirect, _ := url.Parse(req.RedirectURI)
+	query := redirect.Query()
+	query.Set("code", code)
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	redirect.RawQuery = query.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// authorizeError shows error to user when client or redirect uri can not be
+// trusted, otherwise sends it back to client (RFC 6749 4.1.2.1).
+func (h *handlers) authorizeError(w http.ResponseWriter, r *http.Request, req models.AuthorizeRequest, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidClient):
+		http.Error(w, "unknown client", http.StatusBadRequest)
+	case errors.Is(err, auth.ErrInvalidRedirectURI):
+		http.Error(w, "redirect uri is not registered for client", http.StatusBadRequest)
+	case errors.Is(err, auth.ErrUnsupportedResponseType):
+		h.redirectError(w, r, req, "unsupported_response_type")
+	case errors.Is(err, auth.ErrInvalidOAuthRequest):
+		h.redirectError(w, r, req, "invalid_request")
+	default:
+		h.log.Error("failed to validate authorize request", sl.Err(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+func (h *handlers) redirectError(w http.ResponseWriter, r *http.Request, req models.AuthorizeRequest, code string) {
+	redirect, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect uri", http.StatusBadRequest)
+		return
+	}
+
+	query := redirect.Query()
+	query.Set("error", code)
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	redirect.RawQuery = query.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (h *handlers) renderLogin(w http.ResponseWriter, page loginPageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+
+	if err := loginPage.Execute(w, page); err != nil {
+		h.log.Error("failed to render login page", sl.Err(err))
+	}
+}
+
+const grantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+type tokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+	IDToken         string `json:"id_token,omitempty"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int    `json:"expires_in"`
+}
+
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// clientCredentials returns client of HTTP Basic auth or of form, form must
+// be parsed.
+func clientCredentials(r *http.Request) (clientID string, clientSecret string) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+	return clientID, clientSecret
+}
+
+func (h *handlers) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, http.StatusBadRequest, "invalid_request", "invalid form")
+		return
+	}
+
+	clientID, clientSecret := clientCredentials(r)
+
+	var (
+		tokens          models.Tokens
+		issuedTokenType string
+		err             error
+	)
+	expiresIn := h.oauth.AccessTTL()
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		tokens, err = h.oauth.ExchangeAuthorizationCode(
+			r.Context(),
+			clientID,
+			clientSecret,
+			r.PostForm.Get("code"),
+			r.PostForm.Get("redirect_uri"),
+			r.PostForm.Get("code_verifier"),
+		)
+	case "refresh_token":
+		tokens, err = h.oauth.RefreshClientToken(r.Context(), clientID, clientSecret, r.PostForm.Get("refresh_token"))
+	case "client_credentials":
+		// audience is uuid of target app, empty means app of service account
+		targetAppUUID := uuid.Nil
+		if audience := r.PostForm.Get("audience"); audience != "" {
+			targetAppUUID, err = uuid.Parse(audience)
+			if err != nil {
+				writeTokenError(w, http.StatusBadRequest, "invalid_request", "invalid audience")
+				return
+			}
+		}
+		tokens.AccessToken, err = h.oauth.ClientCredentialsToken(r.Context(), clientID, clientSecret, targetAppUUID)
+	case grantTypeDeviceCode:
+		tokens, err = h.oauth.PollDeviceToken(r.Context(), clientID, clientSecret, r.PostForm.Get("device_code"))
+	case grantTypeTokenExchange:
+		tokens.AccessToken, expiresIn, err = h.oauth.TokenExchange(
+			r.Context(),
+			r.PostForm.Get("subject_token"),
+			r.PostForm.Get("subject_token_type"),
+			r.PostForm.Get("actor_token"),
+			r.PostForm.Get("scope"),
+		)
+		issuedTokenType = auth.TokenTypeAccessToken
+	default:
+		writeTokenError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+
+	if err != nil {
+		if deviceTokenError(w, err) {
+			return
+		}
+
+		switch {
+		case errors.Is(err, auth.ErrInvalidClient):
+			w.Header().Set("WWW-Authenticate", `Basic realm="sso"`)
+			writeTokenError(w, http.StatusUnauthorized, "invalid_client", "")
+		case errors.Is(err, auth.ErrInvalidGrant),
+			errors.Is(err, auth.ErrInvalidRefreshToken),
+			errors.Is(err, auth.ErrUserDisabled),
+			errors.Is(err, storage.ErrUserNotFound):
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "")
+		case errors.Is(err, auth.ErrInvalidOAuthRequest):
+			writeTokenError(w, http.StatusBadRequest, "invalid_request", "")
+		case errors.Is(err, auth.ErrInvalidTarget):
+			writeTokenError(w, http.StatusBadRequest, "invalid_target", "")
+		case errors.Is(err, auth.ErrInsufficientScope):
+			writeTokenError(w, http.StatusBadRequest, "invalid_scope", "")
+		case errors.Is(err, auth.ErrExchangeNotAllowed):
+			writeTokenError(w, http.StatusForbidden, "unauthorized_client", "")
+		case errors.Is(err, auth.ErrTooManyRequests):
+			writeTokenError(w, http.StatusTooManyRequests, "temporarily_unavailable", "")
+		default:
+			h.log.Error("failed to issue token", sl.Err(err))
+			writeTokenError(w, http.StatusInternalServerError, "server_error", "")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken:     tokens.AccessToken,
+		RefreshToken:    tokens.RefreshToken,
+		IDToken:         tokens.IDToken,
+		IssuedTokenType: issuedTokenType,
+		TokenType:       "Bearer",
+		ExpiresIn:       int(expiresIn.Seconds()),
+	})
+}
+
+func writeTokenError(w http.ResponseWriter, status int, code string, description string) {
+	writeJSON(w, status, errorResponse{Error: code, ErrorDescription: description})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
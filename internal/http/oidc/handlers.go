@@ -0,0 +1,113 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"SSO/internal/lib/jwtLib"
+	"SSO/internal/lib/logger/sl"
+	"SSO/internal/services/auth"
+	"SSO/internal/storage"
+)
+
+type OIDC interface {
+	Issuer() string
+	JWKS() jwtLib.JWKS
+	UserInfo(
+		ctx context.Context,
+		accessToken string,
+	) (map[string]any, error)
+}
+
+type handlers struct {
+	oidc OIDC
+	log  *slog.Logger
+}
+
+func Register(mux *http.ServeMux, oidc OIDC, log *slog.Logger) {
+	h := &handlers{oidc: oidc, log: log}
+
+	mux.HandleFunc("GET /.well-known/openid-configuration", h.discovery)
+	mux.HandleFunc("GET /.well-known/jwks.json", h.jwks)
+	mux.HandleFunc("GET /oauth/userinfo", h.userInfo)
+	mux.HandleFunc("POST /oauth/userinfo", h.userInfo)
+}
+
+type discoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+func (h *handlers) discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := strings.TrimSuffix(h.oidc.Issuer(), "/")
+
+	writeJSON(w, http.StatusOK, discoveryDocument{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/oauth/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		DeviceAuthorizationEndpoint:       issuer + "/oauth/device_authorization",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials", "urn:ietf:params:oauth:grant-type:device_code", "urn:ietf:params:oauth:grant-type:token-exchange"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		ScopesSupported:                   auth.SupportedScopes,
+		ClaimsSupported:                   auth.SupportedClaims,
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+	})
+}
+
+func (h *handlers) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.oidc.JWKS())
+}
+
+func (h *handlers) userInfo(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="sso"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	info, err := h.oidc.UserInfo(r.Context(), token)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidAccessToken), errors.Is(err, storage.ErrUserNotFound):
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sso", error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		case errors.Is(err, auth.ErrInsufficientScope):
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sso", error="insufficient_scope"`)
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			h.log.Error("failed to get userinfo", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, info)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
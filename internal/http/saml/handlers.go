@@ -0,0 +1,217 @@
+package saml
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/logger/sl"
+	samllib "SSO/internal/lib/saml"
+	"SSO/internal/services/auth"
+)
+
+type SAML interface {
+	SAMLMetadata() ([]byte, error)
+
+	ValidateSAMLRequest(
+		ctx context.Context,
+		samlRequest string,
+		deflated bool,
+	) (models.SAMLServiceProvider, samllib.AuthnRequest, error)
+
+	SAMLLogin(
+		ctx context.Context,
+		samlRequest string,
+		deflated bool,
+		email string,
+		password string,
+		mfaCode string,
+	) (acsURL string, samlResponse string, err error)
+}
+
+type handlers struct {
+	saml SAML
+	log  *slog.Logger
+}
+
+func Register(mux *http.ServeMux, saml SAML, log *slog.Logger) {
+	h := &handlers{saml: saml, log: log}
+
+	mux.HandleFunc("GET /saml/metadata", h.metadata)
+	mux.HandleFunc("GET /saml/sso", h.ssoRedirect)
+	mux.HandleFunc("POST /saml/sso", h.ssoPost)
+	mux.HandleFunc("POST /saml/login", h.login)
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in to {{.ServiceProvider}}</title></head>
+<body>
+<h1>Sign in to {{.ServiceProvider}}</h1>
+{{if .Error}}<p style="color:red">{{.Error}}</p>{{end}}
+<form method="post" action="/saml/login">
+<input type="hidden" name="SAMLRequest" value="{{.SAMLRequest}}">
+<input type="hidden" name="RelayState" value="{{.RelayState}}">
+{{if .Deflated}}<input type="hidden" name="deflated" value="true">{{end}}
+<p><label>Email <input type="email" name="email" value="{{.Email}}" required></label></p>
+<p><label>Password <input type="password" name="password" required></label></p>
+{{if .MFA}}<p><label>Authentication code <input type="text" name="mfa_code" autocomplete="one-time-code"></label></p>{{end}}
+<p><button type="submit">Sign in</button></p>
+</form>
+</body>
+</html>
+`))
+
+// postPage sends response to assertion consumer service by HTTP-POST binding.
+var postPage = template.Must(template.New("post").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Signing in</title></head>
+<body onload="document.forms[0].submit()">
+<form method="post" action="{{.ACSURL}}">
+<input type="hidden" name="SAMLResponse" value="{{.SAMLResponse}}">
+{{if .RelayState}}<input type="hidden" name="RelayState" value="{{.RelayState}}">{{end}}
+<noscript><button type="submit">Continue</button></noscript>
+</form>
+</body>
+</html>
+`))
+
+type loginPageData struct {
+	ServiceProvider string
+	SAMLRequest     string
+	RelayState      string
+	Deflated        bool
+	Email           string
+	Error           string
+	MFA             bool
+}
+
+type postPageData struct {
+	ACSURL       string
+	SAMLResponse string
+	RelayState   string
+}
+
+func (h *handlers) metadata(w http.ResponseWriter, r *http.Request) {
+	metadata, err := h.saml.SAMLMetadata()
+	if err != nil {
+		h.log.Error("failed to build saml metadata", sl.Err(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	_, _ = w.Write(metadata)
+}
+
+// ssoRedirect is HTTP-Redirect binding, request is deflated.
+func (h *handlers) ssoRedirect(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	h.sso(w, r, query.Get("SAMLRequest"), query.Get("RelayState"), true)
+}
+
+func (h *handlers) ssoPost(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	h.sso(w, r, r.PostForm.Get("SAMLRequest"), r.PostForm.Get("RelayState"), false)
+}
+
+func (h *handlers) sso(w http.ResponseWriter, r *http.Request, samlRequest string, relayState string, deflated bool) {
+	sp, _, err := h.saml.ValidateSAMLRequest(r.Context(), samlRequest, deflated)
+	if err != nil {
+		h.requestError(w, err)
+		return
+	}
+
+	h.renderLogin(w, http.StatusOK, loginPageData{
+		ServiceProvider: sp.EntityID,
+		SAMLRequest:     samlRequest,
+		RelayState:      relayState,
+		Deflated:        deflated,
+	})
+}
+
+func (h *handlers) login(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	page := loginPageData{
+		SAMLRequest: r.PostForm.Get("SAMLRequest"),
+		RelayState:  r.PostForm.Get("RelayState"),
+		Deflated:    r.PostForm.Get("deflated") == "true",
+		Email:       r.PostForm.Get("email"),
+	}
+
+	sp, _, err := h.saml.ValidateSAMLRequest(r.Context(), page.SAMLRequest, page.Deflated)
+	if err != nil {
+		h.requestError(w, err)
+		return
+	}
+	page.ServiceProvider = sp.EntityID
+
+	acsURL, response, err := h.saml.SAMLLogin(
+		r.Context(),
+		page.SAMLRequest,
+		page.Deflated,
+		page.Email,
+		r.PostForm.Get("password"),
+		r.PostForm.Get("mfa_code"),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			page.Error = "Invalid email or password"
+		case errors.Is(err, auth.ErrMFARequired):
+			page.MFA = true
+		case errors.Is(err, auth.ErrInvalidMFACode):
+			page.Error = "Invalid authentication code"
+			page.MFA = true
+		case errors.Is(err, auth.ErrTooManyRequests):
+			page.Error = "Too many attempts, try again later"
+		default:
+			h.log.Error("failed to issue saml assertion", sl.Err(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		h.renderLogin(w, http.StatusUnauthorized, page)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := postPage.Execute(w, postPageData{ACSURL: acsURL, SAMLResponse: response, RelayState: page.RelayState}); err != nil {
+		h.log.Error("failed to render saml post page", sl.Err(err))
+	}
+}
+
+func (h *handlers) requestError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidSAMLRequest):
+		http.Error(w, "invalid saml request", http.StatusBadRequest)
+	case errors.Is(err, auth.ErrUnknownServiceProvider):
+		http.Error(w, "unknown service provider", http.StatusBadRequest)
+	default:
+		h.log.Error("failed to validate saml request", sl.Err(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+func (h *handlers) renderLogin(w http.ResponseWriter, status int, page loginPageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+
+	if err := loginPage.Execute(w, page); err != nil {
+		h.log.Error("failed to render login page", sl.Err(err))
+	}
+}
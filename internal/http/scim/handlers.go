@@ -0,0 +1,344 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"SSO/internal/lib/logger/sl"
+	scimlib "SSO/internal/lib/scim"
+	"SSO/internal/services/auth"
+	"SSO/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+type SCIM interface {
+	AuthorizeSCIM(ctx context.Context, accessToken string, adminApp uuid.UUID) (auth.SCIMScope, error)
+
+	SCIMUsers(ctx context.Context, scope auth.SCIMScope, filter string, startIndex int, count int) (scimlib.ListResponse, error)
+	SCIMUser(ctx context.Context, scope auth.SCIMScope, id string) (scimlib.User, error)
+	CreateSCIMUser(ctx context.Context, scope auth.SCIMScope, user scimlib.User) (scimlib.User, error)
+	ReplaceSCIMUser(ctx context.Context, scope auth.SCIMScope, id string, user scimlib.User) (scimlib.User, error)
+	PatchSCIMUser(ctx context.Context, scope auth.SCIMScope, id string, ops []scimlib.PatchOperation) (scimlib.User, error)
+	DeleteSCIMUser(ctx context.Context, scope auth.SCIMScope, id string) error
+
+	SCIMGroups(ctx context.Context, appUUID uuid.UUID, filter string, startIndex int, count int, withMembers bool) (scimlib.ListResponse, error)
+	SCIMGroup(ctx context.Context, appUUID uuid.UUID, id string) (scimlib.Group, error)
+	CreateSCIMGroup(ctx context.Context, appUUID uuid.UUID, group scimlib.Group) (scimlib.Group, error)
+	ReplaceSCIMGroup(ctx context.Context, appUUID uuid.UUID, id string, group scimlib.Group) (scimlib.Group, error)
+	PatchSCIMGroup(ctx context.Context, appUUID uuid.UUID, id string, ops []scimlib.PatchOperation) (scimlib.Group, error)
+	DeleteSCIMGroup(ctx context.Context, appUUID uuid.UUID, id string) error
+}
+
+type handlers struct {
+	scim     SCIM
+	adminApp uuid.UUID
+	log      *slog.Logger
+}
+
+type scopeHandler func(w http.ResponseWriter, r *http.Request, scope auth.SCIMScope)
+
+// Register mounts SCIM 2.0 service provider under /scim/v2. Clients use
+// bearer access token with auth.SCIMPermission in their app, clients of
+// adminApp with auth.SCIMGlobalPermission manage every user.
+func Register(mux *http.ServeMux, scim SCIM, adminApp uuid.UUID, log *slog.Logger) {
+	h := &handlers{scim: scim, adminApp: adminApp, log: log}
+
+	mux.HandleFunc("GET /scim/v2/ServiceProviderConfig", h.serviceProviderConfig)
+	mux.HandleFunc("GET /scim/v2/ResourceTypes", h.resourceTypes)
+
+	mux.HandleFunc("GET /scim/v2/Users", h.authorized(h.listUsers))
+	mux.HandleFunc("POST /scim/v2/Users", h.authorized(h.createUser))
+	mux.HandleFunc("GET /scim/v2/Users/{id}", h.authorized(h.getUser))
+	mux.HandleFunc("PUT /scim/v2/Users/{id}", h.authorized(h.replaceUser))
+	mux.HandleFunc("PATCH /scim/v2/Users/{id}", h.authorized(h.patchUser))
+	mux.HandleFunc("DELETE /scim/v2/Users/{id}", h.authorized(h.deleteUser))
+
+	mux.HandleFunc("GET /scim/v2/Groups", h.authorized(h.listGroups))
+	mux.HandleFunc("POST /scim/v2/Groups", h.authorized(h.createGroup))
+	mux.HandleFunc("GET /scim/v2/Groups/{id}", h.authorized(h.getGroup))
+	mux.HandleFunc("PUT /scim/v2/Groups/{id}", h.authorized(h.replaceGroup))
+	mux.HandleFunc("PATCH /scim/v2/Groups/{id}", h.authorized(h.patchGroup))
+	mux.HandleFunc("DELETE /scim/v2/Groups/{id}", h.authorized(h.deleteGroup))
+}
+
+func (h *handlers) authorized(next scopeHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sso"`)
+			writeError(w, http.StatusUnauthorized, "", "bearer token required")
+			return
+		}
+
+		scope, err := h.scim.AuthorizeSCIM(r.Context(), token, h.adminApp)
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrInvalidAccessToken), errors.Is(err, storage.ErrUserNotFound):
+				w.Header().Set("WWW-Authenticate", `Bearer realm="sso", error="invalid_token"`)
+				writeError(w, http.StatusUnauthorized, "", "invalid token")
+			case errors.Is(err, auth.ErrSCIMNotAllowed):
+				writeError(w, http.StatusForbidden, "", "scim permission required")
+			default:
+				h.log.Error("failed to authorize scim client", sl.Err(err))
+				writeError(w, http.StatusInternalServerError, "", "internal error")
+			}
+			return
+		}
+
+		next(w, r, scope)
+	}
+}
+
+func (h *handlers) listUsers(w http.ResponseWriter, r *http.Request, scope auth.SCIMScope) {
+	startIndex, count := pagination(r)
+
+	list, err := h.scim.SCIMUsers(r.Context(), scope, r.URL.Query().Get("filter"), startIndex, count)
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	writeSCIM(w, http.StatusOK, list)
+}
+
+func (h *handlers) getUser(w http.ResponseWriter, r *http.Request, scope auth.SCIMScope) {
+	user, err := h.scim.SCIMUser(r.Context(), scope, r.PathValue("id"))
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	writeSCIM(w, http.StatusOK, user)
+}
+
+func (h *handlers) createUser(w http.ResponseWriter, r *http.Request, scope auth.SCIMScope) {
+	var in scimlib.User
+	if !readJSON(w, r, &in) {
+		return
+	}
+
+	user, err := h.scim.CreateSCIMUser(r.Context(), scope, in)
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	w.Header().Set("Location", user.Meta.Location)
+	writeSCIM(w, http.StatusCreated, user)
+}
+
+func (h *handlers) replaceUser(w http.ResponseWriter, r *http.Request, scope auth.SCIMScope) {
+	var in scimlib.User
+	if !readJSON(w, r, &in) {
+		return
+	}
+
+	user, err := h.scim.ReplaceSCIMUser(r.Context(), scope, r.PathValue("id"), in)
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	writeSCIM(w, http.StatusOK, user)
+}
+
+func (h *handlers) patchUser(w http.ResponseWriter, r *http.Request, scope auth.SCIMScope) {
+	var in scimlib.PatchRequest
+	if !readJSON(w, r, &in) {
+		return
+	}
+
+	user, err := h.scim.PatchSCIMUser(r.Context(), scope, r.PathValue("id"), in.Operations)
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	writeSCIM(w, http.StatusOK, user)
+}
+
+func (h *handlers) deleteUser(w http.ResponseWriter, r *http.Request, scope auth.SCIMScope) {
+	if err := h.scim.DeleteSCIMUser(r.Context(), scope, r.PathValue("id")); err != nil {
+		h.error(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) listGroups(w http.ResponseWriter, r *http.Request, scope auth.SCIMScope) {
+	startIndex, count := pagination(r)
+
+	// Azure AD asks groups without members to keep responses small
+	withMembers := !strings.Contains(strings.ToLower(r.URL.Query().Get("excludedAttributes")), "members")
+
+	list, err := h.scim.SCIMGroups(r.Context(), scope.AppUUID, r.URL.Query().Get("filter"), startIndex, count, withMembers)
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	writeSCIM(w, http.StatusOK, list)
+}
+
+func (h *handlers) getGroup(w http.ResponseWriter, r *http.Request, scope auth.SCIMScope) {
+	group, err := h.scim.SCIMGroup(r.Context(), scope.AppUUID, r.PathValue("id"))
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	writeSCIM(w, http.StatusOK, group)
+}
+
+func (h *handlers) createGroup(w http.ResponseWriter, r *http.Request, scope auth.SCIMScope) {
+	var in scimlib.Group
+	if !readJSON(w, r, &in) {
+		return
+	}
+
+	group, err := h.scim.CreateSCIMGroup(r.Context(), scope.AppUUID, in)
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	w.Header().Set("Location", group.Meta.Location)
+	writeSCIM(w, http.StatusCreated, group)
+}
+
+func (h *handlers) replaceGroup(w http.ResponseWriter, r *http.Request, scope auth.SCIMScope) {
+	var in scimlib.Group
+	if !readJSON(w, r, &in) {
+		return
+	}
+
+	group, err := h.scim.ReplaceSCIMGroup(r.Context(), scope.AppUUID, r.PathValue("id"), in)
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	writeSCIM(w, http.StatusOK, group)
+}
+
+func (h *handlers) patchGroup(w http.ResponseWriter, r *http.Request, scope auth.SCIMScope) {
+	var in scimlib.PatchRequest
+	if !readJSON(w, r, &in) {
+		return
+	}
+
+	group, err := h.scim.PatchSCIMGroup(r.Context(), scope.AppUUID, r.PathValue("id"), in.Operations)
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	writeSCIM(w, http.StatusOK, group)
+}
+
+func (h *handlers) deleteGroup(w http.ResponseWriter, r *http.Request, scope auth.SCIMScope) {
+	if err := h.scim.DeleteSCIMGroup(r.Context(), scope.AppUUID, r.PathValue("id")); err != nil {
+		h.error(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) serviceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	supported := func(ok bool) map[string]bool { return map[string]bool{"supported": ok} }
+
+	writeSCIM(w, http.StatusOK, map[string]any{
+		"schemas":        []string{scimlib.SchemaServiceConfig},
+		"patch":          supported(true),
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": scimlib.MaxCount},
+		"changePassword": supported(true),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Access token of service account with scim permission",
+		}},
+	})
+}
+
+func (h *handlers) resourceTypes(w http.ResponseWriter, r *http.Request) {
+	resourceType := func(name string, endpoint string, schema string) map[string]any {
+		return map[string]any{
+			"schemas":  []string{scimlib.SchemaResourceType},
+			"id":       name,
+			"name":     name,
+			"endpoint": endpoint,
+			"schema":   schema,
+		}
+	}
+
+	writeSCIM(w, http.StatusOK, scimlib.NewListResponse([]map[string]any{
+		resourceType("User", "/Users", scimlib.SchemaUser),
+		resourceType("Group", "/Groups", scimlib.SchemaGroup),
+	}, 1, scimlib.MaxCount))
+}
+
+func (h *handlers) error(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, scimlib.ErrInvalidFilter):
+		writeError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+	case errors.Is(err, auth.ErrInvalidSCIMRequest):
+		writeError(w, http.StatusBadRequest, "invalidValue", err.Error())
+	case errors.Is(err, auth.ErrSCIMMutability):
+		writeError(w, http.StatusBadRequest, "mutability", err.Error())
+	case errors.Is(err, auth.ErrSCIMGlobalRequired), errors.Is(err, auth.ErrSCIMReservedGroup):
+		writeError(w, http.StatusForbidden, "", err.Error())
+	case errors.Is(err, storage.ErrUserExists), errors.Is(err, storage.ErrEmailTaken), errors.Is(err, storage.ErrPermExists):
+		writeError(w, http.StatusConflict, "uniqueness", err.Error())
+	case errors.Is(err, storage.ErrUserNotFound), errors.Is(err, storage.ErrPermNotFound):
+		writeError(w, http.StatusNotFound, "", "resource not found")
+	default:
+		h.log.Error("failed to handle scim request", sl.Err(err))
+		writeError(w, http.StatusInternalServerError, "", "internal error")
+	}
+}
+
+// pagination reads 1-based startIndex and count, count is capped by MaxCount.
+func pagination(r *http.Request) (startIndex int, count int) {
+	query := r.URL.Query()
+
+	startIndex, err := strconv.Atoi(query.Get("startIndex"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+
+	count, err = strconv.Atoi(query.Get("count"))
+	if err != nil || count < 0 {
+		count = scimlib.DefaultCount
+	}
+
+	return startIndex, min(count, scimlib.MaxCount)
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", "invalid json body")
+		return false
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, status int, scimType string, detail string) {
+	writeSCIM(w, status, scimlib.NewError(status, scimType, detail))
+}
+
+func writeSCIM(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", scimlib.ContentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
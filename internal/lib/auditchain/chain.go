@@ -0,0 +1,135 @@
+package auditchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/jwtLib"
+	"SSO/internal/lib/logger/sl"
+	"SSO/internal/storage"
+)
+
+// maxAppendAttempts bounds retries when other instance appended to chain
+// between reading head and saving event.
+const maxAppendAttempts = 10
+
+type Storage interface {
+	// SaveAuditEvent returns storage.ErrAuditSeqTaken when event with the
+	// same Seq exists, seq must be unique to keep chain linear.
+	SaveAuditEvent(ctx context.Context, event models.AuditEvent) error
+	AuditEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error)
+	// LastAuditEvent returns event with the greatest Seq or
+	// storage.ErrAuditEventNotFound when log is empty.
+	LastAuditEvent(ctx context.Context) (models.AuditEvent, error)
+	SaveAuditCheckpoint(ctx context.Context, checkpoint models.AuditCheckpoint) error
+}
+
+// Chain links events before saving them to storage and signs checkpoint
+// every checkpointEvery events, 0 disables checkpoints.
+type Chain struct {
+	storage         Storage
+	key             *jwtLib.SigningKey
+	checkpointEvery int64
+	log             *slog.Logger
+
+	mu sync.Mutex
+	// head is last appended event, it is read from storage when unknown.
+	head      models.AuditEvent
+	headKnown bool
+}
+
+func New(storage Storage, key *jwtLib.SigningKey, checkpointEvery int, log *slog.Logger) *Chain {
+	return &Chain{
+		storage:         storage,
+		key:             key,
+		checkpointEvery: int64(checkpointEvery),
+		log:             log,
+	}
+}
+
+// SaveAuditEvent appends event to chain. Seq, PrevHash and Hash are set
+// here, whatever caller put into them is overwritten. Appends of this
+// process are serialized, retry on taken Seq only resolves conflicts with
+// other instances.
+func (c *Chain) SaveAuditEvent(ctx context.Context, event models.AuditEvent) error {
+	const op = "auditchain.SaveAuditEvent"
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	event.Time = event.Time.UTC().Truncate(TimePrecision)
+
+	for attempt := 1; ; attempt++ {
+		if !c.headKnown {
+			if err := c.loadHead(ctx); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		event.Seq = c.head.Seq + 1
+		event.PrevHash = c.head.Hash
+		event.Hash = Hash(event)
+
+		err := c.storage.SaveAuditEvent(ctx, event)
+		if err == nil {
+			break
+		}
+
+		// head may be stale or event may be saved despite error
+		c.headKnown = false
+
+		if !errors.Is(err, storage.ErrAuditSeqTaken) || attempt == maxAppendAttempts {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	c.head = event
+
+	if c.checkpointEvery > 0 && event.Seq%c.checkpointEvery == 0 {
+		c.checkpoint(ctx, event)
+	}
+
+	return nil
+}
+
+func (c *Chain) AuditEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	return c.storage.AuditEvents(ctx, filter)
+}
+
+func (c *Chain) loadHead(ctx context.Context) error {
+	head, err := c.storage.LastAuditEvent(ctx)
+	switch {
+	case errors.Is(err, storage.ErrAuditEventNotFound):
+		head = models.AuditEvent{}
+	case err != nil:
+		return err
+	}
+
+	c.head = head
+	c.headKnown = true
+	return nil
+}
+
+// checkpoint signs event hash. Missing checkpoint only weakens protection
+// of recent events, so failure is logged and event stays saved.
+func (c *Chain) checkpoint(ctx context.Context, event models.AuditEvent) {
+	checkpoint := models.AuditCheckpoint{
+		Seq:       event.Seq,
+		EventUUID: event.UUID,
+		Hash:      event.Hash,
+		Time:      time.Now().UTC().Truncate(TimePrecision),
+	}
+
+	err := Sign(c.key, &checkpoint)
+	if err == nil {
+		err = c.storage.SaveAuditCheckpoint(ctx, checkpoint)
+	}
+	if err != nil {
+		c.log.Error("failed to save audit checkpoint", slog.Int64("seq", event.Seq), sl.Err(err))
+	}
+}
@@ -0,0 +1,129 @@
+package auditchain
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/jwtLib"
+	"SSO/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// memoryStorage keeps seq unique like audit_events table does.
+type memoryStorage struct {
+	mu sync.Mutex
+	memorySource
+}
+
+func (s *memoryStorage) SaveAuditEvent(_ context.Context, event models.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, saved := range s.events {
+		if saved.Seq == event.Seq {
+			return storage.ErrAuditSeqTaken
+		}
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *memoryStorage) AuditEvents(context.Context, models.AuditFilter) ([]models.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]models.AuditEvent(nil), s.events...), nil
+}
+
+func (s *memoryStorage) LastAuditEvent(context.Context) (models.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var last models.AuditEvent
+	for _, event := range s.events {
+		if event.Seq > last.Seq {
+			last = event
+		}
+	}
+	if last.Seq == 0 {
+		return models.AuditEvent{}, storage.ErrAuditEventNotFound
+	}
+	return last, nil
+}
+
+func (s *memoryStorage) SaveAuditCheckpoint(_ context.Context, checkpoint models.AuditCheckpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoints = append(s.checkpoints, checkpoint)
+	return nil
+}
+
+func TestChainConcurrentAppends(t *testing.T) {
+	key, err := jwtLib.GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey() error = %v", err)
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	const appends = 50
+	tests := []struct {
+		name      string
+		instances int
+	}{
+		{name: "one instance", instances: 1},
+		// instances share storage, conflicts between them are retried
+		{name: "two instances", instances: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryStorage{}
+			chains := make([]*Chain, tt.instances)
+			for i := range chains {
+				chains[i] = New(store, key, 10, log)
+			}
+
+			var wg sync.WaitGroup
+			errs := make(chan error, appends)
+			for i := range appends {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs <- chains[i%len(chains)].SaveAuditEvent(context.Background(), models.AuditEvent{
+						UUID:    uuid.New(),
+						Time:    time.Now(),
+						Subject: "user@example.com",
+						Action:  models.AuditLogin,
+						Outcome: models.AuditSuccess,
+					})
+				}()
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				if err != nil {
+					t.Errorf("SaveAuditEvent() error = %v", err)
+				}
+			}
+			if len(store.events) != appends {
+				t.Fatalf("saved %d events, want %d", len(store.events), appends)
+			}
+
+			report, err := Verify(context.Background(), &store.memorySource, key.JWKS(), 0)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if report.Broken != nil {
+				t.Fatalf("Verify() broken = %+v, want intact", *report.Broken)
+			}
+		})
+	}
+}
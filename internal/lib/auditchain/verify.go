@@ -0,0 +1,150 @@
+package auditchain
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"sort"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/jwtLib"
+)
+
+const defaultBatchSize = 1000
+
+// Source reads chain for verification.
+type Source interface {
+	// AuditChain returns up to limit events with Seq greater than afterSeq
+	// in Seq order.
+	AuditChain(ctx context.Context, afterSeq int64, limit int) ([]models.AuditEvent, error)
+	AuditCheckpoints(ctx context.Context) ([]models.AuditCheckpoint, error)
+}
+
+type Report struct {
+	Events      int64 `json:"events"`
+	Checkpoints int   `json:"checkpoints"`
+	LastSeq     int64 `json:"last_seq"`
+	// Broken is the first broken link, nil when chain is intact.
+	Broken *BrokenLink `json:"broken,omitempty"`
+}
+
+type BrokenLink struct {
+	Seq       int64  `json:"seq"`
+	EventUUID string `json:"event_uuid,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+// Verify walks chain from the first event and stops at the first broken
+// link. Checkpoints are verified with keys, checkpoint signed by key not
+// in keys is broken link. Error is returned only when chain can't be read.
+func Verify(ctx context.Context, source Source, keys jwtLib.JWKS, batchSize int) (Report, error) {
+	const op = "auditchain.Verify"
+
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	publicKeys := make(map[string]*rsa.PublicKey, len(keys.Keys))
+	for _, jwk := range keys.Keys {
+		public, err := jwk.PublicKey()
+		if err != nil {
+			return Report{}, fmt.Errorf("%s: key %s: %w", op, jwk.Kid, err)
+		}
+		publicKeys[jwk.Kid] = public
+	}
+
+	checkpoints, err := source.AuditCheckpoints(ctx)
+	if err != nil {
+		return Report{}, fmt.Errorf("%s: %w", op, err)
+	}
+	sort.Slice(checkpoints, func(i, j int) bool { return checkpoints[i].Seq < checkpoints[j].Seq })
+
+	var (
+		report Report
+		prev   models.AuditEvent
+	)
+
+	for {
+		events, err := source.AuditChain(ctx, prev.Seq, batchSize)
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", op, err)
+		}
+
+		for _, event := range events {
+			if broken := checkLink(prev, event); broken != nil {
+				report.Broken = broken
+				return report, nil
+			}
+
+			for len(checkpoints) > 0 && checkpoints[0].Seq <= event.Seq {
+				if broken := checkCheckpoint(checkpoints[0], event, publicKeys); broken != nil {
+					report.Broken = broken
+					return report, nil
+				}
+				report.Checkpoints++
+				checkpoints = checkpoints[1:]
+			}
+
+			report.Events++
+			report.LastSeq = event.Seq
+			prev = event
+		}
+
+		if len(events) < batchSize {
+			break
+		}
+	}
+
+	// signed head beyond end of chain means tail was cut off
+	if len(checkpoints) > 0 {
+		report.Broken = &BrokenLink{
+			Seq:    prev.Seq + 1,
+			Reason: fmt.Sprintf("chain ends at seq %d but checkpoint covers seq %d", prev.Seq, checkpoints[len(checkpoints)-1].Seq),
+		}
+	}
+
+	return report, nil
+}
+
+func checkLink(prev, event models.AuditEvent) *BrokenLink {
+	broken := func(reason string) *BrokenLink {
+		return &BrokenLink{Seq: event.Seq, EventUUID: event.UUID.String(), Reason: reason}
+	}
+
+	switch {
+	case event.Seq <= prev.Seq:
+		return broken(fmt.Sprintf("seq is not after seq %d of previous event", prev.Seq))
+	case event.Seq == prev.Seq+2:
+		return &BrokenLink{Seq: prev.Seq + 1, Reason: "event is missing"}
+	case event.Seq != prev.Seq+1:
+		return &BrokenLink{
+			Seq:    prev.Seq + 1,
+			Reason: fmt.Sprintf("events %d..%d are missing", prev.Seq+1, event.Seq-1),
+		}
+	case !bytes.Equal(event.Hash, Hash(event)):
+		return broken("hash does not match event content")
+	case !bytes.Equal(event.PrevHash, prev.Hash):
+		return broken(fmt.Sprintf("prev hash does not match hash of event %d", prev.Seq))
+	}
+	return nil
+}
+
+func checkCheckpoint(checkpoint models.AuditCheckpoint, event models.AuditEvent, keys map[string]*rsa.PublicKey) *BrokenLink {
+	broken := func(reason string) *BrokenLink {
+		return &BrokenLink{Seq: checkpoint.Seq, EventUUID: checkpoint.EventUUID.String(), Reason: reason}
+	}
+
+	if checkpoint.Seq != event.Seq || checkpoint.EventUUID != event.UUID || !bytes.Equal(checkpoint.Hash, event.Hash) {
+		return broken("checkpoint does not match event")
+	}
+
+	key, ok := keys[checkpoint.KeyID]
+	if !ok {
+		return broken(fmt.Sprintf("checkpoint signed by unknown key %s", checkpoint.KeyID))
+	}
+	if err := VerifySignature(key, checkpoint); err != nil {
+		return broken("invalid checkpoint signature")
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package auditchain
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/jwtLib"
+
+	"github.com/google/uuid"
+)
+
+type memorySource struct {
+	events      []models.AuditEvent
+	checkpoints []models.AuditCheckpoint
+}
+
+func (s *memorySource) AuditChain(_ context.Context, afterSeq int64, limit int) ([]models.AuditEvent, error) {
+	var events []models.AuditEvent
+	for _, event := range s.events {
+		if event.Seq > afterSeq && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (s *memorySource) AuditCheckpoints(context.Context) ([]models.AuditCheckpoint, error) {
+	return s.checkpoints, nil
+}
+
+// testChain returns chain of n events with checkpoint of event 2 signed by
+// retired key and of event 4 signed by current key.
+func testChain(t *testing.T, n int, retired, current *jwtLib.SigningKey) *memorySource {
+	t.Helper()
+
+	source := &memorySource{}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var prev models.AuditEvent
+	for i := 1; i <= n; i++ {
+		event := models.AuditEvent{
+			UUID:     uuid.New(),
+			Time:     start.Add(time.Duration(i) * time.Second),
+			Subject:  "user@example.com",
+			Action:   models.AuditLogin,
+			Outcome:  models.AuditSuccess,
+			Seq:      int64(i),
+			PrevHash: prev.Hash,
+		}
+		event.Hash = Hash(event)
+		source.events = append(source.events, event)
+		prev = event
+
+		key := map[int]*jwtLib.SigningKey{2: retired, 4: current}[i]
+		if key == nil {
+			continue
+		}
+		checkpoint := models.AuditCheckpoint{Seq: event.Seq, EventUUID: event.UUID, Hash: event.Hash, Time: event.Time}
+		if err := Sign(key, &checkpoint); err != nil {
+			t.Fatalf("Sign() error = %v", err)
+		}
+		source.checkpoints = append(source.checkpoints, checkpoint)
+	}
+	return source
+}
+
+func TestVerify(t *testing.T) {
+	retired, err := jwtLib.GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey() error = %v", err)
+	}
+	current, err := jwtLib.GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey() error = %v", err)
+	}
+	bothKeys := jwtLib.JWKS{Keys: append(retired.JWKS().Keys, current.JWKS().Keys...)}
+
+	tests := []struct {
+		name      string
+		tamper    func(s *memorySource)
+		keys      jwtLib.JWKS
+		batchSize int
+		// wantSeq and wantReason describe broken link, zero wantSeq means
+		// intact chain.
+		wantSeq    int64
+		wantReason string
+	}{
+		{name: "intact", keys: bothKeys},
+		{name: "intact across batches", keys: bothKeys, batchSize: 2},
+		{
+			name:   "empty log",
+			tamper: func(s *memorySource) { s.events, s.checkpoints = nil, nil },
+			keys:   bothKeys,
+		},
+		{
+			name:       "retired key missing",
+			keys:       current.JWKS(),
+			wantSeq:    2,
+			wantReason: "unknown key",
+		},
+		{
+			name:       "content changed",
+			tamper:     func(s *memorySource) { s.events[2].Subject = "mallory@example.com" },
+			keys:       bothKeys,
+			wantSeq:    3,
+			wantReason: "hash does not match",
+		},
+		{
+			name: "event rehashed",
+			tamper: func(s *memorySource) {
+				s.events[2].Subject = "mallory@example.com"
+				s.events[2].Hash = Hash(s.events[2])
+			},
+			keys:       bothKeys,
+			wantSeq:    4,
+			wantReason: "prev hash does not match",
+		},
+		{
+			name:       "event deleted",
+			tamper:     func(s *memorySource) { s.events = append(s.events[:2], s.events[3:]...) },
+			keys:       bothKeys,
+			wantSeq:    3,
+			wantReason: "event is missing",
+		},
+		{
+			name:       "events deleted",
+			tamper:     func(s *memorySource) { s.events = append(s.events[:1], s.events[4:]...) },
+			keys:       bothKeys,
+			wantSeq:    2,
+			wantReason: "events 2..4 are missing",
+		},
+		{
+			name:       "tail cut off",
+			tamper:     func(s *memorySource) { s.events = s.events[:3] },
+			keys:       bothKeys,
+			wantSeq:    4,
+			wantReason: "checkpoint covers seq 4",
+		},
+		{
+			name: "checkpoint of other event",
+			tamper: func(s *memorySource) {
+				s.checkpoints[1].EventUUID = uuid.New()
+			},
+			keys:       bothKeys,
+			wantSeq:    4,
+			wantReason: "checkpoint does not match",
+		},
+		{
+			name:       "signature forged",
+			tamper:     func(s *memorySource) { s.checkpoints[1].Signature[0] ^= 0xff },
+			keys:       bothKeys,
+			wantSeq:    4,
+			wantReason: "invalid checkpoint signature",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := testChain(t, 6, retired, current)
+			if tt.tamper != nil {
+				tt.tamper(source)
+			}
+
+			report, err := Verify(context.Background(), source, tt.keys, tt.batchSize)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+
+			if tt.wantSeq == 0 {
+				if report.Broken != nil {
+					t.Fatalf("Verify() broken = %+v, want intact", *report.Broken)
+				}
+				if report.Events != int64(len(source.events)) || report.Checkpoints != len(source.checkpoints) {
+					t.Fatalf("Verify() = %d events, %d checkpoints, want %d, %d",
+						report.Events, report.Checkpoints, len(source.events), len(source.checkpoints))
+				}
+				return
+			}
+
+			if report.Broken == nil {
+				t.Fatalf("Verify() chain intact, want broken at seq %d", tt.wantSeq)
+			}
+			if report.Broken.Seq != tt.wantSeq || !strings.Contains(report.Broken.Reason, tt.wantReason) {
+				t.Fatalf("Verify() broken = %+v, want seq %d with %q", *report.Broken, tt.wantSeq, tt.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+// Package backoff computes retry delays.
+package backoff
+
+import "time"
+
+// Exponential is delay after attempts failed ones: initial doubled per
+// attempt and capped by max.
+func Exponential(initial time.Duration, max time.Duration, attempts int) time.Duration {
+	delay := initial
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	return delay
+}
@@ -0,0 +1,72 @@
+// Package eventsink publishes identity events to external systems: log,
+// Kafka through REST proxy and NATS. All sinks send the same JSON made by
+// Encode. Delivery is at least once, consumers deduplicate by event id.
+package eventsink
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"SSO/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+type message struct {
+	ID      string      `json:"id"`
+	Type    string      `json:"type"`
+	Time    time.Time   `json:"time"`
+	AppUUID string      `json:"app_uuid,omitempty"`
+	Data    messageData `json:"data"`
+}
+
+type messageData struct {
+	UserUUID       string `json:"user_uuid,omitempty"`
+	Email          string `json:"email,omitempty"`
+	PermissionUUID string `json:"permission_uuid,omitempty"`
+}
+
+// Encode returns JSON form of event:
+//
+//	{"id", "type", "time", "app_uuid", "data": {"user_uuid", "email", "permission_uuid"}}
+//
+// Nil UUIDs and empty fields are left out.
+func Encode(event models.IdentityEvent) ([]byte, error) {
+	m := message{
+		ID:   event.UUID.String(),
+		Type: event.Type,
+		Time: event.Time,
+		Data: messageData{Email: event.Email},
+	}
+	if event.AppUUID != uuid.Nil {
+		m.AppUUID = event.AppUUID.String()
+	}
+	if event.UserUUID != uuid.Nil {
+		m.Data.UserUUID = event.UserUUID.String()
+	}
+	if event.PermissionUUID != uuid.Nil {
+		m.Data.PermissionUUID = event.PermissionUUID.String()
+	}
+	return json.Marshal(m)
+}
+
+// Log writes events to log, useful locally and as audit of relay.
+type Log struct {
+	log *slog.Logger
+}
+
+func NewLog(log *slog.Logger) *Log {
+	return &Log{log: log}
+}
+
+func (l *Log) Publish(ctx context.Context, event models.IdentityEvent) error {
+	l.log.InfoContext(ctx, "identity event",
+		slog.String("id", event.UUID.String()),
+		slog.String("type", event.Type),
+		slog.String("app_uuid", event.AppUUID.String()),
+		slog.String("email", event.Email),
+	)
+	return nil
+}
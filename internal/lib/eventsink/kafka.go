@@ -0,0 +1,114 @@
+package eventsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"SSO/internal/domain/models"
+)
+
+// Kafka REST Proxy v2 content types.
+const (
+	kafkaJSONContentType = "application/vnd.kafka.json.v2+json"
+	kafkaAccept          = "application/vnd.kafka.v2+json"
+)
+
+// Kafka produces events to topic through Kafka REST Proxy v2 API, which
+// Confluent REST Proxy and Redpanda HTTP Proxy serve. Record key is user
+// email, so events of one user keep order within partition.
+type Kafka struct {
+	endpoint string
+	user     string
+	password string
+	client   *http.Client
+}
+
+// NewKafka creates sink for proxy at baseURL, user and password are basic
+// auth credentials and may be empty.
+func NewKafka(baseURL string, topic string, user string, password string, timeout time.Duration) *Kafka {
+	return &Kafka{
+		endpoint: strings.TrimSuffix(baseURL, "/") + "/topics/" + url.PathEscape(topic),
+		user:     user,
+		password: password,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+type kafkaOffsets struct {
+	Offsets []struct {
+		Partition *int32  `json:"partition"`
+		Offset    *int64  `json:"offset"`
+		ErrorCode *int    `json:"error_code"`
+		Error     *string `json:"error"`
+	} `json:"offsets"`
+}
+
+func (k *Kafka) Publish(ctx context.Context, event models.IdentityEvent) error {
+	const op = "eventsink.Kafka.Publish"
+
+	value, err := Encode(event)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	body, err := json.Marshal(kafkaRecords{Records: []kafkaRecord{{Key: event.Email, Value: value}}})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	req.Header.Set("Content-Type", kafkaJSONContentType)
+	req.Header.Set("Accept", kafkaAccept)
+	if k.user != "" {
+		req.SetBasicAuth(k.user, k.password)
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: proxy answered %s: %s", op, resp.Status, bytes.TrimSpace(respBody))
+	}
+
+	// proxy answers 200 even when broker rejected record
+	var offsets kafkaOffsets
+	if err := json.Unmarshal(respBody, &offsets); err != nil {
+		return fmt.Errorf("%s: decode offsets: %w", op, err)
+	}
+	if len(offsets.Offsets) != 1 {
+		return fmt.Errorf("%s: expected 1 offset, got %d", op, len(offsets.Offsets))
+	}
+	if o := offsets.Offsets[0]; o.ErrorCode != nil || o.Error != nil {
+		reason := "unknown error"
+		if o.Error != nil {
+			reason = *o.Error
+		}
+		return fmt.Errorf("%s: record rejected: %s", op, reason)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package eventsink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"SSO/internal/domain/models"
+)
+
+const natsDefaultPort = "4222"
+
+var ErrNATS = errors.New("nats error")
+
+// NATS publishes events with core NATS protocol to subject
+// "<prefix>.<event type>", e.g. sso.identity.user.registered. Publish
+// returns after server answered PING sent behind PUB, so event reached
+// server. Core NATS does not keep messages, JetStream stream bound to the
+// subjects makes delivery to consumers durable. TLS is not supported.
+type NATS struct {
+	addr    string
+	connect []byte
+	prefix  string
+	timeout time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+type natsConnect struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Name     string `json:"name"`
+	Lang     string `json:"lang"`
+	Version  string `json:"version"`
+	Protocol int    `json:"protocol"`
+	User     string `json:"user,omitempty"`
+	Pass     string `json:"pass,omitempty"`
+	Token    string `json:"auth_token,omitempty"`
+}
+
+// NewNATS creates sink for server at rawURL "nats://[user:pass@]host[:port]"
+// or "nats://token@host[:port]". Connection is made on first Publish.
+func NewNATS(rawURL string, subjectPrefix string, timeout time.Duration) (*NATS, error) {
+	const op = "eventsink.NewNATS"
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if u.Scheme != "nats" || u.Hostname() == "" {
+		return nil, fmt.Errorf("%s: url must be nats://host[:port]", op)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = natsDefaultPort
+	}
+
+	connect := natsConnect{Name: "sso", Lang: "go", Version: "1", Protocol: 1}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			connect.User, connect.Pass = u.User.Username(), pass
+		} else {
+			connect.Token = u.User.Username()
+		}
+	}
+	line, err := json.Marshal(connect)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &NATS{
+		addr:    net.JoinHostPort(u.Hostname(), port),
+		connect: line,
+		prefix:  strings.TrimSuffix(subjectPrefix, "."),
+		timeout: timeout,
+	}, nil
+}
+
+func (n *NATS) Publish(ctx context.Context, event models.IdentityEvent) error {
+	const op = "eventsink.NATS.Publish"
+
+	payload, err := Encode(event)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if err := n.publish(ctx, n.prefix+"."+event.Type, payload); err != nil {
+		// connection state is unknown, next publish reconnects
+		n.closeConn()
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Close closes connection, sink reconnects when used again.
+func (n *NATS) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.closeConn()
+}
+
+func (n *NATS) publish(ctx context.Context, subject string, payload []byte) error {
+	if n.conn == nil {
+		if err := n.dial(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := n.setDeadline(ctx); err != nil {
+		return err
+	}
+
+	msg := make([]byte, 0, len(subject)+len(payload)+32)
+	msg = append(msg, "PUB "+subject+" "+strconv.Itoa(len(payload))+"\r\n"...)
+	msg = append(msg, payload...)
+	msg = append(msg, "\r\nPING\r\n"...)
+	if _, err := n.conn.Write(msg); err != nil {
+		return err
+	}
+
+	return n.waitPong()
+}
+
+// dial connects and authenticates: server greets with INFO, client sends
+// CONNECT and PING, PONG means credentials were accepted.
+func (n *NATS) dial(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: n.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	n.conn = conn
+	n.reader = bufio.NewReader(conn)
+
+	if err := n.setDeadline(ctx); err != nil {
+		return err
+	}
+
+	line, err := n.readLine()
+	if err != nil {
+		return err
+	}
+	info, ok := strings.CutPrefix(line, "INFO ")
+	if !ok {
+		return fmt.Errorf("%w: unexpected greeting %q", ErrNATS, line)
+	}
+	var serverInfo struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	if err := json.Unmarshal([]byte(info), &serverInfo); err != nil {
+		return fmt.Errorf("%w: invalid INFO: %w", ErrNATS, err)
+	}
+	if serverInfo.TLSRequired {
+		return fmt.Errorf("%w: server requires TLS", ErrNATS)
+	}
+
+	if _, err := n.conn.Write([]byte("CONNECT " + string(n.connect) + "\r\nPING\r\n")); err != nil {
+		return err
+	}
+	return n.waitPong()
+}
+
+// waitPong reads until PONG, answering server PINGs on the way.
+func (n *NATS) waitPong() error {
+	for {
+		line, err := n.readLine()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := n.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("%w: %s", ErrNATS, strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// +OK and INFO updates need no answer
+	}
+}
+
+func (n *NATS) readLine() (string, error) {
+	line, err := n.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (n *NATS) setDeadline(ctx context.Context) error {
+	deadline := time.Now().Add(n.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	return n.conn.SetDeadline(deadline)
+}
+
+func (n *NATS) closeConn() error {
+	if n.conn == nil {
+		return nil
+	}
+	err := n.conn.Close()
+	n.conn, n.reader = nil, nil
+	return err
+}
@@ -0,0 +1,326 @@
+package hasher
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgBcrypt   = "bcrypt"
+	AlgArgon2id = "argon2id"
+)
+
+var (
+	ErrMismatchedHash   = errors.New("hash does not match password")
+	ErrUnknownAlgorithm = errors.New("unknown hash algorithm")
+	ErrMalformedHash    = errors.New("malformed hash")
+)
+
+// Caps of argon2id parameters of configured and stored hashes, a hash
+// asking for more is rejected instead of exhausting memory or CPU.
+const (
+	MaxArgon2Memory  = 1 << 20 // KiB
+	MaxArgon2Time    = 16
+	MaxArgon2SaltLen = 64
+	MaxArgon2KeyLen  = 64
+)
+
+// Argon2Params are the argon2id cost parameters.
+type Argon2Params struct {
+	Memory  uint32 // KiB
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// Config selects the algorithm used for new hashes and its parameters.
+type Config struct {
+	Algorithm  string
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Algorithm:  AlgArgon2id,
+		BcryptCost: bcrypt.DefaultCost,
+		Argon2: Argon2Params{
+			Memory:  64 * 1024,
+			Time:    3,
+			Threads: 2,
+			SaltLen: 16,
+			KeyLen:  32,
+		},
+	}
+}
+
+// NewConfigByEnv builds Config from string settings, empty values keep defaults.
+func NewConfigByEnv(algorithm string, bcryptCost string, argonMemory string, argonTime string, argonThreads string) (Config, error) {
+	cfg := DefaultConfig()
+
+	if algorithm != "" {
+		cfg.Algorithm = algorithm
+	}
+
+	if bcryptCost != "" {
+		cost, err := strconv.Atoi(bcryptCost)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.BcryptCost = cost
+	}
+
+	if argonMemory != "" {
+		memory, err := strconv.ParseUint(argonMemory, 10, 32)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.Argon2.Memory = uint32(memory)
+	}
+
+	if argonTime != "" {
+		t, err := strconv.ParseUint(argonTime, 10, 32)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.Argon2.Time = uint32(t)
+	}
+
+	if argonThreads != "" {
+		threads, err := strconv.ParseUint(argonThreads, 10, 8)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.Argon2.Threads = uint8(threads)
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func (c Config) Validate() error {
+	switch c.Algorithm {
+	case AlgBcrypt:
+		if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost %d out of range", c.BcryptCost)
+		}
+	case AlgArgon2id:
+		if c.Argon2.Memory == 0 || c.Argon2.Time == 0 || c.Argon2.Threads == 0 {
+			return errors.New("argon2id memory, time and threads must be positive")
+		}
+		if c.Argon2.Memory > MaxArgon2Memory {
+			return fmt.Errorf("argon2id memory must not exceed %d KiB", MaxArgon2Memory)
+		}
+		if c.Argon2.Time > MaxArgon2Time {
+			return fmt.Errorf("argon2id time must not exceed %d", MaxArgon2Time)
+		}
+		if c.Argon2.SaltLen == 0 || c.Argon2.KeyLen == 0 {
+			return errors.New("argon2id salt and key length must be positive")
+		}
+		if c.Argon2.SaltLen > MaxArgon2SaltLen || c.Argon2.KeyLen > MaxArgon2KeyLen {
+			return fmt.Errorf("argon2id salt and key length must not exceed %d and %d bytes", MaxArgon2SaltLen, MaxArgon2KeyLen)
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownAlgorithm, c.Algorithm)
+	}
+	return nil
+}
+
+// Operations reported to Observer.
+const (
+	OpHash    = "hash"
+	OpCompare = "compare"
+)
+
+// Observer receives duration of every hash and compare.
+type Observer func(operation string, algorithm string, took time.Duration)
+
+// Hasher hashes new passwords with the configured algorithm and verifies
+// hashes produced by any supported one.
+type Hasher struct {
+	cfg      Config
+	observer Observer
+}
+
+func New(cfg Config) *Hasher {
+	return &Hasher{cfg: cfg}
+}
+
+// SetObserver sets timing observer, nil disables it. Call it before hasher
+// is in use.
+func (h *Hasher) SetObserver(observer Observer) {
+	h.observer = observer
+}
+
+func (h *Hasher) observe(operation string, algorithm string, start time.Time) {
+	if h.observer == nil {
+		return
+	}
+	if algorithm == "" {
+		algorithm = "unknown"
+	}
+	h.observer(operation, algorithm, time.Since(start))
+}
+
+// Hash returns encoded hash of password: bcrypt modular crypt format or
+// argon2id PHC string ($argon2id$v=19$m=...,t=...,p=...$salt$key).
+func (h *Hasher) Hash(password string) ([]byte, error) {
+	defer h.observe(OpHash, h.cfg.Algorithm, time.Now())
+
+	switch h.cfg.Algorithm {
+	case AlgBcrypt:
+		return bcrypt.GenerateFromPassword([]byte(password), h.cfg.BcryptCost)
+	case AlgArgon2id:
+		return hashArgon2id(password, h.cfg.Argon2)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, h.cfg.Algorithm)
+	}
+}
+
+// Compare checks password against encoded hash of any supported algorithm.
+func (h *Hasher) Compare(hash []byte, password string) error {
+	alg := Algorithm(hash)
+	defer h.observe(OpCompare, alg, time.Now())
+
+	switch alg {
+	case AlgBcrypt:
+		err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrMismatchedHash
+		}
+		return err
+	case AlgArgon2id:
+		return compareArgon2id(hash, password)
+	default:
+		return ErrUnknownAlgorithm
+	}
+}
+
+// NeedsRehash reports whether hash was produced by another algorithm or
+// with parameters other than the configured ones.
+func (h *Hasher) NeedsRehash(hash []byte) bool {
+	alg := Algorithm(hash)
+	if alg != h.cfg.Algorithm {
+		return true
+	}
+
+	switch alg {
+	case AlgBcrypt:
+		cost, err := bcrypt.Cost(hash)
+		return err != nil || cost != h.cfg.BcryptCost
+	case AlgArgon2id:
+		params, _, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return true
+		}
+		want := h.cfg.Argon2
+		return params.Memory != want.Memory ||
+			params.Time != want.Time ||
+			params.Threads != want.Threads ||
+			uint32(len(key)) != want.KeyLen
+	}
+	return true
+}
+
+// Algorithm detects algorithm of encoded hash, empty string if unknown.
+func Algorithm(hash []byte) string {
+	switch {
+	case bytes.HasPrefix(hash, []byte("$2a$")),
+		bytes.HasPrefix(hash, []byte("$2b$")),
+		bytes.HasPrefix(hash, []byte("$2y$")):
+		return AlgBcrypt
+	case bytes.HasPrefix(hash, []byte("$argon2id$")):
+		return AlgArgon2id
+	}
+	return ""
+}
+
+// Supported reports whether hash is in a format Compare understands and its
+// cost parameters are within bounds.
+func Supported(hash []byte) bool {
+	switch Algorithm(hash) {
+	case AlgBcrypt:
+		_, err := bcrypt.Cost(hash)
+		return err == nil
+	case AlgArgon2id:
+		_, _, _, err := decodeArgon2id(hash)
+		return err == nil
+	}
+	return false
+}
+
+func hashArgon2id(password string, p Argon2Params) ([]byte, error) {
+	salt := make([]byte, p.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+
+	encoded := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+	return []byte(encoded), nil
+}
+
+func compareArgon2id(hash []byte, password string) error {
+	p, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrMismatchedHash
+	}
+	return nil
+}
+
+func decodeArgon2id(hash []byte) (Argon2Params, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != AlgArgon2id {
+		return Argon2Params{}, nil, nil, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2Params{}, nil, nil, ErrMalformedHash
+	}
+
+	var p Argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return Argon2Params{}, nil, nil, ErrMalformedHash
+	}
+	// argon2.IDKey panics on zero time or threads
+	if p.Time < 1 || p.Threads < 1 || p.Memory > MaxArgon2Memory || p.Time > MaxArgon2Time {
+		return Argon2Params{}, nil, nil, ErrMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) > MaxArgon2SaltLen {
+		return Argon2Params{}, nil, nil, ErrMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 || len(key) > MaxArgon2KeyLen {
+		return Argon2Params{}, nil, nil, ErrMalformedHash
+	}
+
+	p.SaltLen = uint32(len(salt))
+	p.KeyLen = uint32(len(key))
+
+	return p, salt, key, nil
+}
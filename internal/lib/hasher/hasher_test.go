@@ -0,0 +1,122 @@
+package hasher
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// validSalt and validKey are base64 of 16 and 32 zero bytes.
+const (
+	validSalt = "AAAAAAAAAAAAAAAAAAAAAA"
+	validKey  = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+)
+
+func TestDecodeArgon2idBounds(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+		// salt and key replace valid ones when set
+		salt    string
+		key     string
+		wantErr bool
+	}{
+		{name: "default", params: "m=65536,t=3,p=2"},
+		{name: "minimal", params: "m=8,t=1,p=1"},
+		{name: "memory cap", params: "m=1048576,t=1,p=1"},
+		{name: "zero time", params: "m=65536,t=0,p=2", wantErr: true},
+		{name: "zero threads", params: "m=65536,t=3,p=0", wantErr: true},
+		{name: "memory above cap", params: "m=1048577,t=3,p=2", wantErr: true},
+		{name: "huge memory", params: "m=4294967295,t=3,p=2", wantErr: true},
+		{name: "threads overflow", params: "m=65536,t=3,p=256", wantErr: true},
+		{name: "negative time", params: "m=65536,t=-1,p=2", wantErr: true},
+		{name: "missing threads", params: "m=65536,t=3", wantErr: true},
+		{name: "time cap", params: "m=8,t=16,p=1"},
+		{name: "time above cap", params: "m=8,t=17,p=1", wantErr: true},
+		{name: "huge time", params: "m=8,t=4294967295,p=1", wantErr: true},
+		{name: "salt above cap", params: "m=8,t=1,p=1", salt: strings.Repeat("A", 88), wantErr: true},
+		{name: "key above cap", params: "m=8,t=1,p=1", key: strings.Repeat("A", 88), wantErr: true},
+		{name: "huge key", params: "m=8,t=1,p=1", key: strings.Repeat("A", 1<<16), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			salt, key := validSalt, validKey
+			if tt.salt != "" {
+				salt = tt.salt
+			}
+			if tt.key != "" {
+				key = tt.key
+			}
+			hash := []byte("$argon2id$v=19$" + tt.params + "$" + salt + "$" + key)
+
+			_, _, _, err := decodeArgon2id(hash)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeArgon2id() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := Supported(hash); got == tt.wantErr {
+				t.Fatalf("Supported() = %v, want %v", got, !tt.wantErr)
+			}
+			if tt.wantErr {
+				// must fail without reaching argon2.IDKey
+				if err := New(DefaultConfig()).Compare(hash, "password"); !errors.Is(err, ErrMalformedHash) {
+					t.Fatalf("Compare() error = %v, want %v", err, ErrMalformedHash)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr bool
+	}{
+		{name: "default", modify: func(*Config) {}},
+		{name: "bcrypt", modify: func(c *Config) { c.Algorithm = AlgBcrypt }},
+		{name: "bcrypt cost too low", modify: func(c *Config) { c.Algorithm, c.BcryptCost = AlgBcrypt, 3 }, wantErr: true},
+		{name: "zero argon2 time", modify: func(c *Config) { c.Argon2.Time = 0 }, wantErr: true},
+		{name: "zero argon2 threads", modify: func(c *Config) { c.Argon2.Threads = 0 }, wantErr: true},
+		{name: "argon2 memory above cap", modify: func(c *Config) { c.Argon2.Memory = MaxArgon2Memory + 1 }, wantErr: true},
+		{name: "argon2 time above cap", modify: func(c *Config) { c.Argon2.Time = MaxArgon2Time + 1 }, wantErr: true},
+		{name: "argon2 salt above cap", modify: func(c *Config) { c.Argon2.SaltLen = MaxArgon2SaltLen + 1 }, wantErr: true},
+		{name: "argon2 key above cap", modify: func(c *Config) { c.Argon2.KeyLen = MaxArgon2KeyLen + 1 }, wantErr: true},
+		{name: "unknown algorithm", modify: func(c *Config) { c.Algorithm = "md5" }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(&cfg)
+
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHashRoundTrip(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Argon2.Memory = 64
+	cfg.Argon2.Time = 1
+	h := New(cfg)
+
+	hash, err := h.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Supported(hash) {
+		t.Fatalf("Supported(%s) = false", hash)
+	}
+	if err := h.Compare(hash, "secret"); err != nil {
+		t.Fatalf("Compare() with right password: %v", err)
+	}
+	if err := h.Compare(hash, "other"); !errors.Is(err, ErrMismatchedHash) {
+		t.Fatalf("Compare() with wrong password = %v, want %v", err, ErrMismatchedHash)
+	}
+	if h.NeedsRehash(hash) {
+		t.Fatal("NeedsRehash() = true for hash made with current config")
+	}
+}
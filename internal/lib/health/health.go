@@ -0,0 +1,185 @@
+// Package health tracks readiness of dependencies. Checks run periodically,
+// result drives standard grpc.health.v1 service and HTTP probes.
+package health
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+	defaultTimeout  = 2 * time.Second
+)
+
+// Check returns error when dependency is not usable.
+type Check func(ctx context.Context) error
+
+type check struct {
+	name  string
+	check Check
+}
+
+// Result is outcome of last run of checks, empty error means ok.
+type Result struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+type Checker struct {
+	log      *slog.Logger
+	interval time.Duration
+	timeout  time.Duration
+	services []string
+	checks   []check
+
+	server *health.Server
+
+	mu           sync.RWMutex
+	results      []Result
+	ready        bool
+	shuttingDown bool
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// New creates checker, services are gRPC service names which get same status
+// as whole server. Server is NOT_SERVING until first checks pass.
+func New(log *slog.Logger, interval time.Duration, timeout time.Duration, services ...string) *Checker {
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	c := &Checker{
+		log:      log,
+		interval: interval,
+		timeout:  timeout,
+		services: append([]string{""}, services...),
+		server:   health.NewServer(),
+		stop:     make(chan struct{}),
+	}
+	c.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+
+	return c
+}
+
+func (c *Checker) Add(name string, fn Check) {
+	c.checks = append(c.checks, check{name: name, check: fn})
+}
+
+// Server is grpc.health.v1 implementation to register on gRPC server.
+func (c *Checker) Server() healthpb.HealthServer {
+	return c.server
+}
+
+// Run checks dependencies right away and then every interval until Stop.
+func (c *Checker) Run() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.CheckNow(context.Background())
+
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Checker) Stop() {
+	c.once.Do(func() { close(c.stop) })
+}
+
+// CheckNow runs all checks concurrently and updates serving status.
+func (c *Checker) CheckNow(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]Result, len(c.checks))
+
+	var wg sync.WaitGroup
+	for i, ch := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			results[i] = Result{Name: ch.name}
+			if err := ch.check(ctx); err != nil {
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	ready := true
+	for _, res := range results {
+		if res.Error != "" {
+			ready = false
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.shuttingDown {
+		return
+	}
+
+	for i, res := range results {
+		// log transitions only, failing check is not repeated every interval
+		if res.Error != "" && (c.results == nil || c.results[i].Error == "") {
+			c.log.Warn("dependency check failed", slog.String("check", res.Name), slog.String("error", res.Error))
+		}
+	}
+	if ready && !c.ready {
+		c.log.Info("dependencies are ready")
+	}
+
+	c.results = results
+	c.ready = ready
+
+	if ready {
+		c.setStatus(healthpb.HealthCheckResponse_SERVING)
+	} else {
+		c.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+// Shutdown reports NOT_SERVING for the rest of process life, so balancers
+// stop sending traffic while in-flight calls drain.
+func (c *Checker) Shutdown() {
+	c.mu.Lock()
+	c.shuttingDown = true
+	c.ready = false
+	c.mu.Unlock()
+
+	c.server.Shutdown()
+	c.Stop()
+
+	c.log.Info("health status set to not serving for shutdown")
+}
+
+// Ready reports whether last checks passed and server is not shutting down.
+func (c *Checker) Ready() (bool, []Result) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.ready, c.results
+}
+
+func (c *Checker) setStatus(status healthpb.HealthCheckResponse_ServingStatus) {
+	for _, service := range c.services {
+		c.server.SetServingStatus(service, status)
+	}
+}
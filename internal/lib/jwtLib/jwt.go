@@ -2,6 +2,7 @@ package jwtLib
 
 import (
 	"context"
+	"errors"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"time"
@@ -9,16 +10,11 @@ import (
 	"SSO/internal/domain/models"
 )
 
-func createAccessToken(ctx context.Context, User models.User, tokenUUID uuid.UUID, authApp models.AuthApp, appUUID uuid.UUID, duration time.Duration) (string, error) {
+func createAccessToken(ctx context.Context, User models.User, tokenUUID uuid.UUID, authApp models.AuthApp, appUUID uuid.UUID, scope string, duration time.Duration) (string, error) {
 	token := jwt.New(jwt.SigningMethodHS256)
 
-	claims := token.Claims.(jwt.MapClaims)
+	setAccessClaims(token.Claims.(jwt.MapClaims), User, tokenUUID, appUUID, scope, duration)
 
-	claims["uuid"] = tokenUUID
-	claims["email"] = User.Email
-	claims["app"] = appUUID
-	claims["exp"] = time.Now().Add(duration).Unix()
-	claims["permissions"] = User.Permissions
 	tokenString, err := token.SignedString([]byte(authApp.Secret))
 	if err != nil {
 		return "", err
@@ -27,15 +23,39 @@ func createAccessToken(ctx context.Context, User models.User, tokenUUID uuid.UUI
 	return tokenString, nil
 }
 
-func createRefreshToken(ctx context.Context, User models.User, tokenUUID uuid.UUID, authApp models.AuthApp, appUUID uuid.UUID, duration time.Duration) (string, error) {
+func setAccessClaims(claims jwt.MapClaims, User models.User, tokenUUID uuid.UUID, appUUID uuid.UUID, scope string, duration time.Duration) {
+	claims["uuid"] = tokenUUID
+	claims["email"] = User.Email
+	claims["app"] = appUUID
+	claims["exp"] = time.Now().Add(duration).Unix()
+	claims["permissions"] = User.Permissions
+	if scope != "" {
+		claims["scope"] = scope
+	}
+}
+
+// refreshTokenType marks refresh tokens, they are not accepted as access
+// tokens.
+const refreshTokenType = "refresh"
+
+// createRefreshToken binds token to OAuth client by azp claim, empty
+// clientID is token of first-party login.
+func createRefreshToken(ctx context.Context, User models.User, tokenUUID uuid.UUID, authApp models.AuthApp, appUUID uuid.UUID, scope string, clientID string, duration time.Duration) (string, error) {
 	token := jwt.New(jwt.SigningMethodHS256)
 
 	claims := token.Claims.(jwt.MapClaims)
 
 	claims["uuid"] = tokenUUID
+	claims["typ"] = refreshTokenType
 	claims["email"] = User.Email
 	claims["app"] = appUUID
 	claims["exp"] = time.Now().Add(duration).Unix()
+	if scope != "" {
+		claims["scope"] = scope
+	}
+	if clientID != "" {
+		claims["azp"] = clientID
+	}
 	tokenString, err := token.SignedString([]byte(authApp.Secret))
 	if err != nil {
 		return "", err
@@ -47,20 +67,163 @@ func createRefreshToken(ctx context.Context, User models.User, tokenUUID uuid.UU
 // TODO пророписать логику обновления токенов при изменении прав
 
 func CreateTokenPair(ctx context.Context, User models.User, authApp models.AuthApp, app uuid.UUID, accessTTL, refTTL time.Duration) (models.Tokens, error) {
+	return CreateScopedTokenPair(ctx, User, authApp, app, "", "", accessTTL, refTTL)
+}
+
+// CreateScopedTokenPair is CreateTokenPair for OAuth clients, granted scope
+// is kept in both tokens and refresh token is bound to clientID.
+func CreateScopedTokenPair(ctx context.Context, User models.User, authApp models.AuthApp, app uuid.UUID, scope string, clientID string, accessTTL, refTTL time.Duration) (models.Tokens, error) {
 	tokensUUID, err := uuid.NewRandom()
 	if err != nil {
 		return models.Tokens{}, err
 	}
 
-	accessToken, err := createAccessToken(ctx, User, tokensUUID, authApp, app, accessTTL)
+	accessToken, err := createAccessToken(ctx, User, tokensUUID, authApp, app, scope, accessTTL)
 	if err != nil {
 		return models.Tokens{}, err
 	}
 
-	refreshToken, err := createRefreshToken(ctx, User, tokensUUID, authApp, app, refTTL)
+	refreshToken, err := createRefreshToken(ctx, User, tokensUUID, authApp, app, scope, clientID, refTTL)
 	if err != nil {
 		return models.Tokens{}, err
 	}
 
 	return models.Tokens{AccessToken: accessToken, RefreshToken: refreshToken}, nil
 }
+
+// CreateIDToken creates OIDC ID token signed with service key. extra holds
+// claims released by granted scopes.
+func CreateIDToken(ctx context.Context, User models.User, key *SigningKey, issuer string, clientID string, nonce string, authTime time.Time, extra map[string]any, duration time.Duration) (string, error) {
+	token := jwt.New(jwt.SigningMethodRS256)
+	token.Header["kid"] = key.ID
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	for name, value := range extra {
+		claims[name] = value
+	}
+	now := time.Now()
+	claims["iss"] = issuer
+	claims["sub"] = User.UUID.String()
+	claims["aud"] = clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(duration).Unix()
+	claims["auth_time"] = authTime.Unix()
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	tokenString, err := token.SignedString(key.Private)
+	if err != nil {
+		return "", err
+	}
+
+	return tokenString, nil
+}
+
+var (
+	ErrRefreshTokenAsAccess = errors.New("refresh token used as access token")
+	ErrNotRefreshToken      = errors.New("not a refresh token")
+)
+
+// ParseAccessToken validates signature and expiration of access token.
+// Untyped token without permissions is legacy refresh token, see
+// ParseRefreshToken, and is refused too.
+func ParseAccessToken(tokenString string, authApp models.AuthApp) (jwt.MapClaims, error) {
+	claims, err := parseToken(tokenString, authApp)
+	if err != nil {
+		return nil, err
+	}
+
+	typ, hasTyp := claims["typ"].(string)
+	_, hasPermissions := claims["permissions"]
+	if typ == refreshTokenType || (!hasTyp && !hasPermissions) {
+		return nil, ErrRefreshTokenAsAccess
+	}
+
+	return claims, nil
+}
+
+// ParseRefreshToken validates signature and expiration of refresh token.
+// Tokens issued before refresh tokens were typed have no typ claim, they
+// are told from access tokens by missing permissions.
+func ParseRefreshToken(tokenString string, authApp models.AuthApp) (jwt.MapClaims, error) {
+	claims, err := parseToken(tokenString, authApp)
+	if err != nil {
+		return nil, err
+	}
+
+	typ, hasTyp := claims["typ"].(string)
+	_, hasPermissions := claims["permissions"]
+	if (hasTyp && typ != refreshTokenType) || (!hasTyp && hasPermissions) {
+		return nil, ErrNotRefreshToken
+	}
+
+	return claims, nil
+}
+
+func parseToken(tokenString string, authApp models.AuthApp) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims,
+		func(token *jwt.Token) (interface{}, error) {
+			return []byte(authApp.Secret), nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// CreateServiceToken creates access token for service account, it has no
+// email and no refresh token pair.
+func CreateServiceToken(ctx context.Context, account models.ServiceAccount, permissions map[string]bool, authApp models.AuthApp, appUUID uuid.UUID, duration time.Duration) (string, error) {
+	tokenUUID, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.New(jwt.SigningMethodHS256)
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	claims["uuid"] = tokenUUID
+	claims["sub"] = "service:" + account.ClientID
+	claims["client_id"] = account.ClientID
+	claims["app"] = appUUID
+	claims["exp"] = time.Now().Add(duration).Unix()
+	claims["permissions"] = permissions
+	tokenString, err := token.SignedString([]byte(authApp.Secret))
+	if err != nil {
+		return "", err
+	}
+
+	return tokenString, nil
+}
+
+// CreateDelegatedToken creates access token of User acting through actor
+// (RFC 8693 token exchange). actor is put into "act" claim, it has no
+// refresh token pair.
+func CreateDelegatedToken(ctx context.Context, User models.User, actor map[string]any, authApp models.AuthApp, appUUID uuid.UUID, scope string, duration time.Duration) (string, error) {
+	tokenUUID, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.New(jwt.SigningMethodHS256)
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	setAccessClaims(claims, User, tokenUUID, appUUID, scope, duration)
+	claims["act"] = actor
+	tokenString, err := token.SignedString([]byte(authApp.Secret))
+	if err != nil {
+		return "", err
+	}
+
+	return tokenString, nil
+}
@@ -0,0 +1,68 @@
+package jwtLib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"SSO/internal/domain/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestParseTokenTypes(t *testing.T) {
+	authApp := models.AuthApp{UUID: uuid.New(), Name: "sso", Secret: "test-secret"}
+	// user without permissions gets null permissions claim
+	user := models.User{UUID: uuid.New(), Email: "user@example.com"}
+
+	pair, err := CreateTokenPair(context.Background(), user, authApp, uuid.New(), time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("CreateTokenPair() error = %v", err)
+	}
+	user.Permissions = map[string]bool{"read": true}
+	granted, err := CreateTokenPair(context.Background(), user, authApp, uuid.New(), time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("CreateTokenPair() error = %v", err)
+	}
+	service, err := CreateServiceToken(context.Background(), models.ServiceAccount{ClientID: "billing"}, map[string]bool{"read": true}, authApp, uuid.New(), time.Minute)
+	if err != nil {
+		t.Fatalf("CreateServiceToken() error = %v", err)
+	}
+
+	// legacy refresh token was issued before typ claim, it has no permissions
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"uuid":  uuid.New(),
+		"email": user.Email,
+		"app":   uuid.New(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(authApp.Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		accessErr  error
+		refreshErr error
+	}{
+		{name: "access", token: granted.AccessToken, refreshErr: ErrNotRefreshToken},
+		{name: "access without permissions", token: pair.AccessToken, refreshErr: ErrNotRefreshToken},
+		{name: "service", token: service, refreshErr: ErrNotRefreshToken},
+		{name: "refresh", token: pair.RefreshToken, accessErr: ErrRefreshTokenAsAccess},
+		{name: "legacy refresh", token: legacy, accessErr: ErrRefreshTokenAsAccess},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseAccessToken(tt.token, authApp); !errors.Is(err, tt.accessErr) {
+				t.Errorf("ParseAccessToken() error = %v, want %v", err, tt.accessErr)
+			}
+			if _, err := ParseRefreshToken(tt.token, authApp); !errors.Is(err, tt.refreshErr) {
+				t.Errorf("ParseRefreshToken() error = %v, want %v", err, tt.refreshErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+// Package ldapauth verifies passwords by LDAP bind, it is used for on-prem
+// directories (OpenLDAP, Active Directory).
+package ldapauth
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid ldap credentials")
+	ErrInvalidConfig      = errors.New("invalid ldap config")
+)
+
+// Config of directory. User is searched under BaseDN by UserFilter with
+// service account BindDN, then password is checked by bind as found entry.
+type Config struct {
+	URL            string // ldap://host:389 or ldaps://host:636
+	StartTLS       bool
+	BindDN         string
+	BindPassword   string
+	BaseDN         string
+	UserFilter     string // %s is replaced by escaped email
+	EmailAttribute string
+	GroupAttribute string
+	Timeout        time.Duration
+
+	// GroupPermissions maps group DN to SSO permission names, lookup is
+	// case insensitive.
+	GroupPermissions map[string][]string
+}
+
+// NewConfigByEnv builds Config from string settings, empty values keep
+// defaults. groupPermissionsFile is JSON object of group DN to permission names.
+func NewConfigByEnv(
+	ldapURL string,
+	startTLS string,
+	bindDN string,
+	bindPassword string,
+	baseDN string,
+	userFilter string,
+	emailAttribute string,
+	groupAttribute string,
+	groupPermissionsFile string,
+) (Config, error) {
+	cfg := Config{
+		URL:            ldapURL,
+		BindDN:         bindDN,
+		BindPassword:   bindPassword,
+		BaseDN:         baseDN,
+		UserFilter:     "(&(objectClass=person)(mail=%s))",
+		EmailAttribute: "mail",
+		GroupAttribute: "memberOf",
+		Timeout:        10 * time.Second,
+	}
+
+	if startTLS != "" {
+		value, err := strconv.ParseBool(startTLS)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.StartTLS = value
+	}
+	if userFilter != "" {
+		cfg.UserFilter = userFilter
+	}
+	if emailAttribute != "" {
+		cfg.EmailAttribute = emailAttribute
+	}
+	if groupAttribute != "" {
+		cfg.GroupAttribute = groupAttribute
+	}
+
+	if groupPermissionsFile != "" {
+		data, err := os.ReadFile(groupPermissionsFile)
+		if err != nil {
+			return Config{}, err
+		}
+		if err := json.Unmarshal(data, &cfg.GroupPermissions); err != nil {
+			return Config{}, fmt.Errorf("%w: group permissions: %w", ErrInvalidConfig, err)
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func (c Config) Validate() error {
+	if c.URL == "" || c.BaseDN == "" {
+		return fmt.Errorf("%w: url and base dn are required", ErrInvalidConfig)
+	}
+	if strings.Count(c.UserFilter, "%s") != 1 {
+		return fmt.Errorf("%w: user filter must contain one %%s", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Entry is directory user who passed bind.
+type Entry struct {
+	DN     string
+	Email  string
+	Groups []string
+}
+
+type Directory struct {
+	cfg              Config
+	groupPermissions map[string][]string
+}
+
+func New(cfg Config) *Directory {
+	groupPermissions := make(map[string][]string, len(cfg.GroupPermissions))
+	for group, permissions := range cfg.GroupPermissions {
+		groupPermissions[strings.ToLower(group)] = permissions
+	}
+
+	return &Directory{cfg: cfg, groupPermissions: groupPermissions}
+}
+
+// Authenticate finds user by email and binds as the user. ErrInvalidCredentials
+// is returned for unknown user, ambiguous search or wrong password.
+func (d *Directory) Authenticate(email string, password string) (Entry, error) {
+	// empty password is unauthenticated bind which succeeds on many servers
+	if password == "" {
+		return Entry{}, ErrInvalidCredentials
+	}
+
+	conn, err := d.dial()
+	if err != nil {
+		return Entry{}, err
+	}
+	defer conn.Close()
+
+	if d.cfg.BindDN != "" {
+		if err := conn.Bind(d.cfg.BindDN, d.cfg.BindPassword); err != nil {
+			return Entry{}, fmt.Errorf("service bind: %w", err)
+		}
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		d.cfg.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2,
+		int(d.cfg.Timeout.Seconds()),
+		false,
+		fmt.Sprintf(d.cfg.UserFilter, ldap.EscapeFilter(email)),
+		[]string{"dn", d.cfg.EmailAttribute, d.cfg.GroupAttribute},
+		nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return Entry{}, fmt.Errorf("search: %w", err)
+	}
+	if result == nil || len(result.Entries) != 1 {
+		return Entry{}, ErrInvalidCredentials
+	}
+	found := result.Entries[0]
+
+	if err := conn.Bind(found.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return Entry{}, ErrInvalidCredentials
+		}
+		return Entry{}, fmt.Errorf("user bind: %w", err)
+	}
+
+	entry := Entry{
+		DN:     found.DN,
+		Email:  found.GetEqualFoldAttributeValue(d.cfg.EmailAttribute),
+		Groups: found.GetEqualFoldAttributeValues(d.cfg.GroupAttribute),
+	}
+	if entry.Email == "" {
+		entry.Email = email
+	}
+
+	return entry, nil
+}
+
+// Permissions returns permission names mapped from groups.
+func (d *Directory) Permissions(groups []string) map[string]bool {
+	permissions := map[string]bool{}
+	for _, group := range groups {
+		for _, permission := range d.groupPermissions[strings.ToLower(group)] {
+			permissions[permission] = true
+		}
+	}
+	return permissions
+}
+
+// ManagedPermissions are permission names present in group mapping. Only
+// they are granted and revoked by directory, others are left to admins.
+func (d *Directory) ManagedPermissions() map[string]bool {
+	managed := map[string]bool{}
+	for _, permissions := range d.groupPermissions {
+		for _, permission := range permissions {
+			managed[permission] = true
+		}
+	}
+	return managed
+}
+
+func (d *Directory) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(d.cfg.URL, ldap.DialWithDialer(&net.Dialer{Timeout: d.cfg.Timeout}))
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	conn.SetTimeout(d.cfg.Timeout)
+
+	if d.cfg.StartTLS {
+		u, err := url.Parse(d.cfg.URL)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("start tls: %w", err)
+		}
+	}
+
+	return conn, nil
+}
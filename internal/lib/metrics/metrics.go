@@ -0,0 +1,189 @@
+// Package metrics is Prometheus instrumentation of the SSO: gRPC calls,
+// auth outcomes, password hashing and dependency latencies. Metrics live
+// in own registry exposed by Handler.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const namespace = "sso"
+
+// Limiters as reported in rate limit metric.
+const (
+	LimiterRegister = "register"
+	LimiterLogin    = "login"
+)
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	grpcHandled  *prometheus.CounterVec
+	grpcDuration *prometheus.HistogramVec
+
+	loginsSucceeded *prometheus.CounterVec
+	loginsFailed    *prometheus.CounterVec
+	registrations   *prometheus.CounterVec
+	refreshes       *prometheus.CounterVec
+	rateLimited     *prometheus.CounterVec
+
+	passwordHash *prometheus.HistogramVec
+
+	storageDuration *prometheus.HistogramVec
+	redisDuration   *prometheus.HistogramVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		grpcHandled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "grpc",
+			Name:      "server_handled_total",
+			Help:      "Completed gRPC calls by method and status code.",
+		}, []string{"method", "code"}),
+		grpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "grpc",
+			Name:      "server_handling_seconds",
+			Help:      "Duration of gRPC calls by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+
+		loginsSucceeded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "auth",
+			Name:      "logins_succeeded_total",
+			Help:      "Logins which issued tokens by login method.",
+		}, []string{"method"}),
+		loginsFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "auth",
+			Name:      "logins_failed_total",
+			Help:      "Failed logins by login method and reason.",
+		}, []string{"method", "reason"}),
+		registrations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "auth",
+			Name:      "registrations_total",
+			Help:      "User registrations by result.",
+		}, []string{"result"}),
+		refreshes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "auth",
+			Name:      "token_refreshes_total",
+			Help:      "Refresh token grants by result.",
+		}, []string{"result"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "auth",
+			Name:      "rate_limited_total",
+			Help:      "Requests rejected by rate limiter.",
+		}, []string{"limiter"}),
+
+		passwordHash: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "password",
+			Name:      "hash_seconds",
+			Help:      "Duration of password hashing and verification by algorithm.",
+			// bcrypt and argon2id are tuned to tens or hundreds of milliseconds
+			Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"operation", "algorithm"}),
+
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "call_seconds",
+			Help:      "Duration of storage calls by operation and result.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "result"}),
+		redisDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "redis",
+			Name:      "command_seconds",
+			Help:      "Duration of Redis commands by command and result.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"command", "result"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.grpcHandled,
+		m.grpcDuration,
+		m.loginsSucceeded,
+		m.loginsFailed,
+		m.registrations,
+		m.refreshes,
+		m.rateLimited,
+		m.passwordHash,
+		m.storageDuration,
+		m.redisDuration,
+	)
+
+	return m
+}
+
+// Handler serves metrics in Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// UnaryServerInterceptor counts calls and observes their duration.
+func (m *Metrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+
+		resp, err := handler(ctx, req)
+
+		m.grpcDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+		m.grpcHandled.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+
+		return resp, err
+	}
+}
+
+func (m *Metrics) LoginSucceeded(method string) {
+	m.loginsSucceeded.WithLabelValues(method).Inc()
+}
+
+func (m *Metrics) LoginFailed(method string, reason string) {
+	m.loginsFailed.WithLabelValues(method, reason).Inc()
+}
+
+func (m *Metrics) Registration(result string) {
+	m.registrations.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) Refresh(result string) {
+	m.refreshes.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) RateLimited(limiter string) {
+	m.rateLimited.WithLabelValues(limiter).Inc()
+}
+
+// ObservePasswordHash matches hasher.Observer.
+func (m *Metrics) ObservePasswordHash(operation string, algorithm string, took time.Duration) {
+	m.passwordHash.WithLabelValues(operation, algorithm).Observe(took.Seconds())
+}
+
+func (m *Metrics) ObserveStorage(operation string, err error, took time.Duration) {
+	m.storageDuration.WithLabelValues(operation, result(err)).Observe(took.Seconds())
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
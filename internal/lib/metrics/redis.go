@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	redisGo "github.com/redis/go-redis/v9"
+)
+
+// RedisHook observes latency of every Redis command, add it with AddHook.
+func (m *Metrics) RedisHook() redisGo.Hook {
+	return redisHook{m: m}
+}
+
+type redisHook struct {
+	m *Metrics
+}
+
+func (h redisHook) DialHook(next redisGo.DialHook) redisGo.DialHook {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		start := time.Now()
+
+		conn, err := next(ctx, network, addr)
+
+		h.m.redisDuration.WithLabelValues("dial", result(err)).Observe(time.Since(start).Seconds())
+		return conn, err
+	}
+}
+
+func (h redisHook) ProcessHook(next redisGo.ProcessHook) redisGo.ProcessHook {
+	return func(ctx context.Context, cmd redisGo.Cmder) error {
+		start := time.Now()
+
+		err := next(ctx, cmd)
+
+		h.m.redisDuration.WithLabelValues(cmd.Name(), redisResult(err)).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+func (h redisHook) ProcessPipelineHook(next redisGo.ProcessPipelineHook) redisGo.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redisGo.Cmder) error {
+		start := time.Now()
+
+		err := next(ctx, cmds)
+
+		h.m.redisDuration.WithLabelValues("pipeline", redisResult(err)).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// redisResult treats missing key as success, it is ordinary answer.
+func redisResult(err error) string {
+	if errors.Is(err, redisGo.Nil) {
+		return "ok"
+	}
+	return result(err)
+}
@@ -0,0 +1,43 @@
+// Package requestmeta carries caller details from transport handlers to
+// services, e.g. for audit records.
+package requestmeta
+
+import (
+	"context"
+	"net"
+)
+
+type clientIPKey struct{}
+
+type actorKey struct{}
+
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP is address of connected peer, empty when unknown.
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// WithActor sets authenticated caller, e.g. principal of client
+// certificate.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func Actor(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// Host strips port from "host:port" address, other values are returned
+// as is.
+func Host(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
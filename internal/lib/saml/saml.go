@@ -0,0 +1,354 @@
+// Package saml implements the parts of SAML 2.0 web browser SSO profile
+// needed by identity provider: SP metadata and AuthnRequest parsing, signed
+// responses and IdP metadata.
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"time"
+
+	"SSO/internal/lib/jwtLib"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	NameIDFormatEmail      = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIDFormatPersistent = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+
+	BindingHTTPPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	BindingHTTPRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	nsDSig      = "http://www.w3.org/2000/09/xmldsig#"
+
+	statusSuccess      = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	attrFormatBasic    = "urn:oasis:names:tc:SAML:2.0:attrname-format:basic"
+	authnContextPass   = "urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport"
+	confirmationBearer = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+
+	// accepted clock difference with service providers
+	clockSkew = 3 * time.Minute
+	// AuthnRequest older than this is rejected, it is decoded again when
+	// login form is submitted
+	requestMaxAge = 30 * time.Minute
+)
+
+var (
+	ErrInvalidMetadata = errors.New("invalid saml metadata")
+	ErrInvalidRequest  = errors.New("invalid saml request")
+)
+
+// IdP signs assertions with the service signing key. Certificate is
+// self-signed and derived from the key only, so it is stable across
+// restarts and changes only with key rotation.
+type IdP struct {
+	entityID string
+	ssoURL   string
+	key      *jwtLib.SigningKey
+	cert     []byte
+}
+
+func NewIdP(key *jwtLib.SigningKey, entityID string, ssoURL string) (*IdP, error) {
+	serial := sha256.Sum256([]byte(key.ID))
+
+	template := &x509.Certificate{
+		SerialNumber:          new(big.Int).SetBytes(serial[:16]),
+		Subject:               pkix.Name{CommonName: hostOf(entityID)},
+		NotBefore:             time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2124, 1, 1, 0, 0, 0, 0, time.UTC),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.Private.PublicKey, key.Private)
+	if err != nil {
+		return nil, fmt.Errorf("saml certificate: %w", err)
+	}
+
+	return &IdP{entityID: entityID, ssoURL: ssoURL, key: key, cert: cert}, nil
+}
+
+func (i *IdP) EntityID() string {
+	return i.entityID
+}
+
+// Metadata is IdP EntityDescriptor given to service providers.
+func (i *IdP) Metadata() ([]byte, error) {
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+
+	entity := doc.CreateElement("md:EntityDescriptor")
+	entity.CreateAttr("xmlns:md", nsMetadata)
+	entity.CreateAttr("xmlns:ds", nsDSig)
+	entity.CreateAttr("entityID", i.entityID)
+
+	descriptor := entity.CreateElement("md:IDPSSODescriptor")
+	descriptor.CreateAttr("protocolSupportEnumeration", nsProtocol)
+	descriptor.CreateAttr("WantAuthnRequestsSigned", "false")
+
+	keyDescriptor := descriptor.CreateElement("md:KeyDescriptor")
+	keyDescriptor.CreateAttr("use", "signing")
+	keyDescriptor.CreateElement("ds:KeyInfo").
+		CreateElement("ds:X509Data").
+		CreateElement("ds:X509Certificate").
+		SetText(base64.StdEncoding.EncodeToString(i.cert))
+
+	for _, format := range []string{NameIDFormatEmail, NameIDFormatPersistent} {
+		descriptor.CreateElement("md:NameIDFormat").SetText(format)
+	}
+
+	for _, binding := range []string{BindingHTTPRedirect, BindingHTTPPost} {
+		sso := descriptor.CreateElement("md:SingleSignOnService")
+		sso.CreateAttr("Binding", binding)
+		sso.CreateAttr("Location", i.ssoURL)
+	}
+
+	doc.Indent(2)
+	return doc.WriteToBytes()
+}
+
+// ServiceProviderMetadata is what IdP needs from SP metadata.
+type ServiceProviderMetadata struct {
+	EntityID string
+	ACSURL   string
+}
+
+type spEntityDescriptor struct {
+	EntityID   string `xml:"entityID,attr"`
+	Descriptor struct {
+		ACS []struct {
+			Binding   string `xml:"Binding,attr"`
+			Location  string `xml:"Location,attr"`
+			IsDefault bool   `xml:"isDefault,attr"`
+		} `xml:"AssertionConsumerService"`
+	} `xml:"SPSSODescriptor"`
+}
+
+// ParseServiceProviderMetadata reads entity id and HTTP-POST assertion
+// consumer service from SP EntityDescriptor.
+func ParseServiceProviderMetadata(data []byte) (ServiceProviderMetadata, error) {
+	var entity spEntityDescriptor
+	if err := xml.Unmarshal(data, &entity); err != nil {
+		return ServiceProviderMetadata{}, fmt.Errorf("%w: %w", ErrInvalidMetadata, err)
+	}
+	if entity.EntityID == "" {
+		return ServiceProviderMetadata{}, fmt.Errorf("%w: no entityID", ErrInvalidMetadata)
+	}
+
+	meta := ServiceProviderMetadata{EntityID: entity.EntityID}
+	for _, acs := range entity.Descriptor.ACS {
+		if acs.Binding != BindingHTTPPost {
+			continue
+		}
+		if meta.ACSURL == "" || acs.IsDefault {
+			meta.ACSURL = acs.Location
+		}
+	}
+
+	if u, err := url.Parse(meta.ACSURL); err != nil || !u.IsAbs() {
+		return ServiceProviderMetadata{}, fmt.Errorf("%w: no HTTP-POST assertion consumer service", ErrInvalidMetadata)
+	}
+
+	return meta, nil
+}
+
+// AuthnRequest is SP-initiated login request.
+type AuthnRequest struct {
+	ID           string
+	Issuer       string
+	ACSURL       string
+	IssueInstant time.Time
+}
+
+type authnRequest struct {
+	XMLName      xml.Name  `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID           string    `xml:"ID,attr"`
+	Version      string    `xml:"Version,attr"`
+	IssueInstant time.Time `xml:"IssueInstant,attr"`
+	ACSURL       string    `xml:"AssertionConsumerServiceURL,attr"`
+	Issuer       string    `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+}
+
+// DecodeAuthnRequest decodes SAMLRequest parameter, deflated is true for
+// HTTP-Redirect binding.
+func DecodeAuthnRequest(samlRequest string, deflated bool) (AuthnRequest, error) {
+	data, err := base64.StdEncoding.DecodeString(samlRequest)
+	if err != nil {
+		return AuthnRequest{}, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	if deflated {
+		data, err = io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(data)), 1<<20))
+		if err != nil {
+			return AuthnRequest{}, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+		}
+	}
+
+	var req authnRequest
+	if err := xml.Unmarshal(data, &req); err != nil {
+		return AuthnRequest{}, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	if req.ID == "" || req.Version != "2.0" || req.Issuer == "" {
+		return AuthnRequest{}, fmt.Errorf("%w: missing id, version or issuer", ErrInvalidRequest)
+	}
+
+	now := time.Now()
+	if req.IssueInstant.After(now.Add(clockSkew)) || req.IssueInstant.Before(now.Add(-requestMaxAge)) {
+		return AuthnRequest{}, fmt.Errorf("%w: stale request", ErrInvalidRequest)
+	}
+
+	return AuthnRequest{
+		ID:           req.ID,
+		Issuer:       req.Issuer,
+		ACSURL:       req.ACSURL,
+		IssueInstant: req.IssueInstant,
+	}, nil
+}
+
+// Assertion is content of assertion issued to service provider.
+type Assertion struct {
+	Audience     string
+	Recipient    string
+	InResponseTo string
+	NameID       string
+	NameIDFormat string
+	AuthnInstant time.Time
+	Attributes   map[string][]string
+	Lifetime     time.Duration
+}
+
+// Response builds samlp:Response with signed assertion, it is sent to
+// Recipient base64 encoded by HTTP-POST binding.
+func (i *IdP) Response(a Assertion) ([]byte, error) {
+	now := time.Now().UTC()
+	notOnOrAfter := now.Add(a.Lifetime).Format(time.RFC3339)
+
+	assertion := etree.NewElement("saml:Assertion")
+	assertion.CreateAttr("xmlns:saml", nsAssertion)
+	assertion.CreateAttr("ID", newID())
+	assertion.CreateAttr("Version", "2.0")
+	assertion.CreateAttr("IssueInstant", now.Format(time.RFC3339))
+
+	assertion.CreateElement("saml:Issuer").SetText(i.entityID)
+
+	subject := assertion.CreateElement("saml:Subject")
+	nameID := subject.CreateElement("saml:NameID")
+	nameID.CreateAttr("Format", a.NameIDFormat)
+	nameID.SetText(a.NameID)
+
+	confirmation := subject.CreateElement("saml:SubjectConfirmation")
+	confirmation.CreateAttr("Method", confirmationBearer)
+	confirmationData := confirmation.CreateElement("saml:SubjectConfirmationData")
+	confirmationData.CreateAttr("InResponseTo", a.InResponseTo)
+	confirmationData.CreateAttr("NotOnOrAfter", notOnOrAfter)
+	confirmationData.CreateAttr("Recipient", a.Recipient)
+
+	conditions := assertion.CreateElement("saml:Conditions")
+	conditions.CreateAttr("NotBefore", now.Add(-clockSkew).Format(time.RFC3339))
+	conditions.CreateAttr("NotOnOrAfter", notOnOrAfter)
+	conditions.CreateElement("saml:AudienceRestriction").
+		CreateElement("saml:Audience").
+		SetText(a.Audience)
+
+	authn := assertion.CreateElement("saml:AuthnStatement")
+	authn.CreateAttr("AuthnInstant", a.AuthnInstant.UTC().Format(time.RFC3339))
+	authn.CreateAttr("SessionIndex", newID())
+	authn.CreateElement("saml:AuthnContext").
+		CreateElement("saml:AuthnContextClassRef").
+		SetText(authnContextPass)
+
+	if len(a.Attributes) > 0 {
+		statement := assertion.CreateElement("saml:AttributeStatement")
+		for name, values := range a.Attributes {
+			attribute := statement.CreateElement("saml:Attribute")
+			attribute.CreateAttr("Name", name)
+			attribute.CreateAttr("NameFormat", attrFormatBasic)
+			for _, value := range values {
+				attribute.CreateElement("saml:AttributeValue").SetText(value)
+			}
+		}
+	}
+
+	signed, err := i.sign(assertion)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := etree.NewDocument()
+	response := doc.CreateElement("samlp:Response")
+	response.CreateAttr("xmlns:samlp", nsProtocol)
+	response.CreateAttr("xmlns:saml", nsAssertion)
+	response.CreateAttr("ID", newID())
+	response.CreateAttr("Version", "2.0")
+	response.CreateAttr("IssueInstant", now.Format(time.RFC3339))
+	response.CreateAttr("Destination", a.Recipient)
+	response.CreateAttr("InResponseTo", a.InResponseTo)
+
+	response.CreateElement("saml:Issuer").SetText(i.entityID)
+	response.CreateElement("samlp:Status").
+		CreateElement("samlp:StatusCode").
+		CreateAttr("Value", statusSuccess)
+	response.AddChild(signed)
+
+	return doc.WriteToBytes()
+}
+
+// sign adds enveloped signature to assertion, schema requires it right
+// after Issuer.
+func (i *IdP) sign(assertion *etree.Element) (*etree.Element, error) {
+	ctx, err := dsig.NewSigningContext(i.key.Private, [][]byte{i.cert})
+	if err != nil {
+		return nil, err
+	}
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	if err := ctx.SetSignatureMethod(dsig.RSASHA256SignatureMethod); err != nil {
+		return nil, err
+	}
+
+	signed, err := ctx.SignEnveloped(assertion)
+	if err != nil {
+		return nil, fmt.Errorf("sign assertion: %w", err)
+	}
+
+	// signature is appended last, parent of it is not set so it is
+	// moved by position
+	last := len(signed.Child) - 1
+	signature := signed.Child[last]
+	signed.Child = signed.Child[:last]
+	signed.InsertChildAt(1, signature)
+
+	return signed, nil
+}
+
+// newID returns xs:ID, it must not start with digit.
+func newID() string {
+	buf := make([]byte, 20)
+	_, _ = rand.Read(buf)
+	return "_" + hex.EncodeToString(buf)
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Hostname()
+}
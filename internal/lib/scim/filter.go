@@ -0,0 +1,255 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Filter is parsed SCIM filter expression (RFC 7644 3.4.2.2).
+type Filter interface {
+	// Match evaluates filter against resource attributes, keys of attrs are
+	// lower case attribute paths like "username" or "emails.value".
+	Match(attrs map[string][]string) bool
+}
+
+// ParseFilter supports attribute comparisons eq, ne, co, sw, ew, gt, ge,
+// lt, le and pr combined with and, or, not and parentheses. Comparison is
+// case insensitive.
+func ParseFilter(filter string) (Filter, error) {
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidFilter, p.tokens[p.pos])
+	}
+	return f, nil
+}
+
+// EqualityValue returns value when filter is single `attr eq value`, it
+// lets callers use index instead of scanning.
+func EqualityValue(f Filter, attr string) (string, bool) {
+	c, ok := f.(comparison)
+	if !ok || c.op != "eq" || c.attr != strings.ToLower(attr) {
+		return "", false
+	}
+	return c.value, true
+}
+
+type comparison struct {
+	attr  string
+	op    string
+	value string
+}
+
+func (c comparison) Match(attrs map[string][]string) bool {
+	values := attrs[c.attr]
+
+	if c.op == "pr" {
+		return len(values) > 0
+	}
+	if c.op == "ne" {
+		return !(comparison{attr: c.attr, op: "eq", value: c.value}).Match(attrs)
+	}
+
+	want := strings.ToLower(c.value)
+	for _, v := range values {
+		v = strings.ToLower(v)
+
+		var ok bool
+		switch c.op {
+		case "eq":
+			ok = v == want
+		case "co":
+			ok = strings.Contains(v, want)
+		case "sw":
+			ok = strings.HasPrefix(v, want)
+		case "ew":
+			ok = strings.HasSuffix(v, want)
+		case "gt":
+			ok = v > want
+		case "ge":
+			ok = v >= want
+		case "lt":
+			ok = v < want
+		case "le":
+			ok = v <= want
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+type and struct{ left, right Filter }
+
+func (f and) Match(attrs map[string][]string) bool {
+	return f.left.Match(attrs) && f.right.Match(attrs)
+}
+
+type or struct{ left, right Filter }
+
+func (f or) Match(attrs map[string][]string) bool {
+	return f.left.Match(attrs) || f.right.Match(attrs)
+}
+
+type not struct{ inner Filter }
+
+func (f not) Match(attrs map[string][]string) bool {
+	return !f.inner.Match(attrs)
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t
+}
+
+func (p *parser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) or() (Filter, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "or") {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = or{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (Filter, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "and") {
+		p.next()
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = and{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) factor() (Filter, error) {
+	token := p.next()
+
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("%w: unexpected end", ErrInvalidFilter)
+	case token == "(":
+		return p.group()
+	case strings.EqualFold(token, "not"):
+		if p.next() != "(" {
+			return nil, fmt.Errorf("%w: not must be followed by (", ErrInvalidFilter)
+		}
+		inner, err := p.group()
+		if err != nil {
+			return nil, err
+		}
+		return not{inner}, nil
+	}
+
+	attr := strings.ToLower(token)
+	op := strings.ToLower(p.next())
+
+	switch op {
+	case "pr":
+		return comparison{attr: attr, op: op}, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidFilter, op)
+	}
+
+	raw := p.next()
+	if raw == "" {
+		return nil, fmt.Errorf("%w: missing value", ErrInvalidFilter)
+	}
+
+	var value string
+	if strings.HasPrefix(raw, `"`) {
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidFilter, err)
+		}
+	} else {
+		// true, false, null and numbers are compared by text
+		value = raw
+	}
+
+	return comparison{attr: attr, op: op, value: value}, nil
+}
+
+func (p *parser) group() (Filter, error) {
+	inner, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.next() != ")" {
+		return nil, fmt.Errorf("%w: missing )", ErrInvalidFilter)
+	}
+	return inner, nil
+}
+
+func tokenize(filter string) ([]string, error) {
+	var tokens []string
+
+	for i := 0; i < len(filter); {
+		switch c := filter[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			j := i + 1
+			for ; j < len(filter) && filter[j] != '"'; j++ {
+				if filter[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(filter) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrInvalidFilter)
+			}
+			tokens = append(tokens, filter[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(filter) && !strings.ContainsRune(" \t()\"", rune(filter[j])) {
+				j++
+			}
+			tokens = append(tokens, filter[i:j])
+			i = j
+		}
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,97 @@
+package scim
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	attrs := map[string][]string{
+		"username":     {"Alice@Example.com"},
+		"emails.value": {"alice@example.com", "a@corp.example"},
+		"active":       {"true"},
+	}
+
+	tests := []struct {
+		name    string
+		filter  string
+		want    bool
+		wantErr bool
+	}{
+		{name: "eq ignores case", filter: `userName eq "alice@example.com"`, want: true},
+		{name: "eq mismatch", filter: `userName eq "bob@example.com"`},
+		{name: "ne", filter: `userName ne "bob@example.com"`, want: true},
+		{name: "co", filter: `userName co "example"`, want: true},
+		{name: "sw", filter: `userName sw "ALICE"`, want: true},
+		{name: "ew", filter: `userName ew ".org"`},
+		{name: "gt", filter: `userName gt "a"`, want: true},
+		{name: "le", filter: `userName le "a"`},
+		{name: "pr", filter: `emails.value pr`, want: true},
+		{name: "pr missing", filter: `title pr`},
+		{name: "multi-valued", filter: `emails.value eq "a@corp.example"`, want: true},
+		{name: "unquoted value", filter: `active eq true`, want: true},
+		{name: "escaped quote", filter: `userName eq "a\"b"`},
+		{name: "and", filter: `userName sw "alice" and active eq true`, want: true},
+		{name: "and short", filter: `userName sw "alice" and active eq false`},
+		{name: "or", filter: `userName eq "bob" or active eq true`, want: true},
+		{name: "and binds tighter than or", filter: `active eq true or userName eq "bob" and active eq false`, want: true},
+		{name: "parentheses", filter: `(active eq true or userName eq "bob") and active eq false`},
+		{name: "not", filter: `not (userName eq "bob")`, want: true},
+		{name: "keywords ignore case", filter: `userName EQ "alice@example.com" AND NOT (active EQ false)`, want: true},
+		{name: "empty", filter: ``, wantErr: true},
+		{name: "unknown operator", filter: `userName is "alice"`, wantErr: true},
+		{name: "missing value", filter: `userName eq`, wantErr: true},
+		{name: "unterminated string", filter: `userName eq "alice`, wantErr: true},
+		{name: "missing paren", filter: `(userName eq "alice"`, wantErr: true},
+		{name: "not without paren", filter: `not userName eq "alice"`, wantErr: true},
+		{name: "trailing token", filter: `userName eq "alice" active`, wantErr: true},
+		{name: "dangling and", filter: `userName eq "alice" and`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseFilter(tt.filter)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidFilter) {
+					t.Fatalf("ParseFilter() error = %v, want %v", err, ErrInvalidFilter)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFilter() error = %v", err)
+			}
+			if got := f.Match(attrs); got != tt.want {
+				t.Fatalf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEqualityValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		attr   string
+		want   string
+		wantOK bool
+	}{
+		{name: "eq", filter: `userName eq "alice@example.com"`, attr: "userName", want: "alice@example.com", wantOK: true},
+		{name: "attr ignores case", filter: `USERNAME eq "alice"`, attr: "userName", want: "alice", wantOK: true},
+		{name: "other attr", filter: `externalId eq "42"`, attr: "userName"},
+		{name: "other operator", filter: `userName sw "alice"`, attr: "userName"},
+		{name: "compound", filter: `userName eq "alice" and active eq true`, attr: "userName"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("ParseFilter() error = %v", err)
+			}
+			got, ok := EqualityValue(f, tt.attr)
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("EqualityValue() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+// Package scim has SCIM 2.0 (RFC 7643, RFC 7644) resource representations,
+// filter and PATCH parsing used by provisioning API.
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	SchemaUser          = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup         = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp       = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError         = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaServiceConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType  = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+
+	ContentType = "application/scim+json"
+
+	DefaultCount = 100
+	MaxCount     = 1000
+)
+
+var (
+	ErrInvalidFilter = errors.New("invalid scim filter")
+	ErrInvalidPatch  = errors.New("invalid scim patch")
+)
+
+type Meta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	Location     string     `json:"location,omitempty"`
+}
+
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// Ref is member of group or group of user.
+type Ref struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type User struct {
+	Schemas  []string `json:"schemas"`
+	ID       string   `json:"id,omitempty"`
+	UserName string   `json:"userName"`
+	Emails   []Email  `json:"emails,omitempty"`
+	Active   *bool    `json:"active,omitempty"`
+	Password string   `json:"password,omitempty"`
+	Groups   []Ref    `json:"groups,omitempty"`
+	Meta     *Meta    `json:"meta,omitempty"`
+}
+
+// Attributes are values of user seen by filter.
+func (u User) Attributes() map[string][]string {
+	attrs := map[string][]string{
+		"id":       {u.ID},
+		"username": {u.UserName},
+	}
+	if u.Active != nil {
+		attrs["active"] = []string{fmt.Sprint(*u.Active)}
+	}
+	for _, email := range u.Emails {
+		attrs["emails"] = append(attrs["emails"], email.Value)
+		attrs["emails.value"] = append(attrs["emails.value"], email.Value)
+	}
+	for _, group := range u.Groups {
+		attrs["groups"] = append(attrs["groups"], group.Value)
+		attrs["groups.value"] = append(attrs["groups.value"], group.Value)
+		attrs["groups.display"] = append(attrs["groups.display"], group.Display)
+	}
+	return attrs
+}
+
+type Group struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	DisplayName string   `json:"displayName"`
+	Members     []Ref    `json:"members,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// Attributes are values of group seen by filter.
+func (g Group) Attributes() map[string][]string {
+	attrs := map[string][]string{
+		"id":          {g.ID},
+		"displayname": {g.DisplayName},
+	}
+	for _, member := range g.Members {
+		attrs["members"] = append(attrs["members"], member.Value)
+		attrs["members.value"] = append(attrs["members.value"], member.Value)
+	}
+	return attrs
+}
+
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+// NewListResponse returns page of all matched resources, startIndex is 1-based.
+func NewListResponse[T any](resources []T, startIndex int, count int) ListResponse {
+	total := len(resources)
+
+	from := min(max(startIndex, 1)-1, total)
+	to := min(from+max(count, 0), total)
+
+	return NewListPage(resources[from:to], total, from+1)
+}
+
+// NewListPage wraps page which was already cut by storage.
+func NewListPage[T any](page []T, total int, startIndex int) ListResponse {
+	resources := make([]any, 0, len(page))
+	for _, r := range page {
+		resources = append(resources, r)
+	}
+
+	return ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   max(startIndex, 1),
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
+
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+func NewError(status int, scimType string, detail string) Error {
+	return Error{
+		Schemas:  []string{SchemaError},
+		Status:   fmt.Sprint(status),
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
+
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Normalize lower cases op and checks it. Azure AD sends "Replace" and "Add".
+func (o PatchOperation) Normalize() (PatchOperation, error) {
+	o.Op = strings.ToLower(o.Op)
+	switch o.Op {
+	case "add", "replace", "remove":
+	default:
+		return o, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, o.Op)
+	}
+	if o.Op == "remove" && o.Path == "" {
+		return o, fmt.Errorf("%w: remove requires path", ErrInvalidPatch)
+	}
+	return o, nil
+}
+
+// ValueFilter splits path like `members[value eq "id"]` to attribute and
+// filter, filter is nil for plain path.
+func ValueFilter(path string) (string, Filter, error) {
+	open := strings.IndexByte(path, '[')
+	if open < 0 {
+		return strings.ToLower(path), nil, nil
+	}
+	if !strings.HasSuffix(path, "]") {
+		return "", nil, fmt.Errorf("%w: bad path %q", ErrInvalidPatch, path)
+	}
+
+	f, err := ParseFilter(path[open+1 : len(path)-1])
+	if err != nil {
+		return "", nil, err
+	}
+	return strings.ToLower(path[:open]), f, nil
+}
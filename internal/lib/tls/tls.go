@@ -1,13 +1,250 @@
+// Package tls serves certificates of gRPC server. Certificate, key and
+// client CA bundle are reloaded when files change, so rotated certificates
+// are picked up without restart.
 package tls
 
+import (
+	cryptotls "crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"SSO/internal/lib/logger/sl"
+)
+
+const defaultReloadInterval = 30 * time.Second
+
+var ErrInvalidConfig = errors.New("invalid tls config")
+
 type Config struct {
 	CertFile string
 	KeyFile  string
+
+	// ClientCAFile is PEM bundle client certificates are verified against,
+	// empty disables mutual TLS.
+	ClientCAFile string
+	// RequireClientCert rejects clients without certificate, otherwise
+	// certificate is verified only when client sends it.
+	RequireClientCert bool
+
+	// ReloadInterval is how often files are checked for changes.
+	ReloadInterval time.Duration
 }
 
 func NewConfig(certFile string, keyFile string) *Config {
 	return &Config{
-		CertFile: certFile,
-		KeyFile:  keyFile,
+		CertFile:       certFile,
+		KeyFile:        keyFile,
+		ReloadInterval: defaultReloadInterval,
+	}
+}
+
+// NewConfigByEnv builds Config from string settings, empty values keep
+// defaults.
+func NewConfigByEnv(certFile string, keyFile string, clientCAFile string, requireClientCert string, reloadInterval string) (*Config, error) {
+	cfg := NewConfig(certFile, keyFile)
+	cfg.ClientCAFile = clientCAFile
+
+	if requireClientCert != "" {
+		value, err := strconv.ParseBool(requireClientCert)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RequireClientCert = value
+	}
+
+	if reloadInterval != "" {
+		interval, err := time.ParseDuration(reloadInterval)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ReloadInterval = interval
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func (c *Config) Validate() error {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return fmt.Errorf("%w: cert and key files are required", ErrInvalidConfig)
+	}
+	if c.RequireClientCert && c.ClientCAFile == "" {
+		return fmt.Errorf("%w: client ca file is required to verify client certificates", ErrInvalidConfig)
+	}
+	if c.ReloadInterval <= 0 {
+		return fmt.Errorf("%w: reload interval must be positive", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Reloader keeps current certificate and client CA pool.
+type Reloader struct {
+	cfg Config
+	log *slog.Logger
+
+	mu        sync.RWMutex
+	cert      *cryptotls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewReloader loads files once, broken files fail startup instead of
+// first handshake.
+func NewReloader(cfg Config, log *slog.Logger) (*Reloader, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	r := &Reloader{cfg: cfg, log: log, stop: make(chan struct{})}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// ServerConfig is TLS config of server, every handshake uses certificate
+// and CA pool loaded last.
+func (r *Reloader) ServerConfig() *cryptotls.Config {
+	return &cryptotls.Config{
+		MinVersion: cryptotls.VersionTLS12,
+		GetConfigForClient: func(*cryptotls.ClientHelloInfo) (*cryptotls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			cfg := &cryptotls.Config{
+				MinVersion:   cryptotls.VersionTLS12,
+				Certificates: []cryptotls.Certificate{*r.cert},
+				NextProtos:   []string{"h2"},
+			}
+
+			if r.clientCAs != nil {
+				cfg.ClientCAs = r.clientCAs
+				cfg.ClientAuth = cryptotls.VerifyClientCertIfGiven
+				if r.cfg.RequireClientCert {
+					cfg.ClientAuth = cryptotls.RequireAndVerifyClientCert
+				}
+			}
+
+			return cfg, nil
+		},
+	}
+}
+
+// Run checks files every ReloadInterval until Stop. Failed reload keeps
+// previous certificate.
+func (r *Reloader) Run() {
+	ticker := time.NewTicker(r.cfg.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			changed, err := r.changed()
+			if err != nil {
+				r.log.Error("failed to stat tls files", sl.Err(err))
+				continue
+			}
+			if !changed {
+				continue
+			}
+
+			if err := r.load(); err != nil {
+				r.log.Error("failed to reload tls files, keeping previous certificate", sl.Err(err))
+				continue
+			}
+			r.log.Info("tls certificate reloaded", slog.String("cert_file", r.cfg.CertFile))
+		}
+	}
+}
+
+func (r *Reloader) Stop() {
+	r.once.Do(func() { close(r.stop) })
+}
+
+func (r *Reloader) load() error {
+	modTimes, err := r.stat()
+	if err != nil {
+		return err
+	}
+
+	cert, err := cryptotls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load key pair: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		data, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("read client ca: %w", err)
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("%w: no certificates in %s", ErrInvalidConfig, r.cfg.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	r.mu.Unlock()
+
+	return nil
+}
+
+func (r *Reloader) changed() (bool, error) {
+	modTimes, err := r.stat()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for file, modTime := range modTimes {
+		if !modTime.Equal(r.modTimes[file]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *Reloader) stat() (map[string]time.Time, error) {
+	modTimes := map[string]time.Time{}
+	for _, file := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		modTimes[file] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// Principal is identity of client certificate: first URI SAN (SPIFFE ID),
+// first DNS SAN or subject common name.
+func Principal(cert *x509.Certificate) string {
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
 	}
+	return cert.Subject.CommonName
 }
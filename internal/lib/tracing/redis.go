@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	redisGo "github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RedisHook creates client span for every Redis command, add it with
+// AddHook. Command arguments are not recorded, they hold tokens.
+func RedisHook() redisGo.Hook {
+	return redisHook{}
+}
+
+type redisHook struct{}
+
+func (redisHook) DialHook(next redisGo.DialHook) redisGo.DialHook {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		ctx, span := startRedisSpan(ctx, "redis dial")
+
+		conn, err := next(ctx, network, addr)
+
+		End(span, err)
+		return conn, err
+	}
+}
+
+func (redisHook) ProcessHook(next redisGo.ProcessHook) redisGo.ProcessHook {
+	return func(ctx context.Context, cmd redisGo.Cmder) error {
+		ctx, span := startRedisSpan(ctx, "redis "+cmd.Name(),
+			semconv.DBOperationName(cmd.Name()),
+		)
+
+		err := next(ctx, cmd)
+
+		End(span, redisError(err))
+		return err
+	}
+}
+
+func (redisHook) ProcessPipelineHook(next redisGo.ProcessPipelineHook) redisGo.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redisGo.Cmder) error {
+		ctx, span := startRedisSpan(ctx, "redis pipeline",
+			attribute.Int("db.redis.num_cmd", len(cmds)),
+		)
+
+		err := next(ctx, cmds)
+
+		End(span, redisError(err))
+		return err
+	}
+}
+
+func startRedisSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(append(attrs, semconv.DBSystemRedis)...),
+	)
+}
+
+// redisError ignores missing key, it is ordinary answer.
+func redisError(err error) error {
+	if errors.Is(err, redisGo.Nil) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"SSO/internal/lib/jwtLib"
+	"SSO/internal/lib/logger/sl"
+	"SSO/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// AdminPermission is permission of admin app, user holding it may call
+// admin RPCs with access token of that app.
+const AdminPermission = "sso.admin"
+
+// AuthorizeAdmin checks bearer token of admin RPC caller and returns its
+// email for audit. Permission is checked in storage so revoked admin stops
+// at once, delegated and service tokens are refused.
+func (a *Auth) AuthorizeAdmin(ctx context.Context, accessToken string, adminApp uuid.UUID) (string, error) {
+	const op = "Auth.AuthorizeAdmin"
+
+	claims, err := jwtLib.ParseAccessToken(accessToken, a.authApp)
+	if err != nil {
+		a.log.Info("invalid admin token", slog.String("op", op), sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", op, ErrInvalidAccessToken)
+	}
+
+	if _, ok := claims["act"]; ok {
+		return "", fmt.Errorf("%s: %w", op, ErrNotAdmin)
+	}
+	if _, ok := claims["client_id"]; ok {
+		return "", fmt.Errorf("%s: %w", op, ErrNotAdmin)
+	}
+
+	app, _ := claims["app"].(string)
+	email, _ := claims["email"].(string)
+	if app != adminApp.String() || email == "" {
+		return "", fmt.Errorf("%s: %w", op, ErrNotAdmin)
+	}
+
+	user, err := a.storage.UserWithPermissions(ctx, email, adminApp)
+	if errors.Is(err, storage.ErrUserNotFound) {
+		return "", fmt.Errorf("%s: %w", op, ErrNotAdmin)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if user.Disabled || !user.Permissions[AdminPermission] {
+		return "", fmt.Errorf("%s: %w", op, ErrNotAdmin)
+	}
+
+	return email, nil
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/logger/sl"
+	"SSO/internal/lib/requestmeta"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultAuditPageSize = 50
+	MaxAuditPageSize     = 500
+
+	// anonymousActor is actor of calls without authenticated caller.
+	anonymousActor = "anonymous"
+)
+
+// AuditStorage keeps audit events, it never updates or deletes them.
+type AuditStorage interface {
+	SaveAuditEvent(ctx context.Context, event models.AuditEvent) error
+	AuditEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error)
+}
+
+// recordAudit completes event from request context and outcome and stores
+// it. Failure to store is logged and does not fail audited operation.
+// selfService marks flows where subject acts on own behalf.
+func (a *Auth) recordAudit(ctx context.Context, event models.AuditEvent, selfService bool, err error) {
+	event.UUID = uuid.New()
+	event.Time = time.Now().UTC()
+	event.IP = requestmeta.ClientIP(ctx)
+
+	event.Actor = requestmeta.Actor(ctx)
+	if event.Actor == "" {
+		event.Actor = anonymousActor
+		if selfService && event.Subject != "" {
+			event.Actor = event.Subject
+		}
+	}
+
+	event.Outcome = models.AuditSuccess
+	if err != nil {
+		event.Outcome = models.AuditFailure
+		event.Reason = failureReason(err)
+	}
+
+	// event is stored even when caller went away
+	if err := a.audit.SaveAuditEvent(context.WithoutCancel(ctx), event); err != nil {
+		a.log.Error("failed to save audit event",
+			slog.String("action", event.Action),
+			slog.String("subject", event.Subject),
+			slog.String("outcome", event.Outcome),
+			sl.Err(err),
+		)
+	}
+}
+
+// QueryAuditEvents returns page of events matching filter, newest first.
+// nextPageToken is empty on the last page.
+func (a *Auth) QueryAuditEvents(
+	ctx context.Context,
+	filter models.AuditFilter,
+	pageSize int,
+	pageToken string,
+) (events []models.AuditEvent, nextPageToken string, err error) {
+	const op = "Auth.QueryAuditEvents"
+
+	switch {
+	case pageSize == 0:
+		pageSize = DefaultAuditPageSize
+	case pageSize < 0 || pageSize > MaxAuditPageSize:
+		return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidAuditQuery)
+	}
+
+	if pageToken != "" {
+		filter.BeforeTime, filter.BeforeUUID, err = decodeAuditPageToken(pageToken)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidAuditQuery)
+		}
+	}
+
+	// one more than page tells whether next page exists
+	filter.Limit = pageSize + 1
+
+	events, err = a.audit.AuditEvents(ctx, filter)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(events) > pageSize {
+		events = events[:pageSize]
+		last := events[len(events)-1]
+		nextPageToken = encodeAuditPageToken(last.Time, last.UUID)
+	}
+
+	return events, nextPageToken, nil
+}
+
+// audit page token is opaque cursor of last returned event.
+func encodeAuditPageToken(t time.Time, eventUUID uuid.UUID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(t.UnixNano(), 10) + ":" + eventUUID.String()))
+}
+
+func decodeAuditPageToken(token string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return time.Time{}, uuid.Nil, fmt.Errorf("malformed page token")
+	}
+
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	eventUUID, err := uuid.Parse(id)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+
+	return time.Unix(0, n).UTC(), eventUUID, nil
+}
@@ -3,7 +3,7 @@ package auth
 import (
 	verfic "SSO/internal/lib/verifications"
 	"SSO/internal/storage"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/google/uuid"
 	_ "sync"
 
@@ -14,9 +14,13 @@ import (
 	"time"
 
 	"SSO/internal/domain/models"
+	"SSO/internal/lib/hasher"
 	"SSO/internal/lib/jwtLib"
 	"SSO/internal/lib/logger/sl"
-	"golang.org/x/crypto/bcrypt"
+	"SSO/internal/lib/mailer"
+	"SSO/internal/lib/metrics"
+	"SSO/internal/lib/saml"
+	"SSO/internal/lib/upstream"
 	"golang.org/x/time/rate"
 )
 
@@ -27,49 +31,149 @@ var (
 type Storage interface {
 	User(ctx context.Context, email string) (models.User, error)
 	UserWithPermissions(ctx context.Context, email string, appUUID uuid.UUID) (models.User, error)
-	SaveUser(ctx context.Context, uuid uuid.UUID, email string, passHash []byte) error
+	// Methods taking events write them to outbox in the same transaction
+	// as the change.
+	SaveUser(ctx context.Context, uuid uuid.UUID, email string, passHash []byte, events []models.IdentityEvent) error
+	UpdatePassHash(ctx context.Context, userUUID uuid.UUID, passHash []byte) error
 	SaveApp(ctx context.Context, appUUID uuid.UUID, name string) (uuid.UUID, error)
-	DeletePermission(ctx context.Context, permUUID uuid.UUID, appUUID uuid.UUID) error
+	DeletePermission(ctx context.Context, permUUID uuid.UUID, appUUID uuid.UUID, events []models.IdentityEvent) error
 	SavePermission(ctx context.Context, permUUID uuid.UUID, appUUID uuid.UUID, permission string) (models.Permission, error)
-	AddUserPermissions(ctx context.Context, email string, appUUID uuid.UUID, permUUID uuid.UUID) error
-	RevokeUserPermissions(ctx context.Context, email string, appUUID uuid.UUID, permUUID uuid.UUID) error
+	AddUserPermissions(ctx context.Context, email string, appUUID uuid.UUID, permUUID uuid.UUID, events []models.IdentityEvent) error
+	RevokeUserPermissions(ctx context.Context, email string, appUUID uuid.UUID, permUUID uuid.UUID, events []models.IdentityEvent) error
 	GetAppPermissions(ctx context.Context, appUUID uuid.UUID) ([]models.Permission, error)
+	SaveMFASecret(ctx context.Context, userUUID uuid.UUID, secret string) error
+	MFASecret(ctx context.Context, userUUID uuid.UUID) (secret string, enabled bool, err error)
+	EnableMFA(ctx context.Context, userUUID uuid.UUID, recoveryCodeHashes [][]byte) error
+	UseRecoveryCode(ctx context.Context, userUUID uuid.UUID, codeHash []byte) error
+	SaveWebAuthnCredential(ctx context.Context, cred models.WebAuthnCredential) error
+	WebAuthnCredentials(ctx context.Context, userUUID uuid.UUID) ([]models.WebAuthnCredential, error)
+	UpdateWebAuthnCredential(ctx context.Context, credID []byte, signCount uint32, data []byte) error
+	SaveOAuthClient(ctx context.Context, client models.OAuthClient) error
+	OAuthClient(ctx context.Context, clientID string) (models.OAuthClient, error)
+	SaveServiceAccount(ctx context.Context, account models.ServiceAccount) error
+	ServiceAccount(ctx context.Context, clientID string) (models.ServiceAccount, error)
+	AddServiceAccountPermission(ctx context.Context, clientID string, appUUID uuid.UUID, permUUID uuid.UUID) error
+	ServiceAccountPermissions(ctx context.Context, clientID string, appUUID uuid.UUID) (map[string]bool, error)
+	SaveExternalIdentity(ctx context.Context, identity models.ExternalIdentity) error
+	ExternalIdentity(ctx context.Context, provider string, subject string) (models.ExternalIdentity, error)
+	SaveSAMLServiceProvider(ctx context.Context, sp models.SAMLServiceProvider) error
+	SAMLServiceProvider(ctx context.Context, entityID string) (models.SAMLServiceProvider, error)
+	UserByUUID(ctx context.Context, userUUID uuid.UUID) (models.User, error)
+	Users(ctx context.Context, offset int, limit int) (users []models.User, total int, err error)
+	// AppUsers pages users holding any permission of app.
+	AppUsers(ctx context.Context, appUUID uuid.UUID, offset int, limit int) (users []models.User, total int, err error)
+	UpdateUser(ctx context.Context, user models.User, events []models.IdentityEvent) error
+	DeleteUser(ctx context.Context, userUUID uuid.UUID, events []models.IdentityEvent) error
+	PermissionUsers(ctx context.Context, permUUID uuid.UUID) ([]models.User, error)
+	// SaveOutboxEvents writes events of changes made outside database.
+	SaveOutboxEvents(ctx context.Context, events []models.IdentityEvent) error
+	// Ping checks database is reachable, used by readiness checks.
+	Ping(ctx context.Context) error
+}
+
+// Casher keeps short-lived state: refresh tokens, login challenges and
+// sessions of multi-step flows. Take and get methods return redis.Nil when
+// key is missing or expired, Take deletes the key so state is used once.
+type Casher interface {
+	SetUserRefresh(ctx context.Context, email string, appUUID uuid.UUID, refreshToken string) error
+	RotateUserRefresh(ctx context.Context, email string, appUUID uuid.UUID, current string, next string) (bool, error)
+	BlockUserRefresh(ctx context.Context, email string, appUUID uuid.UUID) error
+	SetMFAChallenge(ctx context.Context, tokenHash string, email string, appUUID uuid.UUID, ttl time.Duration) error
+	TakeMFAChallenge(ctx context.Context, tokenHash string) (string, uuid.UUID, error)
+	UseTOTPStep(ctx context.Context, userUUID uuid.UUID, step int64, ttl time.Duration) (bool, error)
+	SetMagicLink(ctx context.Context, tokenHash string, email string, appUUID uuid.UUID, ttl time.Duration) error
+	TakeMagicLink(ctx context.Context, tokenHash string) (string, uuid.UUID, error)
+	SetWebAuthnSession(ctx context.Context, sessionID string, session []byte, ttl time.Duration) error
+	TakeWebAuthnSession(ctx context.Context, sessionID string) ([]byte, error)
+	SetOAuthCode(ctx context.Context, codeHash string, code []byte, ttl time.Duration) error
+	TakeOAuthCode(ctx context.Context, codeHash string) ([]byte, error)
+	SetFederationState(ctx context.Context, stateHash string, state []byte, ttl time.Duration) error
+	TakeFederationState(ctx context.Context, stateHash string) ([]byte, error)
+	SetFederationMFA(ctx context.Context, challengeHash string, pending []byte, ttl time.Duration) error
+	TakeFederationMFA(ctx context.Context, challengeHash string) ([]byte, error)
+	SetDeviceAuthorization(ctx context.Context, deviceCodeHash string, userCode string, authorization []byte, ttl time.Duration) error
+	DeviceCodeByUserCode(ctx context.Context, userCode string) (string, error)
+	DeviceAuthorization(ctx context.Context, deviceCodeHash string) ([]byte, error)
+	UpdateDeviceAuthorization(ctx context.Context, deviceCodeHash string, current []byte, next []byte) (bool, error)
+	DeleteDeviceAuthorization(ctx context.Context, deviceCodeHash string, userCode string) (bool, error)
 }
 
 type Auth struct {
-	authApp      models.AuthApp
-	casher       *models.RedisCasher
-	accessTTL    time.Duration
-	refreshTTL   time.Duration
-	storage      Storage
-	regLimiter   *rate.Limiter
-	loginLimiter *rate.Limiter
-	log          *slog.Logger
+	authApp       models.AuthApp
+	casher        Casher
+	accessTTL     time.Duration
+	refreshTTL    time.Duration
+	storage       Storage
+	audit         AuditStorage
+	regLimiter    *rate.Limiter
+	loginLimiter  *rate.Limiter
+	hasher        *hasher.Hasher
+	authenticator Authenticator
+	webAuthn      *webauthn.WebAuthn // nil when passkeys are disabled
+	signingKey    *jwtLib.SigningKey
+	issuer        string
+	mailer        mailer.Mailer
+	magicLinkURL  string
+	providers     map[string]*upstream.Provider
+	samlIdP       *saml.IdP
+	metrics       *metrics.Metrics
+	log           *slog.Logger
 }
 
 func New(
 	AuthApp models.AuthApp,
-	Casher *models.RedisCasher,
+	Casher Casher,
 	AccessTTL time.Duration,
 	RefreshTTL time.Duration,
 	Storage Storage,
+	Audit AuditStorage,
 	RegLimiter *rate.Limiter,
 	LoginLimiter *rate.Limiter,
+	Hasher *hasher.Hasher,
+	Authenticator Authenticator,
+	WebAuthn *webauthn.WebAuthn,
+	SigningKey *jwtLib.SigningKey,
+	Issuer string,
+	Mailer mailer.Mailer,
+	MagicLinkURL string,
+	Providers []*upstream.Provider,
+	SAMLIdP *saml.IdP,
+	Metrics *metrics.Metrics,
 	Log *slog.Logger,
 
 ) *Auth {
+	providers := make(map[string]*upstream.Provider, len(Providers))
+	for _, provider := range Providers {
+		providers[provider.Name()] = provider
+	}
+
+	if Authenticator == nil {
+		Authenticator = NewLocalAuthenticator(Hasher)
+	}
+
 	return &Auth{
-		authApp:      AuthApp,
-		casher:       Casher,
-		accessTTL:    AccessTTL,
-		refreshTTL:   RefreshTTL,
-		storage:      Storage,
-		regLimiter:   RegLimiter,
-		loginLimiter: LoginLimiter,
-		log:          Log,
+		authApp:       AuthApp,
+		casher:        Casher,
+		accessTTL:     AccessTTL,
+		refreshTTL:    RefreshTTL,
+		storage:       Storage,
+		audit:         Audit,
+		regLimiter:    RegLimiter,
+		loginLimiter:  LoginLimiter,
+		hasher:        Hasher,
+		authenticator: Authenticator,
+		webAuthn:      WebAuthn,
+		signingKey:    SigningKey,
+		issuer:        Issuer,
+		mailer:        Mailer,
+		magicLinkURL:  MagicLinkURL,
+		providers:     providers,
+		samlIdP:       SAMLIdP,
+		metrics:       Metrics,
+		log:           Log,
 	}
 }
-func (a *Auth) RegisterNewUser(ctx context.Context, email string, password string) (uuid.UUID, error) {
+func (a *Auth) RegisterNewUser(ctx context.Context, email string, password string) (_ uuid.UUID, err error) {
 	const op = "Auth.RegisterNewUser"
 	log := a.log.With(
 		slog.String("op", op),
@@ -77,13 +181,16 @@ func (a *Auth) RegisterNewUser(ctx context.Context, email string, password strin
 	)
 	log.Info("registering user")
 
+	defer func() { a.observeRegistration(ctx, email, err) }()
+
 	if !a.regLimiter.Allow() {
 		log.Error("too many requests")
+		a.metrics.RateLimited(metrics.LimiterRegister)
 
-		return uuid.Nil, fmt.Errorf("%s: %w", op, "too many requests")
+		return uuid.Nil, fmt.Errorf("%s: %w", op, ErrTooManyRequests)
 	}
 
-	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	passHash, err := a.hasher.Hash(password)
 	if err != nil {
 		log.Error("failed to generate password hash", sl.Err(err))
 
@@ -95,13 +202,18 @@ func (a *Auth) RegisterNewUser(ctx context.Context, email string, password strin
 		log.Error("failed to generate uuid", sl.Err(err))
 	}
 
-	err = a.storage.SaveUser(ctx, userUUID, email, passHash)
+	err = a.storage.SaveUser(ctx, userUUID, email, passHash, outboxEvents(models.IdentityEvent{
+		Type:     models.EventUserRegistered,
+		UserUUID: userUUID,
+		Email:    email,
+	}))
 
 	if err != nil {
 		log.Error("failed to save user", sl.Err(err))
 
 		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
 	}
+
 	return userUUID, nil
 }
 
@@ -110,7 +222,7 @@ func (a *Auth) Login(
 	email string,
 	password string,
 	appUUID uuid.UUID,
-) (string, string, error) {
+) (_ string, _ string, err error) {
 
 	const op = "Auth.Login"
 
@@ -118,63 +230,148 @@ func (a *Auth) Login(
 
 	log.Info("attempting to login user")
 
-	if !a.regLimiter.Allow() {
-		log.Error("too many requests")
+	defer func() { a.observeLogin(ctx, loginMethodPassword, email, appUUID, err) }()
 
-		return "", "", fmt.Errorf("%s: %w", op, "too many requests")
+	user, err := a.checkPassword(ctx, email, password, appUUID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	user, err := a.storage.UserWithPermissions(ctx, email, appUUID)
-	if err != nil {
-		if errors.Is(err, storage.ErrUserNotFound) {
-			a.log.Warn("user not found", sl.Err(err))
+	if user.MFAEnabled {
+		challenge, err := a.createMFAChallenge(ctx, user.Email, appUUID)
+		if err != nil {
+			a.log.Error("failed to create mfa challenge", sl.Err(err))
 
-			return "", "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+			return "", "", fmt.Errorf("%s: %w", op, err)
 		}
+		log.Info("mfa required")
 
-		a.log.Error("failed to get user", sl.Err(err))
+		return "", "", fmt.Errorf("%s: %w", op, &MFARequiredError{ChallengeToken: challenge})
+	}
+
+	tokenPair, err := a.createTokenPair(ctx, user, appUUID)
+	if err != nil {
+		a.log.Error("failed to create token pair", sl.Err(err))
 
 		return "", "", fmt.Errorf("%s: %w", op, err)
 	}
+	return tokenPair.AccessToken, tokenPair.RefreshToken, nil
+}
 
-	if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(password)); err != nil {
-		a.log.Info("invalid credentials", sl.Err(err))
+// checkPassword verifies user credentials with authenticator. Outdated local
+// hash is upgraded, directory users get permissions synced from groups.
+func (a *Auth) checkPassword(ctx context.Context, email string, password string, appUUID uuid.UUID) (models.User, error) {
+	if !a.loginLimiter.Allow() {
+		a.log.Error("too many requests")
+		a.metrics.RateLimited(metrics.LimiterLogin)
 
-		return "", "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+		return models.User{}, ErrTooManyRequests
 	}
 
-	tokenPair, err := a.createTokenPair(ctx, user, appUUID)
+	stored := true
+	user, err := a.storage.UserWithPermissions(ctx, email, appUUID)
 	if err != nil {
-		a.log.Error("failed to create token pair", sl.Err(err))
+		if !errors.Is(err, storage.ErrUserNotFound) {
+			a.log.Error("failed to get user", sl.Err(err))
 
-		return "", "", fmt.Errorf("%s: %w", op, err)
+			return models.User{}, err
+		}
+		if !a.authenticator.Provisions() {
+			a.log.Warn("user not found", sl.Err(err))
+
+			return models.User{}, ErrInvalidCredentials
+		}
+		stored = false
+		user = models.User{Email: email}
 	}
-	return tokenPair.AccessToken, tokenPair.RefreshToken, nil
+
+	if user.Disabled {
+		a.log.Info("user is disabled", slog.String("email", email))
+
+		return models.User{}, ErrInvalidCredentials
+	}
+
+	directory, err := a.authenticator.Authenticate(ctx, user, password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			a.log.Info("invalid credentials", sl.Err(err))
+
+			return models.User{}, ErrInvalidCredentials
+		}
+
+		a.log.Error("failed to authenticate", sl.Err(err))
+
+		return models.User{}, err
+	}
+
+	if directory != nil {
+		return a.syncDirectoryUser(ctx, user, stored, appUUID, directory)
+	}
+
+	a.rehashIfNeeded(ctx, user, password)
+
+	return user, nil
 }
 
-func (a *Auth) Logout(ctx context.Context, email string, appUUID uuid.UUID) error {
+func (a *Auth) Logout(ctx context.Context, email string, appUUID uuid.UUID) (err error) {
 	op := "Auth.Logout"
-	err := a.casher.BlockUserRefresh(ctx, email, appUUID)
+
+	defer func() {
+		a.recordAudit(ctx, models.AuditEvent{Subject: email, AppUUID: appUUID, Action: models.AuditLogout}, false, err)
+	}()
+
+	err = a.casher.BlockUserRefresh(ctx, email, appUUID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// logout is in Redis, event can't share its transaction; on failure
+	// caller repeats logout, it is idempotent
+	err = a.storage.SaveOutboxEvents(ctx, outboxEvents(models.IdentityEvent{
+		Type:    models.EventUserLoggedOut,
+		AppUUID: appUUID,
+		Email:   email,
+	}))
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 	return nil
 }
 
-func (a *Auth) AddPermission(ctx context.Context, appUUID uuid.UUID, permission string) (uuid.UUID, error) {
+func (a *Auth) AddPermission(ctx context.Context, appUUID uuid.UUID, permission string) (permissionUUID uuid.UUID, err error) {
 	op := "Auth.AddPermission"
-	permissionUUID, err := uuid.NewRandom()
+
+	defer func() {
+		a.recordAudit(ctx, models.AuditEvent{
+			AppUUID: appUUID,
+			Action:  models.AuditPermissionCreate,
+			Target:  permission,
+		}, false, err)
+	}()
+
+	permissionUUID, err = uuid.NewRandom()
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
 	}
 	_, err = a.storage.SavePermission(ctx, permissionUUID, appUUID, permission)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
 	return permissionUUID, nil
 }
 
-func (a *Auth) RemovePermission(ctx context.Context, appUUID uuid.UUID, permissionUUID uuid.UUID) error {
+func (a *Auth) RemovePermission(ctx context.Context, appUUID uuid.UUID, permissionUUID uuid.UUID) (err error) {
 	op := "Auth.RemovePermission"
 
-	err := a.storage.DeletePermission(ctx, appUUID, permissionUUID)
+	defer func() {
+		a.recordAudit(ctx, models.AuditEvent{
+			AppUUID: appUUID,
+			Action:  models.AuditPermissionDelete,
+			Target:  permissionUUID.String(),
+		}, false, err)
+	}()
+
+	err = a.deletePermission(ctx, appUUID, permissionUUID)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -184,10 +381,25 @@ func (a *Auth) RemovePermission(ctx context.Context, appUUID uuid.UUID, permissi
 func (a *Auth) GrantPermission(ctx context.Context, email string, AppUUID uuid.UUID, permissionUUID uuid.UUID) (accessToken string, refreshToken string, err error) {
 	op := "Auth.GrantPermission"
 
-	err = a.storage.AddUserPermissions(ctx, email, permissionUUID, AppUUID)
+	defer func() {
+		a.recordAudit(ctx, models.AuditEvent{
+			Subject: email,
+			AppUUID: AppUUID,
+			Action:  models.AuditPermissionGrant,
+			Target:  permissionUUID.String(),
+		}, false, err)
+	}()
+
+	err = a.storage.AddUserPermissions(ctx, email, AppUUID, permissionUUID, outboxEvents(models.IdentityEvent{
+		Type:           models.EventPermissionGranted,
+		AppUUID:        AppUUID,
+		Email:          email,
+		PermissionUUID: permissionUUID,
+	}))
 	if err != nil {
 		return "", "", fmt.Errorf("%s: %w", op, err)
 	}
+
 	user, err := a.storage.UserWithPermissions(ctx, email, AppUUID)
 	if err != nil {
 		return "", "", fmt.Errorf("%s: %w", op, err)
@@ -203,10 +415,25 @@ func (a *Auth) GrantPermission(ctx context.Context, email string, AppUUID uuid.U
 func (a *Auth) RevokePermission(ctx context.Context, email string, AppUUID uuid.UUID, permissionUUID uuid.UUID) (accessToken string, refreshToken string, err error) {
 	op := "Auth.RevokePermission"
 
-	err = a.storage.RevokeUserPermissions(ctx, email, permissionUUID, AppUUID)
+	defer func() {
+		a.recordAudit(ctx, models.AuditEvent{
+			Subject: email,
+			AppUUID: AppUUID,
+			Action:  models.AuditPermissionRevoke,
+			Target:  permissionUUID.String(),
+		}, false, err)
+	}()
+
+	err = a.storage.RevokeUserPermissions(ctx, email, AppUUID, permissionUUID, outboxEvents(models.IdentityEvent{
+		Type:           models.EventPermissionRevoked,
+		AppUUID:        AppUUID,
+		Email:          email,
+		PermissionUUID: permissionUUID,
+	}))
 	if err != nil {
 		return "", "", fmt.Errorf("%s: %w", op, err)
 	}
+
 	user, err := a.storage.UserWithPermissions(ctx, email, AppUUID)
 	if err != nil {
 		return "", "", fmt.Errorf("%s: %w", op, err)
@@ -218,52 +445,97 @@ func (a *Auth) RevokePermission(ctx context.Context, email string, AppUUID uuid.
 	}
 	return tokenPair.AccessToken, tokenPair.RefreshToken, nil
 }
-func (a *Auth) RefreshToken(ctx context.Context, RefreshToken string) (accessToken string, refreshToken string, err error) {
-	op := "Auth.RefreshToken"
 
-	refToken, err := jwt.Parse(RefreshToken,
-		func(refToken *jwt.Token) (interface{}, error) {
-			tokenChecked, err := refToken.SignedString(a.authApp.Secret)
-			if err != nil {
-				return nil, fmt.Errorf("%s: %w", op, err)
-			}
-			return tokenChecked, nil
-		})
+// RefreshToken rotates refresh token of first-party login. Tokens issued
+// to OAuth clients are refreshed by RefreshClientToken.
+func (a *Auth) RefreshToken(ctx context.Context, refreshToken string) (accessToken string, nextRefreshToken string, err error) {
+	const op = "Auth.RefreshToken"
+
+	tokens, err := a.refresh(ctx, refreshToken, "")
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+	return tokens.AccessToken, tokens.RefreshToken, nil
+}
+
+// RefreshClientToken is the token endpoint refresh_token grant, refresh
+// token must be issued to the authenticated client.
+func (a *Auth) RefreshClientToken(ctx context.Context, clientID string, clientSecret string, refreshToken string) (models.Tokens, error) {
+	const op = "Auth.RefreshClientToken"
+
+	client, err := a.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
 
-	claims, ok := refToken.Claims.(jwt.MapClaims)
-	if ok != true {
-		return "", "", fmt.Errorf("%s: %w", op, ErrInvalidRefreshToken)
+	tokens, err := a.refresh(ctx, refreshToken, client.ID)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, err)
 	}
+	return tokens, nil
+}
+
+// refresh issues new token pair for refresh token bound to clientID. Each
+// refresh token is used once: presenting rotated token means it leaked, so
+// the current one is revoked too and the user has to log in again.
+func (a *Auth) refresh(ctx context.Context, refreshToken string, clientID string) (_ models.Tokens, err error) {
+	var email string
+	var appUUID uuid.UUID
+	defer func() { a.observeRefresh(ctx, email, appUUID, err) }()
 
-	expired := time.Unix(claims["exp"].(int64), 0)
-	if time.Now().After(expired) {
-		return "", "", fmt.Errorf("%s: %w", op, ErrTokenExpired)
+	claims, err := jwtLib.ParseRefreshToken(refreshToken, a.authApp)
+	if err != nil {
+		a.log.Info("invalid refresh token", sl.Err(err))
+
+		return models.Tokens{}, ErrInvalidRefreshToken
 	}
 
-	appUUID, err := uuid.Parse(claims["app"].(string))
+	app, _ := claims["app"].(string)
+	appUUID, err = uuid.Parse(app)
 	if err != nil {
-		return "", "", fmt.Errorf("%s: %w", op, ErrInvalidRefreshToken)
+		return models.Tokens{}, ErrInvalidRefreshToken
+	}
+
+	email, _ = claims["email"].(string)
+	if ok, err := verfic.VerifyEmail(email); !ok || err != nil {
+		return models.Tokens{}, ErrInvalidRefreshToken
 	}
 
-	email := claims["email"].(string) //TODO почитать про приведение типов
+	if azp, _ := claims["azp"].(string); azp != clientID {
+		a.log.Warn("refresh token presented by another client", slog.String("email", email), slog.String("client_id", clientID))
 
-	checkedEmail, err := verfic.VerifyEmail(email)
-	if checkedEmail != true || err != nil {
-		return "", "", fmt.Errorf("%s: %w", op, ErrInvalidRefreshToken)
+		return models.Tokens{}, ErrInvalidRefreshToken
 	}
 
 	user, err := a.storage.UserWithPermissions(ctx, email, appUUID)
 	if err != nil {
-		return "", "", fmt.Errorf("%s: %w", op, err)
+		return models.Tokens{}, err
 	}
+	if user.Disabled {
+		return models.Tokens{}, ErrUserDisabled
+	}
+
+	scope, _ := claims["scope"].(string)
 
-	tokens, err := a.createTokenPair(ctx, user, appUUID)
+	tokens, err := jwtLib.CreateScopedTokenPair(ctx, user, a.authApp, appUUID, scope, clientID, a.accessTTL, a.refreshTTL)
 	if err != nil {
-		return "", "", fmt.Errorf("%s: %w", op, err)
+		return models.Tokens{}, err
 	}
 
-	return tokens.AccessToken, tokens.RefreshToken, nil
+	rotated, err := a.casher.RotateUserRefresh(ctx, email, appUUID, refreshToken, tokens.RefreshToken)
+	if err != nil {
+		return models.Tokens{}, err
+	}
+	if !rotated {
+		a.log.Warn("refresh token reuse detected, revoking session", slog.String("email", email), slog.String("app", appUUID.String()))
+
+		if err := a.casher.BlockUserRefresh(ctx, email, appUUID); err != nil {
+			return models.Tokens{}, err
+		}
+		return models.Tokens{}, ErrInvalidRefreshToken
+	}
 
+	return tokens, nil
 }
 
 func (a *Auth) GetAppPermissions(ctx context.Context, appUUID uuid.UUID) ([]models.Permission, error) {
@@ -278,8 +550,17 @@ func (a *Auth) GetAppPermissions(ctx context.Context, appUUID uuid.UUID) ([]mode
 }
 
 func (a *Auth) createTokenPair(ctx context.Context, user models.User, appUUID uuid.UUID) (TokenPair models.Tokens, err error) {
+	return a.createScopedTokenPair(ctx, user, appUUID, "", "")
+}
+
+func (a *Auth) createScopedTokenPair(ctx context.Context, user models.User, appUUID uuid.UUID, scope string, clientID string) (TokenPair models.Tokens, err error) {
 	const op = "Auth.createTokenPair"
-	tokenPair, err := jwtLib.CreateTokenPair(ctx, user, a.authApp, appUUID, a.accessTTL, a.refreshTTL)
+
+	if user.Disabled {
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, ErrUserDisabled)
+	}
+
+	tokenPair, err := jwtLib.CreateScopedTokenPair(ctx, user, a.authApp, appUUID, scope, clientID, a.accessTTL, a.refreshTTL)
 
 	if err != nil {
 		a.log.Error("failed to generate token", sl.Err(err))
@@ -299,3 +580,47 @@ func (a *Auth) createTokenPair(ctx context.Context, user models.User, appUUID uu
 	}
 	return tokenPair, nil
 }
+
+// tokenOwner returns email of user the access token was issued to.
+// Delegated and service tokens are refused, user manages own credentials
+// only in person.
+func (a *Auth) tokenOwner(accessToken string) (string, error) {
+	claims, err := jwtLib.ParseAccessToken(accessToken, a.authApp)
+	if err != nil {
+		return "", ErrInvalidAccessToken
+	}
+	if _, ok := claims["act"]; ok {
+		return "", ErrInvalidAccessToken
+	}
+
+	email, _ := claims["email"].(string)
+	if email == "" {
+		return "", ErrInvalidAccessToken
+	}
+	return email, nil
+}
+
+// rehashIfNeeded upgrades stored hash to the configured algorithm and cost
+// after successful password check. Failure does not break login.
+func (a *Auth) rehashIfNeeded(ctx context.Context, user models.User, password string) {
+	const op = "Auth.rehashIfNeeded"
+
+	if !a.hasher.NeedsRehash(user.PassHash) {
+		return
+	}
+
+	log := a.log.With(slog.String("op", op), slog.String("email", user.Email))
+
+	passHash, err := a.hasher.Hash(password)
+	if err != nil {
+		log.Error("failed to generate password hash", sl.Err(err))
+		return
+	}
+
+	if err := a.storage.UpdatePassHash(ctx, user.UUID, passHash); err != nil {
+		log.Error("failed to update password hash", sl.Err(err))
+		return
+	}
+
+	log.Info("password hash upgraded", slog.String("algorithm", hasher.Algorithm(passHash)))
+}
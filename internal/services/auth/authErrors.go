@@ -6,3 +6,66 @@ import (
 
 var ErrInvalidRefreshToken = errors.New("invalid refresh token")
 var ErrTokenExpired = errors.New("invalid refresh token")
+
+var ErrMFARequired = errors.New("mfa required")
+var ErrInvalidMFACode = errors.New("invalid mfa code")
+var ErrInvalidMFAChallenge = errors.New("invalid mfa challenge")
+var ErrMFANotEnrolled = errors.New("mfa not enrolled")
+var ErrMFAAlreadyEnabled = errors.New("mfa already enabled")
+var ErrInvalidWebAuthnSession = errors.New("invalid webauthn session")
+var ErrInvalidWebAuthnResponse = errors.New("invalid webauthn response")
+var ErrNoWebAuthnCredentials = errors.New("no webauthn credentials")
+var ErrWebAuthnDisabled = errors.New("webauthn is not configured")
+var ErrInvalidMagicLink = errors.New("invalid magic link")
+var ErrTooManyRequests = errors.New("too many requests")
+var ErrUserDisabled = errors.New("user is disabled")
+
+// OAuth errors, names follow RFC 6749 error codes.
+var ErrInvalidClient = errors.New("invalid client")
+var ErrInvalidRedirectURI = errors.New("invalid redirect uri")
+var ErrInvalidOAuthRequest = errors.New("invalid request")
+var ErrUnsupportedResponseType = errors.New("unsupported response type")
+var ErrInvalidGrant = errors.New("invalid grant")
+var ErrInvalidAccessToken = errors.New("invalid access token")
+var ErrInsufficientScope = errors.New("insufficient scope")
+
+// Device flow errors (RFC 8628 3.5).
+var ErrAuthorizationPending = errors.New("authorization pending")
+var ErrSlowDown = errors.New("slow down")
+var ErrAccessDenied = errors.New("access denied")
+var ErrExpiredToken = errors.New("expired token")
+var ErrInvalidUserCode = errors.New("invalid user code")
+
+var ErrInvalidTarget = errors.New("invalid target")
+var ErrExchangeNotAllowed = errors.New("token exchange not allowed")
+
+var ErrUnknownProvider = errors.New("unknown identity provider")
+var ErrInvalidFederationState = errors.New("invalid or expired federation state")
+var ErrUnverifiedEmail = errors.New("email is not verified by identity provider")
+
+var ErrInvalidSAMLRequest = errors.New("invalid saml request")
+var ErrUnknownServiceProvider = errors.New("unknown saml service provider")
+var ErrInvalidAttributeMapping = errors.New("invalid saml attribute mapping")
+
+var ErrInvalidAuditQuery = errors.New("invalid audit query")
+var ErrNotAdmin = errors.New("caller is not admin")
+
+var ErrSCIMNotAllowed = errors.New("scim provisioning not allowed")
+var ErrInvalidSCIMRequest = errors.New("invalid scim request")
+var ErrSCIMMutability = errors.New("scim attribute is immutable")
+var ErrSCIMGlobalRequired = errors.New("scim global scope required")
+var ErrSCIMReservedGroup = errors.New("permission is not managed by scim")
+
+// MFARequiredError is returned by Login when password is correct but user
+// has to pass second factor, ChallengeToken is used in VerifyMFA.
+type MFARequiredError struct {
+	ChallengeToken string
+}
+
+func (e *MFARequiredError) Error() string {
+	return ErrMFARequired.Error()
+}
+
+func (e *MFARequiredError) Unwrap() error {
+	return ErrMFARequired
+}
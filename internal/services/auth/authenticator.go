@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/hasher"
+	"SSO/internal/lib/ldapauth"
+	"SSO/internal/lib/logger/sl"
+	"SSO/internal/lib/tracing"
+	"SSO/internal/storage"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Authenticator verifies password at login, local hashes are used unless
+// external directory is configured.
+type Authenticator interface {
+	// Authenticate returns ErrInvalidCredentials when password does not
+	// match. Directories return permissions to sync, local returns nil.
+	Authenticate(ctx context.Context, user models.User, password string) (*DirectoryPermissions, error)
+
+	// Provisions reports whether users not stored yet can authenticate,
+	// they are saved on first login.
+	Provisions() bool
+}
+
+// DirectoryPermissions are app permissions derived from directory groups.
+// Only Managed permissions are granted or revoked on login.
+type DirectoryPermissions struct {
+	Granted map[string]bool
+	Managed map[string]bool
+}
+
+type LocalAuthenticator struct {
+	hasher *hasher.Hasher
+}
+
+func NewLocalAuthenticator(hasher *hasher.Hasher) *LocalAuthenticator {
+	return &LocalAuthenticator{hasher: hasher}
+}
+
+func (l *LocalAuthenticator) Authenticate(ctx context.Context, user models.User, password string) (*DirectoryPermissions, error) {
+	_, span := tracing.Tracer().Start(ctx, "password.compare",
+		trace.WithAttributes(attribute.String("password.algorithm", hasher.Algorithm(user.PassHash))),
+	)
+	defer span.End()
+
+	if err := l.hasher.Compare(user.PassHash, password); err != nil {
+		// mismatch is expected outcome, span is not marked as failed
+		span.SetAttributes(attribute.Bool("password.match", false))
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	span.SetAttributes(attribute.Bool("password.match", true))
+	return nil, nil
+}
+
+func (l *LocalAuthenticator) Provisions() bool {
+	return false
+}
+
+type LDAPAuthenticator struct {
+	directory *ldapauth.Directory
+}
+
+func NewLDAPAuthenticator(directory *ldapauth.Directory) *LDAPAuthenticator {
+	return &LDAPAuthenticator{directory: directory}
+}
+
+func (l *LDAPAuthenticator) Authenticate(ctx context.Context, user models.User, password string) (*DirectoryPermissions, error) {
+	_, span := tracing.Tracer().Start(ctx, "ldap.bind", trace.WithSpanKind(trace.SpanKindClient))
+	entry, err := l.directory.Authenticate(user.Email, password)
+	if err != nil {
+		if errors.Is(err, ldapauth.ErrInvalidCredentials) {
+			span.End()
+			return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+		}
+		tracing.End(span, err)
+		return nil, err
+	}
+	span.End()
+
+	return &DirectoryPermissions{
+		Granted: l.directory.Permissions(entry.Groups),
+		Managed: l.directory.ManagedPermissions(),
+	}, nil
+}
+
+func (l *LDAPAuthenticator) Provisions() bool {
+	return true
+}
+
+// syncDirectoryUser saves user authenticated by directory on first login
+// and brings managed app permissions in line with directory groups.
+func (a *Auth) syncDirectoryUser(ctx context.Context, user models.User, stored bool, appUUID uuid.UUID, directory *DirectoryPermissions) (models.User, error) {
+	log := a.log.With(slog.String("email", user.Email), slog.String("app", appUUID.String()))
+
+	if !stored {
+		// directory users never log in with local password
+		password, err := newOpaqueToken()
+		if err != nil {
+			return models.User{}, err
+		}
+		passHash, err := a.hasher.Hash(password)
+		if err != nil {
+			return models.User{}, err
+		}
+
+		// user may exist without permissions in this app
+		userUUID := uuid.New()
+		err = a.storage.SaveUser(ctx, userUUID, user.Email, passHash, outboxEvents(models.IdentityEvent{
+			Type:     models.EventUserRegistered,
+			UserUUID: userUUID,
+			Email:    user.Email,
+		}))
+		switch {
+		case err == nil:
+			log.Info("directory user provisioned")
+		case !errors.Is(err, storage.ErrUserExists):
+			log.Error("failed to provision directory user", sl.Err(err))
+
+			return models.User{}, err
+		}
+	}
+
+	appPermissions, err := a.storage.GetAppPermissions(ctx, appUUID)
+	if err != nil && !errors.Is(err, storage.ErrNoPermissionsAtApp) {
+		return models.User{}, err
+	}
+
+	for _, permission := range appPermissions {
+		if !directory.Managed[permission.Name] {
+			continue
+		}
+
+		want, has := directory.Granted[permission.Name], user.Permissions[permission.Name]
+		event := models.IdentityEvent{AppUUID: appUUID, Email: user.Email, PermissionUUID: permission.UUID}
+		switch {
+		case want && !has:
+			event.Type = models.EventPermissionGranted
+			err = a.storage.AddUserPermissions(ctx, user.Email, appUUID, permission.UUID, outboxEvents(event))
+		case !want && has:
+			event.Type = models.EventPermissionRevoked
+			err = a.storage.RevokeUserPermissions(ctx, user.Email, appUUID, permission.UUID, outboxEvents(event))
+		default:
+			continue
+		}
+		if err != nil {
+			log.Error("failed to sync directory permission", slog.String("permission", permission.Name), sl.Err(err))
+
+			return models.User{}, err
+		}
+		log.Info("directory permission synced", slog.String("permission", permission.Name), slog.Bool("granted", want))
+	}
+
+	return a.storage.UserWithPermissions(ctx, user.Email, appUUID)
+}
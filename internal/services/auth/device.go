@@ -0,0 +1,328 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/logger/sl"
+
+	redisGo "github.com/redis/go-redis/v9"
+)
+
+const (
+	deviceCodeTTL      = 10 * time.Minute
+	devicePollInterval = 5 * time.Second
+
+	// user code alphabet without vowels and similar looking characters (RFC 8628 6.1)
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+// StartDeviceAuthorization is device authorization endpoint of RFC 8628.
+// Confidential client authenticates with secret as at token endpoint.
+func (a *Auth) StartDeviceAuthorization(ctx context.Context, clientID string, clientSecret string, scope string) (models.DeviceCode, error) {
+	const op = "Auth.StartDeviceAuthorization"
+
+	log := a.log.With(slog.String("op", op), slog.String("client_id", clientID))
+
+	client, err := a.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deviceCode, err := newOpaqueToken()
+	if err != nil {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	authorization := models.DeviceAuthorization{
+		ClientID: client.ID,
+		AppUUID:  client.AppUUID,
+		Scope:    scope,
+		Status:   models.DeviceStatusPending,
+		Interval: devicePollInterval,
+	}
+
+	// user codes are short, retry on rare collision
+	for attempt := 0; ; attempt++ {
+		authorization.UserCode, err = newUserCode()
+		if err != nil {
+			return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		data, err := json.Marshal(authorization)
+		if err != nil {
+			return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		err = a.casher.SetDeviceAuthorization(ctx, hashToken(deviceCode), authorization.UserCode, data, deviceCodeTTL)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, models.ErrUserCodeTaken) || attempt == 3 {
+			log.Error("failed to save device authorization", sl.Err(err))
+
+			return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	verificationURI := strings.TrimSuffix(a.issuer, "/") + "/oauth/device"
+
+	log.Info("device authorization started")
+
+	return models.DeviceCode{
+		DeviceCode:              deviceCode,
+		UserCode:                formatUserCode(authorization.UserCode),
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(formatUserCode(authorization.UserCode)),
+		ExpiresIn:               int(deviceCodeTTL.Seconds()),
+		Interval:                int(devicePollInterval.Seconds()),
+	}, nil
+}
+
+// DeviceClient returns client waiting for user code, shown on verification page.
+func (a *Auth) DeviceClient(ctx context.Context, userCode string) (models.OAuthClient, error) {
+	const op = "Auth.DeviceClient"
+
+	_, _, authorization, err := a.deviceAuthorizationByUserCode(ctx, userCode)
+	if err != nil {
+		return models.OAuthClient{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	client, err := a.storage.OAuthClient(ctx, authorization.ClientID)
+	if err != nil {
+		return models.OAuthClient{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return client, nil
+}
+
+// ApproveDevice is called from verification page where user signs in and
+// approves or denies device identified by user code.
+func (a *Auth) ApproveDevice(
+	ctx context.Context,
+	userCode string,
+	email string,
+	password string,
+	mfaCode string,
+	approve bool,
+) (err error) {
+	const op = "Auth.ApproveDevice"
+
+	log := a.log.With(slog.String("op", op), slog.String("email", email))
+
+	deviceCodeHash, current, authorization, err := a.deviceAuthorizationByUserCode(ctx, userCode)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if authorization.Status != models.DeviceStatusPending {
+		return fmt.Errorf("%s: %w", op, ErrInvalidUserCode)
+	}
+
+	defer func() { a.observeLogin(ctx, loginMethodDevice, email, authorization.AppUUID, err) }()
+
+	user, err := a.checkPassword(ctx, email, password, authorization.AppUUID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if user.MFAEnabled {
+		if mfaCode == "" {
+			return fmt.Errorf("%s: %w", op, ErrMFARequired)
+		}
+		if err := a.verifyMFACode(ctx, user, mfaCode); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	authorization.Status = models.DeviceStatusDenied
+	if approve {
+		authorization.Status = models.DeviceStatusApproved
+		authorization.Email = user.Email
+		authorization.AuthTime = time.Now()
+	}
+
+	data, err := json.Marshal(authorization)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	updated, err := a.casher.UpdateDeviceAuthorization(ctx, deviceCodeHash, current, data)
+	if err != nil {
+		log.Error("failed to update device authorization", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	// decided concurrently or expired while user was signing in
+	if !updated {
+		return fmt.Errorf("%s: %w", op, ErrInvalidUserCode)
+	}
+
+	log.Info("device authorization decided", slog.String("status", authorization.Status))
+
+	return nil
+}
+
+// PollDeviceToken is the token endpoint device_code grant. It returns
+// ErrAuthorizationPending until user decides and ErrSlowDown when device
+// polls faster than interval. Confidential clients must authenticate.
+func (a *Auth) PollDeviceToken(ctx context.Context, clientID string, clientSecret string, deviceCode string) (_ models.Tokens, err error) {
+	const op = "Auth.PollDeviceToken"
+
+	if _, err := a.authenticateClient(ctx, clientID, clientSecret); err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deviceCodeHash := hashToken(deviceCode)
+
+	data, err := a.casher.DeviceAuthorization(ctx, deviceCodeHash)
+	if err != nil {
+		if errors.Is(err, redisGo.Nil) {
+			return models.Tokens{}, fmt.Errorf("%s: %w", op, ErrExpiredToken)
+		}
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var authorization models.DeviceAuthorization
+	if err := json.Unmarshal(data, &authorization); err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if authorization.ClientID != clientID {
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+	}
+
+	switch authorization.Status {
+	case models.DeviceStatusPending:
+		now := time.Now()
+		tooFast := now.Sub(authorization.LastPoll) < authorization.Interval
+		if tooFast {
+			authorization.Interval += devicePollInterval
+		}
+		authorization.LastPoll = now
+
+		next, err := json.Marshal(authorization)
+		if err != nil {
+			return models.Tokens{}, fmt.Errorf("%s: %w", op, err)
+		}
+		updated, err := a.casher.UpdateDeviceAuthorization(ctx, deviceCodeHash, data, next)
+		if err != nil {
+			return models.Tokens{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		// lost to concurrent poll or approval, device polls again
+		if tooFast || !updated {
+			return models.Tokens{}, fmt.Errorf("%s: %w", op, ErrSlowDown)
+		}
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, ErrAuthorizationPending)
+
+	case models.DeviceStatusDenied:
+		if _, err := a.casher.DeleteDeviceAuthorization(ctx, deviceCodeHash, authorization.UserCode); err != nil {
+			return models.Tokens{}, fmt.Errorf("%s: %w", op, err)
+		}
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, ErrAccessDenied)
+	}
+
+	// approved, device code is exchanged once
+	defer func() {
+		a.recordAudit(ctx, models.AuditEvent{
+			Subject: authorization.Email,
+			AppUUID: authorization.AppUUID,
+			Action:  models.AuditTokenIssue,
+			Method:  loginMethodDevice,
+			Target:  authorization.ClientID,
+		}, true, err)
+	}()
+
+	deleted, err := a.casher.DeleteDeviceAuthorization(ctx, deviceCodeHash, authorization.UserCode)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !deleted {
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, ErrExpiredToken)
+	}
+
+	user, err := a.storage.UserWithPermissions(ctx, authorization.Email, authorization.AppUUID)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	tokenPair, err := a.createScopedTokenPair(ctx, user, authorization.AppUUID, authorization.Scope, authorization.ClientID)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if hasScope(authorization.Scope, scopeOpenID) {
+		tokenPair.IDToken, err = a.createIDToken(ctx, user, models.AuthorizationCode{
+			ClientID: authorization.ClientID,
+			Scope:    authorization.Scope,
+			AuthTime: authorization.AuthTime,
+		})
+		if err != nil {
+			return models.Tokens{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	a.log.Info("device token issued", slog.String("op", op), slog.String("client_id", clientID))
+
+	return tokenPair, nil
+}
+
+// deviceAuthorizationByUserCode returns device flow with its stored form,
+// which is compared on update.
+func (a *Auth) deviceAuthorizationByUserCode(ctx context.Context, userCode string) (string, []byte, models.DeviceAuthorization, error) {
+	deviceCodeHash, err := a.casher.DeviceCodeByUserCode(ctx, normalizeUserCode(userCode))
+	if err != nil {
+		if errors.Is(err, redisGo.Nil) {
+			return "", nil, models.DeviceAuthorization{}, ErrInvalidUserCode
+		}
+		return "", nil, models.DeviceAuthorization{}, err
+	}
+
+	data, err := a.casher.DeviceAuthorization(ctx, deviceCodeHash)
+	if err != nil {
+		if errors.Is(err, redisGo.Nil) {
+			return "", nil, models.DeviceAuthorization{}, ErrInvalidUserCode
+		}
+		return "", nil, models.DeviceAuthorization{}, err
+	}
+
+	var authorization models.DeviceAuthorization
+	if err := json.Unmarshal(data, &authorization); err != nil {
+		return "", nil, models.DeviceAuthorization{}, err
+	}
+	return deviceCodeHash, data, authorization, nil
+}
+
+func newUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// formatUserCode adds dash for readability: BCDF-GHJK.
+func formatUserCode(code string) string {
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+// normalizeUserCode accepts user input in any case and with or without dash.
+func normalizeUserCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"SSO/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+// outboxEvents stamps identity events, storage writes them to outbox
+// together with the change they describe.
+func outboxEvents(events ...models.IdentityEvent) []models.IdentityEvent {
+	now := time.Now().UTC()
+	for i := range events {
+		events[i].UUID = uuid.New()
+		events[i].Time = now
+	}
+	return events
+}
+
+// deletePermission deletes permission with its grants, every holder gets
+// permission.revoked event. Grant made between listing holders and delete
+// is dropped without event.
+func (a *Auth) deletePermission(ctx context.Context, appUUID uuid.UUID, permUUID uuid.UUID) error {
+	holders, err := a.storage.PermissionUsers(ctx, permUUID)
+	if err != nil {
+		return err
+	}
+
+	events := make([]models.IdentityEvent, 0, len(holders))
+	for _, holder := range holders {
+		events = append(events, models.IdentityEvent{
+			Type:           models.EventPermissionRevoked,
+			AppUUID:        appUUID,
+			UserUUID:       holder.UUID,
+			Email:          holder.Email,
+			PermissionUUID: permUUID,
+		})
+	}
+
+	return a.storage.DeletePermission(ctx, permUUID, appUUID, outboxEvents(events...))
+}
+
+// userStateEvents returns event of user being disabled or enabled, none
+// when state is unchanged.
+func userStateEvents(stored models.User, user models.User) []models.IdentityEvent {
+	if stored.Disabled == user.Disabled {
+		return nil
+	}
+
+	eventType := models.EventUserEnabled
+	if user.Disabled {
+		eventType = models.EventUserDisabled
+	}
+	return outboxEvents(models.IdentityEvent{Type: eventType, UserUUID: user.UUID, Email: user.Email})
+}
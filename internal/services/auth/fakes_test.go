@@ -0,0 +1,372 @@
+package auth
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/metrics"
+	"SSO/internal/storage"
+
+	"github.com/google/uuid"
+	redisGo "github.com/redis/go-redis/v9"
+)
+
+// fakeStorage keeps users and permissions in memory. Methods tests do not
+// need are left to embedded nil Storage and panic when called.
+type fakeStorage struct {
+	Storage
+
+	mu          sync.Mutex
+	users       map[uuid.UUID]models.User
+	permissions map[uuid.UUID]models.Permission
+	// grants are permission UUIDs of user UUID.
+	grants     map[uuid.UUID]map[uuid.UUID]bool
+	mfaSecrets map[uuid.UUID]string
+	clients    map[string]models.OAuthClient
+	events     []models.IdentityEvent
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{
+		users:       map[uuid.UUID]models.User{},
+		permissions: map[uuid.UUID]models.Permission{},
+		grants:      map[uuid.UUID]map[uuid.UUID]bool{},
+		mfaSecrets:  map[uuid.UUID]string{},
+		clients:     map[string]models.OAuthClient{},
+	}
+}
+
+func (s *fakeStorage) addUser(email string) models.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := models.User{UUID: uuid.New(), Email: email}
+	s.users[user.UUID] = user
+	return user
+}
+
+// updateUser replaces stored user, e.g. to disable it or enable MFA.
+func (s *fakeStorage) updateUser(user models.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[user.UUID] = user
+}
+
+// enableMFA enrolls user with TOTP secret.
+func (s *fakeStorage) enableMFA(user models.User, secret string) models.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user.MFAEnabled = true
+	s.users[user.UUID] = user
+	s.mfaSecrets[user.UUID] = secret
+	return user
+}
+
+func (s *fakeStorage) addClient(client models.OAuthClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clients[client.ID] = client
+}
+
+func (s *fakeStorage) addPermission(appUUID uuid.UUID, name string, holders ...models.User) models.Permission {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	permission := models.Permission{UUID: uuid.New(), Name: name, AppUUID: appUUID}
+	s.permissions[permission.UUID] = permission
+	for _, holder := range holders {
+		s.grant(holder.UUID, permission.UUID)
+	}
+	return permission
+}
+
+func (s *fakeStorage) grant(userUUID uuid.UUID, permUUID uuid.UUID) {
+	if s.grants[userUUID] == nil {
+		s.grants[userUUID] = map[uuid.UUID]bool{}
+	}
+	s.grants[userUUID][permUUID] = true
+}
+
+func (s *fakeStorage) userByEmail(email string) (models.User, bool) {
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, true
+		}
+	}
+	return models.User{}, false
+}
+
+func (s *fakeStorage) User(_ context.Context, email string) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.userByEmail(email)
+	if !ok {
+		return models.User{}, storage.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *fakeStorage) UserByUUID(_ context.Context, userUUID uuid.UUID) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userUUID]
+	if !ok {
+		return models.User{}, storage.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *fakeStorage) UserWithPermissions(_ context.Context, email string, appUUID uuid.UUID) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.userByEmail(email)
+	if !ok {
+		return models.User{}, storage.ErrUserNotFound
+	}
+	user.Permissions = map[string]bool{}
+	for permUUID := range s.grants[user.UUID] {
+		if permission := s.permissions[permUUID]; permission.AppUUID == appUUID {
+			user.Permissions[permission.Name] = true
+		}
+	}
+	return user, nil
+}
+
+func (s *fakeStorage) GetAppPermissions(_ context.Context, appUUID uuid.UUID) ([]models.Permission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var permissions []models.Permission
+	for _, permission := range s.permissions {
+		if permission.AppUUID == appUUID {
+			permissions = append(permissions, permission)
+		}
+	}
+	if len(permissions) == 0 {
+		return nil, storage.ErrNoPermissionsAtApp
+	}
+	return permissions, nil
+}
+
+func (s *fakeStorage) PermissionUsers(_ context.Context, permUUID uuid.UUID) ([]models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var users []models.User
+	for userUUID, granted := range s.grants {
+		if granted[permUUID] {
+			users = append(users, s.users[userUUID])
+		}
+	}
+	return users, nil
+}
+
+func (s *fakeStorage) AddUserPermissions(_ context.Context, email string, appUUID uuid.UUID, permUUID uuid.UUID, events []models.IdentityEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.userByEmail(email)
+	if !ok {
+		return storage.ErrUserNotFound
+	}
+	if permission, ok := s.permissions[permUUID]; !ok || permission.AppUUID != appUUID {
+		return storage.ErrCantGrantPermission
+	}
+	if s.grants[user.UUID][permUUID] {
+		return storage.ErrUserPermissionsExists
+	}
+	s.grant(user.UUID, permUUID)
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *fakeStorage) MFASecret(_ context.Context, userUUID uuid.UUID) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secret, ok := s.mfaSecrets[userUUID]
+	if !ok {
+		return "", false, storage.ErrMFANotFound
+	}
+	return secret, s.users[userUUID].MFAEnabled, nil
+}
+
+func (s *fakeStorage) UseRecoveryCode(context.Context, uuid.UUID, []byte) error {
+	return storage.ErrRecoveryCodeNotFound
+}
+
+func (s *fakeStorage) OAuthClient(_ context.Context, clientID string) (models.OAuthClient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, ok := s.clients[clientID]
+	if !ok {
+		return models.OAuthClient{}, storage.ErrClientNotFound
+	}
+	return client, nil
+}
+
+func (s *fakeStorage) hasGrant(userUUID uuid.UUID, permUUID uuid.UUID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.grants[userUUID][permUUID]
+}
+
+// fakeCasher keeps refresh tokens, TOTP steps, MFA challenges and OAuth
+// codes in memory, other state is left to embedded nil Casher.
+type fakeCasher struct {
+	Casher
+
+	mu sync.Mutex
+	// refresh is current refresh token of email and app.
+	refresh    map[string]string
+	totpSteps  map[uuid.UUID]int64
+	challenges map[string]pendingLogin
+	codes      map[string][]byte
+}
+
+type pendingLogin struct {
+	email   string
+	appUUID uuid.UUID
+}
+
+func newFakeCasher() *fakeCasher {
+	return &fakeCasher{
+		refresh:    map[string]string{},
+		totpSteps:  map[uuid.UUID]int64{},
+		challenges: map[string]pendingLogin{},
+		codes:      map[string][]byte{},
+	}
+}
+
+func refreshKey(email string, appUUID uuid.UUID) string {
+	return email + "/" + appUUID.String()
+}
+
+func (c *fakeCasher) SetUserRefresh(_ context.Context, email string, appUUID uuid.UUID, refreshToken string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.refresh[refreshKey(email, appUUID)] = refreshToken
+	return nil
+}
+
+func (c *fakeCasher) RotateUserRefresh(_ context.Context, email string, appUUID uuid.UUID, current string, next string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := refreshKey(email, appUUID)
+	if c.refresh[key] != current {
+		return false, nil
+	}
+	c.refresh[key] = next
+	return true, nil
+}
+
+func (c *fakeCasher) BlockUserRefresh(_ context.Context, email string, appUUID uuid.UUID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.refresh, refreshKey(email, appUUID))
+	return nil
+}
+
+func (c *fakeCasher) UseTOTPStep(_ context.Context, userUUID uuid.UUID, step int64, _ time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if last, ok := c.totpSteps[userUUID]; ok && step <= last {
+		return false, nil
+	}
+	c.totpSteps[userUUID] = step
+	return true, nil
+}
+
+func (c *fakeCasher) SetMFAChallenge(_ context.Context, tokenHash string, email string, appUUID uuid.UUID, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.challenges[tokenHash] = pendingLogin{email: email, appUUID: appUUID}
+	return nil
+}
+
+func (c *fakeCasher) TakeMFAChallenge(_ context.Context, tokenHash string) (string, uuid.UUID, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	challenge, ok := c.challenges[tokenHash]
+	if !ok {
+		return "", uuid.Nil, redisGo.Nil
+	}
+	delete(c.challenges, tokenHash)
+	return challenge.email, challenge.appUUID, nil
+}
+
+func (c *fakeCasher) SetOAuthCode(_ context.Context, codeHash string, code []byte, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.codes[codeHash] = code
+	return nil
+}
+
+func (c *fakeCasher) TakeOAuthCode(_ context.Context, codeHash string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	code, ok := c.codes[codeHash]
+	if !ok {
+		return nil, redisGo.Nil
+	}
+	delete(c.codes, codeHash)
+	return code, nil
+}
+
+// fakeAudit keeps audit events in memory.
+type fakeAudit struct {
+	mu     sync.Mutex
+	events []models.AuditEvent
+}
+
+func (a *fakeAudit) SaveAuditEvent(_ context.Context, event models.AuditEvent) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.events = append(a.events, event)
+	return nil
+}
+
+func (a *fakeAudit) AuditEvents(context.Context, models.AuditFilter) ([]models.AuditEvent, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]models.AuditEvent(nil), a.events...), nil
+}
+
+// newTestAuth returns Auth over storage with in-memory casher and audit
+// log, without limiters and signing key, tests set what the flow needs.
+func newTestAuth(storage Storage) *Auth {
+	return &Auth{
+		authApp:    models.AuthApp{UUID: uuid.New(), Name: "sso", Secret: "test-secret"},
+		casher:     newFakeCasher(),
+		accessTTL:  time.Minute,
+		refreshTTL: time.Hour,
+		storage:    storage,
+		audit:      &fakeAudit{},
+		issuer:     "https://sso.example.com",
+		metrics:    metrics.New(),
+		log:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
@@ -0,0 +1,322 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/logger/sl"
+	"SSO/internal/lib/upstream"
+	verfic "SSO/internal/lib/verifications"
+	"SSO/internal/storage"
+
+	"github.com/google/uuid"
+	redisGo "github.com/redis/go-redis/v9"
+)
+
+const federationStateTTL = 10 * time.Minute
+
+// FederatedProviders returns upstream identity providers configured for app,
+// they are offered on login page.
+func (a *Auth) FederatedProviders(appUUID uuid.UUID) []*upstream.Provider {
+	var providers []*upstream.Provider
+	for _, provider := range a.providers {
+		if provider.AppUUID() == appUUID {
+			providers = append(providers, provider)
+		}
+	}
+
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].Name() < providers[j].Name()
+	})
+	return providers
+}
+
+// StartFederatedLogin returns url of upstream provider where user signs in
+// instead of entering local password. Authorization request of client is
+// kept until callback.
+func (a *Auth) StartFederatedLogin(ctx context.Context, providerName string, req models.AuthorizeRequest) (string, error) {
+	const op = "Auth.StartFederatedLogin"
+
+	client, err := a.ValidateAuthorizeRequest(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	provider, ok := a.providers[providerName]
+	if !ok || provider.AppUUID() != client.AppUUID {
+		return "", fmt.Errorf("%s: %w", op, ErrUnknownProvider)
+	}
+
+	state, err := newOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	federation := models.FederationState{Provider: provider.Name(), Request: req}
+	if federation.Nonce, err = newOpaqueToken(); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if federation.CodeVerifier, err = newOpaqueToken(); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	challenge := sha256.Sum256([]byte(federation.CodeVerifier))
+
+	redirect, err := provider.AuthCodeURL(ctx, state, federation.Nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		a.log.Error("failed to build upstream login url", slog.String("op", op), slog.String("provider", provider.Name()), sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	data, err := json.Marshal(federation)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.casher.SetFederationState(ctx, hashToken(state), data, federationStateTTL); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return redirect, nil
+}
+
+// FinishFederatedLogin handles callback from upstream provider. User is
+// found by linked identity, linked by verified email or provisioned, then
+// authorization code for original client request is issued. User with MFA
+// gets MFARequiredError, its challenge is finished by FinishFederatedMFA.
+// Empty code means upstream provider returned error. Request is returned
+// whenever state is valid so errors can be sent back to client.
+func (a *Auth) FinishFederatedLogin(ctx context.Context, state string, code string) (_ models.AuthorizeRequest, _ string, err error) {
+	const op = "Auth.FinishFederatedLogin"
+
+	data, err := a.casher.TakeFederationState(ctx, hashToken(state))
+	if err != nil {
+		if errors.Is(err, redisGo.Nil) {
+			return models.AuthorizeRequest{}, "", fmt.Errorf("%s: %w", op, ErrInvalidFederationState)
+		}
+		return models.AuthorizeRequest{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	var federation models.FederationState
+	if err := json.Unmarshal(data, &federation); err != nil {
+		return models.AuthorizeRequest{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+	req := federation.Request
+
+	log := a.log.With(slog.String("op", op), slog.String("provider", federation.Provider), slog.String("client_id", req.ClientID))
+
+	if code == "" {
+		return req, "", fmt.Errorf("%s: %w", op, ErrAccessDenied)
+	}
+
+	provider, ok := a.providers[federation.Provider]
+	if !ok {
+		return req, "", fmt.Errorf("%s: %w", op, ErrUnknownProvider)
+	}
+
+	client, err := a.ValidateAuthorizeRequest(ctx, req)
+	if err != nil {
+		return req, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	var email string
+	defer func() { a.observeLogin(ctx, loginMethodFederated, email, client.AppUUID, err) }()
+
+	identity, err := provider.Exchange(ctx, code, federation.CodeVerifier, federation.Nonce)
+	if err != nil {
+		log.Warn("upstream login failed", sl.Err(err))
+
+		return req, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := a.federatedUser(ctx, provider, identity)
+	if err != nil {
+		log.Warn("failed to resolve federated user", slog.String("subject", identity.Subject), sl.Err(err))
+
+		return req, "", fmt.Errorf("%s: %w", op, err)
+	}
+	email = user.Email
+
+	// upstream login replaces password, not second factor
+	if user.MFAEnabled {
+		challenge, err := a.saveFederationMFA(ctx, models.FederationMFA{
+			Provider: provider.Name(),
+			Request:  req,
+			UserUUID: user.UUID,
+		})
+		if err != nil {
+			log.Error("failed to save mfa challenge", sl.Err(err))
+
+			return req, "", fmt.Errorf("%s: %w", op, err)
+		}
+		return req, "", fmt.Errorf("%s: %w", op, &MFARequiredError{ChallengeToken: challenge})
+	}
+
+	authCode, err := a.issueFederatedCode(ctx, client, req, user)
+	if err != nil {
+		log.Error("failed to issue authorization code", sl.Err(err))
+
+		return req, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("federated login", slog.String("email", user.Email))
+
+	return req, authCode, nil
+}
+
+// FinishFederatedMFA checks second factor of federated login and issues
+// authorization code. Challenge is single-use, wrong code means login starts
+// again. Request is returned whenever challenge is valid.
+func (a *Auth) FinishFederatedMFA(ctx context.Context, challengeToken string, code string) (_ models.AuthorizeRequest, _ string, err error) {
+	const op = "Auth.FinishFederatedMFA"
+
+	data, err := a.casher.TakeFederationMFA(ctx, hashToken(challengeToken))
+	if err != nil {
+		if errors.Is(err, redisGo.Nil) {
+			return models.AuthorizeRequest{}, "", fmt.Errorf("%s: %w", op, ErrInvalidMFAChallenge)
+		}
+		return models.AuthorizeRequest{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	var pending models.FederationMFA
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return models.AuthorizeRequest{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+	req := pending.Request
+
+	log := a.log.With(slog.String("op", op), slog.String("provider", pending.Provider), slog.String("client_id", req.ClientID))
+
+	client, err := a.ValidateAuthorizeRequest(ctx, req)
+	if err != nil {
+		return req, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := a.storage.UserByUUID(ctx, pending.UserUUID)
+	if err != nil {
+		return req, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() { a.observeLogin(ctx, loginMethodFederated, user.Email, client.AppUUID, err) }()
+
+	if err := a.verifyMFACode(ctx, user, code); err != nil {
+		log.Info("mfa verification failed", slog.String("email", user.Email), sl.Err(err))
+
+		return req, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	authCode, err := a.issueFederatedCode(ctx, client, req, user)
+	if err != nil {
+		log.Error("failed to issue authorization code", sl.Err(err))
+
+		return req, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("federated login", slog.String("email", user.Email))
+
+	return req, authCode, nil
+}
+
+func (a *Auth) saveFederationMFA(ctx context.Context, pending models.FederationMFA) (string, error) {
+	challenge, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return "", err
+	}
+
+	if err := a.casher.SetFederationMFA(ctx, hashToken(challenge), data, mfaChallengeTTL); err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+func (a *Auth) issueFederatedCode(ctx context.Context, client models.OAuthClient, req models.AuthorizeRequest, user models.User) (string, error) {
+	return a.issueAuthorizationCode(ctx, models.AuthorizationCode{
+		ClientID:      client.ID,
+		AppUUID:       client.AppUUID,
+		Email:         user.Email,
+		RedirectURI:   req.RedirectURI,
+		Scope:         req.Scope,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		AuthTime:      time.Now(),
+	})
+}
+
+// federatedUser returns user linked to upstream identity, linked user is
+// found by uuid so it follows email changes. Unlinked identity
+// with verified email is linked to existing user with that email, or new user
+// is provisioned. Provisioned users get random password so only federated
+// login works until password is reset.
+func (a *Auth) federatedUser(ctx context.Context, provider *upstream.Provider, identity upstream.Identity) (models.User, error) {
+	linked, err := a.storage.ExternalIdentity(ctx, provider.Name(), identity.Subject)
+	if err == nil {
+		return a.storage.UserByUUID(ctx, linked.UserUUID)
+	}
+	if !errors.Is(err, storage.ErrIdentityNotFound) {
+		return models.User{}, err
+	}
+
+	if !identity.EmailVerified {
+		return models.User{}, ErrUnverifiedEmail
+	}
+	if ok, err := verfic.VerifyEmail(identity.Email); !ok || err != nil {
+		return models.User{}, ErrUnverifiedEmail
+	}
+
+	user, err := a.storage.User(ctx, identity.Email)
+	switch {
+	case err == nil:
+		a.log.Info("linking external identity to existing user",
+			slog.String("provider", provider.Name()),
+			slog.String("email", user.Email),
+		)
+	case errors.Is(err, storage.ErrUserNotFound):
+		password, err := newOpaqueToken()
+		if err != nil {
+			return models.User{}, err
+		}
+		passHash, err := a.hasher.Hash(password)
+		if err != nil {
+			return models.User{}, err
+		}
+
+		user = models.User{UUID: uuid.New(), Email: identity.Email, PassHash: passHash}
+		events := outboxEvents(models.IdentityEvent{Type: models.EventUserRegistered, UserUUID: user.UUID, Email: user.Email})
+		if err := a.storage.SaveUser(ctx, user.UUID, user.Email, user.PassHash, events); err != nil {
+			return models.User{}, err
+		}
+
+		a.log.Info("user provisioned by external identity",
+			slog.String("provider", provider.Name()),
+			slog.String("email", user.Email),
+		)
+	default:
+		return models.User{}, err
+	}
+
+	err = a.storage.SaveExternalIdentity(ctx, models.ExternalIdentity{
+		Provider:  provider.Name(),
+		Subject:   identity.Subject,
+		UserUUID:  user.UUID,
+		Email:     user.Email,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"SSO/internal/lib/logger/sl"
+	"SSO/internal/lib/metrics"
+	"SSO/internal/storage"
+
+	"github.com/google/uuid"
+	redisGo "github.com/redis/go-redis/v9"
+)
+
+const magicLinkTTL = 15 * time.Minute
+
+// RequestMagicLink mails single-use login link to user. Unknown emails are
+// not reported to caller, so the method can not be used to enumerate users.
+func (a *Auth) RequestMagicLink(ctx context.Context, email string, appUUID uuid.UUID) error {
+	const op = "Auth.RequestMagicLink"
+
+	log := a.log.With(slog.String("op", op), slog.String("email", email))
+
+	if !a.loginLimiter.Allow() {
+		log.Error("too many requests")
+		a.metrics.RateLimited(metrics.LimiterLogin)
+
+		return fmt.Errorf("%s: %w", op, ErrTooManyRequests)
+	}
+
+	if _, err := a.storage.User(ctx, email); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("magic link requested for unknown user")
+
+			return nil
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.casher.SetMagicLink(ctx, hashToken(token), email, appUUID, magicLinkTTL); err != nil {
+		log.Error("failed to save magic link", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	link := a.magicLinkURL + "?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Follow the link to sign in to %s:\n\n%s\n\nThe link expires in %s and can be used once.\n",
+		a.authApp.Name, link, magicLinkTTL)
+
+	if err := a.mailer.Send(ctx, email, "Sign in to "+a.authApp.Name, body); err != nil {
+		log.Error("failed to send magic link", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("magic link sent")
+
+	return nil
+}
+
+// RedeemMagicLink consumes token from link and issues token pair.
+func (a *Auth) RedeemMagicLink(ctx context.Context, token string) (_ string, _ string, err error) {
+	const op = "Auth.RedeemMagicLink"
+
+	var email string
+	var appUUID uuid.UUID
+	defer func() { a.observeLogin(ctx, loginMethodMagicLink, email, appUUID, err) }()
+
+	email, appUUID, err = a.casher.TakeMagicLink(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, redisGo.Nil) {
+			return "", "", fmt.Errorf("%s: %w", op, ErrInvalidMagicLink)
+		}
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log := a.log.With(slog.String("op", op), slog.String("email", email))
+
+	user, err := a.storage.UserWithPermissions(ctx, email, appUUID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("magic link redeemed")
+
+	if user.MFAEnabled {
+		challenge, err := a.createMFAChallenge(ctx, email, appUUID)
+		if err != nil {
+			return "", "", fmt.Errorf("%s: %w", op, err)
+		}
+		return "", "", fmt.Errorf("%s: %w", op, &MFARequiredError{ChallengeToken: challenge})
+	}
+
+	tokenPair, err := a.createTokenPair(ctx, user, appUUID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tokenPair.AccessToken, tokenPair.RefreshToken, nil
+}
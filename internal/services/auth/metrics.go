@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// Login methods as reported in metrics.
+const (
+	loginMethodPassword  = "password"
+	loginMethodMFA       = "mfa"
+	loginMethodWebAuthn  = "webauthn"
+	loginMethodMagicLink = "magic_link"
+	loginMethodOAuth     = "oauth"
+	loginMethodSAML      = "saml"
+	loginMethodFederated = "federated"
+	loginMethodDevice    = "device"
+	// loginMethodClientCredentials is login of service account, its
+	// subject is "service:<client_id>".
+	loginMethodClientCredentials = "client_credentials"
+)
+
+// observeLogin records outcome of login flow in metrics and audit log. MFA
+// challenge is not recorded, the login is finished or failed by VerifyMFA,
+// WebAuthn or repeated form with code.
+func (a *Auth) observeLogin(ctx context.Context, method string, email string, appUUID uuid.UUID, err error) {
+	switch {
+	case err == nil:
+		a.metrics.LoginSucceeded(method)
+	case errors.Is(err, ErrMFARequired):
+		return
+	default:
+		a.metrics.LoginFailed(method, failureReason(err))
+	}
+
+	a.recordAudit(ctx, models.AuditEvent{
+		Subject: email,
+		AppUUID: appUUID,
+		Action:  models.AuditLogin,
+		Method:  method,
+	}, true, err)
+}
+
+func (a *Auth) observeRegistration(ctx context.Context, email string, err error) {
+	a.metrics.Registration(failureReason(err))
+
+	a.recordAudit(ctx, models.AuditEvent{Subject: email, Action: models.AuditRegister}, true, err)
+}
+
+func (a *Auth) observeRefresh(ctx context.Context, email string, appUUID uuid.UUID, err error) {
+	a.metrics.Refresh(failureReason(err))
+
+	a.recordAudit(ctx, models.AuditEvent{Subject: email, AppUUID: appUUID, Action: models.AuditTokenRefresh}, true, err)
+}
+
+// failureReason is low-cardinality label of error, "ok" for nil.
+func failureReason(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrInvalidCredentials):
+		return "invalid_credentials"
+	case errors.Is(err, ErrInvalidClient):
+		return "invalid_client"
+	case errors.Is(err, ErrTooManyRequests):
+		return "rate_limited"
+	case errors.Is(err, ErrUserDisabled):
+		return "user_disabled"
+	case errors.Is(err, ErrInvalidMFACode),
+		errors.Is(err, ErrInvalidWebAuthnResponse):
+		return "invalid_second_factor"
+	case errors.Is(err, ErrInvalidMFAChallenge),
+		errors.Is(err, ErrInvalidWebAuthnSession),
+		errors.Is(err, ErrInvalidMagicLink),
+		errors.Is(err, ErrInvalidRefreshToken),
+		errors.Is(err, ErrTokenExpired):
+		return "invalid_token"
+	case errors.Is(err, storage.ErrUserExists):
+		return "user_exists"
+	case errors.Is(err, storage.ErrUserNotFound):
+		return "user_not_found"
+	default:
+		return "error"
+	}
+}
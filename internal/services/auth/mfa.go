@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/logger/sl"
+	"SSO/internal/lib/totp"
+	"SSO/internal/storage"
+
+	"github.com/google/uuid"
+	redisGo "github.com/redis/go-redis/v9"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	recoveryCodeCount = 10
+
+	// totpStepTTL covers all steps accepted around current time, older
+	// steps fail validation anyway.
+	totpStepTTL = (2*totp.Skew + 1) * totp.Period
+)
+
+// EnrollMFA generates new TOTP secret for owner of access token. Secret is
+// not active until ConfirmMFA is called with first code from authenticator
+// app.
+func (a *Auth) EnrollMFA(ctx context.Context, accessToken string) (secret string, uri string, err error) {
+	const op = "Auth.EnrollMFA"
+
+	email, err := a.tokenOwner(accessToken)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log := a.log.With(slog.String("op", op), slog.String("email", email))
+
+	user, err := a.storage.User(ctx, email)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if user.MFAEnabled {
+		return "", "", fmt.Errorf("%s: %w", op, ErrMFAAlreadyEnabled)
+	}
+
+	secret, err = totp.GenerateSecret()
+	if err != nil {
+		log.Error("failed to generate totp secret", sl.Err(err))
+
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.storage.SaveMFASecret(ctx, user.UUID, secret); err != nil {
+		log.Error("failed to save totp secret", sl.Err(err))
+
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("mfa enrolment started")
+
+	return secret, totp.URI(a.authApp.Name, email, secret), nil
+}
+
+// ConfirmMFA enables MFA of access token owner after checking first code
+// and returns one-time recovery codes. Codes are shown once, only their
+// hashes are stored.
+func (a *Auth) ConfirmMFA(ctx context.Context, accessToken string, code string) ([]string, error) {
+	const op = "Auth.ConfirmMFA"
+
+	email, err := a.tokenOwner(accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log := a.log.With(slog.String("op", op), slog.String("email", email))
+
+	user, err := a.storage.User(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret, enabled, err := a.storage.MFASecret(ctx, user.UUID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMFANotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrMFANotEnrolled)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if enabled {
+		return nil, fmt.Errorf("%s: %w", op, ErrMFAAlreadyEnabled)
+	}
+
+	step, ok := totp.Match(secret, code, time.Now())
+	if !ok {
+		log.Info("invalid mfa code")
+
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidMFACode)
+	}
+	if err := a.useTOTPStep(ctx, user.UUID, step); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([][]byte, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	if err := a.storage.EnableMFA(ctx, user.UUID, hashes); err != nil {
+		log.Error("failed to enable mfa", sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("mfa enabled")
+
+	return codes, nil
+}
+
+// VerifyMFA completes login started by Login. code is either current TOTP
+// code or one of recovery codes.
+func (a *Auth) VerifyMFA(ctx context.Context, challengeToken string, code string) (_ string, _ string, err error) {
+	const op = "Auth.VerifyMFA"
+
+	var email string
+	var appUUID uuid.UUID
+	defer func() { a.observeLogin(ctx, loginMethodMFA, email, appUUID, err) }()
+
+	log := a.log.With(slog.String("op", op))
+
+	email, appUUID, err = a.casher.TakeMFAChallenge(ctx, hashToken(challengeToken))
+	if err != nil {
+		if errors.Is(err, redisGo.Nil) {
+			return "", "", fmt.Errorf("%s: %w", op, ErrInvalidMFAChallenge)
+		}
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.String("email", email))
+
+	user, err := a.storage.UserWithPermissions(ctx, email, appUUID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.verifyMFACode(ctx, user, code); err != nil {
+		log.Info("mfa verification failed", sl.Err(err))
+
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	tokenPair, err := a.createTokenPair(ctx, user, appUUID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+	return tokenPair.AccessToken, tokenPair.RefreshToken, nil
+}
+
+// verifyMFACode checks TOTP code, falling back to one-time recovery code.
+func (a *Auth) verifyMFACode(ctx context.Context, user models.User, code string) error {
+	secret, enabled, err := a.storage.MFASecret(ctx, user.UUID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMFANotFound) {
+			return ErrMFANotEnrolled
+		}
+		return err
+	}
+	if !enabled {
+		return ErrMFANotEnrolled
+	}
+
+	if step, ok := totp.Match(secret, code, time.Now()); ok {
+		return a.useTOTPStep(ctx, user.UUID, step)
+	}
+
+	err = a.storage.UseRecoveryCode(ctx, user.UUID, hashRecoveryCode(code))
+	if err != nil {
+		if errors.Is(err, storage.ErrRecoveryCodeNotFound) {
+			return ErrInvalidMFACode
+		}
+		return err
+	}
+
+	a.log.Warn("recovery code used", slog.String("email", user.Email))
+
+	return nil
+}
+
+// useTOTPStep accepts TOTP code of step once, code seen before is invalid
+// even within its validity window.
+func (a *Auth) useTOTPStep(ctx context.Context, userUUID uuid.UUID, step int64) error {
+	fresh, err := a.casher.UseTOTPStep(ctx, userUUID, step, totpStepTTL)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		a.log.Warn("totp code replayed", slog.String("user_uuid", userUUID.String()))
+
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (a *Auth) createMFAChallenge(ctx context.Context, email string, appUUID uuid.UUID) (string, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := a.casher.SetMFAChallenge(ctx, hashToken(token), email, appUUID, mfaChallengeTTL); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// newOpaqueToken returns random url-safe token for single-use links and challenges.
+func newOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// hashToken is used as storage key for opaque tokens, so leaked storage
+// does not leak usable tokens.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRecoveryCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf)
+	return strings.ToLower(code[:8] + "-" + code[8:]), nil
+}
+
+// Recovery codes have 80 bits of entropy, so plain sha256 is enough.
+func hashRecoveryCode(code string) []byte {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return sum[:]
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"SSO/internal/lib/totp"
+
+	"github.com/google/uuid"
+)
+
+func TestVerifyMFARefusesReplayedStep(t *testing.T) {
+	ctx := context.Background()
+	appUUID := uuid.New()
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret() error = %v", err)
+	}
+	fake := newFakeStorage()
+	user := fake.enableMFA(fake.addUser("user@example.com"), secret)
+	a := newTestAuth(fake)
+
+	now := time.Now()
+	previous, err := totp.Code(secret, now.Add(-totp.Period))
+	if err != nil {
+		t.Fatalf("Code() error = %v", err)
+	}
+	current, err := totp.Code(secret, now)
+	if err != nil {
+		t.Fatalf("Code() error = %v", err)
+	}
+
+	// steps run in order, each login answers fresh challenge
+	steps := []struct {
+		name    string
+		code    string
+		wantErr error
+	}{
+		{name: "previous step within skew", code: previous},
+		{name: "current step", code: current},
+		{name: "current step replayed", code: current, wantErr: ErrInvalidMFACode},
+		{name: "step before accepted one", code: previous, wantErr: ErrInvalidMFACode},
+	}
+
+	for _, step := range steps {
+		challenge, err := a.createMFAChallenge(ctx, user.Email, appUUID)
+		if err != nil {
+			t.Fatalf("createMFAChallenge() error = %v", err)
+		}
+
+		_, _, err = a.VerifyMFA(ctx, challenge, step.code)
+		if !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: VerifyMFA() error = %v, want %v", step.name, err, step.wantErr)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/logger/sl"
+	"SSO/internal/storage"
+
+	"github.com/google/uuid"
+	redisGo "github.com/redis/go-redis/v9"
+)
+
+const (
+	authorizationCodeTTL = time.Minute
+
+	responseTypeCode = "code"
+	pkceMethodS256   = "S256"
+)
+
+// RegisterOAuthClient registers front-end of app. Secret is returned once
+// for confidential clients and is empty for public ones.
+func (a *Auth) RegisterOAuthClient(
+	ctx context.Context,
+	appUUID uuid.UUID,
+	name string,
+	redirectURIs []string,
+	public bool,
+) (client models.OAuthClient, secret string, err error) {
+	const op = "Auth.RegisterOAuthClient"
+
+	log := a.log.With(slog.String("op", op), slog.String("app", appUUID.String()))
+
+	if len(redirectURIs) == 0 {
+		return models.OAuthClient{}, "", fmt.Errorf("%s: %w", op, ErrInvalidRedirectURI)
+	}
+	for _, uri := range redirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return models.OAuthClient{}, "", fmt.Errorf("%s: %w", op, ErrInvalidRedirectURI)
+		}
+	}
+
+	client = models.OAuthClient{
+		ID:           uuid.NewString(),
+		AppUUID:      appUUID,
+		Name:         name,
+		RedirectURIs: redirectURIs,
+		Public:       public,
+	}
+
+	if !public {
+		secret, err = newOpaqueToken()
+		if err != nil {
+			return models.OAuthClient{}, "", fmt.Errorf("%s: %w", op, err)
+		}
+		client.SecretHash, err = a.hasher.Hash(secret)
+		if err != nil {
+			return models.OAuthClient{}, "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := a.storage.SaveOAuthClient(ctx, client); err != nil {
+		log.Error("failed to save client", sl.Err(err))
+
+		return models.OAuthClient{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("oauth client registered", slog.String("client_id", client.ID))
+
+	return client, secret, nil
+}
+
+// ValidateAuthorizeRequest checks authorization request before login form is shown.
+// ErrInvalidClient and ErrInvalidRedirectURI must be shown to user, other
+// errors are sent back to redirect uri.
+func (a *Auth) ValidateAuthorizeRequest(ctx context.Context, req models.AuthorizeRequest) (models.OAuthClient, error) {
+	const op = "Auth.ValidateAuthorizeRequest"
+
+	client, err := a.storage.OAuthClient(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, storage.ErrClientNotFound) {
+			return models.OAuthClient{}, fmt.Errorf("%s: %w", op, ErrInvalidClient)
+		}
+		return models.OAuthClient{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !client.AllowsRedirect(req.RedirectURI) {
+		return models.OAuthClient{}, fmt.Errorf("%s: %w", op, ErrInvalidRedirectURI)
+	}
+
+	if req.ResponseType != responseTypeCode {
+		return client, fmt.Errorf("%s: %w", op, ErrUnsupportedResponseType)
+	}
+
+	// PKCE is required for every client, only S256 is accepted
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != pkceMethodS256 {
+		return client, fmt.Errorf("%s: %w", op, ErrInvalidOAuthRequest)
+	}
+
+	return client, nil
+}
+
+// Authorize logs user in on SSO login page and issues authorization code.
+// mfaCode is required for users with MFA enabled.
+func (a *Auth) Authorize(
+	ctx context.Context,
+	req models.AuthorizeRequest,
+	email string,
+	password string,
+	mfaCode string,
+) (_ string, err error) {
+	const op = "Auth.Authorize"
+
+	log := a.log.With(slog.String("op", op), slog.String("client_id", req.ClientID), slog.String("email", email))
+
+	client, err := a.ValidateAuthorizeRequest(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() { a.observeLogin(ctx, loginMethodOAuth, email, client.AppUUID, err) }()
+
+	user, err := a.checkPassword(ctx, email, password, client.AppUUID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if user.MFAEnabled {
+		if mfaCode == "" {
+			return "", fmt.Errorf("%s: %w", op, ErrMFARequired)
+		}
+		if err := a.verifyMFACode(ctx, user, mfaCode); err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	code, err := a.issueAuthorizationCode(ctx, models.AuthorizationCode{
+		ClientID:      client.ID,
+		AppUUID:       client.AppUUID,
+		Email:         user.Email,
+		RedirectURI:   req.RedirectURI,
+		Scope:         req.Scope,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		AuthTime:      time.Now(),
+	})
+	if err != nil {
+		log.Error("failed to issue authorization code", sl.Err(err))
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("authorization code issued")
+
+	return code, nil
+}
+
+// ExchangeAuthorizationCode is the token endpoint authorization_code grant.
+func (a *Auth) ExchangeAuthorizationCode(
+	ctx context.Context,
+	clientID string,
+	clientSecret string,
+	code string,
+	redirectURI string,
+	codeVerifier string,
+) (models.Tokens, error) {
+	const op = "Auth.ExchangeAuthorizationCode"
+
+	log := a.log.With(slog.String("op", op), slog.String("client_id", clientID))
+
+	client, err := a.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	data, err := a.casher.TakeOAuthCode(ctx, hashToken(code))
+	if err != nil {
+		if errors.Is(err, redisGo.Nil) {
+			return models.Tokens{}, fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+		}
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var authCode models.AuthorizationCode
+	if err := json.Unmarshal(data, &authCode); err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if authCode.ClientID != client.ID || authCode.RedirectURI != redirectURI {
+		log.Warn("authorization code used by another client or redirect uri")
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+	}
+
+	if !verifyPKCE(codeVerifier, authCode.CodeChallenge) {
+		log.Warn("pkce verification failed")
+
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+	}
+
+	user, err := a.storage.UserWithPermissions(ctx, authCode.Email, authCode.AppUUID)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	tokenPair, err := a.createScopedTokenPair(ctx, user, authCode.AppUUID, authCode.Scope, client.ID)
+	if err != nil {
+		return models.Tokens{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if hasScope(authCode.Scope, scopeOpenID) {
+		tokenPair.IDToken, err = a.createIDToken(ctx, user, authCode)
+		if err != nil {
+			log.Error("failed to create id token", sl.Err(err))
+
+			return models.Tokens{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return tokenPair, nil
+}
+
+// AccessTTL is lifetime of issued access tokens, reported as expires_in.
+func (a *Auth) AccessTTL() time.Duration {
+	return a.accessTTL
+}
+
+func (a *Auth) authenticateClient(ctx context.Context, clientID string, clientSecret string) (models.OAuthClient, error) {
+	client, err := a.storage.OAuthClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, storage.ErrClientNotFound) {
+			return models.OAuthClient{}, ErrInvalidClient
+		}
+		return models.OAuthClient{}, err
+	}
+
+	if client.Public {
+		return client, nil
+	}
+
+	if clientSecret == "" || a.hasher.Compare(client.SecretHash, clientSecret) != nil {
+		return models.OAuthClient{}, ErrInvalidClient
+	}
+	return client, nil
+}
+
+func (a *Auth) issueAuthorizationCode(ctx context.Context, authCode models.AuthorizationCode) (string, error) {
+	code, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(authCode)
+	if err != nil {
+		return "", err
+	}
+
+	if err := a.casher.SetOAuthCode(ctx, hashToken(code), data, authorizationCodeTTL); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// verifyPKCE checks code_verifier against S256 code_challenge (RFC 7636).
+func verifyPKCE(verifier string, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
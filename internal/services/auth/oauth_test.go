@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"SSO/internal/domain/models"
+
+	"github.com/google/uuid"
+)
+
+func TestRefreshRotation(t *testing.T) {
+	ctx := context.Background()
+	appUUID := uuid.New()
+
+	fake := newFakeStorage()
+	user := fake.addUser("user@example.com")
+	fake.addClient(models.OAuthClient{ID: "spa", AppUUID: appUUID, Public: true})
+	fake.addClient(models.OAuthClient{ID: "other", AppUUID: appUUID, Public: true})
+	a := newTestAuth(fake)
+
+	first, err := a.createScopedTokenPair(ctx, user, appUUID, "profile", "spa")
+	if err != nil {
+		t.Fatalf("createScopedTokenPair() error = %v", err)
+	}
+
+	second, err := a.RefreshClientToken(ctx, "spa", "", first.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshClientToken() error = %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("RefreshClientToken() returned the same refresh token")
+	}
+
+	// token of another client is refused without revoking session
+	if _, err := a.RefreshClientToken(ctx, "other", "", second.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("RefreshClientToken() of other client error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	third, err := a.RefreshClientToken(ctx, "spa", "", second.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshClientToken() error = %v", err)
+	}
+
+	// rotated token is replayed: it is refused and session is revoked
+	if _, err := a.RefreshClientToken(ctx, "spa", "", first.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("RefreshClientToken() of rotated token error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	if _, err := a.RefreshClientToken(ctx, "spa", "", third.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("RefreshClientToken() after reuse error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func TestExchangeAuthorizationCodePKCE(t *testing.T) {
+	// verifier and challenge of RFC 7636 appendix B
+	const (
+		verifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+		redirectURI = "https://app.example.com/callback"
+	)
+	ctx := context.Background()
+	appUUID := uuid.New()
+
+	fake := newFakeStorage()
+	user := fake.addUser("user@example.com")
+	fake.addClient(models.OAuthClient{ID: "spa", AppUUID: appUUID, RedirectURIs: []string{redirectURI}, Public: true})
+	a := newTestAuth(fake)
+
+	tests := []struct {
+		name     string
+		verifier string
+		wantErr  error
+	}{
+		{name: "S256", verifier: verifier},
+		{name: "wrong verifier", verifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXX", wantErr: ErrInvalidGrant},
+		{name: "plain", verifier: challenge, wantErr: ErrInvalidGrant},
+		{name: "short verifier", verifier: "dBjftJeZ4CVP", wantErr: ErrInvalidGrant},
+		{name: "missing verifier", wantErr: ErrInvalidGrant},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := a.issueAuthorizationCode(ctx, models.AuthorizationCode{
+				ClientID:      "spa",
+				AppUUID:       appUUID,
+				Email:         user.Email,
+				RedirectURI:   redirectURI,
+				CodeChallenge: challenge,
+				AuthTime:      time.Now(),
+			})
+			if err != nil {
+				t.Fatalf("issueAuthorizationCode() error = %v", err)
+			}
+
+			tokens, err := a.ExchangeAuthorizationCode(ctx, "spa", "", code, redirectURI, tt.verifier)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ExchangeAuthorizationCode() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && tokens.AccessToken == "" {
+				t.Fatal("ExchangeAuthorizationCode() returned no access token")
+			}
+
+			// code is used once whatever the outcome
+			if _, err := a.ExchangeAuthorizationCode(ctx, "spa", "", code, redirectURI, verifier); !errors.Is(err, ErrInvalidGrant) {
+				t.Fatalf("ExchangeAuthorizationCode() of used code error = %v, want %v", err, ErrInvalidGrant)
+			}
+		})
+	}
+}
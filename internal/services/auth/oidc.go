@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/jwtLib"
+	"SSO/internal/lib/logger/sl"
+
+	"github.com/google/uuid"
+)
+
+const (
+	scopeOpenID      = "openid"
+	scopeEmail       = "email"
+	scopePermissions = "permissions"
+)
+
+// SupportedScopes are scopes released by ID token and userinfo.
+var SupportedScopes = []string{scopeOpenID, scopeEmail, scopePermissions}
+
+// SupportedClaims are claims that can be released by SupportedScopes.
+var SupportedClaims = []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "email", "permissions"}
+
+// Issuer is OIDC issuer identifier, base url of the SSO.
+func (a *Auth) Issuer() string {
+	return a.issuer
+}
+
+// JWKS is public part of the service signing key.
+func (a *Auth) JWKS() jwtLib.JWKS {
+	return a.signingKey.JWKS()
+}
+
+// UserInfo returns claims about owner of access token released by its scope.
+func (a *Auth) UserInfo(ctx context.Context, accessToken string) (map[string]any, error) {
+	const op = "Auth.UserInfo"
+
+	claims, err := jwtLib.ParseAccessToken(accessToken, a.authApp)
+	if err != nil {
+		a.log.Info("invalid access token", slog.String("op", op), sl.Err(err))
+
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidAccessToken)
+	}
+
+	scope, _ := claims["scope"].(string)
+	if !hasScope(scope, scopeOpenID) {
+		return nil, fmt.Errorf("%s: %w", op, ErrInsufficientScope)
+	}
+
+	email, _ := claims["email"].(string)
+	app, _ := claims["app"].(string)
+	appUUID, err := uuid.Parse(app)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidAccessToken)
+	}
+
+	user, err := a.storage.UserWithPermissions(ctx, email, appUUID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	info := releasedClaims(user, scope)
+	info["sub"] = user.UUID.String()
+
+	return info, nil
+}
+
+func (a *Auth) createIDToken(ctx context.Context, user models.User, authCode models.AuthorizationCode) (string, error) {
+	return jwtLib.CreateIDToken(
+		ctx,
+		user,
+		a.signingKey,
+		a.issuer,
+		authCode.ClientID,
+		authCode.Nonce,
+		authCode.AuthTime,
+		releasedClaims(user, authCode.Scope),
+		a.accessTTL,
+	)
+}
+
+// releasedClaims returns user claims allowed by granted scope.
+func releasedClaims(user models.User, scope string) map[string]any {
+	claims := map[string]any{}
+
+	if hasScope(scope, scopeEmail) {
+		claims["email"] = user.Email
+	}
+	if hasScope(scope, scopePermissions) {
+		claims["permissions"] = user.Permissions
+	}
+
+	return claims
+}
+
+func hasScope(scope string, want string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/logger/sl"
+	"SSO/internal/lib/saml"
+	"SSO/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+const (
+	samlAssertionTTL = 5 * time.Minute
+
+	samlFieldEmail       = "email"
+	samlFieldUUID        = "uuid"
+	samlFieldPermissions = "permissions"
+)
+
+// defaultSAMLAttributes are released when service provider is registered
+// without attribute mapping.
+var defaultSAMLAttributes = map[string]string{
+	"email":       samlFieldEmail,
+	"permissions": samlFieldPermissions,
+}
+
+// RegisterSAMLServiceProvider registers SaaS tool of app from its SAML
+// metadata. attributes maps SAML attribute names to user fields.
+func (a *Auth) RegisterSAMLServiceProvider(
+	ctx context.Context,
+	appUUID uuid.UUID,
+	metadata []byte,
+	nameIDFormat string,
+	attributes map[string]string,
+) (models.SAMLServiceProvider, error) {
+	const op = "Auth.RegisterSAMLServiceProvider"
+
+	log := a.log.With(slog.String("op", op), slog.String("app", appUUID.String()))
+
+	meta, err := saml.ParseServiceProviderMetadata(metadata)
+	if err != nil {
+		return models.SAMLServiceProvider{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	switch nameIDFormat {
+	case "":
+		nameIDFormat = saml.NameIDFormatEmail
+	case saml.NameIDFormatEmail, saml.NameIDFormatPersistent:
+	default:
+		return models.SAMLServiceProvider{}, fmt.Errorf("%s: unsupported name id format: %w", op, ErrInvalidAttributeMapping)
+	}
+
+	if len(attributes) == 0 {
+		attributes = defaultSAMLAttributes
+	}
+	for name, field := range attributes {
+		if name == "" || (field != samlFieldEmail && field != samlFieldUUID && field != samlFieldPermissions) {
+			return models.SAMLServiceProvider{}, fmt.Errorf("%s: attribute %q: %w", op, name, ErrInvalidAttributeMapping)
+		}
+	}
+
+	sp := models.SAMLServiceProvider{
+		EntityID:     meta.EntityID,
+		AppUUID:      appUUID,
+		ACSURL:       meta.ACSURL,
+		NameIDFormat: nameIDFormat,
+		Attributes:   attributes,
+	}
+
+	if err := a.storage.SaveSAMLServiceProvider(ctx, sp); err != nil {
+		log.Error("failed to save service provider", sl.Err(err))
+
+		return models.SAMLServiceProvider{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("saml service provider registered", slog.String("entity_id", sp.EntityID))
+
+	return sp, nil
+}
+
+// SAMLMetadata is IdP metadata published to service providers.
+func (a *Auth) SAMLMetadata() ([]byte, error) {
+	return a.samlIdP.Metadata()
+}
+
+// ValidateSAMLRequest checks AuthnRequest before login form is shown,
+// deflated is true for HTTP-Redirect binding.
+func (a *Auth) ValidateSAMLRequest(ctx context.Context, samlRequest string, deflated bool) (models.SAMLServiceProvider, saml.AuthnRequest, error) {
+	const op = "Auth.ValidateSAMLRequest"
+
+	req, err := saml.DecodeAuthnRequest(samlRequest, deflated)
+	if err != nil {
+		return models.SAMLServiceProvider{}, saml.AuthnRequest{}, fmt.Errorf("%s: %w: %w", op, ErrInvalidSAMLRequest, err)
+	}
+
+	sp, err := a.storage.SAMLServiceProvider(ctx, req.Issuer)
+	if err != nil {
+		if errors.Is(err, storage.ErrServiceProviderNotFound) {
+			return models.SAMLServiceProvider{}, saml.AuthnRequest{}, fmt.Errorf("%s: %w", op, ErrUnknownServiceProvider)
+		}
+		return models.SAMLServiceProvider{}, saml.AuthnRequest{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// assertion is only sent to registered consumer service
+	if req.ACSURL != "" && req.ACSURL != sp.ACSURL {
+		return models.SAMLServiceProvider{}, saml.AuthnRequest{}, fmt.Errorf("%s: unregistered acs url: %w", op, ErrInvalidSAMLRequest)
+	}
+
+	return sp, req, nil
+}
+
+// SAMLLogin logs user in on SAML login page and returns signed response
+// to be posted to assertion consumer service of service provider.
+func (a *Auth) SAMLLogin(
+	ctx context.Context,
+	samlRequest string,
+	deflated bool,
+	email string,
+	password string,
+	mfaCode string,
+) (acsURL string, samlResponse string, err error) {
+	const op = "Auth.SAMLLogin"
+
+	sp, req, err := a.ValidateSAMLRequest(ctx, samlRequest, deflated)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() { a.observeLogin(ctx, loginMethodSAML, email, sp.AppUUID, err) }()
+
+	log := a.log.With(slog.String("op", op), slog.String("entity_id", sp.EntityID), slog.String("email", email))
+
+	user, err := a.checkPassword(ctx, email, password, sp.AppUUID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if user.MFAEnabled {
+		if mfaCode == "" {
+			return "", "", fmt.Errorf("%s: %w", op, ErrMFARequired)
+		}
+		if err := a.verifyMFACode(ctx, user, mfaCode); err != nil {
+			return "", "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	nameID := user.Email
+	if sp.NameIDFormat == saml.NameIDFormatPersistent {
+		nameID = user.UUID.String()
+	}
+
+	response, err := a.samlIdP.Response(saml.Assertion{
+		Audience:     sp.EntityID,
+		Recipient:    sp.ACSURL,
+		InResponseTo: req.ID,
+		NameID:       nameID,
+		NameIDFormat: sp.NameIDFormat,
+		AuthnInstant: time.Now(),
+		Attributes:   samlAttributes(user, sp.Attributes),
+		Lifetime:     samlAssertionTTL,
+	})
+	if err != nil {
+		log.Error("failed to build saml response", sl.Err(err))
+
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("saml assertion issued")
+
+	return sp.ACSURL, base64.StdEncoding.EncodeToString(response), nil
+}
+
+// samlAttributes maps user fields to SAML attributes of service provider.
+func samlAttributes(user models.User, mapping map[string]string) map[string][]string {
+	attributes := make(map[string][]string, len(mapping))
+
+	for name, field := range mapping {
+		switch field {
+		case samlFieldEmail:
+			attributes[name] = []string{user.Email}
+		case samlFieldUUID:
+			attributes[name] = []string{user.UUID.String()}
+		case samlFieldPermissions:
+			var permissions []string
+			for permission, granted := range user.Permissions {
+				if granted {
+					permissions = append(permissions, permission)
+				}
+			}
+			sort.Strings(permissions)
+			attributes[name] = permissions
+		}
+	}
+
+	return attributes
+}
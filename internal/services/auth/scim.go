@@ -0,0 +1,989 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/jwtLib"
+	"SSO/internal/lib/logger/sl"
+	"SSO/internal/lib/scim"
+	verfic "SSO/internal/lib/verifications"
+	"SSO/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// SCIMPermission is app permission provisioning client (HR system) needs.
+	// SCIM groups seen by the client are permissions of its app.
+	SCIMPermission = "scim"
+	// SCIMGlobalPermission is permission of admin app letting provisioning
+	// client manage every user. Users are shared by all apps, so only such
+	// client may change userName, active and password or delete users.
+	SCIMGlobalPermission = "scim.global"
+
+	scimBatchSize = 500
+)
+
+// scimReservedPermission reports permissions granting SCIM or admin access,
+// they are not SCIM groups and are managed by admin API only, otherwise
+// provisioning client could grant itself more power.
+func scimReservedPermission(name string) bool {
+	switch name {
+	case SCIMPermission, SCIMGlobalPermission, AdminPermission:
+		return true
+	}
+	return false
+}
+
+// SCIMScope is what provisioning client manages: groups are permissions of
+// its app, users are users holding any of them unless scope is Global.
+type SCIMScope struct {
+	AppUUID uuid.UUID
+	Global  bool
+}
+
+// AuthorizeSCIM checks bearer token of provisioning client and returns its
+// scope. Scope is global for client of adminApp holding SCIMGlobalPermission.
+func (a *Auth) AuthorizeSCIM(ctx context.Context, accessToken string, adminApp uuid.UUID) (SCIMScope, error) {
+	const op = "Auth.AuthorizeSCIM"
+
+	claims, err := jwtLib.ParseAccessToken(accessToken, a.authApp)
+	if err != nil {
+		a.log.Info("invalid scim token", slog.String("op", op), sl.Err(err))
+
+		return SCIMScope{}, fmt.Errorf("%s: %w", op, ErrInvalidAccessToken)
+	}
+
+	app, _ := claims["app"].(string)
+	appUUID, err := uuid.Parse(app)
+	if err != nil {
+		return SCIMScope{}, fmt.Errorf("%s: %w", op, ErrInvalidAccessToken)
+	}
+
+	// permission is checked in storage so revoked client stops at once
+	var permissions map[string]bool
+	if clientID, ok := claims["client_id"].(string); ok {
+		permissions, err = a.storage.ServiceAccountPermissions(ctx, clientID, appUUID)
+		if err != nil {
+			return SCIMScope{}, fmt.Errorf("%s: %w", op, err)
+		}
+	} else {
+		email, _ := claims["email"].(string)
+		user, err := a.storage.UserWithPermissions(ctx, email, appUUID)
+		if err != nil {
+			return SCIMScope{}, fmt.Errorf("%s: %w", op, err)
+		}
+		if !user.Disabled {
+			permissions = user.Permissions
+		}
+	}
+
+	if !permissions[SCIMPermission] {
+		return SCIMScope{}, fmt.Errorf("%s: %w", op, ErrSCIMNotAllowed)
+	}
+
+	scope := SCIMScope{AppUUID: appUUID}
+	scope.Global = adminApp != uuid.Nil && appUUID == adminApp && permissions[SCIMGlobalPermission]
+
+	return scope, nil
+}
+
+// SCIMUsers lists users matching filter, filter `userName eq "..."` used by
+// provisioning clients to find existing account is served by email lookup.
+func (a *Auth) SCIMUsers(ctx context.Context, scope SCIMScope, filter string, startIndex int, count int) (scim.ListResponse, error) {
+	const op = "Auth.SCIMUsers"
+
+	appUUID := scope.AppUUID
+
+	groups, err := a.scimGroupRefs(ctx, appUUID)
+	if err != nil {
+		return scim.ListResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if filter == "" {
+		users, total, err := a.scimUsersPage(ctx, scope, max(startIndex, 1)-1, count)
+		if err != nil {
+			return scim.ListResponse{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		resources := make([]scim.User, 0, len(users))
+		for _, user := range users {
+			resource, err := a.scimUser(ctx, appUUID, user, groups)
+			if err != nil {
+				return scim.ListResponse{}, fmt.Errorf("%s: %w", op, err)
+			}
+			resources = append(resources, resource)
+		}
+
+		return scim.NewListPage(resources, total, startIndex), nil
+	}
+
+	f, err := scim.ParseFilter(filter)
+	if err != nil {
+		return scim.ListResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var candidates []models.User
+	if email, ok := scim.EqualityValue(f, "userName"); ok {
+		user, err := a.storage.User(ctx, email)
+		if err == nil {
+			err = a.scimCheckVisible(ctx, scope, user)
+		}
+		switch {
+		case err == nil:
+			candidates = append(candidates, user)
+		case !errors.Is(err, storage.ErrUserNotFound):
+			return scim.ListResponse{}, fmt.Errorf("%s: %w", op, err)
+		}
+	} else {
+		for offset := 0; ; offset += scimBatchSize {
+			users, total, err := a.scimUsersPage(ctx, scope, offset, scimBatchSize)
+			if err != nil {
+				return scim.ListResponse{}, fmt.Errorf("%s: %w", op, err)
+			}
+			candidates = append(candidates, users...)
+
+			if len(users) == 0 || offset+scimBatchSize >= total {
+				break
+			}
+		}
+	}
+
+	var matched []scim.User
+	for _, user := range candidates {
+		resource, err := a.scimUser(ctx, appUUID, user, groups)
+		if err != nil {
+			return scim.ListResponse{}, fmt.Errorf("%s: %w", op, err)
+		}
+		if f.Match(resource.Attributes()) {
+			matched = append(matched, resource)
+		}
+	}
+
+	return scim.NewListResponse(matched, startIndex, count), nil
+}
+
+func (a *Auth) SCIMUser(ctx context.Context, scope SCIMScope, id string) (scim.User, error) {
+	const op = "Auth.SCIMUser"
+
+	user, err := a.scimScopedUser(ctx, scope, id)
+	if err != nil {
+		return scim.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	resource, err := a.scimUserWithGroups(ctx, scope.AppUUID, user)
+	if err != nil {
+		return scim.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return resource, nil
+}
+
+// CreateSCIMUser provisions joiner. userName is email of the user, user
+// without password gets random one and logs in by magic link, federation
+// or after password reset. Only global scope may set password.
+func (a *Auth) CreateSCIMUser(ctx context.Context, scope SCIMScope, in scim.User) (scim.User, error) {
+	const op = "Auth.CreateSCIMUser"
+
+	appUUID := scope.AppUUID
+
+	log := a.log.With(slog.String("op", op), slog.String("email", in.UserName))
+
+	if ok, err := verfic.VerifyEmail(in.UserName); !ok || err != nil {
+		return scim.User{}, fmt.Errorf("%s: userName must be email: %w", op, ErrInvalidSCIMRequest)
+	}
+	if in.Password != "" && !scope.Global {
+		return scim.User{}, fmt.Errorf("%s: password: %w", op, ErrSCIMGlobalRequired)
+	}
+
+	password := in.Password
+	if password == "" {
+		random, err := newOpaqueToken()
+		if err != nil {
+			return scim.User{}, fmt.Errorf("%s: %w", op, err)
+		}
+		password = random
+	}
+
+	passHash, err := a.hasher.Hash(password)
+	if err != nil {
+		log.Error("failed to generate password hash", sl.Err(err))
+
+		return scim.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user := models.User{UUID: uuid.New(), Email: in.UserName, PassHash: passHash}
+	events := outboxEvents(models.IdentityEvent{Type: models.EventUserRegistered, UserUUID: user.UUID, Email: user.Email})
+	if err := a.storage.SaveUser(ctx, user.UUID, user.Email, user.PassHash, events); err != nil {
+		if !errors.Is(err, storage.ErrUserExists) {
+			log.Error("failed to save user", sl.Err(err))
+		}
+
+		return scim.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if in.Active != nil && !*in.Active {
+		enabled := user
+		user.Disabled = true
+		if err := a.storage.UpdateUser(ctx, user, userStateEvents(enabled, user)); err != nil {
+			log.Error("failed to disable user", sl.Err(err))
+
+			return scim.User{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	log.Info("user provisioned by scim", slog.String("app", appUUID.String()))
+
+	resource, err := a.scimUserWithGroups(ctx, appUUID, user)
+	if err != nil {
+		return scim.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return resource, nil
+}
+
+// ReplaceSCIMUser is PUT of user, omitted active keeps current state.
+func (a *Auth) ReplaceSCIMUser(ctx context.Context, scope SCIMScope, id string, in scim.User) (scim.User, error) {
+	const op = "Auth.ReplaceSCIMUser"
+
+	user, err := a.scimScopedUser(ctx, scope, id)
+	if err != nil {
+		return scim.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	stored := user
+
+	if ok, err := verfic.VerifyEmail(in.UserName); !ok || err != nil {
+		return scim.User{}, fmt.Errorf("%s: userName must be email: %w", op, ErrInvalidSCIMRequest)
+	}
+	user.Email = in.UserName
+	if in.Active != nil {
+		user.Disabled = !*in.Active
+	}
+
+	if err := scimCheckChange(scope, stored, user, in.Password); err != nil {
+		return scim.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	resource, err := a.saveSCIMUser(ctx, scope.AppUUID, stored, user, in.Password)
+	if err != nil {
+		return scim.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return resource, nil
+}
+
+// PatchSCIMUser applies PATCH operations to userName, active and password.
+// Attributes SSO does not store (name, title, ...) are accepted and ignored.
+func (a *Auth) PatchSCIMUser(ctx context.Context, scope SCIMScope, id string, ops []scim.PatchOperation) (scim.User, error) {
+	const op = "Auth.PatchSCIMUser"
+
+	user, err := a.scimScopedUser(ctx, scope, id)
+	if err != nil {
+		return scim.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	stored := user
+
+	var password string
+	for _, patch := range ops {
+		patch, err := patch.Normalize()
+		if err != nil {
+			return scim.User{}, fmt.Errorf("%s: %w: %w", op, ErrInvalidSCIMRequest, err)
+		}
+
+		values := map[string]json.RawMessage{}
+		if patch.Path == "" {
+			if err := json.Unmarshal(patch.Value, &values); err != nil {
+				return scim.User{}, fmt.Errorf("%s: %w: %w", op, ErrInvalidSCIMRequest, err)
+			}
+		} else {
+			values[patch.Path] = patch.Value
+		}
+
+		for path, value := range values {
+			attr := scimAttribute(path, scim.SchemaUser)
+
+			if patch.Op == "remove" && (attr == "username" || attr == "active") {
+				return scim.User{}, fmt.Errorf("%s: remove %s: %w", op, attr, ErrSCIMMutability)
+			}
+
+			switch attr {
+			case "username":
+				var email string
+				if err := json.Unmarshal(value, &email); err != nil {
+					return scim.User{}, fmt.Errorf("%s: %w: %w", op, ErrInvalidSCIMRequest, err)
+				}
+				if ok, err := verfic.VerifyEmail(email); !ok || err != nil {
+					return scim.User{}, fmt.Errorf("%s: userName must be email: %w", op, ErrInvalidSCIMRequest)
+				}
+				user.Email = email
+			case "active":
+				active, err := scimBool(value)
+				if err != nil {
+					return scim.User{}, fmt.Errorf("%s: %w: %w", op, ErrInvalidSCIMRequest, err)
+				}
+				user.Disabled = !active
+			case "password":
+				if err := json.Unmarshal(value, &password); err != nil {
+					return scim.User{}, fmt.Errorf("%s: %w: %w", op, ErrInvalidSCIMRequest, err)
+				}
+			}
+		}
+	}
+
+	if err := scimCheckChange(scope, stored, user, password); err != nil {
+		return scim.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	resource, err := a.saveSCIMUser(ctx, scope.AppUUID, stored, user, password)
+	if err != nil {
+		return scim.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return resource, nil
+}
+
+// DeleteSCIMUser removes leaver with all permissions. Client without
+// global scope only removes user from its app, revoking app permissions.
+func (a *Auth) DeleteSCIMUser(ctx context.Context, scope SCIMScope, id string) error {
+	const op = "Auth.DeleteSCIMUser"
+
+	appUUID := scope.AppUUID
+
+	user, err := a.scimScopedUser(ctx, scope, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !scope.Global {
+		if err := a.removeSCIMAppUser(ctx, appUUID, user); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		a.log.Info("user removed from app by scim",
+			slog.String("op", op),
+			slog.String("email", user.Email),
+			slog.String("app", appUUID.String()),
+		)
+		return nil
+	}
+
+	events := outboxEvents(models.IdentityEvent{Type: models.EventUserDeleted, UserUUID: user.UUID, Email: user.Email})
+	if err := a.storage.DeleteUser(ctx, user.UUID, events); err != nil {
+		a.log.Error("failed to delete user", slog.String("op", op), sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("user deprovisioned by scim",
+		slog.String("op", op),
+		slog.String("email", user.Email),
+		slog.String("app", appUUID.String()),
+	)
+
+	return nil
+}
+
+// SCIMGroups lists permissions of app as groups, members are left out when
+// withMembers is false.
+func (a *Auth) SCIMGroups(ctx context.Context, appUUID uuid.UUID, filter string, startIndex int, count int, withMembers bool) (scim.ListResponse, error) {
+	const op = "Auth.SCIMGroups"
+
+	var f scim.Filter
+	if filter != "" {
+		var err error
+		if f, err = scim.ParseFilter(filter); err != nil {
+			return scim.ListResponse{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	permissions, err := a.scimPermissions(ctx, appUUID)
+	if err != nil {
+		return scim.ListResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var matched []scim.Group
+	for _, permission := range permissions {
+		// members are needed for filter on them even if not returned
+		group, err := a.scimGroup(ctx, permission, withMembers || f != nil)
+		if err != nil {
+			return scim.ListResponse{}, fmt.Errorf("%s: %w", op, err)
+		}
+		if f != nil && !f.Match(group.Attributes()) {
+			continue
+		}
+		if !withMembers {
+			group.Members = nil
+		}
+		matched = append(matched, group)
+	}
+
+	return scim.NewListResponse(matched, startIndex, count), nil
+}
+
+func (a *Auth) SCIMGroup(ctx context.Context, appUUID uuid.UUID, id string) (scim.Group, error) {
+	const op = "Auth.SCIMGroup"
+
+	permission, err := a.scimPermission(ctx, appUUID, id)
+	if err != nil {
+		return scim.Group{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	group, err := a.scimGroup(ctx, permission, true)
+	if err != nil {
+		return scim.Group{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return group, nil
+}
+
+// CreateSCIMGroup adds permission to app and grants it to members.
+func (a *Auth) CreateSCIMGroup(ctx context.Context, appUUID uuid.UUID, in scim.Group) (scim.Group, error) {
+	const op = "Auth.CreateSCIMGroup"
+
+	log := a.log.With(slog.String("op", op), slog.String("app", appUUID.String()))
+
+	if in.DisplayName == "" {
+		return scim.Group{}, fmt.Errorf("%s: displayName is required: %w", op, ErrInvalidSCIMRequest)
+	}
+	if scimReservedPermission(in.DisplayName) {
+		return scim.Group{}, fmt.Errorf("%s: %w", op, ErrSCIMReservedGroup)
+	}
+
+	permissions, err := a.scimPermissions(ctx, appUUID)
+	if err != nil {
+		return scim.Group{}, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, permission := range permissions {
+		if permission.Name == in.DisplayName {
+			return scim.Group{}, fmt.Errorf("%s: %w", op, storage.ErrPermExists)
+		}
+	}
+
+	permission, err := a.storage.SavePermission(ctx, uuid.New(), appUUID, in.DisplayName)
+	if err != nil {
+		log.Error("failed to save permission", sl.Err(err))
+
+		return scim.Group{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, member := range in.Members {
+		if err := a.grantSCIMMember(ctx, permission, member.Value); err != nil {
+			return scim.Group{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	log.Info("permission created by scim", slog.String("permission", permission.Name))
+
+	group, err := a.scimGroup(ctx, permission, true)
+	if err != nil {
+		return scim.Group{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return group, nil
+}
+
+// ReplaceSCIMGroup sets members of group, permission name cannot change.
+func (a *Auth) ReplaceSCIMGroup(ctx context.Context, appUUID uuid.UUID, id string, in scim.Group) (scim.Group, error) {
+	const op = "Auth.ReplaceSCIMGroup"
+
+	permission, err := a.scimPermission(ctx, appUUID, id)
+	if err != nil {
+		return scim.Group{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if in.DisplayName != "" && in.DisplayName != permission.Name {
+		return scim.Group{}, fmt.Errorf("%s: displayName: %w", op, ErrSCIMMutability)
+	}
+
+	if err := a.setSCIMMembers(ctx, permission, in.Members); err != nil {
+		return scim.Group{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	group, err := a.scimGroup(ctx, permission, true)
+	if err != nil {
+		return scim.Group{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return group, nil
+}
+
+// PatchSCIMGroup grants and revokes permission by member operations, it is
+// how movers are handled.
+func (a *Auth) PatchSCIMGroup(ctx context.Context, appUUID uuid.UUID, id string, ops []scim.PatchOperation) (scim.Group, error) {
+	const op = "Auth.PatchSCIMGroup"
+
+	permission, err := a.scimPermission(ctx, appUUID, id)
+	if err != nil {
+		return scim.Group{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, patch := range ops {
+		patch, err := patch.Normalize()
+		if err != nil {
+			return scim.Group{}, fmt.Errorf("%s: %w: %w", op, ErrInvalidSCIMRequest, err)
+		}
+
+		if err := a.patchSCIMGroup(ctx, permission, patch); err != nil {
+			return scim.Group{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	group, err := a.scimGroup(ctx, permission, true)
+	if err != nil {
+		return scim.Group{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return group, nil
+}
+
+func (a *Auth) DeleteSCIMGroup(ctx context.Context, appUUID uuid.UUID, id string) error {
+	const op = "Auth.DeleteSCIMGroup"
+
+	permission, err := a.scimPermission(ctx, appUUID, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.deletePermission(ctx, appUUID, permission.UUID); err != nil {
+		a.log.Error("failed to delete permission", slog.String("op", op), sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.log.Info("permission deleted by scim",
+		slog.String("op", op),
+		slog.String("app", appUUID.String()),
+		slog.String("permission", permission.Name),
+	)
+
+	return nil
+}
+
+func (a *Auth) patchSCIMGroup(ctx context.Context, permission models.Permission, patch scim.PatchOperation) error {
+	if patch.Path == "" {
+		var value struct {
+			DisplayName *string    `json:"displayName"`
+			Members     []scim.Ref `json:"members"`
+		}
+		if err := json.Unmarshal(patch.Value, &value); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidSCIMRequest, err)
+		}
+		if value.DisplayName != nil && *value.DisplayName != permission.Name {
+			return fmt.Errorf("displayName: %w", ErrSCIMMutability)
+		}
+		if value.Members == nil {
+			return nil
+		}
+		if patch.Op == "replace" {
+			return a.setSCIMMembers(ctx, permission, value.Members)
+		}
+		for _, member := range value.Members {
+			if err := a.grantSCIMMember(ctx, permission, member.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	attr, filter, err := scim.ValueFilter(patch.Path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSCIMRequest, err)
+	}
+
+	switch scimAttribute(attr, scim.SchemaGroup) {
+	case "displayname":
+		var name string
+		if patch.Op == "remove" || json.Unmarshal(patch.Value, &name) != nil || name != permission.Name {
+			return fmt.Errorf("displayName: %w", ErrSCIMMutability)
+		}
+		return nil
+	case "members":
+	default:
+		return fmt.Errorf("%w: unknown path %q", ErrInvalidSCIMRequest, patch.Path)
+	}
+
+	var refs []scim.Ref
+	if len(patch.Value) > 0 {
+		if err := json.Unmarshal(patch.Value, &refs); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidSCIMRequest, err)
+		}
+	}
+
+	switch patch.Op {
+	case "add":
+		for _, ref := range refs {
+			if err := a.grantSCIMMember(ctx, permission, ref.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "replace":
+		return a.setSCIMMembers(ctx, permission, refs)
+	}
+
+	// remove by filter in path, by listed members or all members
+	members, err := a.storage.PermissionUsers(ctx, permission.UUID)
+	if err != nil {
+		return err
+	}
+
+	listed := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		listed[strings.ToLower(ref.Value)] = true
+	}
+
+	for _, member := range members {
+		id := member.UUID.String()
+		switch {
+		case filter != nil && !filter.Match(map[string][]string{"value": {id}, "display": {member.Email}}):
+			continue
+		case filter == nil && len(refs) > 0 && !listed[id]:
+			continue
+		}
+		if err := a.revokeSCIMMember(ctx, permission, member); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setSCIMMembers grants permission to listed users and revokes it from
+// everyone else.
+func (a *Auth) setSCIMMembers(ctx context.Context, permission models.Permission, refs []scim.Ref) error {
+	if scimReservedPermission(permission.Name) {
+		return ErrSCIMReservedGroup
+	}
+
+	members, err := a.storage.PermissionUsers(ctx, permission.UUID)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		wanted[strings.ToLower(ref.Value)] = true
+	}
+
+	current := make(map[string]bool, len(members))
+	for _, member := range members {
+		id := member.UUID.String()
+		current[id] = true
+
+		if !wanted[id] {
+			if err := a.revokeSCIMMember(ctx, permission, member); err != nil {
+				return err
+			}
+		}
+	}
+
+	for id := range wanted {
+		if current[id] {
+			continue
+		}
+		if err := a.grantSCIMMember(ctx, permission, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Auth) grantSCIMMember(ctx context.Context, permission models.Permission, id string) error {
+	if scimReservedPermission(permission.Name) {
+		return ErrSCIMReservedGroup
+	}
+
+	user, err := a.scimStoredUser(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("member %q: %w", id, ErrInvalidSCIMRequest)
+		}
+		return err
+	}
+
+	err = a.storage.AddUserPermissions(ctx, user.Email, permission.AppUUID, permission.UUID, outboxEvents(models.IdentityEvent{
+		Type:           models.EventPermissionGranted,
+		AppUUID:        permission.AppUUID,
+		Email:          user.Email,
+		PermissionUUID: permission.UUID,
+	}))
+	if err != nil && !errors.Is(err, storage.ErrUserPermissionsExists) {
+		return err
+	}
+
+	a.log.Info("permission granted by scim",
+		slog.String("email", user.Email),
+		slog.String("permission", permission.Name),
+	)
+	return nil
+}
+
+func (a *Auth) revokeSCIMMember(ctx context.Context, permission models.Permission, user models.User) error {
+	err := a.storage.RevokeUserPermissions(ctx, user.Email, permission.AppUUID, permission.UUID, outboxEvents(models.IdentityEvent{
+		Type:           models.EventPermissionRevoked,
+		AppUUID:        permission.AppUUID,
+		Email:          user.Email,
+		PermissionUUID: permission.UUID,
+	}))
+	if err != nil && !errors.Is(err, storage.ErrNoSuchUserPermission) {
+		return err
+	}
+
+	a.log.Info("permission revoked by scim",
+		slog.String("email", user.Email),
+		slog.String("permission", permission.Name),
+	)
+	return nil
+}
+
+// saveSCIMUser stores changed email, active state and password of user,
+// stored is user before the change.
+func (a *Auth) saveSCIMUser(ctx context.Context, appUUID uuid.UUID, stored models.User, user models.User, password string) (scim.User, error) {
+	log := a.log.With(slog.String("email", user.Email))
+
+	if password != "" {
+		passHash, err := a.hasher.Hash(password)
+		if err != nil {
+			log.Error("failed to generate password hash", sl.Err(err))
+
+			return scim.User{}, err
+		}
+		if err := a.storage.UpdatePassHash(ctx, user.UUID, passHash); err != nil {
+			log.Error("failed to update password hash", sl.Err(err))
+
+			return scim.User{}, err
+		}
+	}
+
+	if err := a.storage.UpdateUser(ctx, user, userStateEvents(stored, user)); err != nil {
+		if !errors.Is(err, storage.ErrEmailTaken) {
+			log.Error("failed to update user", sl.Err(err))
+		}
+
+		return scim.User{}, err
+	}
+
+	log.Info("user updated by scim", slog.Bool("disabled", user.Disabled))
+
+	return a.scimUserWithGroups(ctx, appUUID, user)
+}
+
+// scimCheckChange refuses changes of shared user attributes to client
+// without global scope, unchanged values sent by PUT are accepted.
+func scimCheckChange(scope SCIMScope, stored models.User, user models.User, password string) error {
+	if scope.Global {
+		return nil
+	}
+	switch {
+	case password != "":
+		return fmt.Errorf("password: %w", ErrSCIMGlobalRequired)
+	case user.Email != stored.Email:
+		return fmt.Errorf("userName: %w", ErrSCIMGlobalRequired)
+	case user.Disabled != stored.Disabled:
+		return fmt.Errorf("active: %w", ErrSCIMGlobalRequired)
+	}
+	return nil
+}
+
+// removeSCIMAppUser revokes every permission of app from user.
+func (a *Auth) removeSCIMAppUser(ctx context.Context, appUUID uuid.UUID, user models.User) error {
+	permissions, err := a.scimPermissions(ctx, appUUID)
+	if err != nil {
+		return err
+	}
+
+	withPermissions, err := a.storage.UserWithPermissions(ctx, user.Email, appUUID)
+	if err != nil {
+		return err
+	}
+
+	for _, permission := range permissions {
+		if !withPermissions.Permissions[permission.Name] {
+			continue
+		}
+		if err := a.revokeSCIMMember(ctx, permission, user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scimUsersPage pages all users for global scope, users of app otherwise.
+func (a *Auth) scimUsersPage(ctx context.Context, scope SCIMScope, offset int, limit int) ([]models.User, int, error) {
+	if scope.Global {
+		return a.storage.Users(ctx, offset, limit)
+	}
+	return a.storage.AppUsers(ctx, scope.AppUUID, offset, limit)
+}
+
+// scimScopedUser is stored user visible to client, others are not found.
+func (a *Auth) scimScopedUser(ctx context.Context, scope SCIMScope, id string) (models.User, error) {
+	user, err := a.scimStoredUser(ctx, id)
+	if err != nil {
+		return models.User{}, err
+	}
+	if err := a.scimCheckVisible(ctx, scope, user); err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// scimCheckVisible reports storage.ErrUserNotFound for user holding no
+// permission of app of client without global scope.
+func (a *Auth) scimCheckVisible(ctx context.Context, scope SCIMScope, user models.User) error {
+	if scope.Global {
+		return nil
+	}
+
+	withPermissions, err := a.storage.UserWithPermissions(ctx, user.Email, scope.AppUUID)
+	if err != nil {
+		return err
+	}
+	for _, granted := range withPermissions.Permissions {
+		if granted {
+			return nil
+		}
+	}
+	return storage.ErrUserNotFound
+}
+
+func (a *Auth) scimStoredUser(ctx context.Context, id string) (models.User, error) {
+	userUUID, err := uuid.Parse(id)
+	if err != nil {
+		return models.User{}, storage.ErrUserNotFound
+	}
+	return a.storage.UserByUUID(ctx, userUUID)
+}
+
+func (a *Auth) scimUserWithGroups(ctx context.Context, appUUID uuid.UUID, user models.User) (scim.User, error) {
+	groups, err := a.scimGroupRefs(ctx, appUUID)
+	if err != nil {
+		return scim.User{}, err
+	}
+	return a.scimUser(ctx, appUUID, user, groups)
+}
+
+// scimUser is SCIM representation of user, groups are permissions of user
+// in app by permission name.
+func (a *Auth) scimUser(ctx context.Context, appUUID uuid.UUID, user models.User, groups map[string]scim.Ref) (scim.User, error) {
+	withPermissions, err := a.storage.UserWithPermissions(ctx, user.Email, appUUID)
+	if err != nil {
+		return scim.User{}, err
+	}
+
+	id := user.UUID.String()
+	active := !user.Disabled
+
+	resource := scim.User{
+		Schemas:  []string{scim.SchemaUser},
+		ID:       id,
+		UserName: user.Email,
+		Emails:   []scim.Email{{Value: user.Email, Type: "work", Primary: true}},
+		Active:   &active,
+		Meta:     &scim.Meta{ResourceType: "User", Location: a.scimLocation("Users", id)},
+	}
+
+	for permission, granted := range withPermissions.Permissions {
+		if group, ok := groups[permission]; ok && granted {
+			resource.Groups = append(resource.Groups, group)
+		}
+	}
+	sort.Slice(resource.Groups, func(i, j int) bool {
+		return resource.Groups[i].Display < resource.Groups[j].Display
+	})
+
+	return resource, nil
+}
+
+func (a *Auth) scimGroup(ctx context.Context, permission models.Permission, withMembers bool) (scim.Group, error) {
+	id := permission.UUID.String()
+
+	group := scim.Group{
+		Schemas:     []string{scim.SchemaGroup},
+		ID:          id,
+		DisplayName: permission.Name,
+		Meta:        &scim.Meta{ResourceType: "Group", Location: a.scimLocation("Groups", id)},
+	}
+
+	if !withMembers {
+		return group, nil
+	}
+
+	members, err := a.storage.PermissionUsers(ctx, permission.UUID)
+	if err != nil {
+		return scim.Group{}, err
+	}
+	for _, member := range members {
+		memberID := member.UUID.String()
+		group.Members = append(group.Members, scim.Ref{
+			Value:   memberID,
+			Ref:     a.scimLocation("Users", memberID),
+			Display: member.Email,
+		})
+	}
+
+	return group, nil
+}
+
+// scimGroupRefs maps permission names of app to group references.
+func (a *Auth) scimGroupRefs(ctx context.Context, appUUID uuid.UUID) (map[string]scim.Ref, error) {
+	permissions, err := a.scimPermissions(ctx, appUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make(map[string]scim.Ref, len(permissions))
+	for _, permission := range permissions {
+		id := permission.UUID.String()
+		refs[permission.Name] = scim.Ref{Value: id, Ref: a.scimLocation("Groups", id), Display: permission.Name}
+	}
+	return refs, nil
+}
+
+// scimPermissions are permissions of app exposed as groups, reserved ones
+// are left out.
+func (a *Auth) scimPermissions(ctx context.Context, appUUID uuid.UUID) ([]models.Permission, error) {
+	permissions, err := a.storage.GetAppPermissions(ctx, appUUID)
+	if err != nil && !errors.Is(err, storage.ErrNoPermissionsAtApp) {
+		return nil, err
+	}
+	return slices.DeleteFunc(permissions, func(permission models.Permission) bool {
+		return scimReservedPermission(permission.Name)
+	}), nil
+}
+
+func (a *Auth) scimPermission(ctx context.Context, appUUID uuid.UUID, id string) (models.Permission, error) {
+	permissions, err := a.scimPermissions(ctx, appUUID)
+	if err != nil {
+		return models.Permission{}, err
+	}
+	for _, permission := range permissions {
+		if strings.EqualFold(permission.UUID.String(), id) {
+			return permission, nil
+		}
+	}
+	return models.Permission{}, storage.ErrPermNotFound
+}
+
+func (a *Auth) scimLocation(resource string, id string) string {
+	return strings.TrimSuffix(a.issuer, "/") + "/scim/v2/" + resource + "/" + id
+}
+
+// scimAttribute lower cases attribute path and strips schema URN prefix.
+func scimAttribute(path string, schema string) string {
+	path = strings.ToLower(path)
+	return strings.TrimPrefix(path, strings.ToLower(schema)+":")
+}
+
+// scimBool accepts JSON bool and "True"/"False" strings sent by Azure AD.
+func scimBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(s)
+}
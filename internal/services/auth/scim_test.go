@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"SSO/internal/lib/scim"
+	"SSO/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+func TestSCIMReservedGroups(t *testing.T) {
+	ctx := context.Background()
+	appUUID := uuid.New()
+
+	for _, name := range []string{SCIMPermission, SCIMGlobalPermission, AdminPermission} {
+		t.Run(name, func(t *testing.T) {
+			fake := newFakeStorage()
+			client := fake.addUser("hr@example.com")
+			target := fake.addUser("mallory@example.com")
+			reserved := fake.addPermission(appUUID, name, client)
+			fake.addPermission(appUUID, "reader", target)
+			a := newTestAuth(fake)
+
+			members, err := json.Marshal([]scim.Ref{{Value: target.UUID.String()}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			id := reserved.UUID.String()
+
+			groups, err := a.SCIMGroups(ctx, appUUID, "", 1, 100, false)
+			if err != nil {
+				t.Fatalf("SCIMGroups() error = %v", err)
+			}
+			var names []string
+			for _, resource := range groups.Resources {
+				if group, ok := resource.(scim.Group); ok {
+					names = append(names, group.DisplayName)
+				}
+			}
+			if len(names) != 1 || names[0] != "reader" {
+				t.Fatalf("SCIMGroups() = %v, want [reader]", names)
+			}
+
+			// reserved groups are not found, handler answers 404
+			calls := map[string]error{}
+			_, calls["get"] = a.SCIMGroup(ctx, appUUID, id)
+			_, calls["patch"] = a.PatchSCIMGroup(ctx, appUUID, id, []scim.PatchOperation{{Op: "add", Path: "members", Value: members}})
+			_, calls["replace"] = a.ReplaceSCIMGroup(ctx, appUUID, id, scim.Group{Members: []scim.Ref{{Value: target.UUID.String()}}})
+			calls["delete"] = a.DeleteSCIMGroup(ctx, appUUID, id)
+			for call, err := range calls {
+				if !errors.Is(err, storage.ErrPermNotFound) {
+					t.Errorf("%s error = %v, want %v", call, err, storage.ErrPermNotFound)
+				}
+			}
+
+			// creating group of reserved name is forbidden, handler answers 403
+			_, err = a.CreateSCIMGroup(ctx, appUUID, scim.Group{DisplayName: name, Members: []scim.Ref{{Value: target.UUID.String()}}})
+			if !errors.Is(err, ErrSCIMReservedGroup) {
+				t.Errorf("CreateSCIMGroup() error = %v, want %v", err, ErrSCIMReservedGroup)
+			}
+			if err := a.grantSCIMMember(ctx, reserved, target.UUID.String()); !errors.Is(err, ErrSCIMReservedGroup) {
+				t.Errorf("grantSCIMMember() error = %v, want %v", err, ErrSCIMReservedGroup)
+			}
+
+			if fake.hasGrant(target.UUID, reserved.UUID) {
+				t.Fatalf("user was granted %s", name)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/jwtLib"
+	"SSO/internal/lib/logger/sl"
+	"SSO/internal/lib/requestmeta"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// TokenExchangePermission is app permission actor needs to exchange
+	// tokens on behalf of other users of the app.
+	TokenExchangePermission = "token_exchange"
+
+	// TokenTypeAccessToken is RFC 8693 type of subject and actor tokens.
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	// TokenTypeEmail is subject given by email, used for impersonation by
+	// support when there is no token of the subject.
+	TokenTypeEmail = "urn:sso:params:oauth:token-type:email"
+
+	// exchanged tokens live shorter than usual access tokens
+	tokenExchangeTTL = 5 * time.Minute
+)
+
+// TokenExchange is RFC 8693 token exchange. It issues access token of the
+// subject with "act" claim recording actor, actor must have
+// TokenExchangePermission in app of the subject. Token is issued for app of
+// the actor token and has no refresh token. Every exchange is recorded in
+// audit log with both actor and subject.
+func (a *Auth) TokenExchange(
+	ctx context.Context,
+	subjectToken string,
+	subjectTokenType string,
+	actorToken string,
+	scope string,
+) (accessToken string, expiresIn time.Duration, err error) {
+	const op = "Auth.TokenExchange"
+
+	log := a.log.With(slog.String("op", op))
+
+	var (
+		appUUID   uuid.UUID
+		actorName string
+		email     string
+	)
+	defer func() {
+		auditCtx := ctx
+		if actorName != "" {
+			auditCtx = requestmeta.WithActor(ctx, actorName)
+		}
+		a.recordAudit(auditCtx, models.AuditEvent{
+			Subject: email,
+			AppUUID: appUUID,
+			Action:  models.AuditTokenExchange,
+			Method:  subjectTokenType,
+		}, false, err)
+	}()
+
+	actorClaims, err := jwtLib.ParseAccessToken(actorToken, a.authApp)
+	if err != nil {
+		log.Info("invalid actor token", sl.Err(err))
+
+		return "", 0, fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+	}
+
+	app, _ := actorClaims["app"].(string)
+	appUUID, err = uuid.Parse(app)
+	if err != nil {
+		return "", 0, fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+	}
+
+	actor, err := a.exchangeActor(ctx, actorClaims, appUUID)
+	if err != nil {
+		return "", 0, fmt.Errorf("%s: %w", op, err)
+	}
+	actorName = exchangeActorName(actor)
+
+	switch subjectTokenType {
+	case TokenTypeAccessToken:
+		subjectClaims, err := jwtLib.ParseAccessToken(subjectToken, a.authApp)
+		if err != nil {
+			log.Info("invalid subject token", sl.Err(err))
+
+			return "", 0, fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+		}
+		if subjectClaims["app"] != app {
+			return "", 0, fmt.Errorf("%s: %w", op, ErrInvalidTarget)
+		}
+
+		email, _ = subjectClaims["email"].(string)
+
+		// subject token scope limits exchanged token
+		subjectScope, _ := subjectClaims["scope"].(string)
+		if subjectScope != "" {
+			if scope == "" {
+				scope = subjectScope
+			}
+			if !scopeAllowed(subjectScope, scope) {
+				return "", 0, fmt.Errorf("%s: %w", op, ErrInsufficientScope)
+			}
+		}
+
+		// subject was already delegated, keep chain of actors
+		if prior, ok := subjectClaims["act"]; ok {
+			actor["act"] = prior
+		}
+	case TokenTypeEmail:
+		email = subjectToken
+	default:
+		return "", 0, fmt.Errorf("%s: %w", op, ErrInvalidOAuthRequest)
+	}
+
+	user, err := a.storage.UserWithPermissions(ctx, email, appUUID)
+	if err != nil {
+		return "", 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if user.Disabled {
+		return "", 0, fmt.Errorf("%s: %w", op, ErrInvalidGrant)
+	}
+
+	expiresIn = min(a.accessTTL, tokenExchangeTTL)
+
+	accessToken, err = jwtLib.CreateDelegatedToken(ctx, user, actor, a.authApp, appUUID, scope, expiresIn)
+	if err != nil {
+		log.Error("failed to generate token", sl.Err(err))
+
+		return "", 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("token exchanged",
+		slog.Any("actor", actor["sub"]),
+		slog.String("subject", user.UUID.String()),
+		slog.String("subject_token_type", subjectTokenType),
+		slog.String("app", appUUID.String()),
+		slog.String("scope", scope),
+	)
+
+	return accessToken, expiresIn, nil
+}
+
+// exchangeActor checks that owner of actor token is enabled, currently holds
+// TokenExchangePermission and is not delegated itself, returns "act" claim
+// describing it.
+func (a *Auth) exchangeActor(ctx context.Context, claims jwt.MapClaims, appUUID uuid.UUID) (map[string]any, error) {
+	// delegated token acts for its subject, it can't delegate further
+	if _, ok := claims["act"]; ok {
+		return nil, ErrInvalidGrant
+	}
+
+	if clientID, ok := claims["client_id"].(string); ok {
+		permissions, err := a.storage.ServiceAccountPermissions(ctx, clientID, appUUID)
+		if err != nil {
+			return nil, err
+		}
+		if !permissions[TokenExchangePermission] {
+			return nil, ErrExchangeNotAllowed
+		}
+
+		return map[string]any{"sub": "service:" + clientID, "client_id": clientID}, nil
+	}
+
+	email, _ := claims["email"].(string)
+
+	user, err := a.storage.UserWithPermissions(ctx, email, appUUID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, ErrInvalidGrant
+	}
+	if !user.Permissions[TokenExchangePermission] {
+		return nil, ErrExchangeNotAllowed
+	}
+
+	return map[string]any{"sub": user.UUID.String(), "email": user.Email}, nil
+}
+
+// exchangeActorName is actor of exchange in audit log: email of user or
+// "service:<client_id>" of service account.
+func exchangeActorName(actor map[string]any) string {
+	if email, ok := actor["email"].(string); ok {
+		return email
+	}
+	sub, _ := actor["sub"].(string)
+	return sub
+}
+
+// scopeAllowed reports whether every requested scope is in granted.
+func scopeAllowed(granted string, requested string) bool {
+	for _, s := range strings.Fields(requested) {
+		if !hasScope(granted, s) {
+			return false
+		}
+	}
+	return true
+}
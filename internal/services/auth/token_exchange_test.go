@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/jwtLib"
+
+	"github.com/google/uuid"
+)
+
+func TestTokenExchange(t *testing.T) {
+	ctx := context.Background()
+	appUUID := uuid.New()
+	otherAppUUID := uuid.New()
+
+	fake := newFakeStorage()
+	support := fake.addUser("support@example.com")
+	intern := fake.addUser("intern@example.com")
+	retired := fake.addUser("retired@example.com")
+	subject := fake.addUser("user@example.com")
+	blocked := fake.addUser("blocked@example.com")
+	fake.addPermission(appUUID, TokenExchangePermission, support, retired)
+	retired.Disabled = true
+	fake.updateUser(retired)
+	blocked.Disabled = true
+	fake.updateUser(blocked)
+	a := newTestAuth(fake)
+
+	accessToken := func(user models.User, appUUID uuid.UUID) string {
+		t.Helper()
+
+		pair, err := jwtLib.CreateTokenPair(ctx, user, a.authApp, appUUID, time.Minute, time.Hour)
+		if err != nil {
+			t.Fatalf("CreateTokenPair() error = %v", err)
+		}
+		return pair.AccessToken
+	}
+
+	pair, err := jwtLib.CreateTokenPair(ctx, support, a.authApp, appUUID, time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("CreateTokenPair() error = %v", err)
+	}
+	refreshToken := pair.RefreshToken
+
+	// token of support acting for subject, it must not act for anyone else
+	delegated, _, err := a.TokenExchange(ctx, accessToken(subject, appUUID), TokenTypeAccessToken, accessToken(support, appUUID), "")
+	if err != nil {
+		t.Fatalf("TokenExchange() error = %v", err)
+	}
+
+	tests := []struct {
+		name             string
+		subjectToken     string
+		subjectTokenType string
+		actorToken       string
+		wantErr          error
+	}{
+		{
+			name:             "subject token",
+			subjectToken:     accessToken(subject, appUUID),
+			subjectTokenType: TokenTypeAccessToken,
+			actorToken:       accessToken(support, appUUID),
+		},
+		{
+			name:             "subject email",
+			subjectToken:     subject.Email,
+			subjectTokenType: TokenTypeEmail,
+			actorToken:       accessToken(support, appUUID),
+		},
+		{
+			name:             "actor without permission",
+			subjectToken:     subject.Email,
+			subjectTokenType: TokenTypeEmail,
+			actorToken:       accessToken(intern, appUUID),
+			wantErr:          ErrExchangeNotAllowed,
+		},
+		{
+			name:             "disabled actor",
+			subjectToken:     subject.Email,
+			subjectTokenType: TokenTypeEmail,
+			actorToken:       accessToken(retired, appUUID),
+			wantErr:          ErrInvalidGrant,
+		},
+		{
+			name:             "delegated actor",
+			subjectToken:     intern.Email,
+			subjectTokenType: TokenTypeEmail,
+			actorToken:       delegated,
+			wantErr:          ErrInvalidGrant,
+		},
+		{
+			name:             "disabled subject",
+			subjectToken:     blocked.Email,
+			subjectTokenType: TokenTypeEmail,
+			actorToken:       accessToken(support, appUUID),
+			wantErr:          ErrInvalidGrant,
+		},
+		{
+			name:             "subject of other app",
+			subjectToken:     accessToken(subject, otherAppUUID),
+			subjectTokenType: TokenTypeAccessToken,
+			actorToken:       accessToken(support, appUUID),
+			wantErr:          ErrInvalidTarget,
+		},
+		{
+			name:             "refresh token as actor",
+			subjectToken:     subject.Email,
+			subjectTokenType: TokenTypeEmail,
+			actorToken:       refreshToken,
+			wantErr:          ErrInvalidGrant,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, _, err := a.TokenExchange(ctx, tt.subjectToken, tt.subjectTokenType, tt.actorToken, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TokenExchange() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			claims, err := jwtLib.ParseAccessToken(token, a.authApp)
+			if err != nil {
+				t.Fatalf("ParseAccessToken() error = %v", err)
+			}
+			act, _ := claims["act"].(map[string]any)
+			if claims["email"] != subject.Email || act["email"] != support.Email {
+				t.Fatalf("exchanged token email = %v, act = %v, want %s acted by %s", claims["email"], act, subject.Email, support.Email)
+			}
+		})
+	}
+}
@@ -0,0 +1,362 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/logger/sl"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	redisGo "github.com/redis/go-redis/v9"
+)
+
+const (
+	webAuthnSessionTTL = 5 * time.Minute
+
+	webAuthnRegistration = "registration"
+	webAuthnLogin        = "login"
+)
+
+// webAuthnSession is ceremony state kept in redis between begin and finish.
+type webAuthnSession struct {
+	Kind    string               `json:"kind"`
+	Email   string               `json:"email"`
+	AppUUID uuid.UUID            `json:"app_uuid"`
+	Data    webauthn.SessionData `json:"data"`
+}
+
+// webAuthnUser adapts models.User to webauthn.User.
+type webAuthnUser struct {
+	user        models.User
+	credentials []webauthn.Credential
+}
+
+func (u webAuthnUser) WebAuthnID() []byte {
+	return u.user.UUID[:]
+}
+
+func (u webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Email
+}
+
+func (u webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// BeginWebAuthnRegistration starts adding new passkey to account of access
+// token owner and returns PublicKeyCredentialCreationOptions as JSON for
+// navigator.credentials.create.
+func (a *Auth) BeginWebAuthnRegistration(ctx context.Context, accessToken string) (options []byte, sessionID string, err error) {
+	const op = "Auth.BeginWebAuthnRegistration"
+
+	if a.webAuthn == nil {
+		return nil, "", fmt.Errorf("%s: %w", op, ErrWebAuthnDisabled)
+	}
+
+	email, err := a.tokenOwner(accessToken)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log := a.log.With(slog.String("op", op), slog.String("email", email))
+
+	user, err := a.storage.User(ctx, email)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	waUser, err := a.webAuthnUser(ctx, user)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(waUser.credentials))
+	for _, cred := range waUser.credentials {
+		exclusions = append(exclusions, cred.Descriptor())
+	}
+
+	creation, session, err := a.webAuthn.BeginRegistration(waUser, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		log.Error("failed to begin registration", sl.Err(err))
+
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	sessionID, err = a.saveWebAuthnSession(ctx, webAuthnSession{Kind: webAuthnRegistration, Email: email, Data: *session})
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	options, err = json.Marshal(creation)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+	return options, sessionID, nil
+}
+
+// FinishWebAuthnRegistration verifies attestation response and stores credential.
+func (a *Auth) FinishWebAuthnRegistration(ctx context.Context, sessionID string, response []byte) error {
+	const op = "Auth.FinishWebAuthnRegistration"
+
+	if a.webAuthn == nil {
+		return fmt.Errorf("%s: %w", op, ErrWebAuthnDisabled)
+	}
+
+	session, err := a.takeWebAuthnSession(ctx, sessionID, webAuthnRegistration)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log := a.log.With(slog.String("op", op), slog.String("email", session.Email))
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(response))
+	if err != nil {
+		log.Info("failed to parse attestation", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, ErrInvalidWebAuthnResponse)
+	}
+
+	user, err := a.storage.User(ctx, session.Email)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	waUser, err := a.webAuthnUser(ctx, user)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	cred, err := a.webAuthn.CreateCredential(waUser, session.Data, parsed)
+	if err != nil {
+		log.Info("attestation rejected", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, ErrInvalidWebAuthnResponse)
+	}
+
+	data, err := json.Marshal(cred)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.storage.SaveWebAuthnCredential(ctx, models.WebAuthnCredential{
+		ID:        cred.ID,
+		UserUUID:  user.UUID,
+		SignCount: cred.Authenticator.SignCount,
+		Data:      data,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		log.Error("failed to save credential", sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("webauthn credential registered")
+
+	return nil
+}
+
+// BeginWebAuthnLogin starts passwordless login with passkey.
+func (a *Auth) BeginWebAuthnLogin(ctx context.Context, email string, appUUID uuid.UUID) (options []byte, sessionID string, err error) {
+	const op = "Auth.BeginWebAuthnLogin"
+
+	options, sessionID, err = a.beginWebAuthnLogin(ctx, email, appUUID)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+	return options, sessionID, nil
+}
+
+// BeginWebAuthnMFA starts WebAuthn as second factor for challenge returned by Login.
+func (a *Auth) BeginWebAuthnMFA(ctx context.Context, challengeToken string) (options []byte, sessionID string, err error) {
+	const op = "Auth.BeginWebAuthnMFA"
+
+	// challenge is single-use, do not spend it on disabled second factor
+	if a.webAuthn == nil {
+		return nil, "", fmt.Errorf("%s: %w", op, ErrWebAuthnDisabled)
+	}
+
+	email, appUUID, err := a.casher.TakeMFAChallenge(ctx, hashToken(challengeToken))
+	if err != nil {
+		if errors.Is(err, redisGo.Nil) {
+			return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidMFAChallenge)
+		}
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	options, sessionID, err = a.beginWebAuthnLogin(ctx, email, appUUID)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+	return options, sessionID, nil
+}
+
+// FinishWebAuthnLogin verifies assertion, tracks sign count and issues token pair.
+func (a *Auth) FinishWebAuthnLogin(ctx context.Context, sessionID string, response []byte) (_ string, _ string, err error) {
+	const op = "Auth.FinishWebAuthnLogin"
+
+	var email string
+	var appUUID uuid.UUID
+	defer func() { a.observeLogin(ctx, loginMethodWebAuthn, email, appUUID, err) }()
+
+	if a.webAuthn == nil {
+		return "", "", fmt.Errorf("%s: %w", op, ErrWebAuthnDisabled)
+	}
+
+	session, err := a.takeWebAuthnSession(ctx, sessionID, webAuthnLogin)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+	email, appUUID = session.Email, session.AppUUID
+
+	log := a.log.With(slog.String("op", op), slog.String("email", session.Email))
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(response))
+	if err != nil {
+		log.Info("failed to parse assertion", sl.Err(err))
+
+		return "", "", fmt.Errorf("%s: %w", op, ErrInvalidWebAuthnResponse)
+	}
+
+	user, err := a.storage.UserWithPermissions(ctx, session.Email, session.AppUUID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	waUser, err := a.webAuthnUser(ctx, user)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	cred, err := a.webAuthn.ValidateLogin(waUser, session.Data, parsed)
+	if err != nil {
+		log.Info("assertion rejected", sl.Err(err))
+
+		return "", "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+
+	if cred.Authenticator.CloneWarning {
+		log.Warn("sign count did not increase, authenticator may be cloned")
+
+		return "", "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+
+	data, err := json.Marshal(cred)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.storage.UpdateWebAuthnCredential(ctx, cred.ID, cred.Authenticator.SignCount, data); err != nil {
+		log.Error("failed to update sign count", sl.Err(err))
+
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	tokenPair, err := a.createTokenPair(ctx, user, session.AppUUID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+	return tokenPair.AccessToken, tokenPair.RefreshToken, nil
+}
+
+func (a *Auth) beginWebAuthnLogin(ctx context.Context, email string, appUUID uuid.UUID) ([]byte, string, error) {
+	if a.webAuthn == nil {
+		return nil, "", ErrWebAuthnDisabled
+	}
+
+	user, err := a.storage.User(ctx, email)
+	if err != nil {
+		return nil, "", err
+	}
+
+	waUser, err := a.webAuthnUser(ctx, user)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(waUser.credentials) == 0 {
+		return nil, "", ErrNoWebAuthnCredentials
+	}
+
+	assertion, session, err := a.webAuthn.BeginLogin(waUser)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sessionID, err := a.saveWebAuthnSession(ctx, webAuthnSession{Kind: webAuthnLogin, Email: email, AppUUID: appUUID, Data: *session})
+	if err != nil {
+		return nil, "", err
+	}
+
+	options, err := json.Marshal(assertion)
+	if err != nil {
+		return nil, "", err
+	}
+	return options, sessionID, nil
+}
+
+func (a *Auth) webAuthnUser(ctx context.Context, user models.User) (webAuthnUser, error) {
+	stored, err := a.storage.WebAuthnCredentials(ctx, user.UUID)
+	if err != nil {
+		return webAuthnUser{}, err
+	}
+
+	credentials := make([]webauthn.Credential, 0, len(stored))
+	for _, s := range stored {
+		var cred webauthn.Credential
+		if err := json.Unmarshal(s.Data, &cred); err != nil {
+			return webAuthnUser{}, err
+		}
+		cred.Authenticator.SignCount = s.SignCount
+		credentials = append(credentials, cred)
+	}
+
+	return webAuthnUser{user: user, credentials: credentials}, nil
+}
+
+func (a *Auth) saveWebAuthnSession(ctx context.Context, session webAuthnSession) (string, error) {
+	sessionID, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+
+	if err := a.casher.SetWebAuthnSession(ctx, hashToken(sessionID), data, webAuthnSessionTTL); err != nil {
+		return "", err
+	}
+	return sessionID, nil
+}
+
+func (a *Auth) takeWebAuthnSession(ctx context.Context, sessionID string, kind string) (webAuthnSession, error) {
+	data, err := a.casher.TakeWebAuthnSession(ctx, hashToken(sessionID))
+	if err != nil {
+		if errors.Is(err, redisGo.Nil) {
+			return webAuthnSession{}, ErrInvalidWebAuthnSession
+		}
+		return webAuthnSession{}, err
+	}
+
+	var session webAuthnSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return webAuthnSession{}, err
+	}
+	if session.Kind != kind {
+		return webAuthnSession{}, ErrInvalidWebAuthnSession
+	}
+	return session, nil
+}
@@ -0,0 +1,353 @@
+package importer
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/hasher"
+	"SSO/internal/lib/logger/sl"
+	verfic "SSO/internal/lib/verifications"
+
+	"github.com/google/uuid"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+
+	defaultBatchSize = 500
+	MaxBatchSize     = 10000
+)
+
+var (
+	ErrUnknownFormat   = errors.New("unknown import format")
+	ErrInvalidEmail    = errors.New("invalid email")
+	ErrUnsupportedHash = errors.New("unsupported password hash")
+	ErrInvalidAppUUID  = errors.New("invalid app uuid")
+	ErrMalformedRow    = errors.New("malformed row")
+	ErrInvalidPerm     = errors.New("empty permission name")
+	ErrInvalidBatch    = errors.New("invalid batch size")
+)
+
+// Storage saves batch of users with their permissions and outbox events in
+// one transaction.
+// rowErrs has one entry per user, nil for imported rows; rows that failed
+// (storage.ErrUserExists, storage.ErrAppNotFound, storage.ErrPermNotFound, ...)
+// are skipped without rolling back the rest of the batch.
+type Storage interface {
+	ImportUsers(ctx context.Context, users []models.ImportUser) (rowErrs []error, err error)
+}
+
+type Options struct {
+	Format string
+	// BatchSize is number of valid rows saved per transaction.
+	BatchSize int
+	// CheckpointPath stores last committed line, import resumes after it.
+	CheckpointPath string
+}
+
+// Validate checks format and batch size, zero batch size means default.
+func (o Options) Validate() error {
+	switch o.Format {
+	case FormatCSV, FormatJSON:
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownFormat, o.Format)
+	}
+	if o.BatchSize < 0 || o.BatchSize > MaxBatchSize {
+		return fmt.Errorf("%w: must be between 0 and %d", ErrInvalidBatch, MaxBatchSize)
+	}
+	return nil
+}
+
+type Importer struct {
+	storage Storage
+	log     *slog.Logger
+}
+
+func New(storage Storage, log *slog.Logger) *Importer {
+	return &Importer{
+		storage: storage,
+		log:     log,
+	}
+}
+
+// row is one decoded input record before validation.
+type row struct {
+	line        int
+	email       string
+	passHash    string
+	permissions map[string][]string
+	err         error
+}
+
+// jsonRow is the JSON lines record format.
+type jsonRow struct {
+	Email        string              `json:"email"`
+	PasswordHash string              `json:"password_hash"`
+	Permissions  map[string][]string `json:"permissions"`
+}
+
+// Import reads users from r and saves them in batches. Rows up to the
+// checkpoint are skipped, so the same input may be imported again after crash.
+func (i *Importer) Import(ctx context.Context, r io.Reader, opts Options) (models.ImportReport, error) {
+	const op = "Importer.Import"
+
+	log := i.log.With(slog.String("op", op), slog.String("format", opts.Format))
+
+	if err := opts.Validate(); err != nil {
+		return models.ImportReport{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if opts.BatchSize == 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+
+	resumeAfter, err := readCheckpoint(opts.CheckpointPath)
+	if err != nil {
+		return models.ImportReport{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if resumeAfter > 0 {
+		log.Info("resuming import", slog.Int("after_line", resumeAfter))
+	}
+
+	next, err := newReader(r, opts.Format)
+	if err != nil {
+		return models.ImportReport{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	report := models.ImportReport{LastLine: resumeAfter}
+	batch := make([]models.ImportUser, 0, opts.BatchSize)
+	lastLine := resumeAfter
+
+	flush := func() error {
+		if len(batch) > 0 {
+			rowErrs, err := i.storage.ImportUsers(ctx, batch)
+			if err != nil {
+				return err
+			}
+			for n, rowErr := range rowErrs {
+				if rowErr != nil {
+					report.Rejected = append(report.Rejected, rejection(batch[n].Line, batch[n].Email, rowErr))
+					continue
+				}
+				report.Imported++
+			}
+			batch = batch[:0]
+		}
+
+		if err := writeCheckpoint(opts.CheckpointPath, lastLine); err != nil {
+			return err
+		}
+		report.LastLine = lastLine
+
+		return nil
+	}
+
+	for {
+		rw, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if rw.line <= resumeAfter {
+			report.Skipped++
+			continue
+		}
+		lastLine = rw.line
+
+		user, err := validate(rw)
+		if err != nil {
+			report.Rejected = append(report.Rejected, rejection(rw.line, rw.email, err))
+			continue
+		}
+		batch = append(batch, user)
+
+		if len(batch) >= opts.BatchSize {
+			if err := flush(); err != nil {
+				log.Error("failed to import batch", sl.Err(err))
+
+				return report, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		log.Error("failed to import batch", sl.Err(err))
+
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("import finished",
+		slog.Int("imported", report.Imported),
+		slog.Int("rejected", len(report.Rejected)),
+		slog.Int("skipped", report.Skipped),
+	)
+
+	return report, nil
+}
+
+func validate(rw row) (models.ImportUser, error) {
+	if rw.err != nil {
+		return models.ImportUser{}, rw.err
+	}
+
+	if _, err := verfic.VerifyEmail(rw.email); err != nil {
+		return models.ImportUser{}, ErrInvalidEmail
+	}
+
+	if !hasher.Supported([]byte(rw.passHash)) {
+		return models.ImportUser{}, ErrUnsupportedHash
+	}
+
+	userUUID, err := uuid.NewRandom()
+	if err != nil {
+		return models.ImportUser{}, err
+	}
+
+	permissions := make(map[uuid.UUID][]string, len(rw.permissions))
+	for app, names := range rw.permissions {
+		appUUID, err := uuid.Parse(app)
+		if err != nil {
+			return models.ImportUser{}, ErrInvalidAppUUID
+		}
+		for _, name := range names {
+			if strings.TrimSpace(name) == "" {
+				return models.ImportUser{}, ErrInvalidPerm
+			}
+		}
+		permissions[appUUID] = append(permissions[appUUID], names...)
+	}
+
+	return models.ImportUser{
+		Line:        rw.line,
+		UUID:        userUUID,
+		Email:       rw.email,
+		PassHash:    []byte(rw.passHash),
+		Permissions: permissions,
+		Events: []models.IdentityEvent{{
+			UUID:     uuid.New(),
+			Type:     models.EventUserRegistered,
+			Time:     time.Now().UTC(),
+			UserUUID: userUUID,
+			Email:    rw.email,
+		}},
+	}, nil
+}
+
+func rejection(line int, email string, err error) models.ImportRejection {
+	return models.ImportRejection{Line: line, Email: email, Reason: err.Error()}
+}
+
+func newReader(r io.Reader, format string) (func() (row, error), error) {
+	switch format {
+	case FormatCSV:
+		return csvReader(r), nil
+	case FormatJSON:
+		return jsonReader(r), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+// csvReader reads "email,password_hash,app_uuid,permissions" records, where
+// permissions are separated by ";". Header line is skipped.
+func csvReader(r io.Reader) func() (row, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	line := 0
+
+	return func() (row, error) {
+		for {
+			record, err := cr.Read()
+			if err != nil {
+				return row{}, err
+			}
+			line++
+
+			if line == 1 && len(record) > 0 && strings.EqualFold(record[0], "email") {
+				continue
+			}
+
+			rw := row{line: line, permissions: map[string][]string{}}
+			if len(record) > 0 {
+				rw.email = strings.TrimSpace(record[0])
+			}
+			if len(record) > 1 {
+				rw.passHash = strings.TrimSpace(record[1])
+			}
+			if len(record) > 3 && record[2] != "" && record[3] != "" {
+				rw.permissions[strings.TrimSpace(record[2])] = strings.Split(record[3], ";")
+			}
+			return rw, nil
+		}
+	}
+}
+
+func jsonReader(r io.Reader) func() (row, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+
+	return func() (row, error) {
+		for scanner.Scan() {
+			line++
+
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+
+			var jr jsonRow
+			if err := json.Unmarshal([]byte(text), &jr); err != nil {
+				// broken line is reported as rejected row, not as import failure
+				return row{line: line, err: ErrMalformedRow}, nil
+			}
+			return row{line: line, email: jr.Email, passHash: jr.PasswordHash, permissions: jr.Permissions}, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return row{}, err
+		}
+		return row{}, io.EOF
+	}
+}
+
+func readCheckpoint(path string) (int, error) {
+	if path == "" {
+		return 0, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+func writeCheckpoint(path string, line int) error {
+	if path == "" {
+		return nil
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(line)), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,267 @@
+// Package outbox relays identity events from outbox table to sinks.
+// Storage writes events in the same transaction as the change they
+// describe, relay started with Run hands every event to every sink at least
+// once and retries failed sinks with exponential backoff. Sink which
+// accepted event is remembered and not called again for it, but crash
+// between Publish and update repeats it, so consumers deduplicate by event
+// id.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/backoff"
+	"SSO/internal/lib/logger/sl"
+)
+
+// purgeInterval is how often events published longer than Retention ago
+// are deleted.
+const purgeInterval = time.Hour
+
+type Sink interface {
+	Publish(ctx context.Context, event models.IdentityEvent) error
+}
+
+type Storage interface {
+	// ClaimOutboxEvents returns unpublished events due at now and moves
+	// their NextAttemptAt by lease, so other instances skip them meanwhile.
+	ClaimOutboxEvents(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.OutboxEvent, error)
+	UpdateOutboxEvent(ctx context.Context, event models.OutboxEvent) error
+	// DeleteOutboxEvents deletes events published before publishedBefore and
+	// returns their number.
+	DeleteOutboxEvents(ctx context.Context, publishedBefore time.Time) (int, error)
+}
+
+type Config struct {
+	PollInterval time.Duration
+	BatchSize    int
+	// InitialBackoff is delay after the first failed attempt, it doubles
+	// with every next one up to MaxBackoff. Events are never given up.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Lease hides claimed events from other instances, it must be longer
+	// than all sinks of one event may take. Relay claims at most as many
+	// events as it can publish to every sink within lease.
+	Lease time.Duration
+	// SinkTimeout limits single Publish.
+	SinkTimeout time.Duration
+	// Retention is how long published events are kept.
+	Retention time.Duration
+}
+
+// Validate checks config of relay publishing to given number of sinks.
+func (c Config) Validate(sinks int) error {
+	switch {
+	case c.PollInterval <= 0 || c.SinkTimeout <= 0 || c.Retention <= 0:
+		return fmt.Errorf("poll interval, sink timeout and retention must be positive")
+	case c.BatchSize < 1:
+		return fmt.Errorf("batch size must be positive")
+	case c.InitialBackoff <= 0 || c.MaxBackoff < c.InitialBackoff:
+		return fmt.Errorf("initial backoff must be positive and not exceed max backoff")
+	case c.Lease <= time.Duration(max(sinks, 1))*c.SinkTimeout:
+		return fmt.Errorf("lease must be longer than sink timeout times number of sinks")
+	}
+	return nil
+}
+
+// claimLimit is number of events relay publishes to every sink within
+// lease even when each Publish runs until timeout, capped by batch size.
+func (c Config) claimLimit(sinks int) int {
+	perEvent := time.Duration(max(sinks, 1)) * c.SinkTimeout
+	return max(1, min(c.BatchSize, int(c.Lease/perEvent)))
+}
+
+type Relay struct {
+	storage Storage
+	sinks   map[string]Sink
+	names   []string
+	cfg     Config
+	log     *slog.Logger
+
+	lastPurge time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	// cancel aborts in-flight publish when shutdown deadline is reached.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New creates relay to sinks by name. Sinks are called in name order.
+func New(storage Storage, sinks map[string]Sink, cfg Config, log *slog.Logger) *Relay {
+	names := make([]string, 0, len(sinks))
+	for name := range sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Relay{
+		storage: storage,
+		sinks:   sinks,
+		names:   names,
+		cfg:     cfg,
+		log:     log,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Run relays due events every poll interval until Shutdown.
+func (r *Relay) Run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.RelayDue(r.ctx)
+		r.purge(r.ctx)
+
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown stops relay, waits for event in flight and closes sinks. When
+// ctx is done first the publish is aborted, its event is retried after
+// lease.
+func (r *Relay) Shutdown(ctx context.Context) error {
+	const op = "outbox.Shutdown"
+
+	r.stopOnce.Do(func() { close(r.stop) })
+
+	var errs []error
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		r.cancel()
+		<-r.done
+		errs = append(errs, ctx.Err())
+	}
+
+	for _, name := range r.names {
+		if closer, ok := r.sinks[name].(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close %s sink: %w", name, err))
+			}
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// RelayDue publishes due events batch by batch until none is left or relay
+// is stopped.
+func (r *Relay) RelayDue(ctx context.Context) {
+	limit := r.cfg.claimLimit(len(r.names))
+
+	for {
+		events, err := r.storage.ClaimOutboxEvents(ctx, time.Now().UTC(), r.cfg.Lease, limit)
+		if err != nil {
+			r.log.Error("failed to claim outbox events", sl.Err(err))
+			return
+		}
+
+		for _, event := range events {
+			select {
+			case <-r.stop:
+				return
+			default:
+			}
+
+			r.relay(ctx, event)
+		}
+
+		if len(events) < limit {
+			return
+		}
+	}
+}
+
+func (r *Relay) relay(ctx context.Context, event models.OutboxEvent) {
+	log := r.log.With(
+		slog.String("event_uuid", event.Event.UUID.String()),
+		slog.String("event_type", event.Event.Type),
+	)
+
+	var failures []string
+	for _, name := range r.names {
+		if slices.Contains(event.Sinks, name) {
+			continue
+		}
+
+		if err := r.publish(ctx, r.sinks[name], event.Event); err != nil {
+			// aborted by shutdown, lease expiry makes it due again
+			if ctx.Err() != nil {
+				return
+			}
+			failures = append(failures, fmt.Sprintf("%s: %s", name, err))
+			continue
+		}
+		event.Sinks = append(event.Sinks, name)
+	}
+
+	now := time.Now().UTC()
+
+	if len(failures) == 0 {
+		event.PublishedAt = now
+		event.LastError = ""
+	} else {
+		event.Attempts++
+		event.NextAttemptAt = now.Add(backoff.Exponential(r.cfg.InitialBackoff, r.cfg.MaxBackoff, event.Attempts))
+		event.LastError = strings.Join(failures, "; ")
+		log.Warn("outbox event not published, will retry",
+			slog.Int("attempts", event.Attempts),
+			slog.Time("next_attempt_at", event.NextAttemptAt),
+			slog.String("error", event.LastError),
+		)
+	}
+
+	if err := r.storage.UpdateOutboxEvent(ctx, event); err != nil {
+		log.Error("failed to update outbox event", sl.Err(err))
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, sink Sink, event models.IdentityEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.SinkTimeout)
+	defer cancel()
+
+	return sink.Publish(ctx, event)
+}
+
+func (r *Relay) purge(ctx context.Context) {
+	if time.Since(r.lastPurge) < purgeInterval {
+		return
+	}
+	r.lastPurge = time.Now()
+
+	deleted, err := r.storage.DeleteOutboxEvents(ctx, time.Now().UTC().Add(-r.cfg.Retention))
+	if err != nil {
+		r.log.Error("failed to delete published outbox events", sl.Err(err))
+		return
+	}
+	if deleted > 0 {
+		r.log.Info("published outbox events deleted", slog.Int("count", deleted))
+	}
+}
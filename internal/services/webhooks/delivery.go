@@ -0,0 +1,242 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/backoff"
+	"SSO/internal/lib/eventsink"
+	"SSO/internal/lib/logger/sl"
+
+	"github.com/google/uuid"
+)
+
+// maxResponseBody is how much of answer is read, the rest is dropped.
+const maxResponseBody = 64 << 10
+
+// Publish creates delivery of event for every subscription of event app
+// that wants its type. Events without app go to subscriptions of all apps
+// opted in to global events.
+// It is the webhook sink of outbox relay, so event published again after
+// relay failure gets deliveries again; receivers deduplicate by payload id.
+func (w *Webhooks) Publish(ctx context.Context, event models.IdentityEvent) error {
+	const op = "Webhooks.Publish"
+
+	subscriptions, err := w.storage.WebhookSubscriptions(ctx, event.AppUUID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	body, err := eventsink.Encode(event)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now().UTC()
+
+	var deliveries []models.WebhookDelivery
+	for _, subscription := range subscriptions {
+		if !subscription.Subscribed(event) {
+			continue
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			UUID:             uuid.New(),
+			SubscriptionUUID: subscription.UUID,
+			AppUUID:          subscription.AppUUID,
+			EventUUID:        event.UUID,
+			EventType:        event.Type,
+			Payload:          body,
+			Status:           models.WebhookPending,
+			NextAttemptAt:    now,
+			CreatedAt:        now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	if err := w.storage.SaveWebhookDeliveries(ctx, deliveries); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Run sends due deliveries every poll interval until Shutdown.
+func (w *Webhooks) Run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		w.DeliverDue(w.ctx)
+
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown stops worker and waits for attempt in flight. When ctx is done
+// first the attempt is aborted, its delivery is retried after lease.
+func (w *Webhooks) Shutdown(ctx context.Context) error {
+	w.stopOnce.Do(func() { close(w.stop) })
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		w.cancel()
+		<-w.done
+		return fmt.Errorf("webhooks.Shutdown: %w", ctx.Err())
+	}
+}
+
+// DeliverDue sends due deliveries batch by batch until none is left or
+// worker is stopped.
+func (w *Webhooks) DeliverDue(ctx context.Context) {
+	// claimed deliveries are hidden from other instances for a lease longer
+	// than attempt may take
+	lease := 2 * w.cfg.Timeout
+
+	for {
+		deliveries, err := w.storage.ClaimWebhookDeliveries(ctx, time.Now().UTC(), lease, w.cfg.BatchSize)
+		if err != nil {
+			w.log.Error("failed to claim webhook deliveries", sl.Err(err))
+			return
+		}
+
+		subscriptions := make(map[uuid.UUID]*models.WebhookSubscription)
+		for _, delivery := range deliveries {
+			select {
+			case <-w.stop:
+				return
+			default:
+			}
+
+			subscription, ok := subscriptions[delivery.SubscriptionUUID]
+			if !ok {
+				var err error
+				subscription, err = w.lookupSubscription(ctx, delivery)
+				if err != nil {
+					// delivery stays claimed, lease expiry makes it due again
+					w.log.Error("failed to get webhook subscription",
+						slog.String("subscription_uuid", delivery.SubscriptionUUID.String()),
+						sl.Err(err),
+					)
+					continue
+				}
+				subscriptions[delivery.SubscriptionUUID] = subscription
+			}
+
+			w.attempt(ctx, delivery, subscription)
+		}
+
+		if len(deliveries) < w.cfg.BatchSize {
+			return
+		}
+	}
+}
+
+// lookupSubscription returns nil when subscription is gone, other errors
+// are returned so delivery is retried instead of marked dead.
+func (w *Webhooks) lookupSubscription(ctx context.Context, delivery models.WebhookDelivery) (*models.WebhookSubscription, error) {
+	subscription, err := w.subscription(ctx, delivery.AppUUID, delivery.SubscriptionUUID)
+	switch {
+	case errors.Is(err, ErrSubscriptionNotFound):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (w *Webhooks) attempt(ctx context.Context, delivery models.WebhookDelivery, subscription *models.WebhookSubscription) {
+	log := w.log.With(
+		slog.String("delivery_uuid", delivery.UUID.String()),
+		slog.String("subscription_uuid", delivery.SubscriptionUUID.String()),
+		slog.String("event_type", delivery.EventType),
+	)
+
+	var (
+		statusCode int
+		err        error
+	)
+	if subscription == nil {
+		err = ErrSubscriptionNotFound
+	} else {
+		statusCode, err = w.send(ctx, delivery, *subscription)
+	}
+
+	// aborted by shutdown, lease expiry makes it due again
+	if ctx.Err() != nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+
+	switch {
+	case err == nil:
+		delivery.Status = models.WebhookDelivered
+		delivery.DeliveredAt = now
+		delivery.LastError = ""
+	case subscription == nil || delivery.Attempts >= w.cfg.MaxAttempts:
+		delivery.Status = models.WebhookDead
+		delivery.LastError = err.Error()
+		log.Warn("webhook delivery is dead", slog.Int("attempts", delivery.Attempts), sl.Err(err))
+	default:
+		delivery.NextAttemptAt = now.Add(w.backoff(delivery.Attempts))
+		delivery.LastError = err.Error()
+		log.Info("webhook delivery failed, will retry",
+			slog.Int("attempts", delivery.Attempts),
+			slog.Time("next_attempt_at", delivery.NextAttemptAt),
+			sl.Err(err),
+		)
+	}
+
+	if err := w.storage.UpdateWebhookDelivery(ctx, delivery); err != nil {
+		log.Error("failed to update webhook delivery", sl.Err(err))
+	}
+}
+
+// send POSTs payload, only 2xx answer is success.
+func (w *Webhooks) send(ctx context.Context, delivery models.WebhookDelivery, subscription models.WebhookSubscription) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SSO-Webhooks/1")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.UUID.String())
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, time.Now(), delivery.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff is delay after attempts failed ones.
+func (w *Webhooks) backoff(attempts int) time.Duration {
+	return backoff.Exponential(w.cfg.InitialBackoff, w.cfg.MaxBackoff, attempts)
+}
@@ -0,0 +1,58 @@
+package webhooks
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"syscall"
+)
+
+var errInternalEndpoint = errors.New("url must not point to loopback, link-local or private address")
+
+// sharedAddressSpace is carrier-grade NAT range, netip does not count it
+// as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// checkEndpointHost refuses host of url given as internal address or as
+// localhost. Names are resolved only when delivery is sent, dialPublic
+// checks them there.
+func checkEndpointHost(host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errInternalEndpoint
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return nil
+	}
+	if !publicAddr(addr) {
+		return errInternalEndpoint
+	}
+	return nil
+}
+
+// dialPublic is Control of webhook dialer, it runs after name is resolved,
+// so endpoint can't reach internal network through DNS either.
+func dialPublic(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !publicAddr(addr) {
+		return errInternalEndpoint
+	}
+	return nil
+}
+
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() &&
+		!addr.IsPrivate() &&
+		!sharedAddressSpace.Contains(addr)
+}
@@ -0,0 +1,69 @@
+package webhooks
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	const secret = "0123456789abcdef"
+	body := []byte(`{"type":"user.registered"}`)
+	signedAt := time.Unix(1700000000, 0)
+	header := Sign(secret, signedAt, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		header    string
+		body      []byte
+		now       time.Time
+		tolerance time.Duration
+		wantErr   bool
+	}{
+		{name: "valid", header: header, now: signedAt, tolerance: 5 * time.Minute},
+		{name: "within tolerance", header: header, now: signedAt.Add(5 * time.Minute), tolerance: 5 * time.Minute},
+		{name: "clock behind", header: header, now: signedAt.Add(-time.Minute), tolerance: 5 * time.Minute},
+		{name: "tolerance disabled", header: header, now: signedAt.Add(24 * time.Hour)},
+		{name: "fields reordered", header: reorder(header), now: signedAt},
+		{name: "expired", header: header, now: signedAt.Add(5*time.Minute + time.Second), tolerance: 5 * time.Minute, wantErr: true},
+		{name: "other secret", secret: "fedcba9876543210", header: header, now: signedAt, wantErr: true},
+		{name: "body changed", header: header, body: []byte(`{"type":"user.deleted"}`), now: signedAt, wantErr: true},
+		{name: "timestamp changed", header: strings.Replace(header, "t=1700000000", "t=1700000001", 1), now: signedAt, wantErr: true},
+		{name: "signature not hex", header: "t=1700000000,v1=zz", now: signedAt, wantErr: true},
+		{name: "missing signature", header: "t=1700000000", now: signedAt, wantErr: true},
+		{name: "missing timestamp", header: header[strings.Index(header, ",")+1:], now: signedAt, wantErr: true},
+		{name: "empty", header: "", now: signedAt, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secretUsed := secret
+			if tt.secret != "" {
+				secretUsed = tt.secret
+			}
+			bodyUsed := body
+			if tt.body != nil {
+				bodyUsed = tt.body
+			}
+
+			err := VerifySignature(secretUsed, tt.header, bodyUsed, tt.now, tt.tolerance)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSignature) {
+					t.Fatalf("VerifySignature() error = %v, want %v", err, ErrInvalidSignature)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifySignature() error = %v", err)
+			}
+		})
+	}
+}
+
+// reorder swaps fields of signature header.
+func reorder(header string) string {
+	timestamp, signature, _ := strings.Cut(header, ",")
+	return signature + "," + timestamp
+}
@@ -0,0 +1,313 @@
+// Package webhooks delivers identity events to HTTP endpoints apps
+// subscribe. Publish stores delivery per matching subscription, worker
+// started with Run sends them as signed JSON POST and retries failures
+// with exponential backoff until delivery is dead.
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultDeliveriesLimit = 50
+	MaxDeliveriesLimit     = 500
+
+	minSecretLength = 16
+)
+
+var (
+	ErrInvalidSubscription   = errors.New("invalid webhook subscription")
+	ErrSubscriptionNotFound  = errors.New("webhook subscription not found")
+	ErrDeliveryNotFound      = errors.New("webhook delivery not found")
+	ErrDeliveryNotDead       = errors.New("only dead delivery can be retried")
+	ErrInvalidDeliveriesPage = errors.New("invalid deliveries limit")
+)
+
+type Storage interface {
+	SaveWebhookSubscription(ctx context.Context, subscription models.WebhookSubscription) error
+	// DeleteWebhookSubscription returns storage.ErrWebhookNotFound when app
+	// has no such subscription.
+	DeleteWebhookSubscription(ctx context.Context, appUUID uuid.UUID, subscriptionUUID uuid.UUID) error
+	WebhookSubscription(ctx context.Context, subscriptionUUID uuid.UUID) (models.WebhookSubscription, error)
+	// WebhookSubscriptions returns subscriptions of app, of all apps for
+	// uuid.Nil.
+	WebhookSubscriptions(ctx context.Context, appUUID uuid.UUID) ([]models.WebhookSubscription, error)
+	SaveWebhookDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) error
+	// ClaimWebhookDeliveries returns pending deliveries due at now and moves
+	// their NextAttemptAt by lease, so other instances skip them meanwhile.
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error
+	WebhookDelivery(ctx context.Context, deliveryUUID uuid.UUID) (models.WebhookDelivery, error)
+	// WebhookDeliveries returns deliveries of subscription newest first.
+	WebhookDeliveries(ctx context.Context, subscriptionUUID uuid.UUID, limit int) ([]models.WebhookDelivery, error)
+}
+
+type Config struct {
+	// MaxAttempts is number of attempts before delivery is dead.
+	MaxAttempts int
+	// InitialBackoff is delay after the first failed attempt, it doubles
+	// with every next one up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Timeout limits single attempt.
+	Timeout      time.Duration
+	PollInterval time.Duration
+	BatchSize    int
+}
+
+func (c Config) Validate() error {
+	switch {
+	case c.MaxAttempts < 1:
+		return fmt.Errorf("max attempts must be positive")
+	case c.InitialBackoff <= 0 || c.MaxBackoff < c.InitialBackoff:
+		return fmt.Errorf("initial backoff must be positive and not exceed max backoff")
+	case c.Timeout <= 0 || c.PollInterval <= 0:
+		return fmt.Errorf("timeout and poll interval must be positive")
+	case c.BatchSize < 1:
+		return fmt.Errorf("batch size must be positive")
+	}
+	return nil
+}
+
+type Webhooks struct {
+	storage Storage
+	client  *http.Client
+	cfg     Config
+	log     *slog.Logger
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	// cancel aborts in-flight attempts when shutdown deadline is reached.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New creates webhooks service. Redirects are not followed, 3xx answer is
+// failed attempt. Endpoints are dialed directly and only at public
+// addresses, host name resolving to internal one is refused.
+func New(storage Storage, cfg Config, log *slog.Logger) *Webhooks {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout: cfg.Timeout,
+		Control: dialPublic,
+	}).DialContext
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   cfg.Timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Webhooks{
+		storage: storage,
+		client:  client,
+		cfg:     cfg,
+		log:     log,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// CreateSubscription subscribes endpoint of app to eventTypes. Random
+// secret is generated when secret is empty. With globalEvents endpoint also
+// gets events not bound to any app, e.g. registrations of all users.
+func (w *Webhooks) CreateSubscription(
+	ctx context.Context,
+	appUUID uuid.UUID,
+	endpoint string,
+	eventTypes []string,
+	secret string,
+	globalEvents bool,
+) (models.WebhookSubscription, error) {
+	const op = "Webhooks.CreateSubscription"
+
+	if appUUID == uuid.Nil {
+		return models.WebhookSubscription{}, fmt.Errorf("%s: %w", op, ErrInvalidSubscription)
+	}
+	if err := ValidateSubscription(endpoint, eventTypes, secret); err != nil {
+		return models.WebhookSubscription{}, fmt.Errorf("%s: %w: %w", op, ErrInvalidSubscription, err)
+	}
+
+	if secret == "" {
+		var err error
+		if secret, err = generateSecret(); err != nil {
+			return models.WebhookSubscription{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	types := slices.Clone(eventTypes)
+	slices.Sort(types)
+
+	subscription := models.WebhookSubscription{
+		UUID:         uuid.New(),
+		AppUUID:      appUUID,
+		URL:          endpoint,
+		EventTypes:   slices.Compact(types),
+		GlobalEvents: globalEvents,
+		Secret:       secret,
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	if err := w.storage.SaveWebhookSubscription(ctx, subscription); err != nil {
+		return models.WebhookSubscription{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	w.log.Info("webhook subscription created",
+		slog.String("app_uuid", appUUID.String()),
+		slog.String("subscription_uuid", subscription.UUID.String()),
+		slog.Any("event_types", subscription.EventTypes),
+		slog.Bool("global_events", globalEvents),
+	)
+
+	return subscription, nil
+}
+
+func (w *Webhooks) DeleteSubscription(ctx context.Context, appUUID uuid.UUID, subscriptionUUID uuid.UUID) error {
+	const op = "Webhooks.DeleteSubscription"
+
+	if err := w.storage.DeleteWebhookSubscription(ctx, appUUID, subscriptionUUID); err != nil {
+		if errors.Is(err, storage.ErrWebhookNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrSubscriptionNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (w *Webhooks) Subscriptions(ctx context.Context, appUUID uuid.UUID) ([]models.WebhookSubscription, error) {
+	const op = "Webhooks.Subscriptions"
+
+	if appUUID == uuid.Nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidSubscription)
+	}
+
+	subscriptions, err := w.storage.WebhookSubscriptions(ctx, appUUID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return subscriptions, nil
+}
+
+// Deliveries returns delivery history of subscription of app, newest
+// first, limit 0 means DefaultDeliveriesLimit.
+func (w *Webhooks) Deliveries(ctx context.Context, appUUID uuid.UUID, subscriptionUUID uuid.UUID, limit int) ([]models.WebhookDelivery, error) {
+	const op = "Webhooks.Deliveries"
+
+	switch {
+	case limit == 0:
+		limit = DefaultDeliveriesLimit
+	case limit < 0 || limit > MaxDeliveriesLimit:
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidDeliveriesPage)
+	}
+
+	if _, err := w.subscription(ctx, appUUID, subscriptionUUID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deliveries, err := w.storage.WebhookDeliveries(ctx, subscriptionUUID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return deliveries, nil
+}
+
+// RetryDelivery gives dead delivery of app new round of attempts.
+func (w *Webhooks) RetryDelivery(ctx context.Context, appUUID uuid.UUID, deliveryUUID uuid.UUID) error {
+	const op = "Webhooks.RetryDelivery"
+
+	delivery, err := w.storage.WebhookDelivery(ctx, deliveryUUID)
+	if err != nil {
+		if errors.Is(err, storage.ErrWebhookDeliveryNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrDeliveryNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if delivery.AppUUID != appUUID {
+		return fmt.Errorf("%s: %w", op, ErrDeliveryNotFound)
+	}
+	if delivery.Status != models.WebhookDead {
+		return fmt.Errorf("%s: %w", op, ErrDeliveryNotDead)
+	}
+
+	delivery.Status = models.WebhookPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now().UTC()
+
+	if err := w.storage.UpdateWebhookDelivery(ctx, delivery); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// subscription returns subscription only when it belongs to app.
+func (w *Webhooks) subscription(ctx context.Context, appUUID uuid.UUID, subscriptionUUID uuid.UUID) (models.WebhookSubscription, error) {
+	subscription, err := w.storage.WebhookSubscription(ctx, subscriptionUUID)
+	if err != nil {
+		if errors.Is(err, storage.ErrWebhookNotFound) {
+			return models.WebhookSubscription{}, ErrSubscriptionNotFound
+		}
+		return models.WebhookSubscription{}, err
+	}
+	if subscription.AppUUID != appUUID {
+		return models.WebhookSubscription{}, ErrSubscriptionNotFound
+	}
+	return subscription, nil
+}
+
+// ValidateSubscription checks subscription settings, error message is
+// meant for caller.
+func ValidateSubscription(endpoint string, eventTypes []string, secret string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.New("url must be absolute http or https url")
+	}
+	if err := checkEndpointHost(u.Hostname()); err != nil {
+		return err
+	}
+
+	if len(eventTypes) == 0 {
+		return errors.New("at least one event type is required")
+	}
+	for _, eventType := range eventTypes {
+		if !slices.Contains(models.IdentityEvents, eventType) {
+			return fmt.Errorf("unknown event type %q", eventType)
+		}
+	}
+
+	if secret != "" && len(secret) < minSecretLength {
+		return fmt.Errorf("secret must be at least %d characters", minSecretLength)
+	}
+	return nil
+}
+
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,48 @@
+package webhooks
+
+import "testing"
+
+func TestValidateSubscription(t *testing.T) {
+	events := []string{"user.registered"}
+
+	tests := []struct {
+		name       string
+		endpoint   string
+		eventTypes []string
+		secret     string
+		wantErr    bool
+	}{
+		{name: "https", endpoint: "https://hooks.example.com/sso"},
+		{name: "public ip", endpoint: "http://203.0.113.10:8080/hook"},
+		{name: "generated secret", endpoint: "https://hooks.example.com", secret: ""},
+		{name: "not absolute", endpoint: "/hook", wantErr: true},
+		{name: "other scheme", endpoint: "ftp://hooks.example.com", wantErr: true},
+		{name: "localhost", endpoint: "http://localhost:8080/hook", wantErr: true},
+		{name: "localhost subdomain", endpoint: "http://api.localhost/hook", wantErr: true},
+		{name: "loopback", endpoint: "http://127.0.0.1/hook", wantErr: true},
+		{name: "loopback v6", endpoint: "http://[::1]/hook", wantErr: true},
+		{name: "mapped loopback", endpoint: "http://[::ffff:127.0.0.1]/hook", wantErr: true},
+		{name: "private", endpoint: "http://10.0.0.5/hook", wantErr: true},
+		{name: "private v6", endpoint: "http://[fd00::1]/hook", wantErr: true},
+		{name: "link-local metadata", endpoint: "http://169.254.169.254/latest", wantErr: true},
+		{name: "shared address space", endpoint: "http://100.64.0.1/hook", wantErr: true},
+		{name: "unspecified", endpoint: "http://0.0.0.0/hook", wantErr: true},
+		{name: "no event types", endpoint: "https://hooks.example.com", eventTypes: []string{}, wantErr: true},
+		{name: "unknown event type", endpoint: "https://hooks.example.com", eventTypes: []string{"user.renamed"}, wantErr: true},
+		{name: "short secret", endpoint: "https://hooks.example.com", secret: "short", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eventTypes := tt.eventTypes
+			if eventTypes == nil {
+				eventTypes = events
+			}
+
+			err := ValidateSubscription(tt.endpoint, eventTypes, tt.secret)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateSubscription() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+// Package metered wraps auth storage to observe latency and errors of every
+// call.
+package metered
+
+import (
+	"context"
+	"time"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/services/auth"
+
+	"github.com/google/uuid"
+)
+
+// Observer receives operation name, its error and duration.
+type Observer func(operation string, err error, took time.Duration)
+
+type Storage struct {
+	storage  auth.Storage
+	observer Observer
+}
+
+var _ auth.Storage = (*Storage)(nil)
+
+func New(storage auth.Storage, observer Observer) *Storage {
+	return &Storage{storage: storage, observer: observer}
+}
+
+func (s *Storage) observe(operation string, start time.Time, err *error) {
+	s.observer(operation, *err, time.Since(start))
+}
+
+func (s *Storage) User(ctx context.Context, email string) (_ models.User, err error) {
+	defer s.observe("User", time.Now(), &err)
+	return s.storage.User(ctx, email)
+}
+
+func (s *Storage) UserWithPermissions(ctx context.Context, email string, appUUID uuid.UUID) (_ models.User, err error) {
+	defer s.observe("UserWithPermissions", time.Now(), &err)
+	return s.storage.UserWithPermissions(ctx, email, appUUID)
+}
+
+func (s *Storage) SaveUser(ctx context.Context, uuid uuid.UUID, email string, passHash []byte, events []models.IdentityEvent) (err error) {
+	defer s.observe("SaveUser", time.Now(), &err)
+	return s.storage.SaveUser(ctx, uuid, email, passHash, events)
+}
+
+func (s *Storage) UpdatePassHash(ctx context.Context, userUUID uuid.UUID, passHash []byte) (err error) {
+	defer s.observe("UpdatePassHash", time.Now(), &err)
+	return s.storage.UpdatePassHash(ctx, userUUID, passHash)
+}
+
+func (s *Storage) SaveApp(ctx context.Context, appUUID uuid.UUID, name string) (_ uuid.UUID, err error) {
+	defer s.observe("SaveApp", time.Now(), &err)
+	return s.storage.SaveApp(ctx, appUUID, name)
+}
+
+func (s *Storage) DeletePermission(ctx context.Context, permUUID uuid.UUID, appUUID uuid.UUID, events []models.IdentityEvent) (err error) {
+	defer s.observe("DeletePermission", time.Now(), &err)
+	return s.storage.DeletePermission(ctx, permUUID, appUUID, events)
+}
+
+func (s *Storage) SavePermission(ctx context.Context, permUUID uuid.UUID, appUUID uuid.UUID, permission string) (_ models.Permission, err error) {
+	defer s.observe("SavePermission", time.Now(), &err)
+	return s.storage.SavePermission(ctx, permUUID, appUUID, permission)
+}
+
+func (s *Storage) AddUserPermissions(ctx context.Context, email string, appUUID uuid.UUID, permUUID uuid.UUID, events []models.IdentityEvent) (err error) {
+	defer s.observe("AddUserPermissions", time.Now(), &err)
+	return s.storage.AddUserPermissions(ctx, email, appUUID, permUUID, events)
+}
+
+func (s *Storage) RevokeUserPermissions(ctx context.Context, email string, appUUID uuid.UUID, permUUID uuid.UUID, events []models.IdentityEvent) (err error) {
+	defer s.observe("RevokeUserPermissions", time.Now(), &err)
+	return s.storage.RevokeUserPermissions(ctx, email, appUUID, permUUID, events)
+}
+
+func (s *Storage) GetAppPermissions(ctx context.Context, appUUID uuid.UUID) (_ []models.Permission, err error) {
+	defer s.observe("GetAppPermissions", time.Now(), &err)
+	return s.storage.GetAppPermissions(ctx, appUUID)
+}
+
+func (s *Storage) SaveMFASecret(ctx context.Context, userUUID uuid.UUID, secret string) (err error) {
+	defer s.observe("SaveMFASecret", time.Now(), &err)
+	return s.storage.SaveMFASecret(ctx, userUUID, secret)
+}
+
+func (s *Storage) MFASecret(ctx context.Context, userUUID uuid.UUID) (secret string, enabled bool, err error) {
+	defer s.observe("MFASecret", time.Now(), &err)
+	return s.storage.MFASecret(ctx, userUUID)
+}
+
+func (s *Storage) EnableMFA(ctx context.Context, userUUID uuid.UUID, recoveryCodeHashes [][]byte) (err error) {
+	defer s.observe("EnableMFA", time.Now(), &err)
+	return s.storage.EnableMFA(ctx, userUUID, recoveryCodeHashes)
+}
+
+func (s *Storage) UseRecoveryCode(ctx context.Context, userUUID uuid.UUID, codeHash []byte) (err error) {
+	defer s.observe("UseRecoveryCode", time.Now(), &err)
+	return s.storage.UseRecoveryCode(ctx, userUUID, codeHash)
+}
+
+func (s *Storage) SaveWebAuthnCredential(ctx context.Context, cred models.WebAuthnCredential) (err error) {
+	defer s.observe("SaveWebAuthnCredential", time.Now(), &err)
+	return s.storage.SaveWebAuthnCredential(ctx, cred)
+}
+
+func (s *Storage) WebAuthnCredentials(ctx context.Context, userUUID uuid.UUID) (_ []models.WebAuthnCredential, err error) {
+	defer s.observe("WebAuthnCredentials", time.Now(), &err)
+	return s.storage.WebAuthnCredentials(ctx, userUUID)
+}
+
+func (s *Storage) UpdateWebAuthnCredential(ctx context.Context, credID []byte, signCount uint32, data []byte) (err error) {
+	defer s.observe("UpdateWebAuthnCredential", time.Now(), &err)
+	return s.storage.UpdateWebAuthnCredential(ctx, credID, signCount, data)
+}
+
+func (s *Storage) SaveOAuthClient(ctx context.Context, client models.OAuthClient) (err error) {
+	defer s.observe("SaveOAuthClient", time.Now(), &err)
+	return s.storage.SaveOAuthClient(ctx, client)
+}
+
+func (s *Storage) OAuthClient(ctx context.Context, clientID string) (_ models.OAuthClient, err error) {
+	defer s.observe("OAuthClient", time.Now(), &err)
+	return s.storage.OAuthClient(ctx, clientID)
+}
+
+func (s *Storage) SaveServiceAccount(ctx context.Context, account models.ServiceAccount) (err error) {
+	defer s.observe("SaveServiceAccount", time.Now(), &err)
+	return s.storage.SaveServiceAccount(ctx, account)
+}
+
+func (s *Storage) ServiceAccount(ctx context.Context, clientID string) (_ models.ServiceAccount, err error) {
+	defer s.observe("ServiceAccount", time.Now(), &err)
+	return s.storage.ServiceAccount(ctx, clientID)
+}
+
+func (s *Storage) AddServiceAccountPermission(ctx context.Context, clientID string, appUUID uuid.UUID, permUUID uuid.UUID) (err error) {
+	defer s.observe("AddServiceAccountPermission", time.Now(), &err)
+	return s.storage.AddServiceAccountPermission(ctx, clientID, appUUID, permUUID)
+}
+
+func (s *Storage) ServiceAccountPermissions(ctx context.Context, clientID string, appUUID uuid.UUID) (_ map[string]bool, err error) {
+	defer s.observe("ServiceAccountPermissions", time.Now(), &err)
+	return s.storage.ServiceAccountPermissions(ctx, clientID, appUUID)
+}
+
+func (s *Storage) SaveExternalIdentity(ctx context.Context, identity models.ExternalIdentity) (err error) {
+	defer s.observe("SaveExternalIdentity", time.Now(), &err)
+	return s.storage.SaveExternalIdentity(ctx, identity)
+}
+
+func (s *Storage) ExternalIdentity(ctx context.Context, provider string, subject string) (_ models.ExternalIdentity, err error) {
+	defer s.observe("ExternalIdentity", time.Now(), &err)
+	return s.storage.ExternalIdentity(ctx, provider, subject)
+}
+
+func (s *Storage) SaveSAMLServiceProvider(ctx context.Context, sp models.SAMLServiceProvider) (err error) {
+	defer s.observe("SaveSAMLServiceProvider", time.Now(), &err)
+	return s.storage.SaveSAMLServiceProvider(ctx, sp)
+}
+
+func (s *Storage) SAMLServiceProvider(ctx context.Context, entityID string) (_ models.SAMLServiceProvider, err error) {
+	defer s.observe("SAMLServiceProvider", time.Now(), &err)
+	return s.storage.SAMLServiceProvider(ctx, entityID)
+}
+
+func (s *Storage) UserByUUID(ctx context.Context, userUUID uuid.UUID) (_ models.User, err error) {
+	defer s.observe("UserByUUID", time.Now(), &err)
+	return s.storage.UserByUUID(ctx, userUUID)
+}
+
+func (s *Storage) Users(ctx context.Context, offset int, limit int) (users []models.User, total int, err error) {
+	defer s.observe("Users", time.Now(), &err)
+	return s.storage.Users(ctx, offset, limit)
+}
+
+func (s *Storage) AppUsers(ctx context.Context, appUUID uuid.UUID, offset int, limit int) (users []models.User, total int, err error) {
+	defer s.observe("AppUsers", time.Now(), &err)
+	return s.storage.AppUsers(ctx, appUUID, offset, limit)
+}
+
+func (s *Storage) UpdateUser(ctx context.Context, user models.User, events []models.IdentityEvent) (err error) {
+	defer s.observe("UpdateUser", time.Now(), &err)
+	return s.storage.UpdateUser(ctx, user, events)
+}
+
+func (s *Storage) DeleteUser(ctx context.Context, userUUID uuid.UUID, events []models.IdentityEvent) (err error) {
+	defer s.observe("DeleteUser", time.Now(), &err)
+	return s.storage.DeleteUser(ctx, userUUID, events)
+}
+
+func (s *Storage) PermissionUsers(ctx context.Context, permUUID uuid.UUID) (_ []models.User, err error) {
+	defer s.observe("PermissionUsers", time.Now(), &err)
+	return s.storage.PermissionUsers(ctx, permUUID)
+}
+
+func (s *Storage) SaveOutboxEvents(ctx context.Context, events []models.IdentityEvent) (err error) {
+	defer s.observe("SaveOutboxEvents", time.Now(), &err)
+	return s.storage.SaveOutboxEvents(ctx, events)
+}
+
+func (s *Storage) Ping(ctx context.Context) (err error) {
+	defer s.observe("Ping", time.Now(), &err)
+	return s.storage.Ping(ctx)
+}
@@ -3,15 +3,32 @@ package storage
 import "errors"
 
 var (
-	ErrUserExists            = errors.New("user already exists")
-	ErrUserNotFound          = errors.New("user not found")
-	ErrPermExists            = errors.New("permission alredy exists")
-	ErrPermNotFound          = errors.New("permission not found")
-	ErrAppExists             = errors.New("app alredy exists")
-	ErrAppNotFound           = errors.New("app not found")
-	ErrUserPermissionsExists = errors.New("user permissions alredy exists")
-	ErrCantGrantPermission   = errors.New("app cant grant this permission")
-	ErrNoSuchRefreshToken    = errors.New("no such refresh token")
-	ErrNoSuchUserPermission  = errors.New("no such user-permission")
-	ErrNoPermissionsAtApp    = errors.New("no permissions at app")
+	ErrUserExists              = errors.New("user already exists")
+	ErrUserNotFound            = errors.New("user not found")
+	ErrPermExists              = errors.New("permission alredy exists")
+	ErrPermNotFound            = errors.New("permission not found")
+	ErrAppExists               = errors.New("app alredy exists")
+	ErrAppNotFound             = errors.New("app not found")
+	ErrUserPermissionsExists   = errors.New("user permissions alredy exists")
+	ErrCantGrantPermission     = errors.New("app cant grant this permission")
+	ErrNoSuchRefreshToken      = errors.New("no such refresh token")
+	ErrNoSuchUserPermission    = errors.New("no such user-permission")
+	ErrNoPermissionsAtApp      = errors.New("no permissions at app")
+	ErrMFANotFound             = errors.New("mfa not found")
+	ErrRecoveryCodeNotFound    = errors.New("recovery code not found")
+	ErrCredentialExists        = errors.New("credential already exists")
+	ErrCredentialNotFound      = errors.New("credential not found")
+	ErrClientExists            = errors.New("client already exists")
+	ErrClientNotFound          = errors.New("client not found")
+	ErrServiceAccountExists    = errors.New("service account already exists")
+	ErrServiceAccountNotFound  = errors.New("service account not found")
+	ErrIdentityExists          = errors.New("external identity already exists")
+	ErrIdentityNotFound        = errors.New("external identity not found")
+	ErrServiceProviderExists   = errors.New("service provider already exists")
+	ErrServiceProviderNotFound = errors.New("service provider not found")
+	ErrEmailTaken              = errors.New("email is taken by other user")
+	ErrAuditSeqTaken           = errors.New("audit event with this seq already exists")
+	ErrAuditEventNotFound      = errors.New("audit event not found")
+	ErrWebhookNotFound         = errors.New("webhook subscription not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
 )
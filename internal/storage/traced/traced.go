@@ -0,0 +1,247 @@
+// Package traced wraps auth storage to create span around every call.
+package traced
+
+import (
+	"context"
+
+	"SSO/internal/domain/models"
+	"SSO/internal/lib/tracing"
+	"SSO/internal/services/auth"
+
+	"github.com/google/uuid"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Storage struct {
+	storage auth.Storage
+	system  string
+}
+
+var _ auth.Storage = (*Storage)(nil)
+
+// New wraps storage, system is database name as in db.system attribute,
+// e.g. postgresql.
+func New(storage auth.Storage, system string) *Storage {
+	return &Storage{storage: storage, system: system}
+}
+
+func (s *Storage) start(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "storage."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemKey.String(s.system),
+			semconv.DBOperationName(operation),
+		),
+	)
+}
+
+func (s *Storage) User(ctx context.Context, email string) (_ models.User, err error) {
+	ctx, span := s.start(ctx, "User")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.User(ctx, email)
+}
+
+func (s *Storage) UserWithPermissions(ctx context.Context, email string, appUUID uuid.UUID) (_ models.User, err error) {
+	ctx, span := s.start(ctx, "UserWithPermissions")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.UserWithPermissions(ctx, email, appUUID)
+}
+
+func (s *Storage) SaveUser(ctx context.Context, uuid uuid.UUID, email string, passHash []byte, events []models.IdentityEvent) (err error) {
+	ctx, span := s.start(ctx, "SaveUser")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.SaveUser(ctx, uuid, email, passHash, events)
+}
+
+func (s *Storage) UpdatePassHash(ctx context.Context, userUUID uuid.UUID, passHash []byte) (err error) {
+	ctx, span := s.start(ctx, "UpdatePassHash")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.UpdatePassHash(ctx, userUUID, passHash)
+}
+
+func (s *Storage) SaveApp(ctx context.Context, appUUID uuid.UUID, name string) (_ uuid.UUID, err error) {
+	ctx, span := s.start(ctx, "SaveApp")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.SaveApp(ctx, appUUID, name)
+}
+
+func (s *Storage) DeletePermission(ctx context.Context, permUUID uuid.UUID, appUUID uuid.UUID, events []models.IdentityEvent) (err error) {
+	ctx, span := s.start(ctx, "DeletePermission")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.DeletePermission(ctx, permUUID, appUUID, events)
+}
+
+func (s *Storage) SavePermission(ctx context.Context, permUUID uuid.UUID, appUUID uuid.UUID, permission string) (_ models.Permission, err error) {
+	ctx, span := s.start(ctx, "SavePermission")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.SavePermission(ctx, permUUID, appUUID, permission)
+}
+
+func (s *Storage) AddUserPermissions(ctx context.Context, email string, appUUID uuid.UUID, permUUID uuid.UUID, events []models.IdentityEvent) (err error) {
+	ctx, span := s.start(ctx, "AddUserPermissions")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.AddUserPermissions(ctx, email, appUUID, permUUID, events)
+}
+
+func (s *Storage) RevokeUserPermissions(ctx context.Context, email string, appUUID uuid.UUID, permUUID uuid.UUID, events []models.IdentityEvent) (err error) {
+	ctx, span := s.start(ctx, "RevokeUserPermissions")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.RevokeUserPermissions(ctx, email, appUUID, permUUID, events)
+}
+
+func (s *Storage) GetAppPermissions(ctx context.Context, appUUID uuid.UUID) (_ []models.Permission, err error) {
+	ctx, span := s.start(ctx, "GetAppPermissions")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.GetAppPermissions(ctx, appUUID)
+}
+
+func (s *Storage) SaveMFASecret(ctx context.Context, userUUID uuid.UUID, secret string) (err error) {
+	ctx, span := s.start(ctx, "SaveMFASecret")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.SaveMFASecret(ctx, userUUID, secret)
+}
+
+func (s *Storage) MFASecret(ctx context.Context, userUUID uuid.UUID) (secret string, enabled bool, err error) {
+	ctx, span := s.start(ctx, "MFASecret")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.MFASecret(ctx, userUUID)
+}
+
+func (s *Storage) EnableMFA(ctx context.Context, userUUID uuid.UUID, recoveryCodeHashes [][]byte) (err error) {
+	ctx, span := s.start(ctx, "EnableMFA")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.EnableMFA(ctx, userUUID, recoveryCodeHashes)
+}
+
+func (s *Storage) UseRecoveryCode(ctx context.Context, userUUID uuid.UUID, codeHash []byte) (err error) {
+	ctx, span := s.start(ctx, "UseRecoveryCode")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.UseRecoveryCode(ctx, userUUID, codeHash)
+}
+
+func (s *Storage) SaveWebAuthnCredential(ctx context.Context, cred models.WebAuthnCredential) (err error) {
+	ctx, span := s.start(ctx, "SaveWebAuthnCredential")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.SaveWebAuthnCredential(ctx, cred)
+}
+
+func (s *Storage) WebAuthnCredentials(ctx context.Context, userUUID uuid.UUID) (_ []models.WebAuthnCredential, err error) {
+	ctx, span := s.start(ctx, "WebAuthnCredentials")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.WebAuthnCredentials(ctx, userUUID)
+}
+
+func (s *Storage) UpdateWebAuthnCredential(ctx context.Context, credID []byte, signCount uint32, data []byte) (err error) {
+	ctx, span := s.start(ctx, "UpdateWebAuthnCredential")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.UpdateWebAuthnCredential(ctx, credID, signCount, data)
+}
+
+func (s *Storage) SaveOAuthClient(ctx context.Context, client models.OAuthClient) (err error) {
+	ctx, span := s.start(ctx, "SaveOAuthClient")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.SaveOAuthClient(ctx, client)
+}
+
+func (s *Storage) OAuthClient(ctx context.Context, clientID string) (_ models.OAuthClient, err error) {
+	ctx, span := s.start(ctx, "OAuthClient")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.OAuthClient(ctx, clientID)
+}
+
+func (s *Storage) SaveServiceAccount(ctx context.Context, account models.ServiceAccount) (err error) {
+	ctx, span := s.start(ctx, "SaveServiceAccount")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.SaveServiceAccount(ctx, account)
+}
+
+func (s *Storage) ServiceAccount(ctx context.Context, clientID string) (_ models.ServiceAccount, err error) {
+	ctx, span := s.start(ctx, "ServiceAccount")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.ServiceAccount(ctx, clientID)
+}
+
+func (s *Storage) AddServiceAccountPermission(ctx context.Context, clientID string, appUUID uuid.UUID, permUUID uuid.UUID) (err error) {
+	ctx, span := s.start(ctx, "AddServiceAccountPermission")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.AddServiceAccountPermission(ctx, clientID, appUUID, permUUID)
+}
+
+func (s *Storage) ServiceAccountPermissions(ctx context.Context, clientID string, appUUID uuid.UUID) (_ map[string]bool, err error) {
+	ctx, span := s.start(ctx, "ServiceAccountPermissions")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.ServiceAccountPermissions(ctx, clientID, appUUID)
+}
+
+func (s *Storage) SaveExternalIdentity(ctx context.Context, identity models.ExternalIdentity) (err error) {
+	ctx, span := s.start(ctx, "SaveExternalIdentity")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.SaveExternalIdentity(ctx, identity)
+}
+
+func (s *Storage) ExternalIdentity(ctx context.Context, provider string, subject string) (_ models.ExternalIdentity, err error) {
+	ctx, span := s.start(ctx, "ExternalIdentity")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.ExternalIdentity(ctx, provider, subject)
+}
+
+func (s *Storage) SaveSAMLServiceProvider(ctx context.Context, sp models.SAMLServiceProvider) (err error) {
+	ctx, span := s.start(ctx, "SaveSAMLServiceProvider")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.SaveSAMLServiceProvider(ctx, sp)
+}
+
+func (s *Storage) SAMLServiceProvider(ctx context.Context, entityID string) (_ models.SAMLServiceProvider, err error) {
+	ctx, span := s.start(ctx, "SAMLServiceProvider")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.SAMLServiceProvider(ctx, entityID)
+}
+
+func (s *Storage) UserByUUID(ctx context.Context, userUUID uuid.UUID) (_ models.User, err error) {
+	ctx, span := s.start(ctx, "UserByUUID")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.UserByUUID(ctx, userUUID)
+}
+
+func (s *Storage) Users(ctx context.Context, offset int, limit int) (users []models.User, total int, err error) {
+	ctx, span := s.start(ctx, "Users")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.Users(ctx, offset, limit)
+}
+
+func (s *Storage) AppUsers(ctx context.Context, appUUID uuid.UUID, offset int, limit int) (users []models.User, total int, err error) {
+	ctx, span := s.start(ctx, "AppUsers")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.AppUsers(ctx, appUUID, offset, limit)
+}
+
+func (s *Storage) UpdateUser(ctx context.Context, user models.User, events []models.IdentityEvent) (err error) {
+	ctx, span := s.start(ctx, "UpdateUser")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.UpdateUser(ctx, user, events)
+}
+
+func (s *Storage) DeleteUser(ctx context.Context, userUUID uuid.UUID, events []models.IdentityEvent) (err error) {
+	ctx, span := s.start(ctx, "DeleteUser")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.DeleteUser(ctx, userUUID, events)
+}
+
+func (s *Storage) PermissionUsers(ctx context.Context, permUUID uuid.UUID) (_ []models.User, err error) {
+	ctx, span := s.start(ctx, "PermissionUsers")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.PermissionUsers(ctx, permUUID)
+}
+
+func (s *Storage) SaveOutboxEvents(ctx context.Context, events []models.IdentityEvent) (err error) {
+	ctx, span := s.start(ctx, "SaveOutboxEvents")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.SaveOutboxEvents(ctx, events)
+}
+
+func (s *Storage) Ping(ctx context.Context) (err error) {
+	ctx, span := s.start(ctx, "Ping")
+	defer func() { tracing.End(span, err) }()
+	return s.storage.Ping(ctx)
+}